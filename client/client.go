@@ -0,0 +1,335 @@
+// Package client is a Go client for the chat room WebSocket protocol. It
+// takes care of the JSON framing, answers the server's pings and resumes
+// dropped connections with the room's reconnect token.
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/chat"
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// The message and user types are shared with the server.
+type (
+	IncomingMessage = model.IncomingMessage
+	OutgoingMessage = model.OutgoingMessage
+	MessageType     = model.MessageType
+	User            = model.User
+)
+
+// Built-in message types. Rooms accept custom types as well.
+const (
+	SystemMessage  = model.SystemMessage
+	UserMessage    = model.UserMessage
+	ImageMessage   = model.ImageMessage
+	MessageDeleted = model.MessageDeleted
+	MessageUpdated = model.MessageUpdated
+	ReceiptMessage = model.ReceiptMessage
+	PinsUpdated    = model.PinsUpdated
+	Occupancy      = model.OccupancyMessage
+	Leave          = model.LeaveMessage
+	RoomUpdated    = model.RoomUpdated
+)
+
+const (
+	pongWait         = 70 * time.Second
+	writeWait        = 10 * time.Second
+	maxReconnects    = 5
+	reconnectBackoff = 200 * time.Millisecond
+)
+
+// ErrClosed is returned by Send after Close was called or the connection
+// ended for good.
+var ErrClosed = errors.New("client: connection closed")
+
+// Conn is a connection to a single room. Messages are delivered on the
+// channel returned by Messages; Send may be called from any goroutine.
+type Conn struct {
+	roomURL   *url.URL
+	dialer    *websocket.Dialer
+	authToken string
+	messages  chan OutgoingMessage
+	done      chan struct{}
+
+	mu    sync.Mutex
+	ws    *websocket.Conn
+	user  User
+	token string
+	err   error
+
+	closeOnce sync.Once
+}
+
+// Dial joins the room at roomURL, e.g. "ws://localhost:8080/api/v1/join/1".
+// A user with an ID joins as that registered user, otherwise user.Name is
+// used as an ephemeral display name; an empty name lets the server pick one.
+func Dial(roomURL string, user User) (*Conn, error) {
+	return DialAuth(roomURL, user, "")
+}
+
+// DialAuth is Dial for servers started with WS_AUTH_TOKEN. The token is sent
+// in an auth frame right after connecting, on reconnects as well.
+func DialAuth(roomURL string, user User, token string) (*Conn, error) {
+	u, err := url.Parse(roomURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	if user.ID != uuid.Nil {
+		q.Set("userId", user.ID.String())
+	} else if user.Name != "" {
+		q.Set("userName", user.Name)
+	}
+	q.Set("userInfo", "true")
+	u.RawQuery = q.Encode()
+
+	c := &Conn{
+		roomURL:   u,
+		dialer:    websocket.DefaultDialer,
+		authToken: token,
+		messages:  make(chan OutgoingMessage, 64),
+		done:      make(chan struct{}),
+	}
+	ws, selfJoin, err := c.connect("")
+	if err != nil {
+		return nil, err
+	}
+	c.ws = ws
+	c.messages <- selfJoin
+
+	go c.readLoop(ws)
+	return c, nil
+}
+
+// Messages returns the channel of messages received from the room, starting
+// with the self-join message. It is closed once the connection ends for
+// good; Err then reports why.
+func (c *Conn) Messages() <-chan OutgoingMessage {
+	return c.messages
+}
+
+// User returns the user the server joined the room as.
+func (c *Conn) User() User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user
+}
+
+// Send writes a message to the room.
+func (c *Conn) Send(msg IncomingMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	if c.err != nil {
+		return ErrClosed
+	}
+	_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.ws.WriteMessage(websocket.TextMessage, b)
+}
+
+// Err returns why the connection ended, or nil while it is open or after
+// Close.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close leaves the room.
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		close(c.done)
+		_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		err = c.ws.Close()
+	})
+	return err
+}
+
+// connect dials the room, resuming with token if it is set, and reads the
+// self-join message the server sends first.
+func (c *Conn) connect(token string) (*websocket.Conn, OutgoingMessage, error) {
+	u := *c.roomURL
+	if token != "" {
+		q := u.Query()
+		q.Set("reconnectToken", token)
+		u.RawQuery = q.Encode()
+	}
+
+	ws, resp, err := c.dialer.Dial(u.String(), nil)
+	if err != nil {
+		if resp != nil {
+			return nil, OutgoingMessage{}, &DialError{StatusCode: resp.StatusCode}
+		}
+		return nil, OutgoingMessage{}, err
+	}
+	if c.authToken != "" {
+		_ = ws.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := ws.WriteJSON(IncomingMessage{MessageType: model.AuthMessage, Token: c.authToken}); err != nil {
+			ws.Close()
+			return nil, OutgoingMessage{}, err
+		}
+	}
+
+	var selfJoin OutgoingMessage
+	_ = ws.SetReadDeadline(time.Now().Add(pongWait))
+	if err := ws.ReadJSON(&selfJoin); err != nil {
+		ws.Close()
+		return nil, OutgoingMessage{}, err
+	}
+	ws.SetPingHandler(func(data string) error {
+		_ = ws.SetReadDeadline(time.Now().Add(pongWait))
+		return ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeWait))
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if user, ok := joinedUser(selfJoin); ok {
+		c.user = user
+	}
+	c.token, _ = selfJoin.AdditionalInfo["reconnectToken"].(string)
+	return ws, selfJoin, nil
+}
+
+func (c *Conn) readLoop(ws *websocket.Conn) {
+	defer close(c.messages)
+
+	for {
+		var msg OutgoingMessage
+		_ = ws.SetReadDeadline(time.Now().Add(pongWait))
+		err := ws.ReadJSON(&msg)
+		if err == nil {
+			select {
+			case c.messages <- msg:
+				continue
+			case <-c.done:
+				return
+			}
+		}
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		if !resumable(err) {
+			c.fail(err)
+			return
+		}
+		if ws, err = c.reconnect(); err != nil {
+			c.fail(err)
+			return
+		}
+	}
+}
+
+// reconnect replaces a dropped connection, retrying with backoff. The
+// resumed connection's self-join message is not delivered, the room never
+// saw the user leave.
+func (c *Conn) reconnect() (*websocket.Conn, error) {
+	backoff := reconnectBackoff
+	var err error
+	for range maxReconnects {
+		select {
+		case <-c.done:
+			return nil, ErrClosed
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		c.mu.Lock()
+		token := c.token
+		c.mu.Unlock()
+
+		var ws *websocket.Conn
+		ws, _, err = c.connect(token)
+		var dialErr *DialError
+		if errors.As(err, &dialErr) && dialErr.StatusCode == http.StatusUnauthorized {
+			// The token expired, join as a new connection instead.
+			ws, _, err = c.connect("")
+		}
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		select {
+		case <-c.done:
+			c.mu.Unlock()
+			ws.Close()
+			return nil, ErrClosed
+		default:
+		}
+		c.ws = ws
+		c.mu.Unlock()
+		return ws, nil
+	}
+	return nil, fmt.Errorf("client: reconnect failed after %d attempts: %w", maxReconnects, err)
+}
+
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	c.ws.Close()
+}
+
+// resumable reports whether a read error is worth reconnecting for. Closes
+// the server or the user asked for are final.
+func resumable(err error) bool {
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		return true
+	}
+	switch closeErr.Code {
+	case websocket.CloseNormalClosure, chat.CloseRoomClosed.Code, chat.CloseKicked.Code, chat.CloseReplaced.Code, chat.CloseAuthFailed.Code:
+		return false
+	}
+	return true
+}
+
+func joinedUser(msg OutgoingMessage) (User, bool) {
+	raw, ok := msg.AdditionalInfo["joinedUser"]
+	if !ok {
+		return User{}, false
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return User{}, false
+	}
+	var user User
+	if err := json.Unmarshal(b, &user); err != nil {
+		return User{}, false
+	}
+	return user, true
+}
+
+// DialError is returned when the server rejects the WebSocket handshake,
+// e.g. because the room doesn't exist or the user is banned.
+type DialError struct {
+	StatusCode int
+}
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("client: join rejected with status %d", e.StatusCode)
+}
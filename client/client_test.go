@@ -0,0 +1,444 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/chat"
+	"github.com/choffmann/chat-room/internal/handler"
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/choffmann/chat-room/internal/schema"
+	"github.com/choffmann/chat-room/internal/user"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+func startServer(t *testing.T) (*chat.Hub, *httptest.Server) {
+	t.Helper()
+	return startServerWithTimeouts(t, 0, 0)
+}
+
+// startServerWithTimeouts starts a server with the given http.Server read and
+// write timeouts, like main configures them. configure runs on the handler
+// before its routes are registered.
+func startServerWithTimeouts(t *testing.T, readTimeout, writeTimeout time.Duration, configure ...func(*handler.Handler)) (*chat.Hub, *httptest.Server) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	hub := chat.NewHub(logger)
+	hub.SetReconnectGrace(time.Minute)
+	h := handler.New(hub, user.NewRegistry(logger), logger, nil)
+	for _, f := range configure {
+		f(h)
+	}
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.ReadTimeout = readTimeout
+	srv.Config.WriteTimeout = writeTimeout
+	srv.Start()
+	t.Cleanup(func() {
+		srv.Close()
+		hub.ShutdownAll(context.Background())
+	})
+	return hub, srv
+}
+
+func roomURL(srv *httptest.Server, roomID uint) string {
+	return fmt.Sprintf("ws%s/api/v1/join/%d", strings.TrimPrefix(srv.URL, "http"), roomID)
+}
+
+func receive(t *testing.T, c *Conn, match func(OutgoingMessage) bool) OutgoingMessage {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.Messages():
+			if !ok {
+				t.Fatalf("messages closed: %v", c.Err())
+			}
+			if match(msg) {
+				return msg
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
+
+func isText(text string) func(OutgoingMessage) bool {
+	return func(msg OutgoingMessage) bool { return msg.Message == text }
+}
+
+func TestDialSendReceive(t *testing.T) {
+	hub, srv := startServer(t)
+	room, _ := hub.CreateRoom(nil)
+
+	c, err := Dial(roomURL(srv, room.ID()), User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	selfJoin := receive(t, c, func(OutgoingMessage) bool { return true })
+	if selfJoin.AdditionalInfo["self"] != true {
+		t.Errorf("expected self-join message first, got %+v", selfJoin)
+	}
+	if u := c.User(); u.Name != "alice" || u.ID.String() != selfJoin.AdditionalInfo["joinedUserId"] {
+		t.Errorf("unexpected user %+v", u)
+	}
+
+	if err := c.Send(IncomingMessage{MessageType: model.UserMessage, Message: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	msg := receive(t, c, isText("hello"))
+	if msg.User.ID != c.User().ID {
+		t.Errorf("expected message from %s, got %s", c.User().ID, msg.User.ID)
+	}
+}
+
+func TestDialRejected(t *testing.T) {
+	_, srv := startServer(t)
+
+	_, err := Dial(roomURL(srv, 42), User{Name: "alice"})
+	var dialErr *DialError
+	if !errors.As(err, &dialErr) || dialErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 dial error, got %v", err)
+	}
+}
+
+func TestReconnectResumesUser(t *testing.T) {
+	hub, srv := startServer(t)
+	room, _ := hub.CreateRoom(nil)
+
+	c, err := Dial(roomURL(srv, room.ID()), User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	watcher, err := Dial(roomURL(srv, room.ID()), User{Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	receive(t, watcher, isText(fmt.Sprintf("bob joined room %d", room.ID())))
+	before := c.User()
+
+	// Drop the network connection without a close frame.
+	c.mu.Lock()
+	c.ws.NetConn().Close()
+	c.mu.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if err := c.Send(IncomingMessage{MessageType: model.UserMessage, Message: "back"}); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection was not resumed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	msg := receive(t, watcher, func(msg OutgoingMessage) bool {
+		return msg.Message == "back" || strings.Contains(msg.Message, "alice")
+	})
+	if msg.Message != "back" {
+		t.Errorf("expected no leave or join churn, got %q", msg.Message)
+	}
+	if msg.User.ID != before.ID || c.User().ID != before.ID {
+		t.Errorf("expected resumed user %s, got %s", before.ID, msg.User.ID)
+	}
+}
+
+func TestKickEndsConnection(t *testing.T) {
+	hub, srv := startServerWithTimeouts(t, 0, 0, func(h *handler.Handler) { h.SetAdminToken("secret") })
+	room, _ := hub.CreateRoom(nil)
+
+	c, err := Dial(roomURL(srv, room.ID()), User{Name: "troll"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	receive(t, c, isText(fmt.Sprintf("troll joined room %d", room.ID())))
+
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/api/v1/rooms/%d/users/%s", srv.URL, room.ID(), c.User().ID), nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-c.Messages():
+			if ok {
+				continue
+			}
+			var closeErr *websocket.CloseError
+			if !errors.As(c.Err(), &closeErr) || closeErr.Code != chat.CloseKicked.Code {
+				t.Errorf("expected kick close error, got %v", c.Err())
+			}
+			if err := c.Send(IncomingMessage{Message: "still here?"}); !errors.Is(err, ErrClosed) {
+				t.Errorf("expected ErrClosed after kick, got %v", err)
+			}
+			return
+		case <-timeout:
+			t.Fatal("messages were not closed after kick")
+		}
+	}
+}
+
+func TestRestoredRoomUsesServerSetup(t *testing.T) {
+	s, err := schema.Compile([]byte(`{"type": "object", "properties": {"theme": {"enum": ["light", "dark"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub, srv := startServerWithTimeouts(t, 0, 0, func(h *handler.Handler) {
+		h.SetInfoSchemas(handler.InfoSchemas{Message: s})
+	})
+	// Restore the way main does: after the handler is configured.
+	if _, err := hub.RestoreRooms(strings.NewReader(`[{"id": 7, "createdAt": "2026-01-01T00:00:00Z", "additionalInfo": {}}]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(srv.URL+"/api/v1/users", "application/json", strings.NewReader(`{"name": "alice"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alice User
+	err = json.NewDecoder(resp.Body).Decode(&alice)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Dial(roomURL(srv, 7), alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if join := receive(t, c, func(OutgoingMessage) bool { return true }); join.User.ID == uuid.Nil {
+		t.Errorf("expected the join message from the system user, got %+v", join.User)
+	}
+
+	if err := c.Send(IncomingMessage{MessageType: model.UserMessage, Message: "themed", AdditionalInfo: model.AdditionalInfo{"theme": "blue"}}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, c, func(msg OutgoingMessage) bool { return strings.HasPrefix(msg.Message, "invalid additionalInfo") })
+
+	if err := c.Send(IncomingMessage{MessageType: model.UserMessage, Message: "hello", AdditionalInfo: model.AdditionalInfo{"theme": "dark"}}); err != nil {
+		t.Fatal(err)
+	}
+	sent := receive(t, c, isText("hello"))
+
+	req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/api/v1/users/"+alice.ID.String(), strings.NewReader(`{"name": "alicia"}`))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	room, _ := hub.GetRoom(7)
+	stored, ok := room.GetMessage(sent.ID)
+	if !ok || stored.User.Name != "alicia" {
+		t.Errorf("expected the stored message to show the author's new name, got %+v", stored)
+	}
+}
+
+func TestShutdownDeliversQueuedMessages(t *testing.T) {
+	hub, srv := startServer(t)
+	room, _ := hub.CreateRoom(nil)
+
+	c, err := Dial(roomURL(srv, room.ID()), User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	receive(t, c, isText(fmt.Sprintf("alice joined room %d", room.ID())))
+
+	const announcements = 50
+	for i := range announcements {
+		hub.Announce(fmt.Sprintf("announcement %d", i))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	hub.ShutdownAll(ctx)
+
+	var received int
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.Messages():
+			if ok {
+				if msg.Message == fmt.Sprintf("announcement %d", received) {
+					received++
+				}
+				continue
+			}
+			if received != announcements {
+				t.Errorf("expected %d announcements before the close, got %d", announcements, received)
+			}
+			var closeErr *websocket.CloseError
+			if !errors.As(c.Err(), &closeErr) || closeErr.Code != chat.CloseRoomClosed.Code {
+				t.Errorf("expected room closed error, got %v", c.Err())
+			}
+			return
+		case <-timeout:
+			t.Fatal("messages were not closed after shutdown")
+		}
+	}
+}
+
+func TestShutdownNotifiesClients(t *testing.T) {
+	hub, srv := startServer(t)
+	hub.SetShutdownMessage("Server is restarting")
+	room, _ := hub.CreateRoom(nil)
+
+	c, err := Dial(roomURL(srv, room.ID()), User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	receive(t, c, isText(fmt.Sprintf("alice joined room %d", room.ID())))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	hub.ShutdownAll(ctx)
+
+	notice := receive(t, c, isText("Server is restarting"))
+	if notice.MessageType != SystemMessage || notice.AdditionalInfo["shutdown"] != true {
+		t.Errorf("expected a system message with shutdown flag, got %+v", notice)
+	}
+	if stored := room.GetMessages(); len(stored) != 1 {
+		t.Errorf("expected the shutdown notice not to be stored, got %d messages", len(stored))
+	}
+}
+
+func TestIdleConnectionOutlivesServerTimeouts(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	hub, srv := startServerWithTimeouts(t, timeout, timeout)
+	room, _ := hub.CreateRoom(nil)
+
+	c, err := Dial(roomURL(srv, room.ID()), User{Name: "idle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	time.Sleep(3 * timeout)
+
+	pong := make(chan struct{}, 1)
+	c.mu.Lock()
+	ws := c.ws
+	ws.SetPongHandler(func(string) error {
+		pong <- struct{}{}
+		return nil
+	})
+	err = ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+	c.mu.Unlock()
+	if err != nil {
+		t.Fatalf("ping after idling: %v", err)
+	}
+	if err := c.Send(IncomingMessage{Message: "still here"}); err != nil {
+		t.Fatalf("send after idling: %v", err)
+	}
+
+	receive(t, c, func(msg OutgoingMessage) bool { return msg.Message == "still here" })
+	select {
+	case <-pong:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a pong after idling past the server timeouts")
+	}
+	if c.Err() != nil {
+		t.Fatalf("connection ended: %v", c.Err())
+	}
+}
+
+func TestDialAuth(t *testing.T) {
+	hub, srv := startServerWithTimeouts(t, 0, 0, func(h *handler.Handler) {
+		h.SetWebSocketAuth("s3cret", time.Second)
+	})
+	room, _ := hub.CreateRoom(nil)
+
+	for _, token := range []string{"", "wrong"} {
+		_, err := DialAuth(roomURL(srv, room.ID()), User{Name: "mallory"}, token)
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != chat.CloseAuthFailed.Code {
+			t.Errorf("token %q: expected close code %d, got %v", token, chat.CloseAuthFailed.Code, err)
+		}
+	}
+
+	c, err := DialAuth(roomURL(srv, room.ID()), User{Name: "alice"}, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	receive(t, c, func(OutgoingMessage) bool { return true })
+
+	// A connection that hasn't authenticated yet hasn't joined the room.
+	pending, _, err := websocket.DefaultDialer.Dial(roomURL(srv, room.ID())+"?userInfo=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pending.Close()
+	// Nor is a failed handshake announced as a join and leave.
+	if _, err := DialAuth(roomURL(srv, room.ID()), User{Name: "mallory"}, "wrong"); err == nil {
+		t.Fatal("expected the wrong token to be rejected")
+	}
+	if err := c.Send(IncomingMessage{MessageType: model.UserMessage, Message: "before auth"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, c, func(msg OutgoingMessage) bool {
+		if strings.Contains(msg.Message, "mallory") {
+			t.Errorf("expected no announcement of the failed handshake, got %q", msg.Message)
+		}
+		return msg.Message == "before auth"
+	})
+	if n := room.GetClientCount(); n != 1 {
+		t.Errorf("expected the pending connection not to be registered, got %d clients", n)
+	}
+
+	if err := pending.WriteJSON(IncomingMessage{MessageType: model.AuthMessage, Token: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	var first OutgoingMessage
+	_ = pending.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := pending.ReadJSON(&first); err != nil {
+		t.Fatal(err)
+	}
+	if first.AdditionalInfo["self"] != true {
+		t.Errorf("expected the self-join message first after authenticating, got %+v", first)
+	}
+	receive(t, c, func(msg OutgoingMessage) bool {
+		return strings.HasSuffix(msg.Message, fmt.Sprintf("joined room %d", room.ID()))
+	})
+
+	if err := c.Send(IncomingMessage{MessageType: model.UserMessage, Message: "after auth"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var msg OutgoingMessage
+		if err := pending.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Message == "before auth" {
+			t.Fatal("expected messages sent before authenticating to be withheld")
+		}
+		if msg.Message == "after auth" {
+			break
+		}
+	}
+}
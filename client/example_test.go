@@ -0,0 +1,26 @@
+package client_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/choffmann/chat-room/client"
+)
+
+func Example() {
+	conn, err := client.Dial("ws://localhost:8080/api/v1/join/1", client.User{Name: "alice"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.Send(client.IncomingMessage{MessageType: client.UserMessage, Message: "Hello everyone!"}); err != nil {
+		log.Fatal(err)
+	}
+	for msg := range conn.Messages() {
+		fmt.Printf("%s: %s\n", msg.User.Name, msg.Message)
+	}
+	if err := conn.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -5,18 +5,23 @@ package main
 import (
 	"context"
 	"errors"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/choffmann/chat-room/docs"
 	"github.com/choffmann/chat-room/internal/chat"
 	"github.com/choffmann/chat-room/internal/config"
+	"github.com/choffmann/chat-room/internal/filter"
 	"github.com/choffmann/chat-room/internal/handler"
+	"github.com/choffmann/chat-room/internal/model"
 	"github.com/choffmann/chat-room/internal/upload"
 	"github.com/choffmann/chat-room/internal/user"
+	"github.com/choffmann/chat-room/internal/webhook"
 	"github.com/gorilla/mux"
 )
 
@@ -35,7 +40,13 @@ import (
 // @description     The field is always optional. If omitted it defaults to an empty object (`{}`). On `PATCH` requests the provided keys are merged into the existing object; on `PUT` the entire object is replaced.
 // @host            chat.homebin.dev
 // @BasePath        /api/v1
+// @securityDefinitions.apikey  AdminToken
+// @in                          header
+// @name                        Authorization
+// @description                 Admin token configured via `ADMIN_TOKEN`, sent as `Bearer <token>`.
 func main() {
+	config.StartTime = time.Now()
+
 	docs.SwaggerInfo.Schemes = []string{"https"}
 	if baseURL := config.BaseURL(); baseURL != "" {
 		docs.SwaggerInfo.Host = baseURL
@@ -43,9 +54,58 @@ func main() {
 
 	logger := config.NewLogger()
 
+	timestampLayout, err := config.TimestampLayout()
+	if err != nil {
+		logger.Error("invalid TIMESTAMP_FORMAT", "error", err)
+		os.Exit(1)
+	}
+	model.SetTimestampLayout(timestampLayout)
+
 	uploadStore := upload.NewStore(config.UploadDir(), logger)
 
 	hub := chat.NewHub(logger)
+	hub.SetBackpressurePolicy(chat.BackpressurePolicy{
+		SendTimeout:  config.SendTimeout(),
+		MaxFailures:  config.MaxSendFailures(),
+		MaxEvictions: config.MaxEvictions(),
+	})
+	hub.SetWritePolicy(chat.WritePolicy{
+		Timeout:       config.WriteTimeout(),
+		MaxSlowWrites: config.MaxSlowWrites(),
+	})
+	hub.SetFloodPolicy(chat.FloodPolicy{
+		MaxPerSecond: config.FloodMaxPerSecond(),
+		Cooldown:     config.FloodCooldown(),
+	})
+	hub.SetMessageByteBudget(config.RoomMaxStoredBytes())
+	hub.SetMaxConnections(config.MaxConnections())
+	hub.SetMaxRooms(config.MaxRooms())
+	hub.SetMaxRoomsPerOwner(config.MaxRoomsPerOwner())
+	hub.SetMaxInfoBytes(config.MaxInfoBytes())
+	hub.SetMaxImageBytes(config.MaxImageBytes())
+	hub.SetReconnectGrace(config.ReconnectGrace())
+	hub.SetCloseGrace(config.CloseGrace())
+	hub.SetEmptyRoomTimeout(config.EmptyRoomTimeout())
+	hub.SetShutdownMessage(config.ShutdownMessage())
+	messageCipher, err := loadMessageCipher()
+	if err != nil {
+		logger.Error("invalid MESSAGE_ENCRYPTION_KEY", "error", err)
+		os.Exit(1)
+	}
+	if messageCipher != nil {
+		hub.SetMessageCipher(messageCipher)
+		logger.Info("encrypting stored messages")
+	}
+	filterWords, err := config.FilterWords()
+	if err != nil {
+		logger.Warn("failed to load filter words, message filtering disabled", "error", err)
+	}
+	hub.SetMessageFilter(filter.WordMasker(filterWords))
+	if url := config.WebhookURL(); url != "" {
+		notifier := webhook.NewNotifier(url, logger)
+		hub.SetOnPresence(func(e chat.PresenceEvent) { notifier.Notify(e) })
+		logger.Info("sending join and leave webhooks", "url", url)
+	}
 	hub.SetOnRoomDelete(func(roomID uint) {
 		if err := uploadStore.DeleteRoomDir(roomID); err != nil {
 			logger.Warn("failed to delete room upload dir", "roomID", roomID, "error", err)
@@ -55,18 +115,52 @@ func main() {
 	userRegistry := user.NewRegistry(logger)
 
 	h := handler.New(hub, userRegistry, logger, uploadStore)
+	h.SetAdminToken(config.AdminToken())
+	h.SetWebSocketAuth(config.WSAuthToken(), config.WSAuthTimeout())
+	h.SetIdempotencyTTL(config.IdempotencyTTL())
+	h.SetAuthorOnlyEdits(config.MessageAuthorOnly())
+	if config.RequireRoomName() {
+		h.AddRoomValidator(handler.RequireRoomName)
+	}
+	h.SetMaxNameLength(config.UserNameMaxLength())
+	h.SetHistoryByteLimit(config.HistoryMaxBytes())
+	h.SetCreationRateLimit(config.CreateRateLimit(), config.CreateRateBurst())
+	h.SetJoinRateLimit(config.JoinRateLimit(), config.JoinRateBurst())
+	anonNames, err := config.AnonNames()
+	if err != nil {
+		logger.Warn("failed to load anonymous user names, using built-in list", "error", err)
+	}
+	h.SetDefaultNames(anonNames)
+	schemas, err := loadInfoSchemas()
+	if err != nil {
+		logger.Error("failed to load additionalInfo schema", "error", err)
+		os.Exit(1)
+	}
+	h.SetInfoSchemas(schemas)
+
+	// Rooms copy the hub's and handler's settings when they are created, so
+	// they are restored only once both are configured.
+	roomsFile := config.RoomsFile()
+	if roomsFile != "" {
+		restored, err := restoreRooms(hub, roomsFile)
+		if err != nil {
+			logger.Error("failed to restore rooms", "file", roomsFile, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("restored rooms", "file", roomsFile, "count", restored)
+	}
 
 	r := mux.NewRouter()
 	h.RegisterRoutes(r, config.LegacyRoutes())
 
-	httpHandler := handler.CORSMiddleware(r)
+	httpHandler := handler.CORSMiddleware(handler.VersionMiddleware(r))
 
 	srv := &http.Server{
 		Addr:         ":8080",
 		Handler:      httpHandler,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  config.HTTPReadTimeout(),
+		WriteTimeout: config.HTTPWriteTimeout(),
+		IdleTimeout:  config.HTTPIdleTimeout(),
 	}
 
 	go func() {
@@ -79,6 +173,11 @@ func main() {
 
 	quitCtx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
+
+	if ttl := config.UserTTL(); ttl > 0 {
+		go userRegistry.RunExpiry(quitCtx, ttl, hub.IsUserOnline)
+		logger.Info("expiring inactive users", "ttl", ttl)
+	}
 	<-quitCtx.Done()
 	logger.Info("shutdown signal received", "signal", quitCtx.Err().Error())
 
@@ -89,7 +188,13 @@ func main() {
 		logger.Error("http server shutdown error", "error", err)
 	}
 
-	hub.ShutdownAll()
+	if roomsFile != "" {
+		if err := saveRooms(hub, roomsFile, config.RoomsPersistWindow()); err != nil {
+			logger.Error("failed to save rooms", "file", roomsFile, "error", err)
+		}
+	}
+
+	hub.ShutdownAll(ctx)
 
 	if err := uploadStore.DeleteAll(); err != nil {
 		logger.Warn("failed to clean up upload directory", "error", err)
@@ -97,3 +202,59 @@ func main() {
 
 	logger.Info("server stopped")
 }
+
+// restoreRooms recreates the rooms saved in path. A missing file restores
+// nothing.
+func restoreRooms(hub *chat.Hub, path string) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return hub.RestoreRooms(f)
+}
+
+// saveRooms writes the hub's rooms active within window to path. The file
+// is replaced only once it was written completely.
+func saveRooms(hub *chat.Hub, path string, window time.Duration) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := hub.SaveRooms(tmp, window); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadMessageCipher returns nil if no message encryption key is configured.
+func loadMessageCipher() (*chat.MessageCipher, error) {
+	key, err := config.MessageEncryptionKey()
+	if err != nil || key == nil {
+		return nil, err
+	}
+	return chat.NewMessageCipher(key)
+}
+
+func loadInfoSchemas() (handler.InfoSchemas, error) {
+	var schemas handler.InfoSchemas
+	var err error
+	if schemas.Room, err = config.RoomInfoSchema(); err != nil {
+		return schemas, err
+	}
+	if schemas.User, err = config.UserInfoSchema(); err != nil {
+		return schemas, err
+	}
+	if schemas.Message, err = config.MessageInfoSchema(); err != nil {
+		return schemas, err
+	}
+	return schemas, nil
+}
@@ -15,21 +15,170 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/broadcast": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Stores and broadcasts a system message with ` + "`" + `\"announcement\": true` + "`" + ` in its additionalInfo to every room, e.g. for maintenance notices. Rooms that are shutting down are skipped. Returns the number of rooms reached.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Announce a message in every room",
+                "parameters": [
+                    {
+                        "description": "Announcement",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/AnnouncementRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/AnnouncementResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/rooms": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns every active room including internal statistics (message count, creation time, last activity). Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List all rooms with full detail",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/AdminRoomsListResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/rooms/{roomID}/dead-letters": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns the last 100 broadcasts the room dropped for clients whose send buffer was full, oldest first, to find out why a client missed messages. The message is left out in rooms that encrypt their messages. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List broadcasts dropped in a room",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/DeadLettersResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "can't parse room id to uint",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/healthz": {
             "get": {
-                "description": "Simple liveness probe. Returns plain text \"OK\".",
+                "description": "Simple liveness probe. Returns plain text \"OK\", or with ` + "`" + `Accept: application/json` + "`" + ` the process uptime and the current number of rooms and WebSocket clients.\nWith ` + "`" + `deep=1` + "`" + ` up to 100 rooms are pinged to check that their goroutines still respond. Rooms that don't answer within a second are reported as stuck with status 503.",
                 "produces": [
-                    "text/plain"
+                    "text/plain",
+                    "application/json"
                 ],
                 "tags": [
                     "info"
                 ],
                 "summary": "Health check",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Check that room goroutines respond",
+                        "name": "deep",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/HealthResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/HealthResponse"
                         }
                     }
                 }
@@ -37,14 +186,27 @@ const docTemplate = `{
         },
         "/info": {
             "get": {
-                "description": "Exposes metadata about the running binary. Field values are populated at build time; when unavailable, they default to \"unknown\".",
+                "description": "Exposes metadata about the running binary. Field values are populated at build time; when unavailable, they default to \"unknown\".\nWith ` + "`" + `format=text` + "`" + ` or ` + "`" + `Accept: text/plain` + "`" + ` only the version and commit are returned on one line, e.g. ` + "`" + `v1.0.0 a1b2c3d` + "`" + `. ` + "`" + `/version` + "`" + ` is an alias.",
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/plain"
                 ],
                 "tags": [
                     "info"
                 ],
                 "summary": "Get build info",
+                "parameters": [
+                    {
+                        "enum": [
+                            "json",
+                            "text"
+                        ],
+                        "type": "string",
+                        "description": "Response format",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -55,9 +217,61 @@ const docTemplate = `{
                 }
             }
         },
+        "/join": {
+            "get": {
+                "description": "Upgrades the HTTP connection to a multiplexed WebSocket that isn't bound to a room. User identification works like ` + "`" + `/join/{roomID}` + "`" + `.\n\n**Subscriptions:** Send ` + "`" + `{\"action\": \"subscribe\", \"roomId\": 1}` + "`" + ` to join a room (optionally with ` + "`" + `\"history\": N` + "`" + ` to replay the last N stored messages) and ` + "`" + `{\"action\": \"unsubscribe\", \"roomId\": 1}` + "`" + ` to leave it. The server confirms with a system message whose ` + "`" + `additionalInfo.action` + "`" + ` is ` + "`" + `\"subscribed\"` + "`" + ` or ` + "`" + `\"unsubscribed\"` + "`" + `. If a room drops the subscription (kick, slow consumer, room closed), an ` + "`" + `\"unsubscribed\"` + "`" + ` message with a ` + "`" + `reason` + "`" + ` is sent and the connection stays open.\n\n**Authentication:** With ` + "`" + `WS_AUTH_TOKEN` + "`" + ` set, the first frame must be an auth frame like on ` + "`" + `/join/{roomID}` + "`" + `.\n\n**Messages:** Every frame sent by the server carries the ` + "`" + `roomId` + "`" + ` it belongs to. To send a message, add ` + "`" + `roomId` + "`" + ` to a regular client message, e.g. ` + "`" + `{\"roomId\": 1, \"message\": \"hi\"}` + "`" + `. Binary uploads are not supported on multiplexed connections.",
+                "tags": [
+                    "websocket"
+                ],
+                "summary": "Join several rooms via one WebSocket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Registered user UUID",
+                        "name": "userId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ephemeral display name",
+                        "name": "userName",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols - WebSocket connection established"
+                    },
+                    "400": {
+                        "description": "invalid user ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "user not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "too many requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "too many connections",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/join/{roomID}": {
             "get": {
-                "description": "Upgrades the HTTP connection to WebSocket and joins the requested room.\n\n**Authentication options:**\n- ` + "`" + `userId` + "`" + ` (UUID): Join as a registered user from the registry. Takes precedence over ` + "`" + `userName` + "`" + `.\n- ` + "`" + `userName` + "`" + ` (string): Join as an ephemeral user with the given display name.\n- Neither: Server assigns a random display name.\n\n**User info extraction:** Set ` + "`" + `userInfo=true` + "`" + ` to receive a self-join message with a ` + "`" + `self` + "`" + ` flag, allowing clients to extract their user information.\n\n**Message types:** The ` + "`" + `type` + "`" + ` field in client messages accepts any string value. Built-in types are ` + "`" + `\"message\"` + "`" + ` and ` + "`" + `\"image\"` + "`" + `, but clients can send custom types (e.g. ` + "`" + `\"poll\"` + "`" + `, ` + "`" + `\"reaction\"` + "`" + `, ` + "`" + `\"file\"` + "`" + `). If the ` + "`" + `type` + "`" + ` field is omitted, it defaults to ` + "`" + `\"message\"` + "`" + `. All message types are stored in room history except ` + "`" + `\"image\"` + "`" + `. System messages (` + "`" + `\"system\"` + "`" + `) are server-generated and cannot be sent by clients.\n\n**Connection management:** Server sends ping every 30s, expects pong within 60s. Max message size: 10 MiB.",
+                "description": "Upgrades the HTTP connection to WebSocket and joins the requested room.\n\n**Authentication options:**\n- ` + "`" + `userId` + "`" + ` (UUID): Join as a registered user from the registry. Takes precedence over ` + "`" + `userName` + "`" + `.\n- ` + "`" + `userName` + "`" + ` (string): Join as an ephemeral user with the given display name.\n- Neither: Server assigns a random display name.\n\nEphemeral users get ` + "`" + `additionalInfo.color` + "`" + ` picked from a fixed palette by their ID, see the README for the derivation.\n\nRooms with ` + "`" + `\"requireRegisteredUsers\": true` + "`" + ` in their additionalInfo reject joins without a registered ` + "`" + `userId` + "`" + ` with 401.\n\n**User info extraction:** Set ` + "`" + `userInfo=true` + "`" + ` to receive a self-join message with a ` + "`" + `self` + "`" + ` flag, allowing clients to extract their user information.\n\n**Reconnects:** If enabled, the self-join message carries a ` + "`" + `reconnectToken` + "`" + ` in ` + "`" + `additionalInfo` + "`" + `. Joining again with ` + "`" + `reconnectToken` + "`" + ` restores the same user, including ephemeral ones, without leave and join messages. The token is valid while connected and for the reconnect grace period after the connection drops; a connection still holding it is closed with ` + "`" + `4004` + "`" + `. Each token works once and the self-join message of the resumed connection has ` + "`" + `resumed` + "`" + ` set and a new token.\n\n**Message types:** The ` + "`" + `type` + "`" + ` field in client messages accepts any string value. Built-in types are ` + "`" + `\"message\"` + "`" + ` and ` + "`" + `\"image\"` + "`" + `, but clients can send custom types (e.g. ` + "`" + `\"poll\"` + "`" + `, ` + "`" + `\"reaction\"` + "`" + `, ` + "`" + `\"file\"` + "`" + `). If the ` + "`" + `type` + "`" + ` field is omitted, it defaults to ` + "`" + `\"message\"` + "`" + `. All message types are stored in room history except ` + "`" + `\"image\"` + "`" + `. System messages (` + "`" + `\"system\"` + "`" + `) are server-generated and cannot be sent by clients.\n\n**Threads:** Set ` + "`" + `parentId` + "`" + ` to the UUID of a stored message to send a threaded reply. Replies to unknown messages are rejected with a private error message.\n\n**Expiry:** Set ` + "`" + `expiresIn` + "`" + ` (seconds, max 7 days) to make a message disappear. The server stores ` + "`" + `expiresAt` + "`" + ` in ` + "`" + `additionalInfo` + "`" + `, removes the message once it expires and broadcasts a ` + "`" + `message_deleted` + "`" + ` event with the removed ` + "`" + `messageId` + "`" + `.\n\n**Connection management:** Server sends ping every 30s, expects pong within 60s. Max message size: 10 MiB.\n\n**Receipts:** Send ` + "`" + `{\"type\": \"receipt\", \"messageId\": \"\u003cuuid\u003e\"}` + "`" + ` to acknowledge a stored message. The server adds the user to the message's ` + "`" + `additionalInfo.deliveredTo` + "`" + ` and broadcasts a ` + "`" + `receipt` + "`" + ` event with the ` + "`" + `messageId` + "`" + ` and the full ` + "`" + `deliveredTo` + "`" + ` list. Messages sent to an audience can only be acknowledged by that audience and their receipt events only reach it. Receipts are not stored.\n\n**Authentication:** With ` + "`" + `WS_AUTH_TOKEN` + "`" + ` set, the first frame must be ` + "`" + `{\"type\": \"auth\", \"token\": \"\u003ctoken\u003e\"}` + "`" + `, sent within ` + "`" + `WS_AUTH_TIMEOUT` + "`" + `. The client joins the room only afterwards, so until then it receives nothing and no join is announced. Any other first frame, a wrong token or a timeout closes the connection with ` + "`" + `4005` + "`" + `.\n\n**Close codes:** When the server ends a connection, the close frame carries a code and reason: ` + "`" + `4001` + "`" + ` \"room closed\", ` + "`" + `4002` + "`" + ` \"kicked\", ` + "`" + `4003` + "`" + ` \"slow consumer\", ` + "`" + `4004` + "`" + ` \"replaced by reconnect\", ` + "`" + `4005` + "`" + ` \"authentication failed\".",
                 "tags": [
                     "websocket"
                 ],
@@ -87,6 +301,18 @@ const docTemplate = `{
                         "description": "Enable self-join message with user info",
                         "name": "userInfo",
                         "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Replay the last N stored messages (oldest first, max 256) right after joining",
+                        "name": "history",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token from a previous self-join message to resume that user",
+                        "name": "reconnectToken",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -99,18 +325,42 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "401": {
+                        "description": "invalid or expired reconnect token, or room requires a registered user",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "user is banned from this room",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "room or user not found",
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "429": {
+                        "description": "too many requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "too many connections",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
         },
         "/rooms": {
             "get": {
-                "description": "Retrieves all currently active rooms with user counts and metadata.",
+                "description": "Retrieves all currently active rooms with user counts and metadata. ` + "`" + `minUsers` + "`" + ` and ` + "`" + `maxUsers` + "`" + ` limit the list to rooms whose online user count lies in that range, e.g. to find rooms with space left.",
                 "produces": [
                     "application/json"
                 ],
@@ -118,17 +368,37 @@ const docTemplate = `{
                     "rooms"
                 ],
                 "summary": "List all rooms",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Minimum number of online users",
+                        "name": "minUsers",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of online users",
+                        "name": "maxUsers",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/RoomsListResponse"
                         }
+                    },
+                    "400": {
+                        "description": "minUsers must not be greater than maxUsers",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             },
             "post": {
-                "description": "Creates a new chat room. The request body is optional and can carry additional metadata that will be echoed back when the room is queried. If the JSON payload cannot be decoded, an empty additionalInfo is used instead.",
+                "description": "Creates a new chat room. The request body is optional and can carry additional metadata that will be echoed back when the room is queried. If the JSON payload cannot be decoded, an empty additionalInfo is used instead. An optional ` + "`" + `slug` + "`" + ` must be unique across rooms. With ` + "`" + `MAX_ROOMS_PER_OWNER` + "`" + ` set, an ` + "`" + `ownerId` + "`" + ` may only have that many rooms open at once; rooms without an ` + "`" + `ownerId` + "`" + ` aren't limited. With ` + "`" + `REQUIRE_ROOM_NAME` + "`" + ` set, rooms without a non-empty ` + "`" + `name` + "`" + ` are rejected with ` + "`" + `422` + "`" + `.",
                 "consumes": [
                     "application/json"
                 ],
@@ -147,6 +417,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/CreateRoomRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Repeated requests with the same key return the originally created room",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -155,6 +431,42 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/CreateRoomResponse"
                         }
+                    },
+                    "400": {
+                        "description": "slug must be a non-empty string",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "slug already in use",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "additionalInfo too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/ValidationError"
+                        }
+                    },
+                    "429": {
+                        "description": "too many requests or too many rooms for this owner",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/RoomLimitResponse"
+                        }
                     }
                 }
             }
@@ -220,7 +532,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Replaces all room metadata. This completely overwrites the existing additionalInfo.",
+                "description": "Replaces all room metadata. This completely overwrites the existing additionalInfo. A ` + "`" + `slug` + "`" + ` already used by another room fails with 409 and leaves the room unchanged. The room keeps the ` + "`" + `ownerId` + "`" + ` it was created with, whatever the body says. With ` + "`" + `REQUIRE_ROOM_NAME` + "`" + ` set, the new metadata must include a non-empty ` + "`" + `name` + "`" + `, or the request fails with ` + "`" + `422` + "`" + `. Connected clients receive a ` + "`" + `room_updated` + "`" + ` event with the new additionalInfo.",
                 "consumes": [
                     "application/json"
                 ],
@@ -267,11 +579,29 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "409": {
+                        "description": "slug already in use",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "additionalInfo too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/ValidationError"
+                        }
                     }
                 }
             },
             "patch": {
-                "description": "Partially updates room metadata. The provided fields are merged with existing additionalInfo, preserving fields not included in the request.",
+                "description": "Partially updates room metadata. The provided fields are merged with existing additionalInfo, preserving fields not included in the request. Changing ` + "`" + `slug` + "`" + ` fails with 409 if another room uses it, without applying any of the other fields; a ` + "`" + `null` + "`" + ` slug removes it. An ` + "`" + `ownerId` + "`" + ` in the body is ignored; the room keeps the owner it was created with. With ` + "`" + `REQUIRE_ROOM_NAME` + "`" + ` set, an update that would leave the room without a non-empty ` + "`" + `name` + "`" + ` is rejected with ` + "`" + `422` + "`" + `. Connected clients receive a ` + "`" + `room_updated` + "`" + ` event with the new additionalInfo.",
                 "consumes": [
                     "application/json"
                 ],
@@ -318,20 +648,43 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "409": {
+                        "description": "slug already in use",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "additionalInfo too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/ValidationError"
+                        }
                     }
                 }
             }
         },
-        "/rooms/{roomID}/messages": {
+        "/rooms/{roomID}/bans": {
             "get": {
-                "description": "Returns all messages that have been sent in a specific room. Messages are stored in memory and include system messages (joins/leaves) as well as user messages. Only messages smaller than 2 MiB are stored.",
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns the IDs of all users banned from the room. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "messages"
+                    "moderation"
                 ],
-                "summary": "Get all messages in a room",
+                "summary": "List banned users of a room",
                 "parameters": [
                     {
                         "type": "integer",
@@ -345,11 +698,17 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/MessagesListResponse"
+                            "$ref": "#/definitions/BansResponse"
                         }
                     },
                     "400": {
-                        "description": "can't parse room id to uint",
+                        "description": "invalid room id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
                         "schema": {
                             "type": "string"
                         }
@@ -361,18 +720,24 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/rooms/{roomID}/messages/{messageID}": {
-            "get": {
-                "description": "Retrieves a specific message from a room by its ID.",
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Adds the user to the room's ban list and kicks any open connections. Banned users are rejected with 403 when joining. Bans match the user ID, so they only make sense for registered users; ephemeral users get a new random ID on every join. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "messages"
+                    "moderation"
                 ],
-                "summary": "Get a specific message",
+                "summary": "Ban a user from a room",
                 "parameters": [
                     {
                         "type": "integer",
@@ -382,46 +747,61 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Message UUID",
-                        "name": "messageID",
-                        "in": "path",
-                        "required": true
+                        "description": "User to ban",
+                        "name": "ban",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/BanRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "user was already banned",
                         "schema": {
-                            "$ref": "#/definitions/OutgoingMessage"
+                            "$ref": "#/definitions/BansResponse"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/BansResponse"
                         }
                     },
                     "400": {
-                        "description": "can't parse room id or message id",
+                        "description": "invalid room id or request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "404": {
-                        "description": "room or message not found",
+                        "description": "room not found",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Completely replaces a message. Unlike PATCH, this requires all fields and replaces the entire message content. The server automatically sets modified: true in additionalInfo.",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
+            }
+        },
+        "/rooms/{roomID}/bans/{userID}": {
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
                 ],
+                "description": "Removes the user from the room's ban list. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
                 "tags": [
-                    "messages"
+                    "moderation"
                 ],
-                "summary": "Replace a message",
+                "summary": "Unban a user from a room",
                 "parameters": [
                     {
                         "type": "integer",
@@ -432,51 +812,48 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Message UUID",
-                        "name": "messageID",
+                        "description": "User UUID",
+                        "name": "userID",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "New message content",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/MessagePutRequest"
-                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "invalid room or user id",
                         "schema": {
-                            "$ref": "#/definitions/OutgoingMessage"
+                            "type": "string"
                         }
                     },
-                    "400": {
-                        "description": "invalid request",
+                    "401": {
+                        "description": "unauthorized",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "404": {
-                        "description": "room or message not found",
+                        "description": "room not found or user not banned",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Marks a message as deleted. The message is not actually removed but its content is replaced with \"deleted\" and a deleted flag is added to additionalInfo.",
+            }
+        },
+        "/rooms/{roomID}/export": {
+            "get": {
+                "description": "Downloads every stored message of a room, oldest first, as an attachment. ` + "`" + `json` + "`" + ` returns the raw message array; ` + "`" + `csv` + "`" + ` has one row per message with the columns ` + "`" + `id` + "`" + `, ` + "`" + `timestamp` + "`" + `, ` + "`" + `user` + "`" + `, ` + "`" + `type` + "`" + ` and ` + "`" + `message` + "`" + `, where ` + "`" + `user` + "`" + ` is the author's display name. The response is streamed. Messages sent to an audience are only included as for ` + "`" + `GET /rooms/{roomID}/messages` + "`" + `.",
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/csv"
                 ],
                 "tags": [
                     "messages"
                 ],
-                "summary": "Delete a message",
+                "summary": "Export a room's messages",
                 "parameters": [
                     {
                         "type": "integer",
@@ -486,36 +863,55 @@ const docTemplate = `{
                         "required": true
                     },
                     {
+                        "enum": [
+                            "json",
+                            "csv"
+                        ],
                         "type": "string",
-                        "description": "Message UUID",
-                        "name": "messageID",
-                        "in": "path",
-                        "required": true
+                        "description": "Export format (default json)",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Include the messages sent to this user's role",
+                        "name": "userId",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/OutgoingMessage"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/OutgoingMessage"
+                            }
                         }
                     },
                     "400": {
-                        "description": "can't parse room id or message id",
+                        "description": "can't parse room id to uint, invalid format or userId",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "404": {
-                        "description": "room or message not found",
+                        "description": "room not found",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
-            },
-            "patch": {
-                "description": "Partially updates a specific message. You can update the message text, additionalInfo, or both. Only provided fields are updated. The server automatically sets modified: true in additionalInfo.",
+            }
+        },
+        "/rooms/{roomID}/import": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Loads messages in the JSON export format into a room's history without broadcasting them. By default they are appended to the existing messages; ` + "`" + `mode=replace` + "`" + ` drops the existing history and pins first. Every message needs a ` + "`" + `type` + "`" + ` and a ` + "`" + `timestamp` + "`" + `, and IDs may appear only once per import. Messages whose ` + "`" + `id` + "`" + ` is missing or already stored get a new ID and replies to them are relinked. ` + "`" + `additionalInfo` + "`" + ` is subject to the same limits as for new messages; an ` + "`" + `expiresAt` + "`" + ` in it makes the message expire like one sent with ` + "`" + `expiresIn` + "`" + `. The request body may be at most 64 MiB. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
                 "consumes": [
                     "application/json"
                 ],
@@ -525,7 +921,7 @@ const docTemplate = `{
                 "tags": [
                     "messages"
                 ],
-                "summary": "Partially update a message",
+                "summary": "Import messages into a room",
                 "parameters": [
                     {
                         "type": "integer",
@@ -535,19 +931,25 @@ const docTemplate = `{
                         "required": true
                     },
                     {
+                        "enum": [
+                            "append",
+                            "replace"
+                        ],
                         "type": "string",
-                        "description": "Message UUID",
-                        "name": "messageID",
-                        "in": "path",
-                        "required": true
+                        "description": "append (default) or replace",
+                        "name": "mode",
+                        "in": "query"
                     },
                     {
-                        "description": "Fields to update",
+                        "description": "Messages from an export",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/MessagePatchRequest"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/OutgoingMessage"
+                            }
                         }
                     }
                 ],
@@ -555,34 +957,52 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/OutgoingMessage"
+                            "$ref": "#/definitions/MessagesImportResponse"
                         }
                     },
                     "400": {
-                        "description": "invalid request",
+                        "description": "can't parse room id to uint, invalid mode, request body or message",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "404": {
-                        "description": "room or message not found",
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "request body or additionalInfo too large",
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/ValidationError"
+                        }
                     }
                 }
             }
         },
-        "/rooms/{roomID}/users": {
+        "/rooms/{roomID}/messages": {
             "get": {
-                "description": "Returns all users currently connected to a specific room.",
+                "description": "Returns the messages that have been sent in a specific room. Messages are stored in memory and include system messages (joins/leaves) as well as user messages. Only messages smaller than 2 MiB are stored.\n\nEvery stored message has a ` + "`" + `seq` + "`" + ` number that increases by one per stored message in the room. Use ` + "`" + `since` + "`" + ` to only return messages with a higher ` + "`" + `seq` + "`" + `, e.g. to fetch what was missed after a reconnect.\n\nUse ` + "`" + `type` + "`" + ` to only return messages of one built-in type. Without ` + "`" + `limit` + "`" + ` and ` + "`" + `offset` + "`" + ` all matching messages are returned. With them, the most recent ` + "`" + `limit` + "`" + ` matching messages are returned after skipping the newest ` + "`" + `offset` + "`" + ` ones. The result is ordered oldest to newest, or newest to oldest with ` + "`" + `order=desc` + "`" + `; the order doesn't change which messages a page contains. ` + "`" + `total` + "`" + ` is the number of matching messages and ` + "`" + `hasMore` + "`" + ` tells whether older ones exist.\n\nWith ` + "`" + `ids` + "`" + `, a comma-separated list of up to 100 message UUIDs, just those messages are returned in the listed order and all other parameters are ignored. IDs of unknown or expired messages, and of messages the requester may not see, are reported in ` + "`" + `notFound` + "`" + `.\n\nMessages sent with an ` + "`" + `audience` + "`" + ` role are only returned with a ` + "`" + `userId` + "`" + ` of their author or of a user with that role, or with the admin token.\n\nA response is cut short once its messages exceed the server's history byte budget; the oldest messages of the page are left out, ` + "`" + `hasMore` + "`" + ` is true and ` + "`" + `nextOffset` + "`" + ` is the ` + "`" + `offset` + "`" + ` that continues with them.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "rooms"
+                    "messages"
                 ],
-                "summary": "Get users in a room",
+                "summary": "Get all messages in a room",
                 "parameters": [
                     {
                         "type": "integer",
@@ -590,17 +1010,69 @@ const docTemplate = `{
                         "name": "roomID",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated message UUIDs to fetch",
+                        "name": "ids",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "message",
+                            "system",
+                            "image",
+                            "message_deleted"
+                        ],
+                        "type": "string",
+                        "description": "Only return messages of this type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only return messages with a higher seq",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of messages to return (max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of newest matching messages to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "asc (default) or desc",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Show the messages sent to this user's role",
+                        "name": "userId",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/UsersListResponse"
+                            "$ref": "#/definitions/MessagesListResponse"
                         }
                     },
                     "400": {
-                        "description": "invalid room id",
+                        "description": "can't parse room id to uint, invalid ids, type, since, limit, offset, order or userId",
                         "schema": {
                             "type": "string"
                         }
@@ -612,32 +1084,9 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/users": {
-            "get": {
-                "description": "Returns all users registered in the user registry. Returns an empty array if no users are registered.",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "users"
-                ],
-                "summary": "List all registered users",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/User"
-                            }
-                        }
-                    }
-                }
             },
-            "post": {
-                "description": "Creates a new user in the user registry. All fields are optional. This allows pre-registering users before they join rooms.",
+            "patch": {
+                "description": "Applies up to 100 partial updates in one request, each like ` + "`" + `PATCH /rooms/{roomID}/messages/{messageID}` + "`" + `. Every entry is reported in ` + "`" + `results` + "`" + `; unknown messages, invalid entries and messages the requester may not change are skipped with an ` + "`" + `error` + "`" + ` instead of failing the whole request.\n\nThe applied changes are announced in a single ` + "`" + `message_updated` + "`" + ` event whose ` + "`" + `additionalInfo.updates` + "`" + ` lists each message's ` + "`" + `messageId` + "`" + `, new ` + "`" + `message` + "`" + ` and ` + "`" + `additionalInfo` + "`" + `.",
                 "consumes": [
                     "application/json"
                 ],
@@ -645,29 +1094,51 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "messages"
                 ],
-                "summary": "Create a user",
+                "summary": "Partially update several messages",
                 "parameters": [
                     {
-                        "description": "User data",
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updates to apply",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/CreateUserRequest"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/MessageBatchPatchEntry"
+                            }
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Author's user ID, required when MESSAGE_AUTHOR_ONLY is enabled (not verified)",
+                        "name": "userId",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/User"
+                            "$ref": "#/definitions/MessageBatchPatchResponse"
                         }
                     },
                     "400": {
-                        "description": "invalid request body",
+                        "description": "invalid request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
                         "schema": {
                             "type": "string"
                         }
@@ -675,28 +1146,1287 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{userID}": {
+        "/rooms/{roomID}/messages/latest": {
             "get": {
-                "description": "Returns a specific user from the user registry.",
+                "description": "Returns the most recently stored message of a room, e.g. for a room preview, without fetching the whole history. With ` + "`" + `skipDeleted=1` + "`" + ` deleted messages are passed over. Messages sent to an audience are only considered as for ` + "`" + `GET /rooms/{roomID}/messages` + "`" + `.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "messages"
                 ],
-                "summary": "Get a user",
+                "summary": "Get the newest message",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "User UUID",
-                        "name": "userID",
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
                         "in": "path",
                         "required": true
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Pass over deleted messages",
+                        "name": "skipDeleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Show the messages sent to this user's role",
+                        "name": "userId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/OutgoingMessage"
+                        }
+                    },
+                    "204": {
+                        "description": "room has no messages"
+                    },
+                    "400": {
+                        "description": "can't parse room id to uint or invalid userId",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/messages/search": {
+            "get": {
+                "description": "Returns the stored messages whose text contains every word of ` + "`" + `q` + "`" + `. Matching is case-insensitive on whole words; system and deleted messages are never returned. Pagination, audience restrictions and the history byte budget work like ` + "`" + `GET /rooms/{roomID}/messages` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Search messages in a room",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Words that must all appear in a message",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of messages to return (max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of newest matching messages to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Show the messages sent to this user's role",
+                        "name": "userId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/MessagesListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "can't parse room id to uint, missing q, invalid limit, offset or userId",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/messages/{messageID}": {
+            "get": {
+                "description": "Retrieves a specific message from a room by its ID. Messages sent to an audience are only returned as for ` + "`" + `GET /rooms/{roomID}/messages` + "`" + `; for everyone else they don't exist.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Get a specific message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message UUID",
+                        "name": "messageID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Show the messages sent to this user's role",
+                        "name": "userId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/OutgoingMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "can't parse room id, message id or userId",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room or message not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Completely replaces a message. Unlike PATCH, this requires all fields and replaces the entire message content, except for the server-owned additionalInfo keys audience, expiresAt and deliveredTo. The server automatically sets modified: true in additionalInfo and broadcasts a message_updated event.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Replace a message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message UUID",
+                        "name": "messageID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New message content",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/MessagePutRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Author's user ID, required when MESSAGE_AUTHOR_ONLY is enabled (not verified)",
+                        "name": "userId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/OutgoingMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "not the message's author",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room or message not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "additionalInfo too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/ValidationError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Marks a message as deleted. The message is not actually removed but its content is replaced with \"deleted\" and a deleted flag is added to additionalInfo. A message_deleted event is broadcast and a pinned message is unpinned.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Delete a message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message UUID",
+                        "name": "messageID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Author's user ID, required when MESSAGE_AUTHOR_ONLY is enabled (not verified)",
+                        "name": "userId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/OutgoingMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "can't parse room id or message id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "not the message's author",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room or message not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Partially updates a specific message. You can update the message text, additionalInfo, or both. Only provided fields are updated. A provided additionalInfo replaces the existing one, except for the server-owned keys audience, expiresAt and deliveredTo, which are kept. The server automatically sets modified: true in additionalInfo and broadcasts a message_updated event.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Partially update a message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message UUID",
+                        "name": "messageID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to update",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/MessagePatchRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Author's user ID, required when MESSAGE_AUTHOR_ONLY is enabled (not verified)",
+                        "name": "userId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/OutgoingMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "not the message's author",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room or message not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "additionalInfo too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/ValidationError"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/messages/{messageID}/pin": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Appends a stored message to the room's pinned list and broadcasts a ` + "`" + `pins_updated` + "`" + ` event with the full list of pinned message IDs. Pinning an already pinned message changes nothing. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "moderation"
+                ],
+                "summary": "Pin a message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message UUID",
+                        "name": "messageID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "message was already pinned",
+                        "schema": {
+                            "$ref": "#/definitions/PinsResponse"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/PinsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid room or message id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room or message not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "message is deleted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Removes a message from the room's pinned list and broadcasts a ` + "`" + `pins_updated` + "`" + ` event. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "tags": [
+                    "moderation"
+                ],
+                "summary": "Unpin a message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message UUID",
+                        "name": "messageID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "invalid room or message id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found or message not pinned",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/messages/{messageID}/receipts": {
+            "get": {
+                "description": "Returns the IDs of the users that acknowledged the message by sending a ` + "`" + `receipt` + "`" + ` event over the WebSocket. Messages sent to an audience are only found as for ` + "`" + `GET /rooms/{roomID}/messages` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Get delivery receipts of a message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message UUID",
+                        "name": "messageID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Show the messages sent to this user's role",
+                        "name": "userId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/MessageReceiptsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "can't parse room id, message id or userId",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room or message not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/messages/{messageID}/replies": {
+            "get": {
+                "description": "Returns all messages sent with ` + "`" + `parentId` + "`" + ` set to the given message, sorted by timestamp. Replies stay retrievable after the parent was deleted or expired; ` + "`" + `parentDeleted` + "`" + ` is set in that case. Messages sent to an audience, the parent included, are only considered as for ` + "`" + `GET /rooms/{roomID}/messages` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Get thread replies of a message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Parent message UUID",
+                        "name": "messageID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Show the messages sent to this user's role",
+                        "name": "userId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/MessageRepliesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "can't parse room id, message id or userId",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room or message not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/mutes": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns the IDs of all users muted in the room. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "moderation"
+                ],
+                "summary": "List muted users of a room",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/MutesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid room id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Adds the user to the room's mute list. Muted users stay connected and keep receiving messages, but their messages and uploads are neither stored nor broadcast; each attempt gets a private ` + "`" + `system` + "`" + ` error instead. Like bans, mutes match the user ID. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "moderation"
+                ],
+                "summary": "Mute a user in a room",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User to mute",
+                        "name": "mute",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/MuteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "user was already muted",
+                        "schema": {
+                            "$ref": "#/definitions/MutesResponse"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/MutesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid room id or request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/mutes/{userID}": {
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Removes the user from the room's mute list. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "tags": [
+                    "moderation"
+                ],
+                "summary": "Unmute a user in a room",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User UUID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "invalid room or user id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found or user not muted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/pins": {
+            "get": {
+                "description": "Returns the pinned messages of a room in the order they were pinned. Pinned messages that have expired or been evicted from the history are left out, and so are messages sent to an audience the requester isn't part of, as for ` + "`" + `GET /rooms/{roomID}/messages` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "moderation"
+                ],
+                "summary": "List pinned messages",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Show the messages sent to this user's role",
+                        "name": "userId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/PinsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid room id or userId",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/stats": {
+            "get": {
+                "description": "Returns usage figures for a room. storedBytes is the JSON size of the stored message history; once it exceeds maxStoredBytes the oldest messages are evicted. A maxStoredBytes of 0 means the history is unlimited. slowMode is true while the room rejects client messages because it was flooded. droppedMessages counts broadcasts that were dropped for clients whose send buffer was full.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Get room statistics",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/RoomStats"
+                        }
+                    },
+                    "400": {
+                        "description": "can't parse room id to uint",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/users": {
+            "get": {
+                "description": "Returns all users currently connected to a specific room. With ` + "`" + `role` + "`" + ` only users whose ` + "`" + `additionalInfo.role` + "`" + ` equals it are returned; no match yields an empty list.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Get users in a room",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return users with this additionalInfo.role",
+                        "name": "role",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/UsersListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid room id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/users/count": {
+            "get": {
+                "description": "Returns the number of connections in a room without building the user list, for badges and lobby views that poll often.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Count users in a room",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/UserCountResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid room id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/users/detail": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns every connection in the room with its user, remote address, user agent and connection time, for moderation. Users with several connections are listed once per connection. The regular user listings never include this data. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List a room's connections with their origin",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/ConnectionDetailsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "can't parse room id to uint",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomID}/users/{userID}": {
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Disconnects every connection of the user from the room. The room receives a system message that the user was removed; the kicked client receives it as well before its socket is closed. Only available when the server is started with ` + "`" + `ADMIN_TOKEN` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "moderation"
+                ],
+                "summary": "Kick a user from a room",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "roomID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User UUID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/KickResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid room or user id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "room not found or user not connected",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "description": "Returns users registered in the user registry ordered by creation time, one page at a time. ` + "`" + `total` + "`" + ` is the number of users matching the filter, ` + "`" + `hasMore` + "`" + ` tells whether another page exists.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "List all registered users",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of users to return (default 100, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of users to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Case-insensitive substring filter over name, firstName and lastName",
+                        "name": "q",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/UsersPageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid limit or offset",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new user in the user registry. All fields are optional. This allows pre-registering users before they join rooms. ` + "`" + `color` + "`" + ` (hex, e.g. ` + "`" + `#1e90ff` + "`" + `) and ` + "`" + `avatarUrl` + "`" + ` are carried in the user of every message they send.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Create a user",
+                "parameters": [
+                    {
+                        "description": "User data",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateUserRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Repeated requests with the same key return the originally created user",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/User"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid request body, name, color or avatarUrl",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "additionalInfo too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/ValidationError"
+                        }
+                    },
+                    "429": {
+                        "description": "too many requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Deletes all registered users, or with ` + "`" + `olderThan` + "`" + ` (a duration such as ` + "`" + `720h` + "`" + `) only those not seen for that long. Users that never connected count as seen when they were created. Connected clients keep their current user data; only the registry is cleared.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Purge the user registry",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only delete users not seen for this duration, e.g. 720h",
+                        "name": "olderThan",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/UsersPurgeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid olderThan",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/online": {
+            "get": {
+                "description": "Returns every user connected to at least one room exactly once, with the IDs of all rooms they are in. Use ` + "`" + `/rooms/users` + "`" + ` for one entry per room membership.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "List online users",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/OnlineUsersListResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{userID}": {
+            "get": {
+                "description": "Returns a specific user from the user registry.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User UUID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/User"
                         }
@@ -753,7 +2483,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "invalid user id or request body",
+                        "description": "invalid user id, request body, name, color or avatarUrl",
                         "schema": {
                             "type": "string"
                         }
@@ -763,6 +2493,18 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "413": {
+                        "description": "additionalInfo too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/ValidationError"
+                        }
                     }
                 }
             },
@@ -837,7 +2579,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "invalid user id or request body",
+                        "description": "invalid user id, request body, name, color or avatarUrl",
                         "schema": {
                             "type": "string"
                         }
@@ -847,12 +2589,147 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "413": {
+                        "description": "additionalInfo too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/ValidationError"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{userID}/rooms": {
+            "get": {
+                "description": "Returns the rooms the user is currently connected to. The list is empty if the user isn't connected anywhere.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "List a user's rooms",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User UUID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/RoomsListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid user id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "user id not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/version": {
+            "get": {
+                "description": "Exposes metadata about the running binary. Field values are populated at build time; when unavailable, they default to \"unknown\".\nWith ` + "`" + `format=text` + "`" + ` or ` + "`" + `Accept: text/plain` + "`" + ` only the version and commit are returned on one line, e.g. ` + "`" + `v1.0.0 a1b2c3d` + "`" + `. ` + "`" + `/version` + "`" + ` is an alias.",
+                "produces": [
+                    "application/json",
+                    "text/plain"
+                ],
+                "tags": [
+                    "info"
+                ],
+                "summary": "Get build info",
+                "parameters": [
+                    {
+                        "enum": [
+                            "json",
+                            "text"
+                        ],
+                        "type": "string",
+                        "description": "Response format",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/BuildInfo"
+                        }
                     }
                 }
             }
         }
     },
     "definitions": {
+        "AdminRoomsListResponse": {
+            "type": "object",
+            "properties": {
+                "rooms": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/RoomDetail"
+                    }
+                }
+            }
+        },
+        "AnnouncementRequest": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "Server maintenance in 10 minutes"
+                }
+            }
+        },
+        "AnnouncementResponse": {
+            "type": "object",
+            "properties": {
+                "rooms": {
+                    "type": "integer",
+                    "example": 12
+                }
+            }
+        },
+        "BanRequest": {
+            "type": "object",
+            "properties": {
+                "userId": {
+                    "type": "string",
+                    "example": "9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"
+                }
+            }
+        },
+        "BansResponse": {
+            "type": "object",
+            "properties": {
+                "bans": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
         "BuildInfo": {
             "type": "object",
             "properties": {
@@ -870,66 +2747,234 @@ const docTemplate = `{
                 },
                 "repository": {
                     "type": "string",
-                    "example": "https://github.com/choffmann/chat-room"
+                    "example": "https://github.com/choffmann/chat-room"
+                },
+                "version": {
+                    "type": "string",
+                    "example": "v1.0.0"
+                }
+            }
+        },
+        "ConnectionDetail": {
+            "type": "object",
+            "properties": {
+                "connectedAt": {
+                    "type": "string",
+                    "example": "2024-04-09T12:30:00Z"
+                },
+                "remoteAddr": {
+                    "type": "string",
+                    "example": "203.0.113.7:51234"
+                },
+                "user": {
+                    "$ref": "#/definitions/User"
+                },
+                "userAgent": {
+                    "type": "string",
+                    "example": "Mozilla/5.0 (X11; Linux x86_64)"
+                }
+            }
+        },
+        "ConnectionDetailsResponse": {
+            "type": "object",
+            "properties": {
+                "connections": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/ConnectionDetail"
+                    }
+                }
+            }
+        },
+        "CreateRoomRequest": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string",
+                    "example": "General chat room"
+                },
+                "slug": {
+                    "type": "string",
+                    "example": "general"
+                },
+                "theme": {
+                    "type": "string",
+                    "example": "dark"
+                }
+            }
+        },
+        "CreateRoomResponse": {
+            "type": "object",
+            "properties": {
+                "roomID": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "CreateUserRequest": {
+            "type": "object",
+            "properties": {
+                "additionalInfo": {
+                    "$ref": "#/definitions/UserAdditionalInfo"
+                },
+                "avatarUrl": {
+                    "type": "string",
+                    "example": "https://example.com/avatars/johndoe.png"
+                },
+                "color": {
+                    "type": "string",
+                    "example": "#1e90ff"
+                },
+                "firstName": {
+                    "type": "string",
+                    "example": "John"
+                },
+                "lastName": {
+                    "type": "string",
+                    "example": "Doe"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "johndoe"
+                }
+            }
+        },
+        "DeadLetter": {
+            "type": "object",
+            "properties": {
+                "droppedAt": {
+                    "type": "string",
+                    "example": "2024-04-09T12:35:10Z"
+                },
+                "message": {
+                    "$ref": "#/definitions/OutgoingMessage"
+                },
+                "messageId": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"
+                }
+            }
+        },
+        "DeadLettersResponse": {
+            "type": "object",
+            "properties": {
+                "deadLetters": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/DeadLetter"
+                    }
+                }
+            }
+        },
+        "HealthResponse": {
+            "type": "object",
+            "properties": {
+                "clients": {
+                    "type": "integer",
+                    "example": 17
+                },
+                "rooms": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                },
+                "stuckRooms": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        3
+                    ]
+                },
+                "uptime": {
+                    "type": "string",
+                    "example": "3h12m5s"
+                }
+            }
+        },
+        "KickResponse": {
+            "type": "object",
+            "properties": {
+                "connections": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "roomId": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"
+                }
+            }
+        },
+        "MessageAdditionalInfo": {
+            "type": "object",
+            "properties": {
+                "format": {
+                    "type": "string",
+                    "example": "markdown"
                 },
-                "version": {
-                    "type": "string",
-                    "example": "v1.0.0"
+                "modified": {
+                    "type": "boolean",
+                    "example": true
                 }
             }
         },
-        "CreateRoomRequest": {
+        "MessageBatchPatchEntry": {
             "type": "object",
             "properties": {
-                "description": {
+                "additionalInfo": {
+                    "$ref": "#/definitions/MessageAdditionalInfo"
+                },
+                "id": {
                     "type": "string",
-                    "example": "General chat room"
+                    "example": "7c9e6679-7425-40de-944b-e07fc1f90ae7"
                 },
-                "theme": {
+                "message": {
                     "type": "string",
-                    "example": "dark"
+                    "example": "Hello everyone! (edited)"
                 }
             }
         },
-        "CreateRoomResponse": {
+        "MessageBatchPatchResponse": {
             "type": "object",
             "properties": {
-                "roomID": {
-                    "type": "integer",
-                    "example": 1
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/MessageBatchPatchResult"
+                    }
                 }
             }
         },
-        "CreateUserRequest": {
+        "MessageBatchPatchResult": {
             "type": "object",
             "properties": {
-                "additionalInfo": {
-                    "$ref": "#/definitions/UserAdditionalInfo"
-                },
-                "firstName": {
+                "error": {
                     "type": "string",
-                    "example": "John"
+                    "example": "message not found"
                 },
-                "lastName": {
+                "id": {
                     "type": "string",
-                    "example": "Doe"
+                    "example": "7c9e6679-7425-40de-944b-e07fc1f90ae7"
                 },
-                "name": {
-                    "type": "string",
-                    "example": "johndoe"
-                }
-            }
-        },
-        "MessageAdditionalInfo": {
-            "type": "object",
-            "properties": {
-                "format": {
-                    "type": "string",
-                    "example": "markdown"
+                "message": {
+                    "$ref": "#/definitions/OutgoingMessage"
                 },
-                "modified": {
+                "updated": {
                     "type": "boolean",
-                    "example": true
+                    "example": false
                 }
             }
         },
@@ -957,14 +3002,130 @@ const docTemplate = `{
                 }
             }
         },
+        "MessageReceiptsResponse": {
+            "type": "object",
+            "properties": {
+                "deliveredTo": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"
+                    ]
+                },
+                "messageId": {
+                    "type": "string",
+                    "example": "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+                }
+            }
+        },
+        "MessageRepliesResponse": {
+            "type": "object",
+            "properties": {
+                "messages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/OutgoingMessage"
+                    }
+                },
+                "parentDeleted": {
+                    "type": "boolean",
+                    "example": false
+                }
+            }
+        },
+        "MessagesImportResponse": {
+            "type": "object",
+            "properties": {
+                "imported": {
+                    "type": "integer",
+                    "example": 120
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 120
+                }
+            }
+        },
         "MessagesListResponse": {
             "type": "object",
             "properties": {
+                "hasMore": {
+                    "type": "boolean",
+                    "example": true
+                },
                 "messages": {
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/OutgoingMessage"
                     }
+                },
+                "nextOffset": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "notFound": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "1b4e28ba-2fa1-11d2-883f-0016d3cca427"
+                    ]
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 42
+                }
+            }
+        },
+        "MuteRequest": {
+            "type": "object",
+            "properties": {
+                "userId": {
+                    "type": "string",
+                    "example": "9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"
+                }
+            }
+        },
+        "MutesResponse": {
+            "type": "object",
+            "properties": {
+                "mutes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "OnlineUser": {
+            "type": "object",
+            "properties": {
+                "roomIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        1,
+                        3
+                    ]
+                },
+                "user": {
+                    "$ref": "#/definitions/User"
+                }
+            }
+        },
+        "OnlineUsersListResponse": {
+            "type": "object",
+            "properties": {
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/OnlineUser"
+                    }
                 }
             }
         },
@@ -982,6 +3143,14 @@ const docTemplate = `{
                     "type": "string",
                     "example": "Hello everyone!"
                 },
+                "parentId": {
+                    "type": "string",
+                    "example": "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+                },
+                "seq": {
+                    "type": "integer",
+                    "example": 42
+                },
                 "timestamp": {
                     "type": "string",
                     "example": "2024-04-09T12:35:10.123456789Z"
@@ -992,12 +3161,20 @@ const docTemplate = `{
                 },
                 "user": {
                     "$ref": "#/definitions/User"
+                },
+                "v": {
+                    "type": "integer",
+                    "example": 1
                 }
             }
         },
         "PatchRoomRequest": {
             "type": "object",
             "properties": {
+                "slug": {
+                    "type": "string",
+                    "example": "general-chat"
+                },
                 "theme": {
                     "type": "string",
                     "example": "light"
@@ -1010,6 +3187,14 @@ const docTemplate = `{
                 "additionalInfo": {
                     "$ref": "#/definitions/UserAdditionalInfo"
                 },
+                "avatarUrl": {
+                    "type": "string",
+                    "example": "https://example.com/avatars/janesmith.png"
+                },
+                "color": {
+                    "type": "string",
+                    "example": "#ff8c00"
+                },
                 "firstName": {
                     "type": "string",
                     "example": "Jane"
@@ -1020,6 +3205,17 @@ const docTemplate = `{
                 }
             }
         },
+        "PinsResponse": {
+            "type": "object",
+            "properties": {
+                "pins": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/OutgoingMessage"
+                    }
+                }
+            }
+        },
         "PutRoomRequest": {
             "type": "object",
             "properties": {
@@ -1027,6 +3223,10 @@ const docTemplate = `{
                     "type": "string",
                     "example": "Updated chat room"
                 },
+                "slug": {
+                    "type": "string",
+                    "example": "general"
+                },
                 "theme": {
                     "type": "string",
                     "example": "dark"
@@ -1046,6 +3246,51 @@ const docTemplate = `{
                 }
             }
         },
+        "RoomDetail": {
+            "type": "object",
+            "properties": {
+                "additionalInfo": {
+                    "$ref": "#/definitions/RoomAdditionalInfo"
+                },
+                "createdAt": {
+                    "type": "string",
+                    "example": "2024-04-09T12:00:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "lastActivity": {
+                    "type": "string",
+                    "example": "2024-04-09T12:35:10Z"
+                },
+                "messageCount": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "onlineUser": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "RoomLimitResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "room limit reached"
+                },
+                "maxRooms": {
+                    "type": "integer",
+                    "example": 1000
+                },
+                "rooms": {
+                    "type": "integer",
+                    "example": 1000
+                }
+            }
+        },
         "RoomResponse": {
             "type": "object",
             "properties": {
@@ -1062,6 +3307,39 @@ const docTemplate = `{
                 }
             }
         },
+        "RoomStats": {
+            "type": "object",
+            "properties": {
+                "droppedMessages": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "maxStoredBytes": {
+                    "type": "integer",
+                    "example": 16777216
+                },
+                "messageCount": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "onlineUser": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "slowMode": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "storedBytes": {
+                    "type": "integer",
+                    "example": 18432
+                }
+            }
+        },
         "RoomsListResponse": {
             "type": "object",
             "properties": {
@@ -1079,6 +3357,14 @@ const docTemplate = `{
                 "additionalInfo": {
                     "$ref": "#/definitions/UserAdditionalInfo"
                 },
+                "avatarUrl": {
+                    "type": "string",
+                    "example": "https://example.com/avatars/janesmith.png"
+                },
+                "color": {
+                    "type": "string",
+                    "example": "#ff8c00"
+                },
                 "firstName": {
                     "type": "string",
                     "example": "Jane"
@@ -1099,6 +3385,18 @@ const docTemplate = `{
                 "additionalInfo": {
                     "$ref": "#/definitions/UserAdditionalInfo"
                 },
+                "avatarUrl": {
+                    "type": "string",
+                    "example": "https://example.com/avatars/johndoe.png"
+                },
+                "color": {
+                    "type": "string",
+                    "example": "#1e90ff"
+                },
+                "createdAt": {
+                    "type": "string",
+                    "example": "2024-04-09T12:00:00Z"
+                },
                 "firstName": {
                     "type": "string",
                     "example": "John"
@@ -1111,6 +3409,10 @@ const docTemplate = `{
                     "type": "string",
                     "example": "Doe"
                 },
+                "lastSeen": {
+                    "type": "string",
+                    "example": "2024-04-09T12:35:10Z"
+                },
                 "name": {
                     "type": "string",
                     "example": "johndoe"
@@ -1130,6 +3432,15 @@ const docTemplate = `{
                 }
             }
         },
+        "UserCountResponse": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
         "UserWithRoom": {
             "type": "object",
             "properties": {
@@ -1153,6 +3464,34 @@ const docTemplate = `{
                 }
             }
         },
+        "UsersPageResponse": {
+            "type": "object",
+            "properties": {
+                "hasMore": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/User"
+                    }
+                }
+            }
+        },
+        "UsersPurgeResponse": {
+            "type": "object",
+            "properties": {
+                "deleted": {
+                    "type": "integer",
+                    "example": 25
+                }
+            }
+        },
         "UsersWithRoomListResponse": {
             "type": "object",
             "properties": {
@@ -1163,6 +3502,32 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "ValidationError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "additionalInfo does not match schema"
+                },
+                "violations": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "/theme: must be one of [light dark]"
+                    ]
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "AdminToken": {
+            "description": "Admin token configured via ` + "`" + `ADMIN_TOKEN` + "`" + `, sent as ` + "`" + `Bearer \u003ctoken\u003e` + "`" + `.",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
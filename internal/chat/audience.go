@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+// audienceBroadcast is a message only for the clients whose user has role
+// in additionalInfo, plus every connection of the sender.
+type audienceBroadcast struct {
+	msg    []byte
+	role   string
+	sender uuid.UUID
+}
+
+func (b audienceBroadcast) includes(c *Client) bool {
+	return c.user.ID == b.sender || c.user.AdditionalInfo["role"] == b.role
+}
+
+// Audience returns the role msg is restricted to, or "" if everyone in the
+// room may see it.
+func Audience(msg model.OutgoingMessage) string {
+	role, _ := msg.AdditionalInfo["audience"].(string)
+	return role
+}
+
+// CanSee reports whether user may see msg: messages without an audience are
+// for everyone, the others for their author and users with the audience's
+// role.
+func CanSee(user model.User, msg model.OutgoingMessage) bool {
+	role := Audience(msg)
+	return role == "" || msg.User.ID == user.ID || user.AdditionalInfo["role"] == role
+}
+
+// tryBroadcastFor delivers b to the clients that may see msg, following
+// CanSee. It returns false if the room is closing.
+func (r *Room) tryBroadcastFor(msg model.OutgoingMessage, b []byte) bool {
+	if role := Audience(msg); role != "" {
+		return r.TryBroadcastTo(role, msg.User.ID, b)
+	}
+	return r.TryBroadcast(b)
+}
+
+// TryBroadcastTo delivers msg to the clients whose user has role and to the
+// sender's connections. It returns false if the room is closing. Restricted
+// messages are not published to event subscribers.
+func (r *Room) TryBroadcastTo(role string, sender uuid.UUID, msg []byte) bool {
+	select {
+	case r.audience <- audienceBroadcast{msg: msg, role: role, sender: sender}:
+		return true
+	case <-r.shutdown:
+		return false
+	}
+}
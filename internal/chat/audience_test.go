@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestAudienceMessageReachesRoleAndSender(t *testing.T) {
+	room := newTestRoom(t)
+	sender := newTestClient(room, nil, "")
+	agent := newTestClient(room, nil, "")
+	agent.user.AdditionalInfo = model.AdditionalInfo{"role": "agent"}
+	customer := newTestClient(room, nil, "")
+	customer.user.AdditionalInfo = model.AdditionalInfo{"role": "customer"}
+	for _, c := range []*Client{sender, agent, customer} {
+		room.register <- c
+	}
+
+	if ok := sender.handleTextMessage([]byte(`{"message": "staff note", "audience": "agent"}`)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+	if ok := sender.handleTextMessage([]byte(`{"message": "hello everyone"}`)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	for _, tt := range []struct {
+		name     string
+		client   *Client
+		expected []string
+	}{
+		{"sender", sender, []string{"staff note", "hello everyone"}},
+		{"agent", agent, []string{"staff note", "hello everyone"}},
+		{"customer", customer, []string{"hello everyone"}},
+	} {
+		for _, text := range tt.expected {
+			select {
+			case b := <-tt.client.send:
+				var msg model.OutgoingMessage
+				if err := json.Unmarshal(b, &msg); err != nil {
+					t.Fatalf("unmarshal: %v", err)
+				}
+				if msg.Message != text {
+					t.Errorf("%s: expected %q, got %q", tt.name, text, msg.Message)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s: timed out waiting for %q", tt.name, text)
+			}
+		}
+	}
+
+	msgs := room.GetMessages()
+	if len(msgs) != 2 || Audience(msgs[0]) != "agent" || Audience(msgs[1]) != "" {
+		t.Fatalf("expected the staff note to be stored with its audience, got %v", msgs)
+	}
+	if CanSee(customer.user, msgs[0]) || !CanSee(agent.user, msgs[0]) || !CanSee(sender.user, msgs[0]) {
+		t.Error("expected only the sender and agents to see the staff note")
+	}
+}
+
+func TestReplayHistorySkipsOtherAudiences(t *testing.T) {
+	room := newTestRoom(t)
+	sender := newTestClient(room, nil, "")
+	room.StoreMessage(model.OutgoingMessage{MessageType: model.UserMessage, Message: "staff note", User: sender.user, AdditionalInfo: model.AdditionalInfo{"audience": "agent"}})
+	room.StoreMessage(model.OutgoingMessage{MessageType: model.UserMessage, Message: "hello everyone", User: sender.user})
+
+	customer := newTestClient(room, nil, "")
+	customer.SetHistoryReplay(10)
+	room.replayHistory(customer)
+
+	history := customer.takeHistory()
+	if len(history) != 1 {
+		t.Fatalf("expected 1 replayed message, got %d", len(history))
+	}
+	var msg model.OutgoingMessage
+	if err := json.Unmarshal(history[0], &msg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if msg.Message != "hello everyone" {
+		t.Errorf("expected the public message, got %q", msg.Message)
+	}
+}
+
+func TestReceiptsAndDeletionsFollowAudience(t *testing.T) {
+	room := newTestRoom(t)
+	author := model.User{ID: uuid.New(), Name: "author"}
+	agent := newTestClient(room, nil, "")
+	agent.user.AdditionalInfo = model.AdditionalInfo{"role": "agent"}
+	customer := newTestClient(room, nil, "")
+	customer.user.AdditionalInfo = model.AdditionalInfo{"role": "customer"}
+	for _, c := range []*Client{agent, customer} {
+		room.register <- c
+	}
+	staff := room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "staff note", User: author, AdditionalInfo: model.AdditionalInfo{"audience": "agent"}})
+
+	next := func(c *Client) (model.OutgoingMessage, bool) {
+		select {
+		case b := <-c.send:
+			var msg model.OutgoingMessage
+			if err := json.Unmarshal(b, &msg); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			return msg, true
+		case <-time.After(100 * time.Millisecond):
+			return model.OutgoingMessage{}, false
+		}
+	}
+
+	receipt := []byte(fmt.Sprintf(`{"type": "receipt", "messageId": %q}`, staff.ID))
+	customer.handleTextMessage(receipt)
+	if msg, _ := next(customer); msg.AdditionalInfo["error"] != true {
+		t.Errorf("expected the customer's receipt to be rejected, got %+v", msg)
+	}
+	if deliveredTo, _ := room.GetReceipts(staff.ID); len(deliveredTo) != 0 {
+		t.Errorf("expected no receipts, got %v", deliveredTo)
+	}
+
+	agent.handleTextMessage(receipt)
+	if msg, ok := next(agent); !ok || msg.MessageType != model.ReceiptMessage {
+		t.Errorf("expected the agent to get the receipt event, got %+v", msg)
+	}
+	if msg, ok := next(customer); ok {
+		t.Errorf("expected the customer not to get the receipt event, got %+v", msg)
+	}
+
+	room.BroadcastDeletion(staff, "deleted")
+	if msg, ok := next(agent); !ok || msg.MessageType != model.MessageDeleted {
+		t.Errorf("expected the agent to get the deletion event, got %+v", msg)
+	}
+	if msg, ok := next(customer); ok {
+		t.Errorf("expected the customer not to get the deletion event, got %+v", msg)
+	}
+}
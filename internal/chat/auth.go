@@ -0,0 +1,85 @@
+package chat
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	errAuthFailed  = errors.New("authentication failed")
+	errAuthTimeout = errors.New("authentication timeout")
+)
+
+// connAuth is the token a connection must present in its first frame before
+// it takes part in a room.
+type connAuth struct {
+	token   string
+	timeout time.Duration
+}
+
+// readAuthFrame reads the connection's first frame and checks that it is an
+// auth frame carrying the expected token. On failure the connection is sent a
+// CloseAuthFailed close frame; the caller closes it.
+func readAuthFrame(conn *websocket.Conn, auth *connAuth) error {
+	timeout := auth.timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	msgType, data, err := conn.ReadMessage()
+	if err != nil {
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return err
+		}
+		err = errAuthTimeout
+	} else if validAuthFrame(msgType, data, auth.token) {
+		return nil
+	} else {
+		err = errAuthFailed
+	}
+
+	_ = conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(CloseAuthFailed.Code, err.Error()),
+		time.Now().Add(time.Second))
+	return err
+}
+
+func validAuthFrame(msgType int, data []byte, token string) bool {
+	if msgType != websocket.TextMessage {
+		return false
+	}
+	var frame model.IncomingMessage
+	if err := json.Unmarshal(data, &frame); err != nil || frame.MessageType != model.AuthMessage {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(frame.Token), []byte(token)) == 1
+}
+
+// IsAuthError reports whether err from Authenticate means the peer failed
+// the handshake rather than went away.
+func IsAuthError(err error) bool {
+	return errors.Is(err, errAuthFailed) || errors.Is(err, errAuthTimeout)
+}
+
+// Authenticate makes a connection that hasn't joined a room yet present an
+// auth frame carrying token as its first message, within timeout. Clients
+// join their room only afterwards, so an unauthenticated connection is never
+// announced, listed or sent anything. On failure the connection is sent a
+// CloseAuthFailed close frame; the caller closes it.
+func Authenticate(conn *websocket.Conn, token string, timeout time.Duration) error {
+	return readAuthFrame(conn, &connAuth{token: token, timeout: timeout})
+}
+
+// RequireAuth makes the connection authenticate like Authenticate before any
+// of its frames is handled.
+func (m *MultiClient) RequireAuth(token string, timeout time.Duration) {
+	m.auth = &connAuth{token: token, timeout: timeout}
+}
@@ -0,0 +1,38 @@
+package chat
+
+import (
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+// UserResolver looks up the current data of a registered user. It reports
+// false for unknown users, such as ephemeral ones.
+type UserResolver func(id uuid.UUID) (model.User, bool)
+
+// authorResolver returns the resolver used to show stored messages with
+// their author's current user data, or nil if the room keeps the author as
+// it was when the message was sent. Rooms with "immutableAuthors": true in
+// their additionalInfo always keep that snapshot.
+func (r *Room) authorResolver() UserResolver {
+	if r.resolveUser == nil {
+		return nil
+	}
+	r.infoMu.RLock()
+	defer r.infoMu.RUnlock()
+	if r.additionalInfo["immutableAuthors"] == true {
+		return nil
+	}
+	return r.resolveUser
+}
+
+// withCurrentAuthor replaces the author stored with msg by the user's
+// current data. Authors unknown to resolve keep their snapshot.
+func withCurrentAuthor(resolve UserResolver, msg model.OutgoingMessage) model.OutgoingMessage {
+	if resolve == nil {
+		return msg
+	}
+	if u, ok := resolve(msg.User.ID); ok {
+		msg.User = u
+	}
+	return msg
+}
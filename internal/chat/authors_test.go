@@ -0,0 +1,39 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestRoomResolvesCurrentAuthor(t *testing.T) {
+	author := model.User{ID: uuid.New(), Name: "alice"}
+	current := map[uuid.UUID]model.User{author.ID: {ID: author.ID, Name: "alicia"}}
+	room := &Room{logger: testLogger(), resolveUser: func(id uuid.UUID) (model.User, bool) {
+		u, ok := current[id]
+		return u, ok
+	}}
+	stored := room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello", User: author})
+
+	if msg, _ := room.GetMessage(stored.ID); msg.User.Name != "alicia" {
+		t.Errorf("expected GetMessage to show the current name, got %q", msg.User.Name)
+	}
+	if msgs := room.GetMessages(); msgs[0].User.Name != "alicia" {
+		t.Errorf("expected GetMessages to show the current name, got %q", msgs[0].User.Name)
+	}
+	if msgs := room.SearchMessages("hello"); len(msgs) != 1 || msgs[0].User.Name != "alicia" {
+		t.Errorf("expected search results to show the current name, got %v", msgs)
+	}
+
+	room.UpdateAdditionalInfo(model.AdditionalInfo{"immutableAuthors": true})
+	if msg, _ := room.GetMessage(stored.ID); msg.User.Name != "alice" {
+		t.Errorf("expected immutableAuthors to keep the sent name, got %q", msg.User.Name)
+	}
+
+	delete(current, author.ID)
+	room.UpdateAdditionalInfo(nil)
+	if msg, _ := room.GetMessage(stored.ID); msg.User.Name != "alice" {
+		t.Errorf("expected unknown authors to keep the sent name, got %q", msg.User.Name)
+	}
+}
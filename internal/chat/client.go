@@ -1,9 +1,12 @@
 package chat
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -27,69 +30,308 @@ const (
 
 const maxUploadSize = 5 * MiB
 
+// mutedNotice is the private error muted users get for each message they try
+// to send.
+const mutedNotice = "you are muted in this room, your messages are not delivered"
+
+// CloseReason is sent to a client in the WebSocket close frame when the
+// server ends the connection, so clients can tell why they were dropped.
+type CloseReason struct {
+	Code int
+	Text string
+}
+
+// WritePolicy bounds how long WebSocket writes may take. A write that takes
+// longer than Timeout counts as slow; after MaxSlowWrites consecutive slow
+// writes the client is dropped as a stuck writer. A single write is aborted
+// once it has taken Timeout*MaxSlowWrites, since a timed out connection
+// can't be written to again.
+type WritePolicy struct {
+	Timeout       time.Duration
+	MaxSlowWrites int
+}
+
+var DefaultWritePolicy = WritePolicy{
+	Timeout:       10 * time.Second,
+	MaxSlowWrites: 3,
+}
+
+var errStuckWriter = errors.New("too many slow writes")
+
+// withDefaults fills unset fields from DefaultWritePolicy so zero-value
+// rooms built in tests keep the historic 10 second deadline.
+func (p WritePolicy) withDefaults() WritePolicy {
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultWritePolicy.Timeout
+	}
+	if p.MaxSlowWrites <= 0 {
+		p.MaxSlowWrites = 1
+	}
+	return p
+}
+
+// writeTracker writes to a connection and counts consecutive slow writes.
+// It is owned by a single write pump.
+type writeTracker struct {
+	policy     WritePolicy
+	slowWrites int
+}
+
+func newWriteTracker(p WritePolicy) *writeTracker {
+	return &writeTracker{policy: p.withDefaults()}
+}
+
+func (t *writeTracker) write(conn *websocket.Conn, msgType int, data []byte) error {
+	start := time.Now()
+	_ = conn.SetWriteDeadline(start.Add(t.policy.Timeout * time.Duration(t.policy.MaxSlowWrites)))
+	if err := conn.WriteMessage(msgType, data); err != nil {
+		return err
+	}
+
+	if time.Since(start) <= t.policy.Timeout {
+		t.slowWrites = 0
+		return nil
+	}
+	t.slowWrites++
+	if t.slowWrites >= t.policy.MaxSlowWrites {
+		return errStuckWriter
+	}
+	return nil
+}
+
+// isStuck reports whether err means the peer stopped reading.
+func isStuck(err error) bool {
+	if errors.Is(err, errStuckWriter) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+var (
+	CloseRoomClosed   = CloseReason{Code: 4001, Text: "room closed"}
+	CloseKicked       = CloseReason{Code: 4002, Text: "kicked"}
+	CloseSlowConsumer = CloseReason{Code: 4003, Text: "slow consumer"}
+	CloseReplaced     = CloseReason{Code: 4004, Text: "replaced by reconnect"}
+	CloseAuthFailed   = CloseReason{Code: 4005, Text: "authentication failed"}
+	CloseLeft         = CloseReason{Code: websocket.CloseNormalClosure, Text: "left room"}
+)
+
 type Client struct {
-	room          *Room
-	conn          *websocket.Conn
-	user          model.User
-	send          chan []byte
-	closeMu       sync.Mutex
-	closed        bool
-	disconnected  sync.Once
-	systemUser    model.User
-	uploadStore   UploadStore
-	uploadBaseURL string
-	logger        *slog.Logger
+	room           *Room
+	conn           *websocket.Conn
+	user           model.User
+	send           chan []byte
+	closeMu        sync.Mutex
+	closed         bool
+	closedAt       time.Time
+	closeReason    *CloseReason
+	sendFailures   int
+	evicting       bool
+	historySize    int
+	historyMu      sync.Mutex
+	history        [][]byte
+	historyReady   chan struct{}
+	writerDone     chan struct{}
+	announceJoin   bool
+	reconnectToken string
+	resumed        bool
+	onDisconnect   func()
+	onActivity     func()
+	disconnected   sync.Once
+	systemUser     model.User
+	uploadStore    UploadStore
+	uploadBaseURL  string
+	connInfo       ConnInfo
+	logger         *slog.Logger
+}
+
+// ConnInfo describes where a client connected from. It is kept on the
+// connection rather than the user and only shown to admins.
+type ConnInfo struct {
+	RemoteAddr  string    `json:"remoteAddr"`
+	UserAgent   string    `json:"userAgent,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
 }
 
 func NewClient(room *Room, conn *websocket.Conn, user model.User, systemUser model.User, logger *slog.Logger, uploadStore UploadStore, uploadBaseURL string) *Client {
-	return &Client{
+	c := &Client{
 		room:          room,
 		conn:          conn,
 		user:          user,
 		send:          make(chan []byte, 256),
+		historyReady:  make(chan struct{}, 1),
 		systemUser:    systemUser,
 		uploadStore:   uploadStore,
 		uploadBaseURL: uploadBaseURL,
 		logger:        logger,
 	}
+	// Only clients with a connection run a write pump that can be waited for.
+	if conn != nil {
+		c.writerDone = make(chan struct{})
+	}
+	return c
 }
 
 func (c *Client) User() model.User  { return c.user }
 func (c *Client) Send() chan []byte { return c.send }
 func (c *Client) Room() *Room       { return c.room }
 
+// SetHistoryReplay makes the room write the last n stored messages to the
+// client right after it is registered, before any live broadcast. n is capped
+// at the size of the send buffer.
+func (c *Client) SetHistoryReplay(n int) {
+	c.historySize = min(max(n, 0), cap(c.send))
+}
+
+// queueHistory hands the replayed messages to the client's writer instead of
+// the send buffer, so a large replay doesn't leave the buffer full and get the
+// client dropped by the next broadcast.
+func (c *Client) queueHistory(messages [][]byte) {
+	c.historyMu.Lock()
+	c.history = append(c.history, messages...)
+	c.historyMu.Unlock()
+
+	select {
+	case c.historyReady <- struct{}{}:
+	default:
+	}
+}
+
+// takeHistory returns the queued history messages and clears the queue. The
+// writer must call it before writing anything from the send buffer, since
+// the history was queued ahead of any live message.
+func (c *Client) takeHistory() [][]byte {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+	messages := c.history
+	c.history = nil
+	return messages
+}
+
+// SetOnDisconnect registers a callback that runs once when the client leaves
+// its room.
+func (c *Client) SetOnDisconnect(f func()) {
+	c.onDisconnect = f
+}
+
+// SetOnActivity registers a callback that runs whenever the client sends a
+// frame.
+func (c *Client) SetOnActivity(f func()) {
+	c.onActivity = f
+}
+
+// SetConnInfo records where the client connected from.
+func (c *Client) SetConnInfo(info ConnInfo) {
+	c.connInfo = info
+}
+
 func (c *Client) CloseSend() {
 	c.closeMu.Lock()
 	defer c.closeMu.Unlock()
 	if !c.closed {
 		close(c.send)
 		c.closed = true
+		c.closedAt = timeNow()
+	}
+}
+
+// CloseSendWithReason closes the send channel like CloseSend and makes the
+// write pump report reason in the close frame.
+func (c *Client) CloseSendWithReason(reason CloseReason) {
+	c.setCloseReason(reason)
+	c.CloseSend()
+}
+
+// setCloseReason records why the client is being closed. The first reason
+// wins and it can't be changed once the send channel is closed.
+func (c *Client) setCloseReason(reason CloseReason) {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	if !c.closed && c.closeReason == nil {
+		c.closeReason = &reason
 	}
 }
 
+// closeMessage returns the payload of the close frame sent once the send
+// channel is closed. Without a reason it is a normal closure.
+func (c *Client) closeMessage() []byte {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	if c.closeReason == nil {
+		return websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	}
+	return websocket.FormatCloseMessage(c.closeReason.Code, c.closeReason.Text)
+}
+
+// flushExpired reports whether the send channel was closed longer than the
+// room's close grace ago, so messages still queued are no longer worth
+// writing. Without a grace the queue is always flushed.
+func (c *Client) flushExpired() bool {
+	grace := c.room.closeGrace
+	if grace <= 0 {
+		return false
+	}
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	return c.closed && timeNow().Sub(c.closedAt) > grace
+}
+
+// Disconnect removes the client from its room and announces the leave. For
+// clients holding a reconnect token the announcement waits for the room's
+// reconnect grace period.
 func (c *Client) Disconnect() {
-	c.disconnected.Do(func() {
-		displayName := model.GetDisplayName(c.user)
-		timestamp := time.Now()
+	displayName := model.GetDisplayName(c.user)
+	c.leave(fmt.Sprintf("%s left room %d", displayName, c.room.id), nil, true)
+}
 
+// Leave removes the client from its room at its own request. The leave is
+// announced right away and its reconnect token is revoked; the connection
+// is then closed with CloseLeft.
+func (c *Client) Leave() {
+	c.setCloseReason(CloseLeft)
+	displayName := model.GetDisplayName(c.user)
+	c.leave(fmt.Sprintf("%s left room %d", displayName, c.room.id), nil, false)
+}
+
+// Kick removes the client from its room. Instead of the regular leave
+// message, the room is told that the user was removed; the kicked client
+// receives that notice before its connection is closed with CloseKicked.
+func (c *Client) Kick() {
+	c.setCloseReason(CloseKicked)
+	displayName := model.GetDisplayName(c.user)
+	c.leave(fmt.Sprintf("%s was removed from room %d", displayName, c.room.id), model.AdditionalInfo{
+		"kickedUser": c.user,
+	}, false)
+}
+
+func (c *Client) leave(message string, additionalInfo model.AdditionalInfo, resumable bool) {
+	c.disconnected.Do(func() {
 		leaveMsg := model.OutgoingMessage{
-			ID:          uuid.New(),
-			MessageType: model.SystemMessage,
-			Message:     fmt.Sprintf("%s left room %d", displayName, c.room.id),
-			Timestamp:   timestamp,
-			User:        c.systemUser,
+			ID:             uuid.New(),
+			MessageType:    model.SystemMessage,
+			Message:        message,
+			Timestamp:      time.Now(),
+			User:           c.systemUser,
+			AdditionalInfo: additionalInfo,
 		}
 
-		c.room.StoreMessage(leaveMsg)
+		if !c.room.holdLeave(c, leaveMsg, resumable) {
+			leaveMsg = c.room.StoreMessage(leaveMsg)
 
-		b, _ := json.Marshal(leaveMsg)
-		if !c.room.TryBroadcast(b) {
-			c.logger.Debug("failed to broadcast leave message, room may be closing", "roomID", c.room.id)
+			b, _ := json.Marshal(leaveMsg)
+			if !c.room.TryBroadcast(b) {
+				c.logger.Debug("failed to broadcast leave message, room may be closing", "roomID", c.room.id)
+			}
 		}
 
 		if !c.room.TryUnregister(c) {
 			c.logger.Debug("failed to unregister client, room may be closing", "roomID", c.room.id, "userID", c.user.ID)
 		}
+
+		if c.onDisconnect != nil {
+			c.onDisconnect()
+		}
 	})
 }
 
@@ -115,6 +357,10 @@ func (c *Client) ReadPump() {
 			break
 		}
 
+		if c.onActivity != nil {
+			c.onActivity()
+		}
+
 		switch msgType {
 		case websocket.TextMessage:
 			if !c.handleTextMessage(data) {
@@ -135,32 +381,159 @@ func (c *Client) handleTextMessage(data []byte) bool {
 		return true
 	}
 
+	if !model.SupportedVersion(message.Version) {
+		c.sendError(fmt.Sprintf("unsupported message version %d, the server speaks version %d", message.Version, model.ProtocolVersion))
+		return true
+	}
+
 	if message.MessageType == "" {
 		message.MessageType = model.UserMessage
 	}
 
+	if message.MessageType == model.ReceiptMessage {
+		return c.handleReceipt(message)
+	}
+
+	if message.MessageType == model.LeaveMessage {
+		// Keep reading until the write pump has sent the close frame and
+		// the peer closes the connection.
+		c.Leave()
+		return true
+	}
+
+	if c.room.IsMuted(c.user.ID) {
+		c.sendError(mutedNotice)
+		return true
+	}
+
+	if c.room.SlowMode() {
+		c.sendError("room is in slow mode, try again in a few seconds")
+		return true
+	}
+
+	if message.MessageType == model.UserMessage && strings.TrimSpace(message.Message) == "" {
+		c.logger.Warn("empty message from client", "roomID", c.room.id, "userID", c.user.ID)
+		c.sendError("message content cannot be empty")
+		return true
+	}
+
+	if InfoTooLarge(message.AdditionalInfo, c.room.maxInfoBytes) {
+		c.logger.Warn("oversized additionalInfo from client", "roomID", c.room.id, "userID", c.user.ID, "maxInfoBytes", c.room.maxInfoBytes)
+		c.sendError(fmt.Sprintf("additionalInfo exceeds %d bytes", c.room.maxInfoBytes))
+		return true
+	}
+
+	if c.room.validateInfo != nil {
+		if violations := c.room.validateInfo(message.AdditionalInfo); len(violations) > 0 {
+			c.logger.Warn("additionalInfo rejected by schema", "roomID", c.room.id, "userID", c.user.ID, "violations", len(violations))
+			c.sendError("invalid additionalInfo: " + strings.Join(violations, "; "))
+			return true
+		}
+	}
+
+	if message.ParentID != nil {
+		if _, ok := c.room.GetMessage(*message.ParentID); !ok {
+			c.logger.Warn("reply to unknown parent message", "roomID", c.room.id, "userID", c.user.ID, "parentID", *message.ParentID)
+			c.sendError("parent message not found")
+			return true
+		}
+	}
+
 	timestamp := time.Now()
 
+	if message.ExpiresIn != 0 {
+		ttl := time.Duration(message.ExpiresIn) * time.Second
+		if message.ExpiresIn < 0 || ttl > MaxMessageTTL {
+			c.logger.Warn("invalid message expiry", "roomID", c.room.id, "userID", c.user.ID, "expiresIn", message.ExpiresIn)
+			c.sendError("invalid expiresIn")
+			return true
+		}
+		if message.AdditionalInfo == nil {
+			message.AdditionalInfo = make(model.AdditionalInfo)
+		}
+		message.AdditionalInfo["expiresAt"] = timestamp.Add(ttl)
+	}
+
+	if message.Audience != "" {
+		if message.AdditionalInfo == nil {
+			message.AdditionalInfo = make(model.AdditionalInfo)
+		}
+		message.AdditionalInfo["audience"] = message.Audience
+	}
+
+	if model.ShouldStoreMessage(message.MessageType) {
+		if wait := c.room.messageCooldown(c.user, timestamp); wait > 0 {
+			c.sendError(cooldownNotice(wait))
+			return true
+		}
+	}
+
 	payload := model.OutgoingMessage{
 		ID:             uuid.New(),
 		MessageType:    message.MessageType,
-		Message:        message.Message,
+		Message:        c.room.filterMessage(message.Message),
 		Timestamp:      timestamp,
 		User:           c.user,
+		ParentID:       message.ParentID,
 		AdditionalInfo: message.AdditionalInfo,
 	}
 
 	b, _ := json.Marshal(payload)
-	if !c.room.TryBroadcast(b) {
+	// Stored messages are broadcast with their sequence number.
+	if model.ShouldStoreMessage(message.MessageType) && len(b) < 2*MiB && len(b) > 0 {
+		payload = c.room.StoreMessage(payload)
+		b, _ = json.Marshal(payload)
+	}
+
+	var sent bool
+	if message.Audience != "" {
+		sent = c.room.TryBroadcastTo(message.Audience, c.user.ID, b)
+	} else {
+		sent = c.room.TryBroadcast(b)
+	}
+	if !sent {
 		c.logger.Warn("failed to broadcast message, room may be closing", "roomID", c.room.id, "userID", c.user.ID)
 		return false
 	}
 
-	if model.ShouldStoreMessage(message.MessageType) && len(b) < 2*MiB && len(b) > 0 {
-		c.room.StoreMessage(payload)
+	c.logger.Info("new message received", "roomID", c.room.id, "userID", c.user.ID, "messageID", payload.ID, "messageType", payload.MessageType)
+	return true
+}
+
+// handleReceipt records that the client received a stored message and tells
+// the clients that may see the message who has acknowledged it so far.
+// Receipts themselves aren't stored.
+func (c *Client) handleReceipt(message model.IncomingMessage) bool {
+	if message.MessageID == nil {
+		c.sendError("receipt requires messageId")
+		return true
 	}
 
-	c.logger.Info("new message received", "roomID", c.room.id, "userID", c.user.ID, "messageID", payload.ID, "messageType", payload.MessageType)
+	acknowledged, added, ok := c.room.MarkDelivered(*message.MessageID, c.user)
+	if !ok {
+		c.logger.Warn("receipt for unknown message", "roomID", c.room.id, "userID", c.user.ID, "messageID", *message.MessageID)
+		c.sendError("message not found")
+		return true
+	}
+	if !added {
+		return true
+	}
+
+	update := model.OutgoingMessage{
+		ID:          uuid.New(),
+		MessageType: model.ReceiptMessage,
+		Timestamp:   time.Now(),
+		User:        c.user,
+		AdditionalInfo: model.AdditionalInfo{
+			"messageId":   *message.MessageID,
+			"deliveredTo": deliveredToOf(acknowledged),
+		},
+	}
+	b, _ := json.Marshal(update)
+	if !c.room.tryBroadcastFor(acknowledged, b) {
+		c.logger.Warn("failed to broadcast receipt, room may be closing", "roomID", c.room.id, "userID", c.user.ID)
+		return false
+	}
 	return true
 }
 
@@ -201,17 +574,38 @@ func (c *Client) handleBinaryMessage(data []byte) bool {
 		return true
 	}
 
-	relPath, err := c.uploadStore.Save(c.room.id, data)
-	if err != nil {
-		c.logger.Error("failed to save upload", "roomID", c.room.id, "userID", c.user.ID, "error", err)
-		c.sendError("failed to save upload")
+	if c.room.IsMuted(c.user.ID) {
+		c.sendError(mutedNotice)
 		return true
 	}
 
+	// The type is sniffed from the magic bytes, whatever the client claims.
 	contentType := http.DetectContentType(data)
 	msgType := model.MessageType("file")
 	if strings.HasPrefix(contentType, "image/") {
 		msgType = model.ImageMessage
+		if limit := c.room.maxImageBytes; limit > 0 && len(data) > limit {
+			c.logger.Warn("image too large", "roomID", c.room.id, "userID", c.user.ID, "size", len(data), "max", limit)
+			c.sendError(fmt.Sprintf("image too large: %d bytes exceeds limit of %d bytes", len(data), limit))
+			return true
+		}
+	}
+
+	if c.room.SlowMode() {
+		c.sendError("room is in slow mode, try again in a few seconds")
+		return true
+	}
+
+	if wait := c.room.messageCooldown(c.user, time.Now()); wait > 0 {
+		c.sendError(cooldownNotice(wait))
+		return true
+	}
+
+	relPath, err := c.uploadStore.Save(c.room.id, data)
+	if err != nil {
+		c.logger.Error("failed to save upload", "roomID", c.room.id, "userID", c.user.ID, "error", err)
+		c.sendError("failed to save upload")
+		return true
 	}
 
 	fileURL := c.uploadBaseURL + "/" + relPath
@@ -229,44 +623,110 @@ func (c *Client) handleBinaryMessage(data []byte) bool {
 		},
 	}
 
+	payload = c.room.StoreMessage(payload)
 	b, _ := json.Marshal(payload)
 	if !c.room.TryBroadcast(b) {
 		c.logger.Warn("failed to broadcast upload notification, room may be closing", "roomID", c.room.id, "userID", c.user.ID)
 		return false
 	}
 
-	c.room.StoreMessage(payload)
 	c.logger.Info("binary upload received", "roomID", c.room.id, "userID", c.user.ID, "messageID", payload.ID, "url", fileURL, "contentType", contentType, "size", len(data))
 	return true
 }
 
+// WritePump writes the client's messages to the connection. Once the send
+// channel is closed, it still writes whatever was queued before it, then the
+// close frame. Messages left over when the room's close grace runs out are
+// discarded so the close frame isn't held up indefinitely.
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer func() {
 		ticker.Stop()
 		c.Disconnect()
 		c.conn.Close()
+		if c.writerDone != nil {
+			close(c.writerDone)
+		}
 	}()
 
+	writer := newWriteTracker(c.room.writePolicy)
+	writeHistory := func() bool {
+		for _, msg := range c.takeHistory() {
+			if err := writer.write(c.conn, websocket.TextMessage, msg); err != nil {
+				c.logWriteFailure("failed to write history message", err)
+				return false
+			}
+		}
+		return true
+	}
 	for {
 		select {
 		case msg, ok := <-c.send:
-			_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				if writeHistory() {
+					_ = writer.write(c.conn, websocket.CloseMessage, c.closeMessage())
+				}
+				return
+			}
+			if c.flushExpired() {
+				c.discardQueued()
+				_ = writer.write(c.conn, websocket.CloseMessage, c.closeMessage())
+				return
+			}
+			if !writeHistory() {
 				return
 			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-				c.logger.Warn("failed to write websocket message", "roomID", c.room.id, "userID", c.user.ID, "error", err)
+			if err := writer.write(c.conn, websocket.TextMessage, msg); err != nil {
+				c.logWriteFailure("failed to write websocket message", err)
+				return
+			}
+
+		case <-c.historyReady:
+			if !writeHistory() {
 				return
 			}
 
 		case <-ticker.C:
-			_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				c.logger.Warn("failed to send websocket ping", "roomID", c.room.id, "userID", c.user.ID, "error", err)
+			if err := writer.write(c.conn, websocket.PingMessage, nil); err != nil {
+				c.logWriteFailure("failed to send websocket ping", err)
 				return
 			}
 		}
 	}
 }
+
+// discardQueued empties the closed send channel after the close grace ran
+// out. The message the write pump already took from it counts as well.
+func (c *Client) discardQueued() {
+	discarded := 1
+	for range c.send {
+		discarded++
+	}
+	c.logger.Warn("close grace expired, discarding queued messages", "roomID", c.room.id, "userID", c.user.ID, "discarded", discarded)
+}
+
+// waitWritten waits until the write pump has written the client's remaining
+// messages and exited. When ctx ends first, the connection is closed so the
+// pump gives up. Clients without a write pump return right away.
+func (c *Client) waitWritten(ctx context.Context) {
+	if c.writerDone == nil {
+		return
+	}
+	select {
+	case <-c.writerDone:
+	case <-ctx.Done():
+		c.conn.Close()
+	}
+}
+
+func (c *Client) logWriteFailure(msg string, err error) {
+	if isStuck(err) {
+		c.logger.Warn("dropping stuck websocket writer", "roomID", c.room.id, "userID", c.user.ID, "userName", c.user.Name, "error", err)
+		if errors.Is(err, errStuckWriter) {
+			// The connection still works, so the client can learn why.
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(CloseSlowConsumer.Code, CloseSlowConsumer.Text), time.Now().Add(time.Second))
+		}
+		return
+	}
+	c.logger.Warn(msg, "roomID", c.room.id, "userID", c.user.ID, "error", err)
+}
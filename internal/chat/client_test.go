@@ -10,6 +10,7 @@ import (
 
 	"github.com/choffmann/chat-room/internal/model"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 )
 
 type mockUploadStore struct {
@@ -32,7 +33,7 @@ func (m *mockUploadStore) Save(roomID uint, data []byte) (string, error) {
 func newTestRoom(t *testing.T) *Room {
 	t.Helper()
 	hub := NewHub(testLogger())
-	room := hub.CreateRoom(nil)
+	room, _ := hub.CreateRoom(nil)
 	t.Cleanup(func() {
 		room.shutdownOnce.Do(func() { close(room.shutdown) })
 		<-room.closed
@@ -343,6 +344,42 @@ func TestHandleBinaryMessage_TooLarge(t *testing.T) {
 	}
 }
 
+func TestHandleBinaryMessage_ImageTooLarge(t *testing.T) {
+	room := newTestRoom(t)
+	room.maxImageBytes = 16
+	store := &mockUploadStore{relPath: "1/abc.png"}
+	client := newTestClient(room, store, "http://localhost/uploads")
+
+	pngHeader := []byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A}
+	image := append(pngHeader, make([]byte, 9)...)
+	if ok := client.handleBinaryMessage(image); !ok {
+		t.Fatal("expected true")
+	}
+
+	select {
+	case msg := <-client.send:
+		var out model.OutgoingMessage
+		json.Unmarshal(msg, &out)
+		if out.Message != "image too large: 17 bytes exceeds limit of 16 bytes" {
+			t.Errorf("expected image size error, got %q", out.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out")
+	}
+	if store.savedData != nil {
+		t.Error("store.Save should not have been called")
+	}
+
+	// Other files of the same size aren't images and only face the upload
+	// limit.
+	if ok := client.handleBinaryMessage(make([]byte, 17)); !ok {
+		t.Fatal("expected true")
+	}
+	if store.savedData == nil {
+		t.Error("expected non-image upload to be saved")
+	}
+}
+
 func TestHandleBinaryMessage_EmptyData(t *testing.T) {
 	room := newTestRoom(t)
 	store := &mockUploadStore{relPath: "1/empty.bin"}
@@ -465,3 +502,486 @@ func TestHandleBinaryMessage_ExactMaxSize(t *testing.T) {
 		t.Fatal("timed out")
 	}
 }
+
+func TestHandleTextMessage_ReplyToUnknownParent(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+
+	data := []byte(fmt.Sprintf(`{"message": "reply", "parentId": %q}`, uuid.New()))
+	if ok := client.handleTextMessage(data); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	select {
+	case msg := <-client.send:
+		var out model.OutgoingMessage
+		if err := json.Unmarshal(msg, &out); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if !strings.Contains(out.Message, "parent message not found") {
+			t.Errorf("expected parent error, got %q", out.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error message")
+	}
+
+	if msgs := room.GetMessages(); len(msgs) != 0 {
+		t.Errorf("expected reply to be rejected, got %d stored messages", len(msgs))
+	}
+}
+
+func TestHandleTextMessage_UnsupportedVersion(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+
+	if ok := client.handleTextMessage([]byte(`{"v": 2, "message": "from the future"}`)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	select {
+	case msg := <-client.send:
+		var out model.OutgoingMessage
+		if err := json.Unmarshal(msg, &out); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if !strings.Contains(out.Message, "unsupported message version 2") || out.AdditionalInfo["error"] != true {
+			t.Errorf("expected version error, got %q", out.Message)
+		}
+		if out.Version != model.ProtocolVersion {
+			t.Errorf("expected error to carry version %d, got %d", model.ProtocolVersion, out.Version)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error message")
+	}
+
+	if msgs := room.GetMessages(); len(msgs) != 0 {
+		t.Errorf("expected message to be rejected, got %d stored messages", len(msgs))
+	}
+}
+
+func TestHandleTextMessage_Muted(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+	room.Mute(client.user.ID)
+
+	if ok := client.handleTextMessage([]byte(`{"message": "let me talk"}`)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	select {
+	case msg := <-client.send:
+		var out model.OutgoingMessage
+		if err := json.Unmarshal(msg, &out); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if out.Message != mutedNotice || out.AdditionalInfo["error"] != true {
+			t.Errorf("expected muted error, got %q", out.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error message")
+	}
+	if msgs := room.GetMessages(); len(msgs) != 0 {
+		t.Errorf("expected message to be rejected, got %d stored messages", len(msgs))
+	}
+
+	room.Unmute(client.user.ID)
+	if ok := client.handleTextMessage([]byte(`{"message": "thanks"}`)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+	if msgs := room.GetMessages(); len(msgs) != 1 {
+		t.Errorf("expected message after unmute to be stored, got %d stored messages", len(msgs))
+	}
+}
+
+func TestHandleTextMessage_EmptyMessage(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+
+	for _, data := range []string{`{"message": ""}`, `{"type": "message", "message": "  \n\t"}`} {
+		if ok := client.handleTextMessage([]byte(data)); !ok {
+			t.Fatal("expected handleTextMessage to return true")
+		}
+
+		select {
+		case msg := <-client.send:
+			var out model.OutgoingMessage
+			if err := json.Unmarshal(msg, &out); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if out.Message != "message content cannot be empty" || out.AdditionalInfo["error"] != true {
+				t.Errorf("expected empty message error, got %q", out.Message)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for error message")
+		}
+	}
+
+	if msgs := room.GetMessages(); len(msgs) != 0 {
+		t.Errorf("expected empty messages to be rejected, got %d stored messages", len(msgs))
+	}
+
+	// Custom types may carry their payload in additionalInfo only.
+	if ok := client.handleTextMessage([]byte(`{"type": "reaction", "additionalInfo": {"emoji": "+1"}}`)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+	select {
+	case msg := <-client.send:
+		t.Errorf("expected no error for custom type, got %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHandleTextMessage_InvalidAdditionalInfo(t *testing.T) {
+	room := newTestRoom(t)
+	room.validateInfo = func(info model.AdditionalInfo) []string {
+		if info["theme"] != "dark" {
+			return []string{"/theme: must be one of [dark]"}
+		}
+		return nil
+	}
+	client := newTestClient(room, nil, "")
+
+	if ok := client.handleTextMessage([]byte(`{"message": "hi", "additionalInfo": {"theme": "blue"}}`)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	select {
+	case msg := <-client.send:
+		var out model.OutgoingMessage
+		if err := json.Unmarshal(msg, &out); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if !strings.Contains(out.Message, "invalid additionalInfo: /theme") {
+			t.Errorf("expected validation error, got %q", out.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error message")
+	}
+
+	if msgs := room.GetMessages(); len(msgs) != 0 {
+		t.Errorf("expected message to be rejected, got %d stored messages", len(msgs))
+	}
+}
+
+func TestHandleTextMessage_Reply(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	time.Sleep(50 * time.Millisecond)
+
+	parent := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "parent", Timestamp: time.Now()}
+	room.StoreMessage(parent)
+
+	data := []byte(fmt.Sprintf(`{"message": "reply", "parentId": %q}`, parent.ID))
+	if ok := client.handleTextMessage(data); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	replies, parentDeleted, ok := room.GetReplies(parent.ID)
+	if !ok {
+		t.Fatal("expected replies to be found")
+	}
+	if parentDeleted {
+		t.Error("expected parentDeleted to be false")
+	}
+	if len(replies) != 1 || replies[0].Message != "reply" {
+		t.Fatalf("expected one reply, got %+v", replies)
+	}
+	if replies[0].ParentID == nil || *replies[0].ParentID != parent.ID {
+		t.Errorf("expected parentId %s, got %v", parent.ID, replies[0].ParentID)
+	}
+}
+
+func TestHandleTextMessage_ExpiresIn(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+
+	before := time.Now()
+	if ok := client.handleTextMessage([]byte(`{"message": "secret", "expiresIn": 60}`)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	msgs := room.GetMessages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 stored message, got %d", len(msgs))
+	}
+	expiresAt, ok := msgs[0].AdditionalInfo["expiresAt"].(time.Time)
+	if !ok {
+		t.Fatalf("expected expiresAt in additionalInfo, got %v", msgs[0].AdditionalInfo)
+	}
+	if expiresAt.Before(before.Add(60*time.Second)) || expiresAt.After(time.Now().Add(60*time.Second)) {
+		t.Errorf("unexpected expiresAt %v", expiresAt)
+	}
+}
+
+func TestHandleTextMessage_InvalidExpiresIn(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+
+	if ok := client.handleTextMessage([]byte(`{"message": "secret", "expiresIn": -5}`)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	select {
+	case msg := <-client.send:
+		if !strings.Contains(string(msg), "invalid expiresIn") {
+			t.Errorf("expected expiry error, got %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error message")
+	}
+
+	if msgs := room.GetMessages(); len(msgs) != 0 {
+		t.Errorf("expected message to be rejected, got %d stored messages", len(msgs))
+	}
+}
+
+func TestClientCloseMessage(t *testing.T) {
+	client := &Client{send: make(chan []byte, 1)}
+	if msg := client.closeMessage(); string(msg) != string(websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")) {
+		t.Errorf("expected normal closure without reason, got %q", msg)
+	}
+
+	client.CloseSendWithReason(CloseSlowConsumer)
+	client.CloseSendWithReason(CloseRoomClosed)
+
+	expected := websocket.FormatCloseMessage(CloseSlowConsumer.Code, CloseSlowConsumer.Text)
+	if msg := client.closeMessage(); string(msg) != string(expected) {
+		t.Errorf("expected first close reason to win, got %q", msg)
+	}
+}
+
+func TestClientFlushExpired(t *testing.T) {
+	now := time.Now()
+	origTimeNow := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = origTimeNow }()
+
+	room := &Room{closeGrace: time.Second}
+	client := &Client{room: room, send: make(chan []byte, 1)}
+	if client.flushExpired() {
+		t.Error("expected an open client to keep flushing")
+	}
+
+	client.CloseSend()
+	timeNow = func() time.Time { return now.Add(time.Second) }
+	if client.flushExpired() {
+		t.Error("expected flushing within the close grace")
+	}
+	timeNow = func() time.Time { return now.Add(2 * time.Second) }
+	if !client.flushExpired() {
+		t.Error("expected the close grace to expire")
+	}
+
+	room.closeGrace = 0
+	if client.flushExpired() {
+		t.Error("expected no limit without a close grace")
+	}
+}
+
+func TestClientKickSetsCloseReason(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	time.Sleep(50 * time.Millisecond)
+
+	client.Kick()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-client.send:
+			if ok {
+				continue
+			}
+			expected := websocket.FormatCloseMessage(CloseKicked.Code, CloseKicked.Text)
+			if msg := client.closeMessage(); string(msg) != string(expected) {
+				t.Errorf("expected kicked close frame, got %q", msg)
+			}
+			return
+		case <-timeout:
+			t.Fatal("kicked client's send channel was not closed")
+		}
+	}
+}
+
+func TestHandleTextMessage_Receipt(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	time.Sleep(50 * time.Millisecond)
+
+	target := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello", Timestamp: time.Now()}
+	room.StoreMessage(target)
+
+	data := []byte(fmt.Sprintf(`{"type": "receipt", "messageId": %q}`, target.ID))
+	for range 2 {
+		if ok := client.handleTextMessage(data); !ok {
+			t.Fatal("expected handleTextMessage to return true")
+		}
+	}
+
+	select {
+	case msg := <-client.send:
+		var out model.OutgoingMessage
+		if err := json.Unmarshal(msg, &out); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if out.MessageType != model.ReceiptMessage {
+			t.Fatalf("expected receipt event, got %q", out.MessageType)
+		}
+		if out.AdditionalInfo["messageId"] != target.ID.String() {
+			t.Errorf("expected messageId %s, got %v", target.ID, out.AdditionalInfo["messageId"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for receipt event")
+	}
+
+	select {
+	case msg := <-client.send:
+		t.Errorf("expected duplicate receipt not to be broadcast, got %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	deliveredTo, ok := room.GetReceipts(target.ID)
+	if !ok || len(deliveredTo) != 1 || deliveredTo[0] != client.user.ID {
+		t.Errorf("expected receipt from %s, got %v", client.user.ID, deliveredTo)
+	}
+	if count := room.GetMessageCount(); count != 1 {
+		t.Errorf("expected receipt events not to be stored, got %d messages", count)
+	}
+}
+
+func TestHandleTextMessage_ReceiptUnknownMessage(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+
+	data := []byte(fmt.Sprintf(`{"type": "receipt", "messageId": %q}`, uuid.New()))
+	if ok := client.handleTextMessage(data); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	select {
+	case msg := <-client.send:
+		if !strings.Contains(string(msg), "message not found") {
+			t.Errorf("expected not found error, got %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error message")
+	}
+}
+
+func TestWritePolicyDefaults(t *testing.T) {
+	p := WritePolicy{}.withDefaults()
+	if p.Timeout != DefaultWritePolicy.Timeout || p.MaxSlowWrites != 1 {
+		t.Errorf("unexpected defaults: %+v", p)
+	}
+
+	hub := NewHub(testLogger())
+	hub.SetWritePolicy(WritePolicy{Timeout: time.Second, MaxSlowWrites: 5})
+	room := newHubRoom(t, hub)
+	if room.writePolicy != hub.WritePolicy() {
+		t.Errorf("expected room to inherit %+v, got %+v", hub.WritePolicy(), room.writePolicy)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsStuck(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errStuckWriter, true},
+		{fmt.Errorf("write: %w", timeoutError{}), true},
+		{errors.New("broken pipe"), false},
+	}
+	for _, tt := range tests {
+		if got := isStuck(tt.err); got != tt.want {
+			t.Errorf("isStuck(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestHandleTextMessage_OversizedInfo(t *testing.T) {
+	room := newTestRoom(t)
+	room.maxInfoBytes = 32
+	client := newTestClient(room, nil, "")
+
+	data := fmt.Sprintf(`{"message": "hi", "additionalInfo": {"blob": %q}}`, strings.Repeat("x", 64))
+	if ok := client.handleTextMessage([]byte(data)); !ok {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+
+	select {
+	case msg := <-client.send:
+		var out model.OutgoingMessage
+		if err := json.Unmarshal(msg, &out); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if out.Message != "additionalInfo exceeds 32 bytes" || out.AdditionalInfo["error"] != true {
+			t.Errorf("expected size error, got %q", out.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error message")
+	}
+	if msgs := room.GetMessages(); len(msgs) != 0 {
+		t.Errorf("expected oversized message to be rejected, got %d stored messages", len(msgs))
+	}
+}
+
+func TestHandleTextMessage_Filter(t *testing.T) {
+	room := newTestRoom(t)
+	room.filter = func(text string) string { return strings.ReplaceAll(text, "darn", "****") }
+	client := newTestClient(room, nil, "")
+
+	client.handleTextMessage([]byte(`{"message": "darn it"}`))
+	room.PatchAdditionalInfo(model.AdditionalInfo{"filterMessages": false})
+	client.handleTextMessage([]byte(`{"message": "darn again"}`))
+
+	got := messageTexts(room.GetMessages())
+	if len(got) != 2 || got[0] != "**** it" || got[1] != "darn again" {
+		t.Fatalf("expected only the first message to be filtered, got %v", got)
+	}
+}
+
+func TestHandleTextMessage_Leave(t *testing.T) {
+	room := newTestRoom(t)
+	leaving := newTestClient(room, nil, "")
+	staying := newTestClient(room, nil, "")
+	room.register <- leaving
+	room.register <- staying
+	time.Sleep(50 * time.Millisecond)
+
+	if ok := leaving.handleTextMessage([]byte(`{"type": "leave"}`)); !ok {
+		t.Fatal("expected the read loop to keep running until the peer closes")
+	}
+
+	select {
+	case msg := <-staying.send:
+		var out model.OutgoingMessage
+		if err := json.Unmarshal(msg, &out); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if out.MessageType != model.SystemMessage || !strings.Contains(out.Message, "left room") {
+			t.Errorf("expected leave announcement, got %+v", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for leave announcement")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := room.GetClientCount(); n != 1 {
+		t.Errorf("expected one client left in the room, got %d", n)
+	}
+	if !leaving.closed {
+		t.Error("expected the leaving client's send channel to be closed")
+	}
+	if got := string(leaving.closeMessage()); got != string(websocket.FormatCloseMessage(websocket.CloseNormalClosure, "left room")) {
+		t.Errorf("unexpected close message %q", got)
+	}
+}
@@ -0,0 +1,59 @@
+package chat
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+// exemptRoles are the user additionalInfo roles that aren't subject to a
+// room's slow mode.
+var exemptRoles = []string{"owner", "moderator"}
+
+// SlowModeInterval returns the minimum time between two messages of the
+// same user set with additionalInfo.slowModeSeconds, or 0 if it isn't set.
+func (r *Room) SlowModeInterval() time.Duration {
+	r.infoMu.RLock()
+	defer r.infoMu.RUnlock()
+
+	seconds, ok := r.additionalInfo["slowModeSeconds"].(float64)
+	if !ok || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// messageCooldown reports how long user has to wait before sending another
+// message. If it doesn't have to wait, now is recorded as its last message.
+func (r *Room) messageCooldown(user model.User, now time.Time) time.Duration {
+	interval := r.SlowModeInterval()
+	if interval == 0 {
+		return 0
+	}
+	if role, ok := user.AdditionalInfo["role"].(string); ok {
+		for _, exempt := range exemptRoles {
+			if role == exempt {
+				return 0
+			}
+		}
+	}
+
+	r.cooldownMu.Lock()
+	defer r.cooldownMu.Unlock()
+	if wait := r.lastMessageAt[user.ID].Add(interval).Sub(now); wait > 0 {
+		return wait
+	}
+	if r.lastMessageAt == nil {
+		r.lastMessageAt = make(map[uuid.UUID]time.Time)
+	}
+	r.lastMessageAt[user.ID] = now
+	return 0
+}
+
+// cooldownNotice tells a user how many whole seconds to wait.
+func cooldownNotice(wait time.Duration) string {
+	return fmt.Sprintf("slow mode is on, wait %ds before sending another message", int(math.Ceil(wait.Seconds())))
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestRoomMessageCooldown(t *testing.T) {
+	room := &Room{additionalInfo: model.AdditionalInfo{"slowModeSeconds": float64(10)}}
+	user := model.User{ID: uuid.New()}
+	other := model.User{ID: uuid.New()}
+	moderator := model.User{ID: uuid.New(), AdditionalInfo: model.AdditionalInfo{"role": "moderator"}}
+	now := time.Now()
+
+	if wait := room.messageCooldown(user, now); wait != 0 {
+		t.Fatalf("expected the first message to pass, got wait %v", wait)
+	}
+	if wait := room.messageCooldown(user, now.Add(4*time.Second)); wait != 6*time.Second {
+		t.Fatalf("expected a 6s wait, got %v", wait)
+	}
+	if wait := room.messageCooldown(other, now.Add(4*time.Second)); wait != 0 {
+		t.Fatalf("expected other users to be unaffected, got wait %v", wait)
+	}
+	for range 3 {
+		if wait := room.messageCooldown(moderator, now); wait != 0 {
+			t.Fatalf("expected moderators to be exempt, got wait %v", wait)
+		}
+	}
+	if wait := room.messageCooldown(user, now.Add(10*time.Second)); wait != 0 {
+		t.Fatalf("expected the message to pass after the interval, got wait %v", wait)
+	}
+
+	room.UpdateAdditionalInfo(nil)
+	if wait := room.messageCooldown(user, now.Add(11*time.Second)); wait != 0 {
+		t.Fatalf("expected no cooldown without slowModeSeconds, got wait %v", wait)
+	}
+}
+
+func TestHandleTextMessage_Cooldown(t *testing.T) {
+	room := newTestRoom(t)
+	room.PatchAdditionalInfo(model.AdditionalInfo{"slowModeSeconds": float64(30)})
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	time.Sleep(50 * time.Millisecond)
+
+	client.handleTextMessage([]byte(`{"message":"first"}`))
+	client.handleTextMessage([]byte(`{"message":"second"}`))
+	time.Sleep(50 * time.Millisecond)
+
+	var notices []string
+	for len(client.send) > 0 {
+		var out model.OutgoingMessage
+		if err := json.Unmarshal(<-client.send, &out); err != nil {
+			t.Fatalf("failed to unmarshal message: %v", err)
+		}
+		if out.AdditionalInfo["error"] == true {
+			notices = append(notices, out.Message)
+		}
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], "wait 30s") {
+		t.Fatalf("expected one cooldown notice, got %v", notices)
+	}
+	if got := messageTexts(room.GetMessages()); len(got) != 1 || got[0] != "first" {
+		t.Fatalf("expected only the first message to be stored, got %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+// deadLetterCapacity is how many dropped deliveries a room keeps for
+// inspection. Older ones are discarded first.
+const deadLetterCapacity = 100
+
+// DeadLetter is a broadcast that was dropped for a client because its send
+// buffer was full. Message holds the frame as it would have been sent; it is
+// left out in rooms that encrypt their messages.
+type DeadLetter struct {
+	MessageID uuid.UUID       `json:"messageId"`
+	UserID    uuid.UUID       `json:"userId"`
+	DroppedAt time.Time       `json:"droppedAt"`
+	Message   json.RawMessage `json:"message,omitempty"`
+}
+
+// MarshalJSON writes the dead letter with droppedAt in the configured
+// timestamp layout.
+func (d DeadLetter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		MessageID uuid.UUID       `json:"messageId"`
+		UserID    uuid.UUID       `json:"userId"`
+		DroppedAt string          `json:"droppedAt"`
+		Message   json.RawMessage `json:"message,omitempty"`
+	}{
+		MessageID: d.MessageID,
+		UserID:    d.UserID,
+		DroppedAt: model.FormatTimestamp(d.DroppedAt),
+		Message:   d.Message,
+	})
+}
+
+// recordDrop logs and counts a broadcast dropped for c and keeps it in the
+// room's dead letter ring.
+func (r *Room) recordDrop(c *Client, msg []byte) {
+	var head struct {
+		ID uuid.UUID `json:"id"`
+	}
+	_ = json.Unmarshal(msg, &head)
+	r.logger.Warn("dropped message for slow client", "roomID", r.id, "userID", c.user.ID, "messageID", head.ID, "failures", c.sendFailures)
+	r.droppedMessages.Add(1)
+
+	letter := DeadLetter{
+		MessageID: head.ID,
+		UserID:    c.user.ID,
+		DroppedAt: timeNow(),
+	}
+	if r.cipher == nil && json.Valid(msg) {
+		letter.Message = msg
+	}
+
+	r.deadLettersMu.Lock()
+	defer r.deadLettersMu.Unlock()
+	if len(r.deadLetters) == deadLetterCapacity {
+		r.deadLetters = append(r.deadLetters[:0], r.deadLetters[1:]...)
+	}
+	r.deadLetters = append(r.deadLetters, letter)
+}
+
+// DroppedMessages returns how many broadcasts the room dropped for slow
+// clients since it was created.
+func (r *Room) DroppedMessages() int64 {
+	return r.droppedMessages.Load()
+}
+
+// DeadLetters returns the most recently dropped broadcasts, oldest first.
+func (r *Room) DeadLetters() []DeadLetter {
+	r.deadLettersMu.Lock()
+	defer r.deadLettersMu.Unlock()
+	letters := make([]DeadLetter, len(r.deadLetters))
+	copy(letters, r.deadLetters)
+	return letters
+}
@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestDeliverRecordsDeadLetters(t *testing.T) {
+	room := &Room{logger: testLogger(), backpressure: BackpressurePolicy{MaxFailures: 3}}
+	slow := newTestClient(room, nil, "")
+	slow.send = make(chan []byte, 1)
+
+	var ids []uuid.UUID
+	for range 3 {
+		msg := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hi"}
+		ids = append(ids, msg.ID)
+		b, _ := json.Marshal(msg)
+		room.deliver([]*Client{slow}, b)
+	}
+
+	if got := room.DroppedMessages(); got != 2 {
+		t.Fatalf("expected 2 dropped messages, got %d", got)
+	}
+	letters := room.DeadLetters()
+	if len(letters) != 2 {
+		t.Fatalf("expected 2 dead letters, got %d", len(letters))
+	}
+	for i, letter := range letters {
+		if letter.MessageID != ids[i+1] || letter.UserID != slow.user.ID {
+			t.Errorf("dead letter %d: got message %s for user %s", i, letter.MessageID, letter.UserID)
+		}
+		if len(letter.Message) == 0 {
+			t.Errorf("dead letter %d: expected the dropped frame", i)
+		}
+	}
+}
+
+func TestDeadLettersCapped(t *testing.T) {
+	room := &Room{logger: testLogger()}
+	slow := newTestClient(room, nil, "")
+	var last uuid.UUID
+	for range deadLetterCapacity + 5 {
+		last = uuid.New()
+		b, _ := json.Marshal(model.OutgoingMessage{ID: last})
+		room.recordDrop(slow, b)
+	}
+
+	letters := room.DeadLetters()
+	if len(letters) != deadLetterCapacity {
+		t.Fatalf("expected %d dead letters, got %d", deadLetterCapacity, len(letters))
+	}
+	if letters[len(letters)-1].MessageID != last {
+		t.Error("expected the newest drop to be kept last")
+	}
+	if got := room.DroppedMessages(); got != deadLetterCapacity+5 {
+		t.Errorf("expected every drop to be counted, got %d", got)
+	}
+}
+
+func TestDeadLettersOmitEncryptedMessages(t *testing.T) {
+	cipher, err := NewMessageCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := &Room{logger: testLogger(), cipher: cipher}
+	b, _ := json.Marshal(model.OutgoingMessage{ID: uuid.New(), Message: "secret"})
+	room.recordDrop(newTestClient(room, nil, ""), b)
+
+	if letters := room.DeadLetters(); len(letters) != 1 || letters[0].Message != nil {
+		t.Fatalf("expected a dead letter without message, got %+v", letters)
+	}
+}
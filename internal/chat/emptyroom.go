@@ -0,0 +1,50 @@
+package chat
+
+import "time"
+
+// scheduleEmptyCleanup starts the countdown that deletes the room once its
+// last client has left. Permanent rooms and hubs without an empty room
+// timeout are left alone. It must only be called from the Run goroutine.
+func (r *Room) scheduleEmptyCleanup() {
+	if r.emptyTimeout <= 0 || r.emptyTimer != nil {
+		return
+	}
+	if r.GetClientCount() > 0 || r.isPermanent() {
+		return
+	}
+	r.emptyTimer = time.NewTimer(r.emptyTimeout)
+}
+
+// cancelEmptyCleanup stops a running countdown because a client joined. It
+// must only be called from the Run goroutine.
+func (r *Room) cancelEmptyCleanup() {
+	if r.emptyTimer == nil {
+		return
+	}
+	r.emptyTimer.Stop()
+	r.emptyTimer = nil
+}
+
+// emptyDue fires when the countdown of an empty room ran out.
+func (r *Room) emptyDue() <-chan time.Time {
+	if r.emptyTimer == nil {
+		return nil
+	}
+	return r.emptyTimer.C
+}
+
+// deleteIfEmpty deletes the room if it is still empty and not permanent and
+// reports whether it did. It must only be called from the Run goroutine,
+// which has to return afterwards.
+func (r *Room) deleteIfEmpty() bool {
+	r.emptyTimer = nil
+	if r.GetClientCount() > 0 || r.isPermanent() {
+		return false
+	}
+	r.shutdownOnce.Do(func() {
+		close(r.shutdown)
+	})
+	r.hub.DeleteRoom(r.id)
+	r.logger.Info("remove room after last client left", "roomID", r.id)
+	return true
+}
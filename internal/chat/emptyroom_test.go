@@ -0,0 +1,59 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+func TestEmptyRoomDeletedAfterTimeout(t *testing.T) {
+	hub := NewHub(testLogger())
+	hub.SetEmptyRoomTimeout(50 * time.Millisecond)
+	room := newHubRoom(t, hub)
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	room.unregister <- client
+
+	select {
+	case <-room.closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the empty room to shut down")
+	}
+	if _, ok := hub.GetRoom(room.id); ok {
+		t.Fatal("expected the empty room to be deleted")
+	}
+}
+
+func TestEmptyRoomRejoinCancelsCleanup(t *testing.T) {
+	hub := NewHub(testLogger())
+	hub.SetEmptyRoomTimeout(100 * time.Millisecond)
+	room := newHubRoom(t, hub)
+	first := newTestClient(room, nil, "")
+	room.register <- first
+	room.unregister <- first
+	room.register <- newTestClient(room, nil, "")
+
+	time.Sleep(200 * time.Millisecond)
+	if _, ok := hub.GetRoom(room.id); !ok {
+		t.Fatal("expected the room to be kept after a client rejoined")
+	}
+}
+
+func TestEmptyRoomPermanentKept(t *testing.T) {
+	hub := NewHub(testLogger())
+	hub.SetEmptyRoomTimeout(50 * time.Millisecond)
+	room, _ := hub.CreateRoom(model.AdditionalInfo{"permanent": true})
+	t.Cleanup(func() {
+		room.ShutdownOnce(func() { close(room.shutdown) })
+		<-room.closed
+	})
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	room.unregister <- client
+
+	time.Sleep(150 * time.Millisecond)
+	if _, ok := hub.GetRoom(room.id); !ok {
+		t.Fatal("expected the permanent room to be kept")
+	}
+}
@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+var errCiphertextTooShort = errors.New("ciphertext too short")
+
+// MessageCipher encrypts the bodies of stored messages with AES-GCM so that
+// memory dumps don't expose them in plaintext.
+type MessageCipher struct {
+	aead cipher.AEAD
+}
+
+// NewMessageCipher returns a cipher for key, which must be 16, 24 or 32
+// bytes long to select AES-128, AES-192 or AES-256.
+func NewMessageCipher(key []byte) (*MessageCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("message encryption key must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageCipher{aead: aead}, nil
+}
+
+// seal encrypts plaintext with a random nonce and returns the nonce and
+// ciphertext base64-encoded.
+func (c *MessageCipher) seal(plaintext string) string {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, []byte(plaintext), nil))
+}
+
+func (c *MessageCipher) open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < c.aead.NonceSize() {
+		return "", errCiphertextTooShort
+	}
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// sealMessage returns msg with its body encrypted for storage. Without a
+// cipher it is returned unchanged.
+func (r *Room) sealMessage(msg model.OutgoingMessage) model.OutgoingMessage {
+	if r.cipher != nil {
+		msg.Message = r.cipher.seal(msg.Message)
+	}
+	return msg
+}
+
+// openMessage returns a stored message with its body decrypted.
+func (r *Room) openMessage(msg model.OutgoingMessage) model.OutgoingMessage {
+	if r.cipher == nil {
+		return msg
+	}
+	plaintext, err := r.cipher.open(msg.Message)
+	if err != nil {
+		r.logger.Error("failed to decrypt stored message", "roomID", r.id, "messageID", msg.ID, "error", err)
+		plaintext = ""
+	}
+	msg.Message = plaintext
+	return msg
+}
@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+func TestNewMessageCipherKeyLength(t *testing.T) {
+	for _, n := range []int{16, 24, 32} {
+		if _, err := NewMessageCipher(bytes.Repeat([]byte{1}, n)); err != nil {
+			t.Errorf("%d byte key: unexpected error %v", n, err)
+		}
+	}
+	if _, err := NewMessageCipher([]byte("short")); err == nil {
+		t.Error("expected error for invalid key length")
+	}
+}
+
+func TestRoomEncryptsStoredMessages(t *testing.T) {
+	c, err := NewMessageCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := NewHub(testLogger())
+	hub.SetMessageCipher(c)
+	room := newHubRoom(t, hub)
+
+	id := storeText(room, "top secret plan")
+
+	room.messagesMu.RLock()
+	raw := room.messages().GetAll()[0].Message
+	room.messagesMu.RUnlock()
+	if raw == "top secret plan" {
+		t.Fatal("expected stored message to be encrypted")
+	}
+
+	if msg, _ := room.GetMessage(id); msg.Message != "top secret plan" {
+		t.Errorf("GetMessage: expected plaintext, got %q", msg.Message)
+	}
+	if got := messageTexts(room.GetMessages()); len(got) != 1 || got[0] != "top secret plan" {
+		t.Errorf("GetMessages: expected plaintext, got %v", got)
+	}
+	if got := messageTexts(room.SearchMessages("secret")); len(got) != 1 || got[0] != "top secret plan" {
+		t.Errorf("SearchMessages: expected plaintext match, got %v", got)
+	}
+
+	edited := "revised plan"
+	room.PatchMessage(id, &edited, nil)
+	if msg, _ := room.GetMessage(id); msg.Message != edited || msg.AdditionalInfo["modified"] != true {
+		t.Errorf("expected edited plaintext, got %+v", msg)
+	}
+	room.UpdateMessage(id, "deleted", model.AdditionalInfo{"deleted": true})
+	if msg, _ := room.GetMessage(id); msg.Message != "deleted" {
+		t.Errorf("expected replaced plaintext, got %q", msg.Message)
+	}
+}
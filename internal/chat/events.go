@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+// EventBroadcast is the type of events for messages broadcast to a room.
+// Joins and leaves use PresenceJoined and PresenceLeft.
+const EventBroadcast = "message_broadcast"
+
+// eventBuffer is how many events a subscriber may fall behind before
+// further events are dropped for it.
+const eventBuffer = 256
+
+// Event is delivered to hub subscribers for every message broadcast, join
+// and leave in any room. Message is only set for EventBroadcast.
+type Event struct {
+	Type      string                 `json:"type"`
+	RoomID    uint                   `json:"roomId"`
+	User      model.User             `json:"user"`
+	Message   *model.OutgoingMessage `json:"message,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// eventBus fans events out to subscribers without ever blocking the
+// publisher: a subscriber whose buffer is full misses the event.
+type eventBus struct {
+	mu   sync.RWMutex
+	subs map[chan Event]struct{}
+}
+
+// Subscribe returns a channel receiving an Event for every broadcast, join
+// and leave across all rooms, and a function that unsubscribes and closes
+// the channel. Events are dropped while the channel's buffer is full, so
+// slow subscribers never hold up a room.
+func (h *Hub) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+	h.events.mu.Lock()
+	if h.events.subs == nil {
+		h.events.subs = make(map[chan Event]struct{})
+	}
+	h.events.subs[ch] = struct{}{}
+	h.events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.events.mu.Lock()
+			delete(h.events.subs, ch)
+			h.events.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (b *eventBus) hasSubscribers() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs) > 0
+}
+
+func (b *eventBus) publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// publishEvent hands e to the hub's subscribers. Rooms built without a hub
+// have none.
+func (r *Room) publishEvent(e Event) {
+	if r.hub == nil {
+		return
+	}
+	r.hub.events.publish(e)
+}
+
+// publishBroadcast decodes a broadcast message for the hub's subscribers.
+// It is skipped entirely while nobody is subscribed.
+func (r *Room) publishBroadcast(data []byte) {
+	if r.hub == nil || !r.hub.events.hasSubscribers() {
+		return
+	}
+	var msg model.OutgoingMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	r.publishEvent(Event{
+		Type:      EventBroadcast,
+		RoomID:    r.id,
+		User:      msg.User,
+		Message:   &msg,
+		Timestamp: timeNow(),
+	})
+}
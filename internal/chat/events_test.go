@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func TestHubSubscribe(t *testing.T) {
+	hub := NewHub(testLogger())
+	room := newHubRoom(t, hub)
+	events, unsubscribe := hub.Subscribe()
+
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	if e := nextEvent(t, events); e.Type != PresenceJoined || e.RoomID != room.ID() || e.User.ID != client.user.ID {
+		t.Fatalf("expected join event, got %+v", e)
+	}
+
+	b, _ := json.Marshal(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello", User: client.user})
+	room.broadcast <- b
+	e := nextEvent(t, events)
+	if e.Type != EventBroadcast || e.Message == nil || e.Message.Message != "hello" || e.User.ID != client.user.ID {
+		t.Fatalf("expected broadcast event, got %+v", e)
+	}
+
+	room.unregister <- client
+	if e := nextEvent(t, events); e.Type != PresenceLeft || e.User.ID != client.user.ID {
+		t.Fatalf("expected leave event, got %+v", e)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Fatal("expected the channel to be closed after unsubscribing")
+	}
+	room.broadcast <- b
+}
+
+func TestHubSubscribeSlowSubscriber(t *testing.T) {
+	hub := NewHub(testLogger())
+	room := newHubRoom(t, hub)
+	events, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	b, _ := json.Marshal(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "spam"})
+	done := make(chan struct{})
+	go func() {
+		for range eventBuffer + 10 {
+			room.broadcast <- b
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a full subscriber blocked the room")
+	}
+	if len(events) != eventBuffer {
+		t.Fatalf("expected %d buffered events, got %d", eventBuffer, len(events))
+	}
+}
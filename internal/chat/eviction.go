@@ -0,0 +1,70 @@
+package chat
+
+// alwaysReady is a closed channel; receiving from it never blocks.
+var alwaysReady = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// queueEvictions marks clients that exceeded the backpressure policy for
+// disconnection. Broadcasts skip them from then on. It must only be called
+// from the Run goroutine.
+func (r *Room) queueEvictions(clients []*Client) {
+	for _, c := range clients {
+		if !c.evicting {
+			c.evicting = true
+			r.evictions = append(r.evictions, c)
+		}
+	}
+}
+
+// evictionsDue is ready while slow clients are waiting to be disconnected,
+// so the Run loop gets to them between other work.
+func (r *Room) evictionsDue() <-chan struct{} {
+	if len(r.evictions) == 0 {
+		return nil
+	}
+	return alwaysReady
+}
+
+// evictPending disconnects the queued slow clients, at most MaxEvictions of
+// them at once so a broadcast to a room full of stuck clients doesn't hold
+// the clients lock for all of them. The rest wait for the next round. It
+// must only be called from the Run goroutine.
+func (r *Room) evictPending() {
+	n := len(r.evictions)
+	if limit := r.backpressure.MaxEvictions; limit > 0 {
+		n = min(n, limit)
+	}
+	batch := r.evictions[:n]
+	r.evictions = r.evictions[n:]
+	if len(r.evictions) == 0 {
+		r.evictions = nil
+	}
+
+	removed := make([]*Client, 0, len(batch))
+	r.clientsMu.Lock()
+	for _, c := range batch {
+		// The client may have left on its own in the meantime.
+		if _, ok := r.clients[c]; !ok {
+			continue
+		}
+		r.logger.Warn("disconnecting slow client", "roomID", r.id, "userID", c.user.ID, "failures", c.sendFailures)
+		delete(r.clients, c)
+		c.CloseSendWithReason(CloseSlowConsumer)
+		removed = append(removed, c)
+	}
+	r.clientsMu.Unlock()
+
+	for _, c := range removed {
+		r.notifyPresence(PresenceLeft, c.user)
+	}
+	if len(removed) > 0 {
+		r.scheduleOccupancy()
+		r.scheduleEmptyCleanup()
+	}
+	if len(r.evictions) > 0 {
+		r.logger.Debug("deferring slow client evictions", "roomID", r.id, "pending", len(r.evictions))
+	}
+}
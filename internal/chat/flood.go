@@ -0,0 +1,70 @@
+package chat
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+// FloodPolicy puts a room into slow mode when it broadcasts more than
+// MaxPerSecond user messages within a second, counted across all clients. In slow
+// mode client messages are rejected until no flood was seen for Cooldown.
+// A MaxPerSecond of 0 disables flood protection.
+type FloodPolicy struct {
+	MaxPerSecond int
+	Cooldown     time.Duration
+}
+
+var DefaultFloodPolicy = FloodPolicy{
+	Cooldown: 10 * time.Second,
+}
+
+// floodExempt are the message types the server broadcasts on its own, such as
+// join and leave announcements or receipts. They never count as a flood.
+var floodExempt = map[model.MessageType]struct{}{
+	model.SystemMessage:    {},
+	model.MessageDeleted:   {},
+	model.MessageUpdated:   {},
+	model.ReceiptMessage:   {},
+	model.PinsUpdated:      {},
+	model.OccupancyMessage: {},
+	model.RoomUpdated:      {},
+}
+
+// trackFlood counts a broadcast user message in the current one second window
+// and enters or extends slow mode once the window exceeds the policy. Server
+// broadcasts are ignored. It must only be called from the Run goroutine.
+func (r *Room) trackFlood(now time.Time, data []byte) {
+	if r.flood.MaxPerSecond <= 0 {
+		return
+	}
+	var msg struct {
+		MessageType model.MessageType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	if _, ok := floodExempt[msg.MessageType]; ok {
+		return
+	}
+	if now.Sub(r.floodWindow) >= time.Second {
+		r.floodWindow = now
+		r.floodCount = 0
+	}
+	r.floodCount++
+	if r.floodCount <= r.flood.MaxPerSecond {
+		return
+	}
+
+	if !r.SlowMode() {
+		r.logger.Warn("room flooded, entering slow mode", "roomID", r.id, "broadcasts", r.floodCount, "cooldown", r.flood.Cooldown)
+	}
+	r.slowModeUntil.Store(now.Add(r.flood.Cooldown).UnixNano())
+}
+
+// SlowMode reports whether the room currently rejects client messages
+// because it was flooded.
+func (r *Room) SlowMode() bool {
+	return timeNow().UnixNano() < r.slowModeUntil.Load()
+}
@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+func TestRoomTrackFlood(t *testing.T) {
+	now := time.Now()
+	origTimeNow := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = origTimeNow }()
+
+	room := &Room{flood: FloodPolicy{MaxPerSecond: 3, Cooldown: 10 * time.Second}, logger: testLogger()}
+	msg := []byte(`{"type":"message","message":"hi"}`)
+
+	for range 3 {
+		room.trackFlood(now, msg)
+	}
+	if room.SlowMode() {
+		t.Fatal("expected no slow mode at the threshold")
+	}
+
+	room.trackFlood(now.Add(500*time.Millisecond), msg)
+	if !room.SlowMode() {
+		t.Fatal("expected slow mode once the threshold is exceeded")
+	}
+
+	now = now.Add(5 * time.Second)
+	room.trackFlood(now, msg)
+	if !room.SlowMode() {
+		t.Fatal("expected slow mode to last for the cooldown")
+	}
+
+	now = now.Add(11 * time.Second)
+	if room.SlowMode() {
+		t.Fatal("expected slow mode to end after the cooldown")
+	}
+}
+
+func TestRoomTrackFloodDisabled(t *testing.T) {
+	room := &Room{logger: testLogger()}
+	now := time.Now()
+	for range 1000 {
+		room.trackFlood(now, []byte(`{"type":"message"}`))
+	}
+	if room.SlowMode() {
+		t.Fatal("expected the zero policy to disable flood protection")
+	}
+}
+
+func TestRoomTrackFloodIgnoresServerMessages(t *testing.T) {
+	room := &Room{flood: FloodPolicy{MaxPerSecond: 1, Cooldown: time.Minute}, logger: testLogger()}
+	now := time.Now()
+	for range 10 {
+		for _, msgType := range []model.MessageType{model.SystemMessage, model.ReceiptMessage, model.OccupancyMessage} {
+			b, _ := json.Marshal(model.OutgoingMessage{MessageType: msgType})
+			room.trackFlood(now, b)
+		}
+	}
+	if room.SlowMode() {
+		t.Fatal("expected server messages not to count toward the flood limit")
+	}
+
+	for _, msgType := range []model.MessageType{model.UserMessage, "custom"} {
+		b, _ := json.Marshal(model.OutgoingMessage{MessageType: msgType})
+		room.trackFlood(now, b)
+	}
+	if !room.SlowMode() {
+		t.Fatal("expected user messages to count toward the flood limit")
+	}
+}
+
+func TestJoinChurnDoesNotFloodRoom(t *testing.T) {
+	hub := NewHub(testLogger())
+	hub.SetFloodPolicy(FloodPolicy{MaxPerSecond: 2, Cooldown: time.Minute})
+	room := newHubRoom(t, hub)
+
+	for range 5 {
+		client := newTestClient(room, nil, "")
+		room.Join(client)
+		client.Leave()
+	}
+	time.Sleep(50 * time.Millisecond)
+	if room.SlowMode() {
+		t.Fatal("expected joins and leaves not to put the room into slow mode")
+	}
+}
+
+func TestHandleTextMessage_SlowMode(t *testing.T) {
+	hub := NewHub(testLogger())
+	hub.SetFloodPolicy(FloodPolicy{MaxPerSecond: 2, Cooldown: time.Minute})
+	room := newHubRoom(t, hub)
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	time.Sleep(50 * time.Millisecond)
+
+	for _, text := range []string{"one", "two", "three"} {
+		if !client.handleTextMessage([]byte(`{"message":"` + text + `"}`)) {
+			t.Fatalf("expected %q to be handled", text)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !room.SlowMode() {
+		t.Fatal("expected the room to enter slow mode")
+	}
+	for len(client.send) > 0 {
+		<-client.send
+	}
+
+	client.handleTextMessage([]byte(`{"message":"four"}`))
+	select {
+	case raw := <-client.send:
+		var out model.OutgoingMessage
+		if err := json.Unmarshal(raw, &out); err != nil {
+			t.Fatalf("failed to unmarshal notice: %v", err)
+		}
+		if out.MessageType != model.SystemMessage || out.AdditionalInfo["error"] != true {
+			t.Fatalf("expected a private error notice, got %+v", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for slow mode notice")
+	}
+
+	if got := messageTexts(room.GetMessages()); len(got) != 3 || got[2] != "three" {
+		t.Fatalf("expected the rejected message not to be stored, got %v", got)
+	}
+}
@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Ping reports whether the room's Run loop answers within timeout. A room
+// that is shutting down counts as alive; one whose Run loop returned without
+// being shut down does not.
+func (r *Room) Ping(timeout time.Duration) bool {
+	select {
+	case <-r.shutdown:
+		return true
+	default:
+	}
+	select {
+	case <-r.closed:
+		return false
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	reply := make(chan struct{})
+	select {
+	case r.ping <- reply:
+	case <-r.shutdown:
+		return true
+	case <-timer.C:
+		return false
+	}
+	select {
+	case <-reply:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// StuckRooms pings up to sample rooms concurrently and returns the IDs of
+// those that didn't answer within timeout, in ascending order. A sample of
+// 0 or less checks every room.
+func (h *Hub) StuckRooms(sample int, timeout time.Duration) []uint {
+	h.mu.RLock()
+	rooms := make([]*Room, 0, len(h.rooms))
+	for _, room := range h.rooms {
+		if sample > 0 && len(rooms) == sample {
+			break
+		}
+		rooms = append(rooms, room)
+	}
+	h.mu.RUnlock()
+
+	var (
+		mu    sync.Mutex
+		stuck []uint
+		wg    sync.WaitGroup
+	)
+	for _, room := range rooms {
+		wg.Go(func() {
+			if room.Ping(timeout) {
+				return
+			}
+			h.logger.Warn("room goroutine not responding", "roomID", room.id)
+			mu.Lock()
+			stuck = append(stuck, room.id)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	slices.Sort(stuck)
+	return stuck
+}
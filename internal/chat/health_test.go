@@ -0,0 +1,42 @@
+package chat
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHubStuckRooms(t *testing.T) {
+	hub := NewHub(testLogger())
+	healthy := newHubRoom(t, hub)
+	stuck := newHubRoom(t, hub)
+
+	if got := hub.StuckRooms(0, 100*time.Millisecond); len(got) != 0 {
+		t.Fatalf("expected no stuck rooms, got %v", got)
+	}
+
+	// Block the Run loop of one room on its client lock.
+	stuck.clientsMu.Lock()
+	go stuck.TryRegister(newTestClient(stuck, nil, ""))
+	time.Sleep(50 * time.Millisecond)
+
+	got := hub.StuckRooms(0, 100*time.Millisecond)
+	stuck.clientsMu.Unlock()
+	if !slices.Equal(got, []uint{stuck.ID()}) {
+		t.Fatalf("expected room %d to be stuck, got %v", stuck.ID(), got)
+	}
+	if !healthy.Ping(100 * time.Millisecond) {
+		t.Fatal("expected the healthy room to answer")
+	}
+}
+
+func TestRoomPingAfterShutdown(t *testing.T) {
+	hub := NewHub(testLogger())
+	room := newHubRoom(t, hub)
+	room.ShutdownOnce(func() { close(room.shutdown) })
+	<-room.closed
+
+	if !room.Ping(10 * time.Millisecond) {
+		t.Fatal("expected a room that is shutting down to count as alive")
+	}
+}
@@ -1,26 +1,77 @@
 package chat
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"maps"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSlugTaken    = errors.New("slug already in use")
+	ErrInvalidSlug  = errors.New("slug must be a non-empty string")
+	ErrTooManyRooms = errors.New("room limit reached")
+	// ErrRoomExists is returned by RestoreRoom for an ID that is in use.
+	ErrRoomExists = errors.New("room id already in use")
+	// ErrInvalidRoomID is returned by RestoreRoom for the zero ID.
+	ErrInvalidRoomID = errors.New("room id must be positive")
+	// ErrTooManyOwnerRooms is returned by CreateRoom when the room's ownerId
+	// already has the maximum number of rooms open.
+	ErrTooManyOwnerRooms = errors.New("too many rooms for this owner")
 )
 
 type Hub struct {
-	mu           sync.RWMutex
-	rooms        map[uint]*Room
-	roomCounter  int
-	roomMu       sync.Mutex
-	onRoomDelete func(roomID uint)
-	logger       *slog.Logger
+	mu             sync.RWMutex
+	rooms          map[uint]*Room
+	slugs          map[string]uint
+	roomCounter    int
+	roomMu         sync.Mutex
+	onRoomDelete   func(roomID uint)
+	backpressure   BackpressurePolicy
+	writePolicy    WritePolicy
+	flood          FloodPolicy
+	messageBytes   int
+	cipher         *MessageCipher
+	storeFactory   MessageStoreFactory
+	maxRooms       int
+	maxOwnerRooms  int
+	maxInfoBytes   int
+	maxImageBytes  int
+	onPresence     func(PresenceEvent)
+	reconnectGrace time.Duration
+	closeGrace     time.Duration
+	emptyTimeout   time.Duration
+	resolveUser    UserResolver
+	shutdownText   string
+	maxConns       atomic.Int64
+	connections    atomic.Int64
+	systemUser     model.User
+	validateInfo   func(model.AdditionalInfo) []string
+	filter         func(string) string
+	events         eventBus
+	logger         *slog.Logger
 }
 
 func NewHub(logger *slog.Logger) *Hub {
 	return &Hub{
-		rooms:  make(map[uint]*Room),
-		logger: logger,
+		rooms:        make(map[uint]*Room),
+		slugs:        make(map[string]uint),
+		backpressure: DefaultBackpressurePolicy,
+		writePolicy:  DefaultWritePolicy,
+		flood:        DefaultFloodPolicy,
+		logger:       logger,
 	}
 }
 
@@ -31,30 +82,215 @@ func (h *Hub) newRoomID() uint {
 	return uint(h.roomCounter)
 }
 
-func (h *Hub) CreateRoom(additionalInfo model.AdditionalInfo) *Room {
+// CreateRoom creates and starts a room. A "slug" in additionalInfo must be
+// unique across rooms, otherwise ErrSlugTaken is returned and no room is
+// created.
+func (h *Hub) CreateRoom(additionalInfo model.AdditionalInfo) (*Room, error) {
+	slug, hasSlug, err := slugOf(additionalInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	if h.maxRooms > 0 && len(h.rooms) >= h.maxRooms {
+		h.mu.Unlock()
+		return nil, ErrTooManyRooms
+	}
+	if owner, ok := additionalInfo["ownerId"].(string); ok && owner != "" && h.maxOwnerRooms > 0 && h.ownerRoomCountLocked(owner) >= h.maxOwnerRooms {
+		h.mu.Unlock()
+		return nil, ErrTooManyOwnerRooms
+	}
+	if hasSlug {
+		if _, taken := h.slugs[slug]; taken {
+			h.mu.Unlock()
+			return nil, ErrSlugTaken
+		}
+	}
+
 	id := h.newRoomID()
-	room := &Room{
+	room := h.newRoom(id, additionalInfo, timeNow())
+
+	h.logger.Info("creating new room", "roomID", id)
+	h.rooms[id] = room
+	if hasSlug {
+		h.slugs[slug] = id
+	}
+	h.mu.Unlock()
+
+	go room.Run()
+	return room, nil
+}
+
+// RestoreRoom recreates a previously persisted room under its original ID
+// and starts it. Later rooms get IDs above the highest restored one. Room
+// limits don't apply; an ID or slug already in use fails with ErrRoomExists
+// or ErrSlugTaken.
+func (h *Hub) RestoreRoom(id uint, additionalInfo model.AdditionalInfo, createdAt time.Time) (*Room, error) {
+	if id == 0 {
+		return nil, ErrInvalidRoomID
+	}
+	slug, hasSlug, err := slugOf(additionalInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	if _, taken := h.rooms[id]; taken {
+		h.mu.Unlock()
+		return nil, ErrRoomExists
+	}
+	if hasSlug {
+		if _, taken := h.slugs[slug]; taken {
+			h.mu.Unlock()
+			return nil, ErrSlugTaken
+		}
+	}
+
+	h.roomMu.Lock()
+	h.roomCounter = max(h.roomCounter, int(id))
+	h.roomMu.Unlock()
+
+	room := h.newRoom(id, additionalInfo, createdAt)
+	h.logger.Info("restoring room", "roomID", id)
+	h.rooms[id] = room
+	if hasSlug {
+		h.slugs[slug] = id
+	}
+	h.mu.Unlock()
+
+	go room.Run()
+	return room, nil
+}
+
+// newRoom builds a room with the hub's current settings.
+func (h *Hub) newRoom(id uint, additionalInfo model.AdditionalInfo, createdAt time.Time) *Room {
+	return &Room{
 		id:             id,
 		hub:            h,
 		clients:        make(map[*Client]bool),
 		broadcast:      make(chan []byte),
+		audience:       make(chan audienceBroadcast),
 		register:       make(chan *Client),
 		unregister:     make(chan *Client),
+		ping:           make(chan chan struct{}),
 		closed:         make(chan struct{}),
 		shutdown:       make(chan struct{}),
+		createdAt:      createdAt,
 		lastActivity:   timeNow(),
 		additionalInfo: additionalInfo,
-		messages:       make([]model.OutgoingMessage, 0),
+		store:          h.newStore(id),
+		backpressure:   h.backpressure,
+		writePolicy:    h.writePolicy,
+		flood:          h.flood,
+		maxStoredBytes: h.messageBytes,
+		cipher:         h.cipher,
+		systemUser:     h.systemUser,
+		validateInfo:   h.validateInfo,
+		filter:         h.filter,
+		maxInfoBytes:   h.maxInfoBytes,
+		maxImageBytes:  h.maxImageBytes,
+		onPresence:     h.onPresence,
+		reconnectGrace: h.reconnectGrace,
+		closeGrace:     h.closeGrace,
+		emptyTimeout:   h.emptyTimeout,
+		resolveUser:    h.resolveUser,
 		logger:         h.logger,
 	}
+}
+
+// PatchRoomInfo merges updates into the room's additionalInfo. If updates
+// touches "slug", the hub's slug index is updated in the same critical
+// section; a slug used by another room fails with ErrSlugTaken and leaves
+// the room untouched. A null slug removes it.
+func (h *Hub) PatchRoomInfo(room *Room, updates model.AdditionalInfo) error {
+	if _, touchesSlug := updates["slug"]; !touchesSlug {
+		room.PatchAdditionalInfo(updates)
+		return nil
+	}
 
-	h.logger.Info("creating new room", "roomID", id)
 	h.mu.Lock()
-	h.rooms[id] = room
-	h.mu.Unlock()
+	defer h.mu.Unlock()
 
-	go room.Run()
-	return room
+	if updates["slug"] == nil {
+		h.releaseSlugLocked(room.id)
+		updates = maps.Clone(updates)
+		delete(updates, "slug")
+		room.PatchAdditionalInfo(updates)
+		room.removeAdditionalInfoKey("slug")
+		return nil
+	}
+
+	if err := h.claimSlugLocked(room.id, updates); err != nil {
+		return err
+	}
+	room.PatchAdditionalInfo(updates)
+	return nil
+}
+
+// ReplaceRoomInfo replaces the room's additionalInfo and keeps the slug index
+// in sync with the new "slug", if any.
+func (h *Hub) ReplaceRoomInfo(room *Room, newInfo model.AdditionalInfo) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, hasSlug := newInfo["slug"]; hasSlug {
+		if err := h.claimSlugLocked(room.id, newInfo); err != nil {
+			return err
+		}
+	} else {
+		h.releaseSlugLocked(room.id)
+	}
+	room.UpdateAdditionalInfo(newInfo)
+	return nil
+}
+
+// GetRoomBySlug returns the room currently using slug.
+func (h *Hub) GetRoomBySlug(slug string) (*Room, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	id, ok := h.slugs[slug]
+	if !ok {
+		return nil, false
+	}
+	r, ok := h.rooms[id]
+	return r, ok
+}
+
+// claimSlugLocked points the slug in info at roomID, releasing the room's
+// previous slug. The caller must hold h.mu.
+func (h *Hub) claimSlugLocked(roomID uint, info model.AdditionalInfo) error {
+	slug, _, err := slugOf(info)
+	if err != nil {
+		return err
+	}
+	if owner, taken := h.slugs[slug]; taken && owner != roomID {
+		return ErrSlugTaken
+	}
+	h.releaseSlugLocked(roomID)
+	h.slugs[slug] = roomID
+	return nil
+}
+
+// releaseSlugLocked removes the slug of roomID from the index. The caller
+// must hold h.mu.
+func (h *Hub) releaseSlugLocked(roomID uint) {
+	for slug, owner := range h.slugs {
+		if owner == roomID {
+			delete(h.slugs, slug)
+		}
+	}
+}
+
+func slugOf(info model.AdditionalInfo) (slug string, ok bool, err error) {
+	v, ok := info["slug"]
+	if !ok {
+		return "", false, nil
+	}
+	slug, isString := v.(string)
+	if !isString || slug == "" {
+		return "", true, ErrInvalidSlug
+	}
+	return slug, true, nil
 }
 
 func (h *Hub) GetRoom(id uint) (*Room, bool) {
@@ -71,8 +307,31 @@ func (h *Hub) GetAllRoomIDs() []model.RoomResponse {
 	for _, room := range h.rooms {
 		rooms = append(rooms, model.RoomResponse{
 			ID:             room.id,
-			AdditionalInfo: room.additionalInfo,
+			AdditionalInfo: room.GetAdditionalInfo(),
+			UserCount:      room.GetClientCount(),
+		})
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].ID < rooms[j].ID
+	})
+	return rooms
+}
+
+// GetAllRoomDetails returns every room including internal activity and
+// message statistics, sorted by room ID.
+func (h *Hub) GetAllRoomDetails() []model.RoomDetail {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	rooms := make([]model.RoomDetail, 0, len(h.rooms))
+	for _, room := range h.rooms {
+		rooms = append(rooms, model.RoomDetail{
+			ID:             room.id,
 			UserCount:      room.GetClientCount(),
+			MessageCount:   room.GetMessageCount(),
+			CreatedAt:      room.CreatedAt(),
+			LastActivity:   room.LastActivity(),
+			AdditionalInfo: room.GetAdditionalInfo(),
 		})
 	}
 
@@ -82,14 +341,231 @@ func (h *Hub) GetAllRoomIDs() []model.RoomResponse {
 	return rooms
 }
 
+// PersistableRooms returns the details of the rooms worth saving for a later
+// RestoreRoom: permanent rooms and rooms active within window. Rooms idle for
+// longer would be reloaded only to be deleted again, or kept forever by
+// repeated restarts. A window of 0 or less returns every room.
+func (h *Hub) PersistableRooms(window time.Duration) []model.RoomDetail {
+	rooms := h.GetAllRoomDetails()
+	if window <= 0 {
+		return rooms
+	}
+	cutoff := timeNow().Add(-window)
+	return slices.DeleteFunc(rooms, func(room model.RoomDetail) bool {
+		return room.AdditionalInfo["permanent"] != true && room.LastActivity.Before(cutoff)
+	})
+}
+
 func (h *Hub) SetOnRoomDelete(fn func(roomID uint)) {
 	h.onRoomDelete = fn
 }
 
+// SetOnPresence registers a hook that rooms created afterwards call whenever
+// a connection joins or leaves. It is called from the room goroutine and
+// must return quickly.
+func (h *Hub) SetOnPresence(fn func(PresenceEvent)) {
+	h.onPresence = fn
+}
+
+// SetReconnectGrace sets how long a dropped client of a room created
+// afterwards may resume with its reconnect token before its leave is
+// announced. 0 disables reconnect tokens.
+func (h *Hub) SetReconnectGrace(d time.Duration) {
+	h.reconnectGrace = d
+}
+
+// SetCloseGrace sets how long clients of rooms created afterwards keep
+// writing their queued messages once they were removed before the close
+// frame is sent and the rest is discarded. 0 flushes the whole queue.
+func (h *Hub) SetCloseGrace(d time.Duration) {
+	h.closeGrace = d
+}
+
+// SetWritePolicy configures how long WebSocket writes may take for clients
+// of rooms created afterwards and for multiplexed connections.
+func (h *Hub) SetWritePolicy(p WritePolicy) {
+	h.writePolicy = p
+}
+
+// SetMessageFilter sets a filter that rooms created afterwards apply to the
+// text of client messages before they are stored and broadcast, e.g. to
+// mask profanity. A room can turn it off with additionalInfo.filterMessages
+// set to false. nil disables filtering.
+func (h *Hub) SetMessageFilter(fn func(string) string) {
+	h.filter = fn
+}
+
+// SetFloodPolicy configures when rooms created afterwards enter slow mode.
+func (h *Hub) SetFloodPolicy(p FloodPolicy) {
+	h.flood = p
+}
+
+// WritePolicy returns the policy set with SetWritePolicy.
+func (h *Hub) WritePolicy() WritePolicy {
+	return h.writePolicy
+}
+
+// SetBackpressurePolicy configures the policy used by rooms created afterwards.
+func (h *Hub) SetBackpressurePolicy(p BackpressurePolicy) {
+	h.backpressure = p
+}
+
+// SetMessageCipher encrypts the stored messages of rooms created afterwards.
+// Messages are decrypted on read and broadcast in plaintext. nil stores
+// them unencrypted.
+func (h *Hub) SetMessageCipher(c *MessageCipher) {
+	h.cipher = c
+}
+
+// SetMessageStoreFactory makes rooms created afterwards keep their message
+// history in the store returned by f. nil keeps it in memory.
+func (h *Hub) SetMessageStoreFactory(f MessageStoreFactory) {
+	h.storeFactory = f
+}
+
+func (h *Hub) newStore(roomID uint) MessageStore {
+	if h.storeFactory == nil {
+		return nil
+	}
+	return h.storeFactory(roomID)
+}
+
+// SetMessageByteBudget caps the JSON size of the message history kept by rooms
+// created afterwards. Once exceeded, the oldest messages are evicted. 0
+// disables the limit.
+func (h *Hub) SetMessageByteBudget(bytes int) {
+	h.messageBytes = bytes
+}
+
+// SetMaxRooms caps the number of rooms the hub holds at once. CreateRoom
+// fails with ErrTooManyRooms once reached. 0 disables the limit.
+func (h *Hub) SetMaxRooms(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxRooms = n
+}
+
+// SetMaxRoomsPerOwner caps how many rooms with the same additionalInfo.ownerId
+// the hub holds at once. CreateRoom fails with ErrTooManyOwnerRooms once
+// reached. Rooms without an ownerId aren't counted. 0 disables the limit.
+func (h *Hub) SetMaxRoomsPerOwner(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxOwnerRooms = n
+}
+
+// ownerRoomCountLocked counts the rooms whose ownerId is owner. h.mu must be
+// held.
+func (h *Hub) ownerRoomCountLocked(owner string) int {
+	count := 0
+	for _, room := range h.rooms {
+		room.infoMu.RLock()
+		if room.additionalInfo["ownerId"] == owner {
+			count++
+		}
+		room.infoMu.RUnlock()
+	}
+	return count
+}
+
+// RoomLimit returns the current number of rooms and the configured maximum.
+func (h *Hub) RoomLimit() (count, limit int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms), h.maxRooms
+}
+
+// SetMaxConnections caps the number of concurrent WebSocket connections across
+// all rooms. 0 disables the limit.
+func (h *Hub) SetMaxConnections(n int) {
+	h.maxConns.Store(int64(n))
+}
+
+// AcquireConnection reserves a connection slot and reports whether one was
+// available. Every successful call must be paired with ReleaseConnection.
+func (h *Hub) AcquireConnection() bool {
+	limit := h.maxConns.Load()
+	for {
+		current := h.connections.Load()
+		if limit > 0 && current >= limit {
+			return false
+		}
+		if h.connections.CompareAndSwap(current, current+1) {
+			return true
+		}
+	}
+}
+
+func (h *Hub) ReleaseConnection() {
+	h.connections.Add(-1)
+}
+
+// ConnectionCount returns the number of reserved connection slots.
+func (h *Hub) ConnectionCount() int {
+	return int(h.connections.Load())
+}
+
+// SetMessageInfoValidator sets a check that additionalInfo of messages sent
+// over WebSocket must pass in rooms created afterwards. It returns the list
+// of violations, empty if the info is valid.
+func (h *Hub) SetMessageInfoValidator(validate func(model.AdditionalInfo) []string) {
+	h.validateInfo = validate
+}
+
+// SetMaxInfoBytes limits the JSON size of additionalInfo attached to rooms,
+// users and messages. It applies to WebSocket messages in rooms created
+// afterwards. 0 disables the limit.
+func (h *Hub) SetMaxInfoBytes(n int) {
+	h.maxInfoBytes = n
+}
+
+// SetMaxImageBytes limits the size of image uploads in rooms created
+// afterwards, below the general upload limit. Whether an upload is an image
+// is decided by its content. 0 leaves only the general limit.
+func (h *Hub) SetMaxImageBytes(n int) {
+	h.maxImageBytes = n
+}
+
+// SetEmptyRoomTimeout makes rooms created afterwards delete themselves once
+// their last client has left and nobody joined for d. Permanent rooms are
+// kept. 0 disables the cleanup.
+func (h *Hub) SetEmptyRoomTimeout(d time.Duration) {
+	h.emptyTimeout = d
+}
+
+// MaxInfoBytes returns the limit set with SetMaxInfoBytes.
+func (h *Hub) MaxInfoBytes() int {
+	return h.maxInfoBytes
+}
+
+// InfoTooLarge reports whether info exceeds the limit of max bytes when
+// encoded as JSON. A limit of 0 or less allows any size.
+func InfoTooLarge(info model.AdditionalInfo, max int) bool {
+	if max <= 0 || len(info) == 0 {
+		return false
+	}
+	b, err := json.Marshal(info)
+	return err != nil || len(b) > max
+}
+
+// SetSystemUser sets the author of server-generated room events, such as
+// deletion notices for expired messages, for rooms created afterwards.
+func (h *Hub) SetSystemUser(u model.User) {
+	h.systemUser = u
+}
+
+// SetUserResolver makes rooms created afterwards show stored messages with
+// their author's current user data, so renames apply to earlier messages
+// too. Rooms with "immutableAuthors": true keep the author as sent.
+func (h *Hub) SetUserResolver(resolve UserResolver) {
+	h.resolveUser = resolve
+}
+
 func (h *Hub) DeleteRoom(id uint) {
 	h.logger.Info("deleting room", "roomID", id)
 	h.mu.Lock()
 	delete(h.rooms, id)
+	h.releaseSlugLocked(id)
 	h.mu.Unlock()
 
 	if h.onRoomDelete != nil {
@@ -97,7 +573,9 @@ func (h *Hub) DeleteRoom(id uint) {
 	}
 }
 
-func (h *Hub) ShutdownAll() {
+// Announce stores and broadcasts a system message in every room and returns
+// the number of rooms it reached. Rooms that are shutting down are skipped.
+func (h *Hub) Announce(text string) int {
 	h.mu.RLock()
 	snapshot := make([]*Room, 0, len(h.rooms))
 	for _, r := range h.rooms {
@@ -105,12 +583,70 @@ func (h *Hub) ShutdownAll() {
 	}
 	h.mu.RUnlock()
 
+	reached := 0
 	for _, r := range snapshot {
+		msg := model.OutgoingMessage{
+			ID:             uuid.New(),
+			MessageType:    model.SystemMessage,
+			Message:        text,
+			Timestamp:      timeNow(),
+			User:           h.systemUser,
+			AdditionalInfo: model.AdditionalInfo{"announcement": true},
+		}
+		select {
+		case <-r.shutdown:
+			h.logger.Debug("skipping announcement for closing room", "roomID", r.id)
+			continue
+		default:
+		}
+		b, _ := json.Marshal(r.StoreMessage(msg))
+		if !r.TryBroadcast(b) {
+			h.logger.Debug("skipping announcement for closing room", "roomID", r.id)
+			continue
+		}
+		reached++
+	}
+	h.logger.Info("announcement sent", "rooms", reached)
+	return reached
+}
+
+// SetShutdownMessage sets the system message ShutdownAll sends to every room
+// before it closes them. An empty text sends none.
+func (h *Hub) SetShutdownMessage(text string) {
+	h.shutdownText = text
+}
+
+// ShutdownAll closes every room and disconnects its clients. Clients still
+// get the messages queued for them before their close frame, starting with
+// the shutdown message if one is set; ShutdownAll waits for that until ctx
+// ends and then closes the remaining connections.
+func (h *Hub) ShutdownAll(ctx context.Context) {
+	h.mu.RLock()
+	snapshot := make([]*Room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		snapshot = append(snapshot, r)
+	}
+	h.mu.RUnlock()
+
+	var clients []*Client
+	for _, r := range snapshot {
+		if h.shutdownText != "" {
+			r.notifyShutdown(h.shutdownText)
+		}
 		r.shutdownOnce.Do(func() { close(r.shutdown) })
 		<-r.closed
+		r.clientsMu.RLock()
+		for c := range r.clients {
+			clients = append(clients, c)
+		}
+		r.clientsMu.RUnlock()
 		r.DisconnectAllClients()
 		h.DeleteRoom(r.id)
 	}
+
+	for _, c := range clients {
+		c.waitWritten(ctx)
+	}
 }
 
 func (h *Hub) GetAllUsersWithRooms() []model.UserWithRoom {
@@ -129,3 +665,81 @@ func (h *Hub) GetAllUsersWithRooms() []model.UserWithRoom {
 	}
 	return usersWithRooms
 }
+
+// GetUserRooms returns the rooms the user is currently connected to, sorted
+// by room ID.
+func (h *Hub) GetUserRooms(userID uuid.UUID) []model.RoomResponse {
+	h.mu.RLock()
+	roomList := slices.Collect(maps.Values(h.rooms))
+	h.mu.RUnlock()
+
+	rooms := make([]model.RoomResponse, 0)
+	for _, room := range roomList {
+		if len(room.GetClientsByUserID(userID)) == 0 {
+			continue
+		}
+		rooms = append(rooms, model.RoomResponse{
+			ID:             room.id,
+			AdditionalInfo: room.GetAdditionalInfo(),
+			UserCount:      room.GetClientCount(),
+		})
+	}
+	slices.SortFunc(rooms, func(a, b model.RoomResponse) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return rooms
+}
+
+// IsUserOnline reports whether the user is connected to any room.
+func (h *Hub) IsUserOnline(userID uuid.UUID) bool {
+	h.mu.RLock()
+	rooms := slices.Collect(maps.Values(h.rooms))
+	h.mu.RUnlock()
+
+	for _, room := range rooms {
+		if len(room.GetClientsByUserID(userID)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOnlineUsers returns every user connected to at least one room once,
+// with the sorted IDs of the rooms they are in. Users are ordered by display
+// name, then ID.
+func (h *Hub) GetOnlineUsers() []model.OnlineUser {
+	h.mu.RLock()
+	roomIDs := slices.Sorted(maps.Keys(h.rooms))
+	rooms := make([]*Room, len(roomIDs))
+	for i, id := range roomIDs {
+		rooms[i] = h.rooms[id]
+	}
+	h.mu.RUnlock()
+
+	byID := make(map[uuid.UUID]*model.OnlineUser)
+	for i, room := range rooms {
+		for _, user := range room.GetUsers() {
+			online, ok := byID[user.ID]
+			if !ok {
+				online = &model.OnlineUser{User: user}
+				byID[user.ID] = online
+			}
+			// A user with several connections to one room is listed once.
+			if !slices.Contains(online.RoomIDs, roomIDs[i]) {
+				online.RoomIDs = append(online.RoomIDs, roomIDs[i])
+			}
+		}
+	}
+
+	users := make([]model.OnlineUser, 0, len(byID))
+	for _, online := range byID {
+		users = append(users, *online)
+	}
+	slices.SortFunc(users, func(a, b model.OnlineUser) int {
+		if c := strings.Compare(model.GetDisplayName(a.User), model.GetDisplayName(b.User)); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.User.ID[:], b.User.ID[:])
+	})
+	return users
+}
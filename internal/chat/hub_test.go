@@ -1,9 +1,18 @@
 package chat
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/choffmann/chat-room/internal/model"
 	"github.com/google/uuid"
@@ -21,7 +30,7 @@ func TestHubCreateAndGetRoom(t *testing.T) {
 		"type": "public",
 	}
 
-	room := h.CreateRoom(additionalInfo)
+	room, _ := h.CreateRoom(additionalInfo)
 	defer func() {
 		room.ShutdownOnce(func() { close(room.shutdown) })
 		<-room.closed
@@ -53,7 +62,7 @@ func TestHubCreateAndGetRoom(t *testing.T) {
 func TestHubDeleteRoom(t *testing.T) {
 	h := NewHub(testLogger())
 
-	room := h.CreateRoom(nil)
+	room, _ := h.CreateRoom(nil)
 	roomID := room.id
 
 	room.ShutdownOnce(func() { close(room.shutdown) })
@@ -73,7 +82,7 @@ func TestHubGetAllRoomIDs(t *testing.T) {
 	numRooms := 5
 	rooms := make([]*Room, numRooms)
 	for i := range numRooms {
-		room := h.CreateRoom(model.AdditionalInfo{
+		room, _ := h.CreateRoom(model.AdditionalInfo{
 			"name": "Room " + string(rune(i+1)),
 		})
 		rooms[i] = room
@@ -113,6 +122,104 @@ func TestNewRoomID(t *testing.T) {
 	}
 }
 
+func TestHubPersistableRooms(t *testing.T) {
+	h := NewHub(testLogger())
+	t.Cleanup(func() { h.ShutdownAll(context.Background()) })
+
+	active, _ := h.CreateRoom(nil)
+	idle, _ := h.CreateRoom(nil)
+	permanent, _ := h.CreateRoom(model.AdditionalInfo{"permanent": true})
+	for _, room := range []*Room{idle, permanent} {
+		room.activityMu.Lock()
+		room.lastActivity = timeNow().Add(-48 * time.Hour)
+		room.activityMu.Unlock()
+	}
+
+	var ids []uint
+	for _, room := range h.PersistableRooms(time.Hour) {
+		ids = append(ids, room.ID)
+	}
+	if want := []uint{active.ID(), permanent.ID()}; !slices.Equal(ids, want) {
+		t.Errorf("expected rooms %v to be persisted, got %v", want, ids)
+	}
+
+	if rooms := h.PersistableRooms(0); len(rooms) != 3 {
+		t.Errorf("expected every room without a window, got %d", len(rooms))
+	}
+}
+
+func TestHubSaveAndRestoreRooms(t *testing.T) {
+	saved := NewHub(testLogger())
+	t.Cleanup(func() { saved.ShutdownAll(context.Background()) })
+	saved.CreateRoom(nil)
+	named, _ := saved.CreateRoom(model.AdditionalInfo{"slug": "lobby"})
+
+	var buf bytes.Buffer
+	if err := saved.SaveRooms(&buf, time.Hour); err != nil {
+		t.Fatalf("save rooms: %v", err)
+	}
+
+	h := NewHub(testLogger())
+	t.Cleanup(func() { h.ShutdownAll(context.Background()) })
+	h.CreateRoom(nil)
+	restored, err := h.RestoreRooms(&buf)
+	if err != nil {
+		t.Fatalf("restore rooms: %v", err)
+	}
+	// Room 1 is taken in the new hub and is skipped.
+	if restored != 1 {
+		t.Errorf("expected 1 restored room, got %d", restored)
+	}
+	room, ok := h.GetRoomBySlug("lobby")
+	if !ok || room.ID() != named.ID() || !room.CreatedAt().Equal(named.CreatedAt()) {
+		t.Errorf("expected room %d to be restored with its slug and createdAt", named.ID())
+	}
+	if next, _ := h.CreateRoom(nil); next.ID() != named.ID()+1 {
+		t.Errorf("expected the next room to get ID %d, got %d", named.ID()+1, next.ID())
+	}
+
+	if _, err := h.RestoreRooms(strings.NewReader("not json")); err == nil {
+		t.Error("expected an error for an invalid rooms file")
+	}
+}
+
+func TestHubRestoreRoomAdvancesCounter(t *testing.T) {
+	h := NewHub(testLogger())
+	t.Cleanup(func() { h.ShutdownAll(context.Background()) })
+
+	createdAt := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	for _, id := range []uint{7, 3} {
+		room, err := h.RestoreRoom(id, model.AdditionalInfo{"slug": fmt.Sprintf("room-%d", id)}, createdAt)
+		if err != nil {
+			t.Fatalf("restore room %d: %v", id, err)
+		}
+		if room.ID() != id || !room.CreatedAt().Equal(createdAt) {
+			t.Errorf("expected room %d created at %v, got room %d created at %v", id, createdAt, room.ID(), room.CreatedAt())
+		}
+	}
+
+	next, err := h.CreateRoom(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID() != 8 {
+		t.Errorf("expected the next room to get ID 8, got %d", next.ID())
+	}
+
+	if _, err := h.RestoreRoom(3, nil, createdAt); !errors.Is(err, ErrRoomExists) {
+		t.Errorf("expected ErrRoomExists, got %v", err)
+	}
+	if _, err := h.RestoreRoom(5, model.AdditionalInfo{"slug": "room-7"}, createdAt); !errors.Is(err, ErrSlugTaken) {
+		t.Errorf("expected ErrSlugTaken, got %v", err)
+	}
+	if _, err := h.RestoreRoom(0, nil, createdAt); !errors.Is(err, ErrInvalidRoomID) {
+		t.Errorf("expected ErrInvalidRoomID, got %v", err)
+	}
+	if room, ok := h.GetRoomBySlug("room-3"); !ok || room.ID() != 3 {
+		t.Error("expected restored slugs to be indexed")
+	}
+}
+
 func TestHubGetAllUsersWithRooms(t *testing.T) {
 	h := NewHub(testLogger())
 
@@ -147,12 +254,38 @@ func TestHubGetAllUsersWithRooms(t *testing.T) {
 	}
 }
 
+func TestHubGetOnlineUsers(t *testing.T) {
+	h := NewHub(testLogger())
+
+	alice := model.User{ID: uuid.New(), Name: "alice"}
+	bob := model.User{ID: uuid.New(), Name: "bob"}
+
+	for id := uint(1); id <= 3; id++ {
+		h.rooms[id] = &Room{id: id, clients: make(map[*Client]bool)}
+	}
+	h.rooms[3].clients[&Client{user: alice}] = true
+	h.rooms[1].clients[&Client{user: alice}] = true
+	h.rooms[1].clients[&Client{user: alice}] = true
+	h.rooms[2].clients[&Client{user: bob}] = true
+
+	online := h.GetOnlineUsers()
+	if len(online) != 2 {
+		t.Fatalf("expected 2 distinct users, got %d", len(online))
+	}
+	if online[0].User.ID != alice.ID || !slices.Equal(online[0].RoomIDs, []uint{1, 3}) {
+		t.Errorf("expected alice in rooms [1 3], got %s in %v", online[0].User.Name, online[0].RoomIDs)
+	}
+	if online[1].User.ID != bob.ID || !slices.Equal(online[1].RoomIDs, []uint{2}) {
+		t.Errorf("expected bob in rooms [2], got %s in %v", online[1].User.Name, online[1].RoomIDs)
+	}
+}
+
 func TestHubShutdownAll(t *testing.T) {
 	h := NewHub(testLogger())
 
 	rooms := make([]*Room, 3)
 	for i := range rooms {
-		rooms[i] = h.CreateRoom(nil)
+		rooms[i], _ = h.CreateRoom(nil)
 	}
 
 	var deletedIDs []uint
@@ -160,7 +293,7 @@ func TestHubShutdownAll(t *testing.T) {
 		deletedIDs = append(deletedIDs, roomID)
 	})
 
-	h.ShutdownAll()
+	h.ShutdownAll(context.Background())
 
 	if len(deletedIDs) != 3 {
 		t.Errorf("expected 3 rooms deleted via callback, got %d", len(deletedIDs))
@@ -231,3 +364,193 @@ func TestRoomGetClientCount(t *testing.T) {
 		t.Errorf("expected 2 clients, got %d", count)
 	}
 }
+
+func TestHubRoomLimit(t *testing.T) {
+	h := NewHub(testLogger())
+	h.SetMaxRooms(2)
+
+	for range 2 {
+		room, err := h.CreateRoom(nil)
+		if err != nil {
+			t.Fatalf("CreateRoom: %v", err)
+		}
+		defer func() {
+			room.ShutdownOnce(func() { close(room.shutdown) })
+			<-room.closed
+		}()
+	}
+
+	if _, err := h.CreateRoom(nil); !errors.Is(err, ErrTooManyRooms) {
+		t.Errorf("expected ErrTooManyRooms, got %v", err)
+	}
+	if count, limit := h.RoomLimit(); count != 2 || limit != 2 {
+		t.Errorf("expected 2/2 rooms, got %d/%d", count, limit)
+	}
+}
+
+func TestHubRoomsPerOwnerLimit(t *testing.T) {
+	h := NewHub(testLogger())
+	h.SetMaxRoomsPerOwner(1)
+
+	room := newHubRoom(t, h)
+	h.PatchRoomInfo(room, model.AdditionalInfo{"ownerId": "alice"})
+
+	if _, err := h.CreateRoom(model.AdditionalInfo{"ownerId": "alice"}); !errors.Is(err, ErrTooManyOwnerRooms) {
+		t.Fatalf("expected ErrTooManyOwnerRooms, got %v", err)
+	}
+
+	h.DeleteRoom(room.ID())
+	other, err := h.CreateRoom(model.AdditionalInfo{"ownerId": "alice"})
+	if err != nil {
+		t.Fatalf("expected a new room once the owner's previous room is gone, got %v", err)
+	}
+	other.ShutdownOnce(func() { close(other.shutdown) })
+	<-other.closed
+}
+
+func TestHubConnectionLimit(t *testing.T) {
+	h := NewHub(testLogger())
+	h.SetMaxConnections(2)
+
+	if !h.AcquireConnection() || !h.AcquireConnection() {
+		t.Fatal("expected two connections to be accepted")
+	}
+	if h.AcquireConnection() {
+		t.Error("expected third connection to be rejected")
+	}
+
+	h.ReleaseConnection()
+	if !h.AcquireConnection() {
+		t.Error("expected released slot to be reusable")
+	}
+	if count := h.ConnectionCount(); count != 2 {
+		t.Errorf("expected 2 connections, got %d", count)
+	}
+
+	h.SetMaxConnections(0)
+	if !h.AcquireConnection() {
+		t.Error("expected unlimited connections when the cap is 0")
+	}
+}
+
+func TestClientLeaveReleasesConnection(t *testing.T) {
+	room := newTestRoom(t)
+	room.hub.AcquireConnection()
+
+	client := newTestClient(room, nil, "")
+	client.SetOnDisconnect(room.hub.ReleaseConnection)
+	room.register <- client
+
+	client.Disconnect()
+	client.Disconnect()
+
+	if count := room.hub.ConnectionCount(); count != 0 {
+		t.Errorf("expected connection to be released once, got count %d", count)
+	}
+}
+
+func TestHubSlugIndex(t *testing.T) {
+	h := NewHub(testLogger())
+
+	first, err := h.CreateRoom(model.AdditionalInfo{"slug": "general"})
+	if err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	defer close(first.shutdown)
+
+	if _, err := h.CreateRoom(model.AdditionalInfo{"slug": "general"}); !errors.Is(err, ErrSlugTaken) {
+		t.Fatalf("expected ErrSlugTaken, got %v", err)
+	}
+	if _, err := h.CreateRoom(model.AdditionalInfo{"slug": 42}); !errors.Is(err, ErrInvalidSlug) {
+		t.Fatalf("expected ErrInvalidSlug, got %v", err)
+	}
+
+	second, err := h.CreateRoom(model.AdditionalInfo{"slug": "random", "theme": "dark"})
+	if err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	defer close(second.shutdown)
+
+	err = h.PatchRoomInfo(second, model.AdditionalInfo{"slug": "general", "theme": "light"})
+	if !errors.Is(err, ErrSlugTaken) {
+		t.Fatalf("expected ErrSlugTaken, got %v", err)
+	}
+	if info := second.GetAdditionalInfo(); info["slug"] != "random" || info["theme"] != "dark" {
+		t.Errorf("expected failed rename to leave room untouched, got %v", info)
+	}
+
+	if err := h.PatchRoomInfo(second, model.AdditionalInfo{"slug": "offtopic"}); err != nil {
+		t.Fatalf("failed to rename room: %v", err)
+	}
+	if r, ok := h.GetRoomBySlug("offtopic"); !ok || r != second {
+		t.Error("expected new slug to resolve to the renamed room")
+	}
+	if _, ok := h.GetRoomBySlug("random"); ok {
+		t.Error("expected old slug to be released")
+	}
+
+	if err := h.PatchRoomInfo(second, model.AdditionalInfo{"theme": "blue"}); err != nil {
+		t.Fatalf("failed to patch room: %v", err)
+	}
+	if r, ok := h.GetRoomBySlug("offtopic"); !ok || r != second {
+		t.Error("expected patch without slug to keep the slug")
+	}
+
+	if err := h.ReplaceRoomInfo(second, model.AdditionalInfo{"theme": "green"}); err != nil {
+		t.Fatalf("failed to replace room info: %v", err)
+	}
+	if _, ok := h.GetRoomBySlug("offtopic"); ok {
+		t.Error("expected replacing info without slug to release it")
+	}
+
+	h.DeleteRoom(first.id)
+	if err := h.PatchRoomInfo(second, model.AdditionalInfo{"slug": "general"}); err != nil {
+		t.Fatalf("expected slug of deleted room to be free, got %v", err)
+	}
+}
+
+func TestHubConcurrentRenames(t *testing.T) {
+	h := NewHub(testLogger())
+
+	rooms := make([]*Room, 10)
+	for i := range rooms {
+		rooms[i], _ = h.CreateRoom(nil)
+		defer close(rooms[i].shutdown)
+	}
+
+	var wg sync.WaitGroup
+	var winners atomic.Int32
+	for _, room := range rooms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if h.PatchRoomInfo(room, model.AdditionalInfo{"slug": "contested"}) == nil {
+				winners.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if winners.Load() != 1 {
+		t.Errorf("expected exactly one room to get the slug, got %d", winners.Load())
+	}
+	owner, ok := h.GetRoomBySlug("contested")
+	if !ok || owner.GetAdditionalInfo()["slug"] != "contested" {
+		t.Error("expected slug index to match the winning room")
+	}
+}
+
+func TestHubIsUserOnline(t *testing.T) {
+	hub := NewHub(testLogger())
+	room := newHubRoom(t, hub)
+	client := newTestClient(room, nil, "")
+
+	if hub.IsUserOnline(client.user.ID) {
+		t.Error("expected user to be offline before joining")
+	}
+	room.register <- client
+	time.Sleep(50 * time.Millisecond)
+	if !hub.IsUserOnline(client.user.ID) {
+		t.Error("expected user to be online after joining")
+	}
+}
@@ -0,0 +1,460 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrRoomNotFound      = errors.New("room not found")
+	ErrBanned            = errors.New("user is banned from this room")
+	ErrNotRegistered     = errors.New("room requires a registered user")
+	ErrAlreadySubscribed = errors.New("already subscribed to room")
+	ErrNotSubscribed     = errors.New("not subscribed to room")
+
+	errConnectionClosed = errors.New("connection closed")
+)
+
+// Control actions a MultiClient accepts. Frames without an action that carry
+// a roomId are sent to that room like a regular client message.
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+	ActionLeave       = "leave"
+	ActionSend        = "send"
+)
+
+// controlFrame is the envelope of every text frame on a multiplexed
+// connection. The rest of the frame is decoded as a model.IncomingMessage.
+type controlFrame struct {
+	Action  string `json:"action"`
+	RoomID  *uint  `json:"roomId"`
+	History int    `json:"history"`
+}
+
+// MultiClient is a single WebSocket connection subscribed to several rooms.
+// Each subscription is a regular Client registered in its room; their send
+// channels are fanned into the connection and every outgoing frame is tagged
+// with the roomId it came from.
+type MultiClient struct {
+	hub          *Hub
+	conn         *websocket.Conn
+	user         model.User
+	registered   bool
+	systemUser   model.User
+	out          chan []byte
+	done         chan struct{}
+	mu           sync.Mutex
+	subs         map[uint]*Client
+	onDisconnect func()
+	onActivity   func()
+	disconnected sync.Once
+	connInfo     ConnInfo
+	auth         *connAuth
+	logger       *slog.Logger
+}
+
+func NewMultiClient(hub *Hub, conn *websocket.Conn, user model.User, systemUser model.User, logger *slog.Logger) *MultiClient {
+	return &MultiClient{
+		hub:        hub,
+		conn:       conn,
+		user:       user,
+		systemUser: systemUser,
+		out:        make(chan []byte, 256),
+		done:       make(chan struct{}),
+		subs:       make(map[uint]*Client),
+		logger:     logger,
+	}
+}
+
+func (m *MultiClient) User() model.User { return m.user }
+
+// SetOnDisconnect registers a callback that runs once when the connection
+// ends.
+func (m *MultiClient) SetOnDisconnect(f func()) {
+	m.onDisconnect = f
+}
+
+// SetOnActivity registers a callback that runs whenever the client sends a
+// frame.
+func (m *MultiClient) SetOnActivity(f func()) {
+	m.onActivity = f
+}
+
+// SetRegistered marks the client's user as registered, which rooms that
+// require registered users check on subscribe.
+func (m *MultiClient) SetRegistered(registered bool) {
+	m.registered = registered
+}
+
+// SetConnInfo records where the connection came from; every subscription
+// reports it to its room.
+func (m *MultiClient) SetConnInfo(info ConnInfo) {
+	m.connInfo = info
+}
+
+// Subscriptions returns the IDs of the rooms the client is subscribed to.
+func (m *MultiClient) Subscriptions() []uint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]uint, 0, len(m.subs))
+	for id := range m.subs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Subscribe joins the room and starts forwarding its broadcasts. history
+// replays the last stored messages like the history query parameter of a
+// single-room connection.
+func (m *MultiClient) Subscribe(roomID uint, history int) error {
+	room, ok := m.hub.GetRoom(roomID)
+	if !ok {
+		return ErrRoomNotFound
+	}
+	if room.IsBanned(m.user.ID) {
+		return ErrBanned
+	}
+	if room.RequiresRegisteredUsers() && !m.registered {
+		return ErrNotRegistered
+	}
+
+	m.mu.Lock()
+	select {
+	case <-m.done:
+		m.mu.Unlock()
+		return errConnectionClosed
+	default:
+	}
+	if _, ok := m.subs[roomID]; ok {
+		m.mu.Unlock()
+		return ErrAlreadySubscribed
+	}
+	sub := NewClient(room, nil, m.user, m.systemUser, m.logger, nil, "")
+	sub.SetHistoryReplay(history)
+	sub.SetConnInfo(m.connInfo)
+	m.subs[roomID] = sub
+	m.mu.Unlock()
+
+	if !room.Join(sub) {
+		m.mu.Lock()
+		delete(m.subs, roomID)
+		m.mu.Unlock()
+		return ErrRoomNotFound
+	}
+
+	// Acknowledge before forwarding so the client sees the confirmation ahead
+	// of any replayed history.
+	m.sendControl(roomID, fmt.Sprintf("subscribed to room %d", roomID), model.AdditionalInfo{
+		"action": "subscribed",
+		"user":   m.user,
+	})
+	go m.forward(roomID, sub)
+	m.logger.Info("multiplexed client subscribed", "roomID", roomID, "userID", m.user.ID)
+	return nil
+}
+
+// Unsubscribe leaves the room. The room sees a regular leave message.
+func (m *MultiClient) Unsubscribe(roomID uint) error {
+	m.mu.Lock()
+	sub, ok := m.subs[roomID]
+	delete(m.subs, roomID)
+	m.mu.Unlock()
+	if !ok {
+		return ErrNotSubscribed
+	}
+
+	sub.Disconnect()
+	m.logger.Info("multiplexed client unsubscribed", "roomID", roomID, "userID", m.user.ID)
+	return nil
+}
+
+// forward copies the subscription's messages to the connection until the
+// room drops it or the connection ends. If the room dropped it (kick, slow
+// consumer, room closed) the client is told why.
+func (m *MultiClient) forward(roomID uint, sub *Client) {
+	forwardHistory := func() bool {
+		for _, msg := range sub.takeHistory() {
+			select {
+			case m.out <- tagRoom(roomID, msg):
+			case <-m.done:
+				return false
+			}
+		}
+		return true
+	}
+	for {
+		select {
+		case msg, ok := <-sub.send:
+			if !ok {
+				m.dropped(roomID, sub)
+				return
+			}
+			if !forwardHistory() {
+				return
+			}
+			select {
+			case m.out <- tagRoom(roomID, msg):
+			case <-m.done:
+				return
+			}
+		case <-sub.historyReady:
+			if !forwardHistory() {
+				return
+			}
+		case <-sub.room.Closed():
+			m.dropped(roomID, sub)
+			return
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *MultiClient) dropped(roomID uint, sub *Client) {
+	m.mu.Lock()
+	current, ok := m.subs[roomID]
+	if ok && current == sub {
+		delete(m.subs, roomID)
+	}
+	m.mu.Unlock()
+	if !ok || current != sub {
+		// Unsubscribed by the client, which already got an acknowledgement.
+		return
+	}
+
+	reason := CloseRoomClosed.Text
+	sub.closeMu.Lock()
+	if sub.closeReason != nil {
+		reason = sub.closeReason.Text
+	}
+	sub.closeMu.Unlock()
+
+	m.logger.Info("multiplexed subscription dropped by room", "roomID", roomID, "userID", m.user.ID, "reason", reason)
+	m.sendControl(roomID, fmt.Sprintf("unsubscribed from room %d: %s", roomID, reason), model.AdditionalInfo{
+		"action": "unsubscribed",
+		"reason": reason,
+	})
+}
+
+// Disconnect leaves every subscribed room and stops the write pump.
+func (m *MultiClient) Disconnect() {
+	m.disconnected.Do(func() {
+		m.mu.Lock()
+		close(m.done)
+		subs := m.subs
+		m.subs = make(map[uint]*Client)
+		m.mu.Unlock()
+
+		for _, sub := range subs {
+			sub.Disconnect()
+		}
+
+		if m.onDisconnect != nil {
+			m.onDisconnect()
+		}
+	})
+}
+
+func (m *MultiClient) ReadPump() {
+	defer func() {
+		m.Disconnect()
+		m.conn.Close()
+	}()
+
+	m.conn.SetReadLimit(10 * MiB)
+	if m.auth != nil {
+		if err := readAuthFrame(m.conn, m.auth); err != nil {
+			if IsAuthError(err) {
+				m.logger.Warn("websocket authentication failed", "userID", m.user.ID, "error", err)
+			}
+			return
+		}
+	}
+	_ = m.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	m.conn.SetPongHandler(func(string) error {
+		_ = m.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+
+	for {
+		msgType, data, err := m.conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) && !strings.Contains(err.Error(), "use of closed network connection") {
+				m.logger.Warn("websocket read failed", "userID", m.user.ID, "error", err)
+			}
+			break
+		}
+
+		if m.onActivity != nil {
+			m.onActivity()
+		}
+
+		switch msgType {
+		case websocket.TextMessage:
+			m.handleFrame(data)
+		case websocket.BinaryMessage:
+			m.sendError(nil, "uploads are not supported on multiplexed connections")
+		}
+	}
+}
+
+func (m *MultiClient) handleFrame(data []byte) {
+	var frame controlFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		m.logger.Warn("invalid JSON from client", "userID", m.user.ID, "error", err)
+		return
+	}
+	if frame.RoomID == nil {
+		m.sendError(nil, "roomId is required")
+		return
+	}
+	roomID := *frame.RoomID
+
+	switch frame.Action {
+	case ActionSubscribe:
+		if frame.History < 0 {
+			m.sendError(&roomID, "invalid history size")
+			return
+		}
+		if err := m.Subscribe(roomID, frame.History); err != nil {
+			m.logger.Warn("multiplexed subscribe failed", "roomID", roomID, "userID", m.user.ID, "error", err)
+			m.sendError(&roomID, err.Error())
+		}
+
+	case ActionUnsubscribe, ActionLeave:
+		if err := m.Unsubscribe(roomID); err != nil {
+			m.sendError(&roomID, err.Error())
+			return
+		}
+		m.sendControl(roomID, fmt.Sprintf("unsubscribed from room %d", roomID), model.AdditionalInfo{
+			"action": "unsubscribed",
+		})
+
+	case "", ActionSend:
+		m.mu.Lock()
+		sub, ok := m.subs[roomID]
+		m.mu.Unlock()
+		if !ok {
+			m.sendError(&roomID, ErrNotSubscribed.Error())
+			return
+		}
+		if !sub.handleTextMessage(data) {
+			// The room is closing; its forwarder reports the drop.
+			sub.Disconnect()
+		}
+
+	default:
+		m.sendError(&roomID, fmt.Sprintf("unknown action %q", frame.Action))
+	}
+}
+
+func (m *MultiClient) sendControl(roomID uint, message string, additionalInfo model.AdditionalInfo) {
+	m.sendSystem(&roomID, message, additionalInfo)
+}
+
+func (m *MultiClient) sendError(roomID *uint, errMsg string) {
+	m.sendSystem(roomID, errMsg, model.AdditionalInfo{"error": true})
+}
+
+func (m *MultiClient) sendSystem(roomID *uint, message string, additionalInfo model.AdditionalInfo) {
+	payload := model.OutgoingMessage{
+		ID:             uuid.New(),
+		MessageType:    model.SystemMessage,
+		Message:        message,
+		Timestamp:      time.Now(),
+		User:           m.systemUser,
+		AdditionalInfo: additionalInfo,
+	}
+	b, _ := json.Marshal(payload)
+	if roomID != nil {
+		b = tagRoom(*roomID, b)
+	}
+	select {
+	case m.out <- b:
+	case <-m.done:
+	default:
+		m.logger.Warn("failed to send message to multiplexed client, channel full", "userID", m.user.ID)
+	}
+}
+
+func (m *MultiClient) WritePump() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer func() {
+		ticker.Stop()
+		m.Disconnect()
+		m.conn.Close()
+	}()
+
+	writer := newWriteTracker(m.hub.WritePolicy())
+	for {
+		select {
+		case msg := <-m.out:
+			if err := writer.write(m.conn, websocket.TextMessage, msg); err != nil {
+				m.logWriteFailure("failed to write websocket message", err)
+				return
+			}
+
+		case <-ticker.C:
+			if err := writer.write(m.conn, websocket.PingMessage, nil); err != nil {
+				m.logWriteFailure("failed to send websocket ping", err)
+				return
+			}
+
+		case <-m.done:
+			m.flushQueued(writer)
+			_ = writer.write(m.conn, websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
+
+// flushQueued writes the messages already queued when the connection was
+// closed, so they aren't lost with it.
+func (m *MultiClient) flushQueued(writer *writeTracker) {
+	for {
+		select {
+		case msg := <-m.out:
+			if err := writer.write(m.conn, websocket.TextMessage, msg); err != nil {
+				m.logWriteFailure("failed to write websocket message", err)
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (m *MultiClient) logWriteFailure(msg string, err error) {
+	if isStuck(err) {
+		m.logger.Warn("dropping stuck websocket writer", "userID", m.user.ID, "userName", m.user.Name, "rooms", m.Subscriptions(), "error", err)
+		return
+	}
+	m.logger.Warn(msg, "userID", m.user.ID, "error", err)
+}
+
+// tagRoom adds a roomId field to a JSON object without decoding it.
+func tagRoom(roomID uint, msg []byte) []byte {
+	if len(msg) < 2 || msg[0] != '{' {
+		return msg
+	}
+	tagged := make([]byte, 0, len(msg)+24)
+	tagged = append(tagged, `{"roomId":`...)
+	tagged = strconv.AppendUint(tagged, uint64(roomID), 10)
+	if rest := msg[1:]; len(rest) > 0 && rest[0] != '}' {
+		tagged = append(tagged, ',')
+	}
+	return append(tagged, msg[1:]...)
+}
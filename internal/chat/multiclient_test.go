@@ -0,0 +1,245 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+type taggedMessage struct {
+	RoomID uint `json:"roomId"`
+	model.OutgoingMessage
+}
+
+func newTestMultiClient(t *testing.T, hub *Hub) *MultiClient {
+	t.Helper()
+	m := NewMultiClient(hub, nil, model.User{ID: uuid.New(), Name: "multi"}, model.User{ID: uuid.New(), Name: "system"}, testLogger())
+	t.Cleanup(m.Disconnect)
+	return m
+}
+
+func newHubRoom(t *testing.T, hub *Hub) *Room {
+	t.Helper()
+	room, _ := hub.CreateRoom(nil)
+	t.Cleanup(func() {
+		room.ShutdownOnce(func() { close(room.shutdown) })
+		<-room.closed
+	})
+	return room
+}
+
+// nextTagged reads frames from the multiplexed client until one matches.
+func nextTagged(t *testing.T, m *MultiClient, match func(taggedMessage) bool) taggedMessage {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case b := <-m.out:
+			var msg taggedMessage
+			if err := json.Unmarshal(b, &msg); err != nil {
+				t.Fatalf("unmarshal %s: %v", b, err)
+			}
+			if match(msg) {
+				return msg
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
+
+func TestTagRoom(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"message":"hi"}`, `{"roomId":7,"message":"hi"}`},
+		{`{}`, `{"roomId":7}`},
+		{`not json`, `not json`},
+	}
+	for _, tt := range tests {
+		if got := string(tagRoom(7, []byte(tt.in))); got != tt.want {
+			t.Errorf("tagRoom(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMultiClientSubscribeAndRoute(t *testing.T) {
+	hub := NewHub(testLogger())
+	first := newHubRoom(t, hub)
+	second := newHubRoom(t, hub)
+	m := newTestMultiClient(t, hub)
+
+	for _, room := range []*Room{first, second} {
+		m.handleFrame([]byte(fmt.Sprintf(`{"action":"subscribe","roomId":%d}`, room.ID())))
+		ack := nextTagged(t, m, func(msg taggedMessage) bool { return msg.AdditionalInfo["action"] == "subscribed" })
+		if ack.RoomID != room.ID() {
+			t.Errorf("expected ack for room %d, got %d", room.ID(), ack.RoomID)
+		}
+	}
+	if subs := m.Subscriptions(); len(subs) != 2 {
+		t.Fatalf("expected 2 subscriptions, got %v", subs)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	other := newTestClient(second, nil, "")
+	second.register <- other
+	time.Sleep(20 * time.Millisecond)
+	if !other.handleTextMessage([]byte(`{"message":"from second"}`)) {
+		t.Fatal("expected handleTextMessage to return true")
+	}
+	got := nextTagged(t, m, func(msg taggedMessage) bool { return msg.Message == "from second" })
+	if got.RoomID != second.ID() {
+		t.Errorf("expected roomId %d, got %d", second.ID(), got.RoomID)
+	}
+
+	m.handleFrame([]byte(fmt.Sprintf(`{"roomId":%d,"message":"to first"}`, first.ID())))
+	got = nextTagged(t, m, func(msg taggedMessage) bool { return msg.Message == "to first" })
+	if got.RoomID != first.ID() || got.User.ID != m.user.ID {
+		t.Errorf("unexpected echo: room %d user %s", got.RoomID, got.User.ID)
+	}
+	if msgs := first.GetMessages(); msgs[len(msgs)-1].Message != "to first" {
+		t.Errorf("expected message stored in first room, got %q", msgs[len(msgs)-1].Message)
+	}
+}
+
+func TestMultiClientUnsubscribe(t *testing.T) {
+	hub := NewHub(testLogger())
+	room := newHubRoom(t, hub)
+	m := newTestMultiClient(t, hub)
+
+	m.handleFrame([]byte(fmt.Sprintf(`{"action":"subscribe","roomId":%d}`, room.ID())))
+	nextTagged(t, m, func(msg taggedMessage) bool { return msg.AdditionalInfo["action"] == "subscribed" })
+	time.Sleep(20 * time.Millisecond)
+
+	m.handleFrame([]byte(fmt.Sprintf(`{"action":"unsubscribe","roomId":%d}`, room.ID())))
+	nextTagged(t, m, func(msg taggedMessage) bool { return msg.AdditionalInfo["action"] == "unsubscribed" })
+	time.Sleep(20 * time.Millisecond)
+
+	if n := room.GetClientCount(); n != 0 {
+		t.Errorf("expected room to have no clients, got %d", n)
+	}
+	if subs := m.Subscriptions(); len(subs) != 0 {
+		t.Errorf("expected no subscriptions, got %v", subs)
+	}
+
+	m.handleFrame([]byte(fmt.Sprintf(`{"roomId":%d,"message":"hi"}`, room.ID())))
+	errMsg := nextTagged(t, m, func(msg taggedMessage) bool { return msg.AdditionalInfo["error"] == true })
+	if errMsg.Message != ErrNotSubscribed.Error() {
+		t.Errorf("expected not subscribed error, got %q", errMsg.Message)
+	}
+}
+
+func TestMultiClientSubscribeErrors(t *testing.T) {
+	hub := NewHub(testLogger())
+	room := newHubRoom(t, hub)
+	m := newTestMultiClient(t, hub)
+
+	if err := m.Subscribe(room.ID()+100, 0); err != ErrRoomNotFound {
+		t.Errorf("expected ErrRoomNotFound, got %v", err)
+	}
+	if err := m.Subscribe(room.ID(), 0); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := m.Subscribe(room.ID(), 0); err != ErrAlreadySubscribed {
+		t.Errorf("expected ErrAlreadySubscribed, got %v", err)
+	}
+
+	banned := newHubRoom(t, hub)
+	banned.Ban(m.user.ID)
+	if err := m.Subscribe(banned.ID(), 0); err != ErrBanned {
+		t.Errorf("expected ErrBanned, got %v", err)
+	}
+
+	members := newHubRoom(t, hub)
+	members.PatchAdditionalInfo(model.AdditionalInfo{"requireRegisteredUsers": true})
+	if err := m.Subscribe(members.ID(), 0); err != ErrNotRegistered {
+		t.Errorf("expected ErrNotRegistered, got %v", err)
+	}
+	m.SetRegistered(true)
+	if err := m.Subscribe(members.ID(), 0); err != nil {
+		t.Errorf("expected registered user to subscribe, got %v", err)
+	}
+}
+
+func TestMultiClientKickedFromRoom(t *testing.T) {
+	hub := NewHub(testLogger())
+	room := newHubRoom(t, hub)
+	kept := newHubRoom(t, hub)
+	m := newTestMultiClient(t, hub)
+
+	for _, r := range []*Room{room, kept} {
+		if err := m.Subscribe(r.ID(), 0); err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if n := room.KickUser(m.user.ID); n != 1 {
+		t.Fatalf("expected 1 kicked client, got %d", n)
+	}
+
+	notice := nextTagged(t, m, func(msg taggedMessage) bool {
+		return msg.AdditionalInfo["action"] == "unsubscribed"
+	})
+	if notice.RoomID != room.ID() || notice.AdditionalInfo["reason"] != CloseKicked.Text {
+		t.Errorf("unexpected notice for room %d: %v", notice.RoomID, notice.AdditionalInfo)
+	}
+	if subs := m.Subscriptions(); len(subs) != 1 || subs[0] != kept.ID() {
+		t.Errorf("expected only room %d to remain, got %v", kept.ID(), subs)
+	}
+}
+
+func TestMultiClientDisconnectLeavesRooms(t *testing.T) {
+	hub := NewHub(testLogger())
+	first := newHubRoom(t, hub)
+	second := newHubRoom(t, hub)
+
+	released := make(chan struct{})
+	m := NewMultiClient(hub, nil, model.User{ID: uuid.New(), Name: "multi"}, model.User{}, testLogger())
+	m.SetOnDisconnect(func() { close(released) })
+	for _, r := range []*Room{first, second} {
+		if err := m.Subscribe(r.ID(), 0); err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	m.Disconnect()
+	time.Sleep(20 * time.Millisecond)
+
+	for _, r := range []*Room{first, second} {
+		if n := r.GetClientCount(); n != 0 {
+			t.Errorf("expected room %d to be empty, got %d clients", r.ID(), n)
+		}
+	}
+	select {
+	case <-released:
+	default:
+		t.Error("expected disconnect callback to run")
+	}
+	if err := m.Subscribe(first.ID(), 0); err == nil {
+		t.Error("expected subscribe after disconnect to fail")
+	}
+}
+
+func TestMultiClientLeave(t *testing.T) {
+	hub := NewHub(testLogger())
+	room := newHubRoom(t, hub)
+	m := newTestMultiClient(t, hub)
+
+	m.handleFrame([]byte(fmt.Sprintf(`{"action":"subscribe","roomId":%d}`, room.ID())))
+	nextTagged(t, m, func(msg taggedMessage) bool { return msg.AdditionalInfo["action"] == "subscribed" })
+	time.Sleep(20 * time.Millisecond)
+
+	m.handleFrame([]byte(fmt.Sprintf(`{"action":"leave","roomId":%d}`, room.ID())))
+	nextTagged(t, m, func(msg taggedMessage) bool { return msg.AdditionalInfo["action"] == "unsubscribed" })
+	time.Sleep(20 * time.Millisecond)
+
+	if n := room.GetClientCount(); n != 0 {
+		t.Errorf("expected room to have no clients, got %d", n)
+	}
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+// occupancyDebounce is how long a room collects joins and leaves before it
+// broadcasts its client count.
+const occupancyDebounce = 500 * time.Millisecond
+
+// scheduleOccupancy arranges for an occupancy event once the debounce
+// interval has passed. It must only be called from the Run goroutine.
+func (r *Room) scheduleOccupancy() {
+	if r.occupancyTimer != nil {
+		return
+	}
+	r.occupancyTimer = time.NewTimer(occupancyDebounce)
+}
+
+// occupancyDue fires when a scheduled occupancy event is due.
+func (r *Room) occupancyDue() <-chan time.Time {
+	if r.occupancyTimer == nil {
+		return nil
+	}
+	return r.occupancyTimer.C
+}
+
+// broadcastOccupancy sends the current client count to every client unless
+// it is the count that was sent last. It must only be called from the Run
+// goroutine.
+func (r *Room) broadcastOccupancy() {
+	r.occupancyTimer = nil
+	count := r.GetClientCount()
+	if count == r.lastOccupancy {
+		return
+	}
+	r.lastOccupancy = count
+
+	event := model.OutgoingMessage{
+		ID:          uuid.New(),
+		MessageType: model.OccupancyMessage,
+		Timestamp:   timeNow(),
+		User:        r.systemUser,
+		AdditionalInfo: model.AdditionalInfo{
+			"count": count,
+		},
+	}
+	b, _ := json.Marshal(event)
+	r.broadcastLocal(b)
+}
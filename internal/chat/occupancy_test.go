@@ -0,0 +1,64 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+// occupancyEvents drains the client's send buffer and returns the counts of
+// the occupancy events in it.
+func occupancyEvents(t *testing.T, c *Client) []float64 {
+	t.Helper()
+	var counts []float64
+	for len(c.send) > 0 {
+		var msg model.OutgoingMessage
+		if err := json.Unmarshal(<-c.send, &msg); err != nil {
+			t.Fatalf("failed to unmarshal message: %v", err)
+		}
+		if msg.MessageType == model.OccupancyMessage {
+			counts = append(counts, msg.AdditionalInfo["count"].(float64))
+		}
+	}
+	return counts
+}
+
+func TestRoomOccupancyDebounced(t *testing.T) {
+	room := newTestRoom(t)
+	first := newTestClient(room, nil, "")
+	second := newTestClient(room, nil, "")
+	third := newTestClient(room, nil, "")
+	room.register <- first
+	room.register <- second
+	room.register <- third
+	room.unregister <- third
+
+	time.Sleep(occupancyDebounce + 100*time.Millisecond)
+	if got := occupancyEvents(t, first); len(got) != 1 || got[0] != 2 {
+		t.Fatalf("expected a single occupancy event with count 2, got %v", got)
+	}
+
+	room.unregister <- second
+	time.Sleep(occupancyDebounce + 100*time.Millisecond)
+	if got := occupancyEvents(t, first); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("expected an occupancy event with count 1, got %v", got)
+	}
+}
+
+func TestRoomOccupancyUnchanged(t *testing.T) {
+	room := newTestRoom(t)
+	stays := newTestClient(room, nil, "")
+	room.register <- stays
+	time.Sleep(occupancyDebounce + 100*time.Millisecond)
+	occupancyEvents(t, stays)
+
+	visitor := newTestClient(room, nil, "")
+	room.register <- visitor
+	room.unregister <- visitor
+	time.Sleep(occupancyDebounce + 100*time.Millisecond)
+	if got := occupancyEvents(t, stays); len(got) != 0 {
+		t.Fatalf("expected no event when the count ends up unchanged, got %v", got)
+	}
+}
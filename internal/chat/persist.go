@@ -0,0 +1,36 @@
+package chat
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+// SaveRooms writes the details of the rooms PersistableRooms picks for window
+// to w as a JSON array, in the form RestoreRooms reads. Messages are not
+// saved.
+func (h *Hub) SaveRooms(w io.Writer, window time.Duration) error {
+	return json.NewEncoder(w).Encode(h.PersistableRooms(window))
+}
+
+// RestoreRooms reads rooms written by SaveRooms and recreates each with
+// RestoreRoom. Rooms that can't be restored, e.g. because their ID is in
+// use, are logged and skipped. It returns the number of restored rooms.
+func (h *Hub) RestoreRooms(r io.Reader) (int, error) {
+	var rooms []model.RoomDetail
+	if err := json.NewDecoder(r).Decode(&rooms); err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, room := range rooms {
+		if _, err := h.RestoreRoom(room.ID, room.AdditionalInfo, room.CreatedAt); err != nil {
+			h.logger.Warn("failed to restore room", "roomID", room.ID, "error", err)
+			continue
+		}
+		restored++
+	}
+	return restored, nil
+}
@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+// reconnectEntry tracks the identity behind a reconnect token. While client
+// is set the token's owner is connected; once it leaves, the leave message
+// is held back until the grace period ends.
+type reconnectEntry struct {
+	user   model.User
+	client *Client
+	timer  *time.Timer
+}
+
+// IssueReconnectToken creates a token that lets the client's user resume in
+// this room after the connection drops, without leave and join messages.
+// It returns "" if reconnects are disabled.
+func (r *Room) IssueReconnectToken(c *Client) string {
+	if r.reconnectGrace <= 0 {
+		return ""
+	}
+	token := rand.Text()
+
+	r.reconnectMu.Lock()
+	defer r.reconnectMu.Unlock()
+	if r.reconnects == nil {
+		r.reconnects = make(map[string]*reconnectEntry)
+	}
+	r.reconnects[token] = &reconnectEntry{user: c.user, client: c}
+	c.reconnectToken = token
+	return token
+}
+
+// ReconnectUser returns the user a reconnect token belongs to without
+// redeeming it.
+func (r *Room) ReconnectUser(token string) (model.User, bool) {
+	r.reconnectMu.Lock()
+	defer r.reconnectMu.Unlock()
+	entry, ok := r.reconnects[token]
+	if !ok {
+		return model.User{}, false
+	}
+	return entry.user, true
+}
+
+// Resume redeems a reconnect token and returns the user it belongs to. The
+// token's client is dropped quietly if it is still connected, and its
+// pending leave message is cancelled. Each token can be used once.
+func (r *Room) Resume(token string) (model.User, bool) {
+	r.reconnectMu.Lock()
+	entry, ok := r.reconnects[token]
+	if !ok {
+		r.reconnectMu.Unlock()
+		return model.User{}, false
+	}
+	delete(r.reconnects, token)
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	old := entry.client
+	if old != nil {
+		old.resumed = true
+	}
+	r.reconnectMu.Unlock()
+
+	if old != nil {
+		old.setCloseReason(CloseReplaced)
+		r.TryUnregister(old)
+	}
+	r.logger.Info("client resumed with reconnect token", "roomID", r.id, "userID", entry.user.ID)
+	return entry.user, true
+}
+
+// holdLeave postpones the leave message of a client that holds a reconnect
+// token. It reports whether the caller should skip announcing the leave,
+// either because it is held back or because the client was replaced by a
+// resumed connection. If the leave is not resumable, e.g. after a kick, the
+// client's token is revoked instead.
+func (r *Room) holdLeave(c *Client, leaveMsg model.OutgoingMessage, resumable bool) bool {
+	r.reconnectMu.Lock()
+	defer r.reconnectMu.Unlock()
+
+	if c.resumed {
+		return true
+	}
+	entry, ok := r.reconnects[c.reconnectToken]
+	if !ok || entry.client != c {
+		return false
+	}
+	if !resumable {
+		delete(r.reconnects, c.reconnectToken)
+		return false
+	}
+
+	token := c.reconnectToken
+	entry.client = nil
+	entry.timer = time.AfterFunc(r.reconnectGrace, func() {
+		r.reconnectMu.Lock()
+		current, ok := r.reconnects[token]
+		if !ok || current != entry {
+			// Resumed in the meantime.
+			r.reconnectMu.Unlock()
+			return
+		}
+		delete(r.reconnects, token)
+		r.reconnectMu.Unlock()
+
+		leaveMsg = r.StoreMessage(leaveMsg)
+		b, _ := json.Marshal(leaveMsg)
+		if !r.TryBroadcast(b) {
+			r.logger.Debug("failed to broadcast delayed leave message, room may be closing", "roomID", r.id)
+		}
+	})
+	return true
+}
@@ -0,0 +1,124 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+func newReconnectRoom(t *testing.T, grace time.Duration) *Room {
+	t.Helper()
+	hub := NewHub(testLogger())
+	hub.SetReconnectGrace(grace)
+	return newHubRoom(t, hub)
+}
+
+func leaveMessages(r *Room) int {
+	n := 0
+	for _, msg := range r.GetMessages() {
+		if msg.MessageType == model.SystemMessage && strings.Contains(msg.Message, " left room ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReconnectTokenDisabled(t *testing.T) {
+	room := newReconnectRoom(t, 0)
+	if token := room.IssueReconnectToken(newTestClient(room, nil, "")); token != "" {
+		t.Errorf("expected no token with reconnects disabled, got %q", token)
+	}
+}
+
+func TestResumeAfterDisconnect(t *testing.T) {
+	room := newReconnectRoom(t, time.Minute)
+	client := newTestClient(room, nil, "")
+	room.Join(client)
+	token := room.IssueReconnectToken(client)
+	time.Sleep(20 * time.Millisecond)
+
+	client.Disconnect()
+	time.Sleep(20 * time.Millisecond)
+	if n := leaveMessages(room); n != 0 {
+		t.Fatalf("expected leave to be held back, got %d leave messages", n)
+	}
+
+	user, ok := room.Resume(token)
+	if !ok || user.ID != client.user.ID {
+		t.Fatalf("expected to resume %s, got %s %v", client.user.ID, user.ID, ok)
+	}
+	if _, ok := room.Resume(token); ok {
+		t.Error("expected token to be single-use")
+	}
+}
+
+func TestResumeReplacesConnectedClient(t *testing.T) {
+	room := newReconnectRoom(t, time.Minute)
+	old := newTestClient(room, nil, "")
+	room.Join(old)
+	token := room.IssueReconnectToken(old)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := room.Resume(token); !ok {
+		t.Fatal("expected token of a connected client to be valid")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := room.GetClientCount(); n != 0 {
+		t.Errorf("expected replaced client to be removed, got %d clients", n)
+	}
+	if got := string(old.closeMessage()[2:]); got != CloseReplaced.Text {
+		t.Errorf("expected close reason %q, got %q", CloseReplaced.Text, got)
+	}
+
+	// Its read pump ending must not announce a leave.
+	old.Disconnect()
+	time.Sleep(20 * time.Millisecond)
+	if n := leaveMessages(room); n != 0 {
+		t.Errorf("expected no leave message, got %d", n)
+	}
+}
+
+func TestHeldLeaveAnnouncedAfterGrace(t *testing.T) {
+	room := newReconnectRoom(t, 30*time.Millisecond)
+	client := newTestClient(room, nil, "")
+	watcher := newTestClient(room, nil, "")
+	room.Join(client)
+	room.register <- watcher
+	token := room.IssueReconnectToken(client)
+	time.Sleep(20 * time.Millisecond)
+	for len(watcher.send) > 0 {
+		<-watcher.send
+	}
+
+	client.Disconnect()
+	select {
+	case b := <-watcher.send:
+		var msg model.OutgoingMessage
+		json.Unmarshal(b, &msg)
+		if msg.Message != fmt.Sprintf("tester left room %d", room.ID()) {
+			t.Errorf("unexpected message %q", msg.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for delayed leave")
+	}
+	if _, ok := room.Resume(token); ok {
+		t.Error("expected token to expire with the grace period")
+	}
+}
+
+func TestKickRevokesReconnectToken(t *testing.T) {
+	room := newReconnectRoom(t, time.Minute)
+	client := newTestClient(room, nil, "")
+	room.Join(client)
+	token := room.IssueReconnectToken(client)
+	time.Sleep(20 * time.Millisecond)
+
+	client.Kick()
+	if _, ok := room.ReconnectUser(token); ok {
+		t.Error("expected kick to revoke the token")
+	}
+}
@@ -1,45 +1,145 @@
 package chat
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"math/rand"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/choffmann/chat-room/internal/model"
 	"github.com/google/uuid"
 )
 
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrMessageDeleted  = errors.New("message is deleted")
+)
+
 const (
 	RoomTimeout         = 3 * time.Hour
 	RoomTimeoutInterval = 25 * time.Second
+	// RoomTimeoutJitter is the fraction by which each room randomly shifts
+	// its inactivity check interval, so rooms created together don't all
+	// check at the same moment.
+	RoomTimeoutJitter = 0.2
+
+	// MessageExpiryInterval is how often a room removes expired messages.
+	MessageExpiryInterval = 5 * time.Second
+	// MaxMessageTTL is the longest lifetime a client may request for a message.
+	MaxMessageTTL = 7 * 24 * time.Hour
 )
 
 // timeNow is a variable for testing purposes
 var timeNow = time.Now
 
+// BackpressurePolicy controls how a room treats clients whose send buffer is
+// full. A delivery is retried until SendTimeout elapses (shared across all
+// slow clients of a single broadcast) and a client is only disconnected after
+// MaxFailures consecutive failed deliveries. At most MaxEvictions clients are
+// disconnected at once, the others soon after; 0 means no limit. The zero
+// value disconnects on the first failed delivery.
+type BackpressurePolicy struct {
+	SendTimeout  time.Duration
+	MaxFailures  int
+	MaxEvictions int
+}
+
+var DefaultBackpressurePolicy = BackpressurePolicy{
+	SendTimeout:  100 * time.Millisecond,
+	MaxFailures:  3,
+	MaxEvictions: 100,
+}
+
+// Presence event types reported to the hub's presence hook.
+const (
+	PresenceJoined = "user_joined"
+	PresenceLeft   = "user_left"
+)
+
+// PresenceEvent describes a connection joining or leaving a room.
+type PresenceEvent struct {
+	Type      string     `json:"type"`
+	RoomID    uint       `json:"roomId"`
+	User      model.User `json:"user"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
 type Room struct {
-	id             uint
-	hub            *Hub
-	clientsMu      sync.RWMutex
-	clients        map[*Client]bool
-	broadcast      chan []byte
-	register       chan *Client
-	unregister     chan *Client
-	closed         chan struct{}
-	shutdown       chan struct{}
-	shutdownOnce   sync.Once
-	activityMu     sync.RWMutex
-	lastActivity   time.Time
-	additionalInfo model.AdditionalInfo
-	messagesMu     sync.RWMutex
-	messages       []model.OutgoingMessage
-	logger         *slog.Logger
+	id              uint
+	hub             *Hub
+	clientsMu       sync.RWMutex
+	clients         map[*Client]bool
+	broadcast       chan []byte
+	audience        chan audienceBroadcast
+	register        chan *Client
+	unregister      chan *Client
+	ping            chan chan struct{}
+	closed          chan struct{}
+	shutdown        chan struct{}
+	shutdownOnce    sync.Once
+	createdAt       time.Time
+	activityMu      sync.RWMutex
+	lastActivity    time.Time
+	infoMu          sync.RWMutex
+	additionalInfo  model.AdditionalInfo
+	messagesMu      sync.RWMutex
+	store           MessageStore
+	memStore        memoryStore
+	pins            []uuid.UUID
+	index           *searchIndex
+	replies         map[uuid.UUID][]uuid.UUID
+	expiries        map[uuid.UUID]time.Time
+	nextSeq         uint64
+	storedBytes     int
+	maxStoredBytes  int
+	cipher          *MessageCipher
+	backpressure    BackpressurePolicy
+	writePolicy     WritePolicy
+	flood           FloodPolicy
+	floodWindow     time.Time
+	floodCount      int
+	slowModeUntil   atomic.Int64
+	occupancyTimer  *time.Timer
+	lastOccupancy   int
+	emptyTimeout    time.Duration
+	emptyTimer      *time.Timer
+	evictions       []*Client
+	droppedMessages atomic.Int64
+	deadLettersMu   sync.Mutex
+	deadLetters     []DeadLetter
+	resolveUser     UserResolver
+	cooldownMu      sync.Mutex
+	lastMessageAt   map[uuid.UUID]time.Time
+	bansMu          sync.RWMutex
+	bans            map[uuid.UUID]struct{}
+	mutesMu         sync.RWMutex
+	mutes           map[uuid.UUID]struct{}
+	systemUser      model.User
+	validateInfo    func(model.AdditionalInfo) []string
+	filter          func(string) string
+	maxInfoBytes    int
+	maxImageBytes   int
+	onPresence      func(PresenceEvent)
+	reconnectGrace  time.Duration
+	closeGrace      time.Duration
+	reconnectMu     sync.Mutex
+	reconnects      map[string]*reconnectEntry
+	logger          *slog.Logger
 }
 
 func (r *Room) ID() uint                { return r.id }
 func (r *Room) Shutdown() chan struct{} { return r.shutdown }
 func (r *Room) Closed() chan struct{}   { return r.closed }
+func (r *Room) CreatedAt() time.Time    { return r.createdAt }
 
 func (r *Room) ShutdownOnce(f func()) {
 	r.shutdownOnce.Do(f)
@@ -51,15 +151,21 @@ func (r *Room) UpdateActivityNow() {
 	r.lastActivity = time.Now()
 }
 
+func (r *Room) LastActivity() time.Time {
+	r.activityMu.RLock()
+	defer r.activityMu.RUnlock()
+	return r.lastActivity
+}
+
 func (r *Room) UpdateAdditionalInfo(newInfo model.AdditionalInfo) {
-	r.activityMu.Lock()
-	defer r.activityMu.Unlock()
+	r.infoMu.Lock()
+	defer r.infoMu.Unlock()
 	r.additionalInfo = newInfo
 }
 
 func (r *Room) PatchAdditionalInfo(updates model.AdditionalInfo) {
-	r.activityMu.Lock()
-	defer r.activityMu.Unlock()
+	r.infoMu.Lock()
+	defer r.infoMu.Unlock()
 	if r.additionalInfo == nil {
 		r.additionalInfo = make(model.AdditionalInfo)
 	}
@@ -68,9 +174,15 @@ func (r *Room) PatchAdditionalInfo(updates model.AdditionalInfo) {
 	}
 }
 
+func (r *Room) removeAdditionalInfoKey(key string) {
+	r.infoMu.Lock()
+	defer r.infoMu.Unlock()
+	delete(r.additionalInfo, key)
+}
+
 func (r *Room) GetAdditionalInfo() model.AdditionalInfo {
-	r.activityMu.RLock()
-	defer r.activityMu.RUnlock()
+	r.infoMu.RLock()
+	defer r.infoMu.RUnlock()
 	info := make(model.AdditionalInfo, len(r.additionalInfo))
 	for k, v := range r.additionalInfo {
 		info[k] = v
@@ -82,7 +194,7 @@ func (r *Room) DisconnectAllClients() {
 	r.clientsMu.Lock()
 	defer r.clientsMu.Unlock()
 	for c := range r.clients {
-		c.CloseSend()
+		c.CloseSendWithReason(CloseRoomClosed)
 	}
 }
 
@@ -103,6 +215,198 @@ func (r *Room) GetUsers() []model.User {
 	return users
 }
 
+// ConnectionDetail is a connected user together with where the connection
+// came from.
+type ConnectionDetail struct {
+	User model.User `json:"user"`
+	ConnInfo
+}
+
+// MarshalJSON writes the detail with connectedAt in the configured
+// timestamp layout.
+func (d ConnectionDetail) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		User        model.User `json:"user"`
+		RemoteAddr  string     `json:"remoteAddr"`
+		UserAgent   string     `json:"userAgent,omitempty"`
+		ConnectedAt string     `json:"connectedAt"`
+	}{
+		User:        d.User,
+		RemoteAddr:  d.RemoteAddr,
+		UserAgent:   d.UserAgent,
+		ConnectedAt: model.FormatTimestamp(d.ConnectedAt),
+	})
+}
+
+// GetConnectionDetails returns every connection in the room with its
+// connection info. Users with several connections are listed once per
+// connection.
+func (r *Room) GetConnectionDetails() []ConnectionDetail {
+	r.clientsMu.RLock()
+	defer r.clientsMu.RUnlock()
+
+	details := make([]ConnectionDetail, 0, len(r.clients))
+	for client := range r.clients {
+		details = append(details, ConnectionDetail{User: client.user, ConnInfo: client.connInfo})
+	}
+	return details
+}
+
+// GetClientsByUserID returns all connections of the given user in this room.
+func (r *Room) GetClientsByUserID(userID uuid.UUID) []*Client {
+	r.clientsMu.RLock()
+	defer r.clientsMu.RUnlock()
+
+	clients := make([]*Client, 0)
+	for client := range r.clients {
+		if client.user.ID == userID {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// KickUser removes every connection of the given user from the room and
+// returns how many connections were removed.
+func (r *Room) KickUser(userID uuid.UUID) int {
+	clients := r.GetClientsByUserID(userID)
+	for _, c := range clients {
+		c.Kick()
+	}
+	if len(clients) > 0 {
+		r.logger.Info("user kicked from room", "roomID", r.id, "userID", userID, "connections", len(clients))
+	}
+	return len(clients)
+}
+
+// Ban adds the user to the room's ban list and reports whether the user was
+// not banned before. Banning does not disconnect the user; see KickUser.
+func (r *Room) Ban(userID uuid.UUID) bool {
+	r.bansMu.Lock()
+	defer r.bansMu.Unlock()
+
+	if r.bans == nil {
+		r.bans = make(map[uuid.UUID]struct{})
+	}
+	if _, ok := r.bans[userID]; ok {
+		return false
+	}
+	r.bans[userID] = struct{}{}
+	return true
+}
+
+// Unban removes the user from the room's ban list and reports whether the
+// user was banned.
+func (r *Room) Unban(userID uuid.UUID) bool {
+	r.bansMu.Lock()
+	defer r.bansMu.Unlock()
+
+	if _, ok := r.bans[userID]; !ok {
+		return false
+	}
+	delete(r.bans, userID)
+	return true
+}
+
+// RequiresRegisteredUsers reports whether the room's additionalInfo has
+// "requireRegisteredUsers": true, in which case ephemeral users can't join.
+func (r *Room) RequiresRegisteredUsers() bool {
+	r.infoMu.RLock()
+	defer r.infoMu.RUnlock()
+	return r.additionalInfo["requireRegisteredUsers"] == true
+}
+
+// filterMessage applies the hub's message filter to text unless the room
+// turned it off with additionalInfo.filterMessages set to false.
+func (r *Room) filterMessage(text string) string {
+	if r.filter == nil {
+		return text
+	}
+	r.infoMu.RLock()
+	enabled := r.additionalInfo["filterMessages"] != false
+	r.infoMu.RUnlock()
+	if !enabled {
+		return text
+	}
+	return r.filter(text)
+}
+
+func (r *Room) IsBanned(userID uuid.UUID) bool {
+	r.bansMu.RLock()
+	defer r.bansMu.RUnlock()
+
+	_, ok := r.bans[userID]
+	return ok
+}
+
+// GetBans returns the banned user IDs in a stable order.
+func (r *Room) GetBans() []uuid.UUID {
+	r.bansMu.RLock()
+	defer r.bansMu.RUnlock()
+
+	bans := make([]uuid.UUID, 0, len(r.bans))
+	for id := range r.bans {
+		bans = append(bans, id)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].String() < bans[j].String()
+	})
+	return bans
+}
+
+// Mute adds the user to the room's mute list and reports whether the user
+// was not muted before. Muted users stay connected and keep receiving
+// messages, but their own messages are rejected.
+func (r *Room) Mute(userID uuid.UUID) bool {
+	r.mutesMu.Lock()
+	defer r.mutesMu.Unlock()
+
+	if r.mutes == nil {
+		r.mutes = make(map[uuid.UUID]struct{})
+	}
+	if _, ok := r.mutes[userID]; ok {
+		return false
+	}
+	r.mutes[userID] = struct{}{}
+	return true
+}
+
+// Unmute removes the user from the room's mute list and reports whether the
+// user was muted.
+func (r *Room) Unmute(userID uuid.UUID) bool {
+	r.mutesMu.Lock()
+	defer r.mutesMu.Unlock()
+
+	if _, ok := r.mutes[userID]; !ok {
+		return false
+	}
+	delete(r.mutes, userID)
+	return true
+}
+
+func (r *Room) IsMuted(userID uuid.UUID) bool {
+	r.mutesMu.RLock()
+	defer r.mutesMu.RUnlock()
+
+	_, ok := r.mutes[userID]
+	return ok
+}
+
+// GetMutes returns the muted user IDs in a stable order.
+func (r *Room) GetMutes() []uuid.UUID {
+	r.mutesMu.RLock()
+	defer r.mutesMu.RUnlock()
+
+	mutes := make([]uuid.UUID, 0, len(r.mutes))
+	for id := range r.mutes {
+		mutes = append(mutes, id)
+	}
+	sort.Slice(mutes, func(i, j int) bool {
+		return mutes[i].String() < mutes[j].String()
+	})
+	return mutes
+}
+
 func (r *Room) TryBroadcast(msg []byte) bool {
 	select {
 	case r.broadcast <- msg:
@@ -121,6 +425,40 @@ func (r *Room) TryRegister(c *Client) bool {
 	}
 }
 
+// Join registers the client and announces its user to the room. The join
+// message is stored and broadcast by the room goroutine right after
+// registration, so the new client receives it too and the stored order of
+// join messages matches the order in which clients were registered. It
+// returns false if the room is closing.
+func (r *Room) Join(c *Client) bool {
+	c.announceJoin = true
+	return r.TryRegister(c)
+}
+
+// announceJoin stores and delivers the join message of a freshly registered
+// client. It must only be called from the Run goroutine.
+func (r *Room) announceJoin(c *Client) {
+	displayName := model.GetDisplayName(c.user)
+	hello := model.OutgoingMessage{
+		ID:          uuid.New(),
+		MessageType: model.SystemMessage,
+		Message:     fmt.Sprintf("%s joined room %d", displayName, r.id),
+		Timestamp:   time.Now(),
+		User:        c.systemUser,
+		AdditionalInfo: model.AdditionalInfo{
+			"joinedUser": c.user,
+			// Deprecated: kept for pre-2.0 clients, remove in v2
+			"joinedUserId":   c.user.ID.String(),
+			"joinedUserName": displayName,
+		},
+	}
+
+	hello = r.StoreMessage(hello)
+
+	b, _ := json.Marshal(hello)
+	r.broadcastLocal(b)
+}
+
 func (r *Room) TryUnregister(c *Client) bool {
 	select {
 	case r.unregister <- c:
@@ -138,69 +476,253 @@ func (r *Room) Run() {
 	}()
 
 	go r.deleteRoomWithNoActivity(ctx)
+	go r.sweepExpiredMessages(ctx)
 
 	for {
 		select {
 		case <-r.shutdown:
 			r.logger.Info("room shutdown signal received", "roomID", r.id)
+			r.flushBroadcasts()
 			return
 
 		case c := <-r.register:
 			r.clientsMu.Lock()
 			r.clients[c] = true
 			r.clientsMu.Unlock()
+			r.cancelEmptyCleanup()
+			r.replayHistory(c)
+			if c.announceJoin {
+				r.announceJoin(c)
+			}
 			r.UpdateActivityNow()
+			r.notifyPresence(PresenceJoined, c.user)
+			r.scheduleOccupancy()
 
 		case c := <-r.unregister:
 			r.clientsMu.Lock()
-			if _, ok := r.clients[c]; ok {
+			_, ok := r.clients[c]
+			if ok {
 				delete(r.clients, c)
 				c.CloseSend()
 			}
 			r.clientsMu.Unlock()
+			if ok {
+				r.notifyPresence(PresenceLeft, c.user)
+				r.scheduleOccupancy()
+				r.scheduleEmptyCleanup()
+			}
 
 		case msg := <-r.broadcast:
 			r.UpdateActivityNow()
-			r.clientsMu.RLock()
-			clientsList := make([]*Client, 0, len(r.clients))
-			for c := range r.clients {
-				clientsList = append(clientsList, c)
-			}
-			r.clientsMu.RUnlock()
-
-			failedClients := make([]*Client, 0)
-			for _, c := range clientsList {
-				select {
-				case c.send <- msg:
-				default:
-					failedClients = append(failedClients, c)
-				}
+			r.trackFlood(timeNow(), msg)
+			r.broadcastLocal(msg)
+			r.publishBroadcast(msg)
+
+		case b := <-r.audience:
+			r.UpdateActivityNow()
+			r.trackFlood(timeNow(), b.msg)
+			r.broadcastFiltered(b.msg, b.includes)
+
+		case reply := <-r.ping:
+			close(reply)
+
+		case <-r.occupancyDue():
+			r.broadcastOccupancy()
+
+		case <-r.emptyDue():
+			if r.deleteIfEmpty() {
+				return
 			}
 
-			if len(failedClients) > 0 {
-				r.clientsMu.Lock()
-				for _, c := range failedClients {
-					delete(r.clients, c)
-					c.CloseSend()
-				}
-				r.clientsMu.Unlock()
+		case <-r.evictionsDue():
+			r.evictPending()
+		}
+	}
+}
+
+// notifyShutdown broadcasts a system message with "shutdown": true telling
+// clients the server is going away. It is not stored.
+func (r *Room) notifyShutdown(text string) {
+	msg := model.OutgoingMessage{
+		ID:             uuid.New(),
+		MessageType:    model.SystemMessage,
+		Message:        text,
+		Timestamp:      timeNow(),
+		User:           r.systemUser,
+		AdditionalInfo: model.AdditionalInfo{"shutdown": true},
+	}
+	b, _ := json.Marshal(msg)
+	if !r.TryBroadcast(b) {
+		r.logger.Debug("failed to send shutdown notice, room is closing", "roomID", r.id)
+	}
+}
+
+// flushBroadcasts delivers the broadcasts still queued when the room shuts
+// down, so clients see the room's final messages before they are closed.
+func (r *Room) flushBroadcasts() {
+	for {
+		select {
+		case msg := <-r.broadcast:
+			r.broadcastLocal(msg)
+			r.publishBroadcast(msg)
+		case b := <-r.audience:
+			r.broadcastFiltered(b.msg, b.includes)
+		default:
+			return
+		}
+	}
+}
+
+// broadcastLocal delivers msg to every registered client and drops the ones
+// that exceeded the backpressure policy. It must only be called from the Run
+// goroutine.
+func (r *Room) broadcastLocal(msg []byte) {
+	r.broadcastFiltered(msg, nil)
+}
+
+// broadcastFiltered is broadcastLocal for the clients include accepts; a nil
+// include accepts all of them.
+func (r *Room) broadcastFiltered(msg []byte, include func(*Client) bool) {
+	r.clientsMu.RLock()
+	clientsList := make([]*Client, 0, len(r.clients))
+	for c := range r.clients {
+		// Clients waiting to be disconnected would only stall the broadcast.
+		if c.evicting {
+			continue
+		}
+		if include == nil || include(c) {
+			clientsList = append(clientsList, c)
+		}
+	}
+	r.clientsMu.RUnlock()
+
+	if failedClients := r.deliver(clientsList, msg); len(failedClients) > 0 {
+		r.queueEvictions(failedClients)
+		r.evictPending()
+	}
+}
+
+// notifyPresence reports a join or leave to the hub's subscribers and to the
+// presence hook, if any. It runs on the Run goroutine, so the hook must not
+// block.
+func (r *Room) notifyPresence(eventType string, user model.User) {
+	now := timeNow()
+	r.publishEvent(Event{Type: eventType, RoomID: r.id, User: user, Timestamp: now})
+	if r.onPresence == nil {
+		return
+	}
+	r.onPresence(PresenceEvent{
+		Type:      eventType,
+		RoomID:    r.id,
+		User:      user,
+		Timestamp: now,
+	})
+}
+
+// replayHistory queues the last stored messages, oldest first, for a freshly
+// registered client. It runs on the room goroutine so the history is queued
+// before any broadcast reaches the client. The messages bypass the send
+// buffer; the client's writer drains them at its own pace.
+func (r *Room) replayHistory(c *Client) {
+	if c.historySize == 0 {
+		return
+	}
+
+	messages := slices.DeleteFunc(r.GetMessages(), func(msg model.OutgoingMessage) bool {
+		return !CanSee(c.user, msg)
+	})
+	if len(messages) > c.historySize {
+		messages = messages[len(messages)-c.historySize:]
+	}
+
+	history := make([][]byte, 0, len(messages))
+	for _, msg := range messages {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			r.logger.Warn("failed to marshal history message", "roomID", r.id, "messageID", msg.ID, "error", err)
+			continue
+		}
+		history = append(history, b)
+	}
+	c.queueHistory(history)
+}
+
+// deliver sends msg to every client and returns the clients that exceeded the
+// room's backpressure policy. It must only be called from the Run goroutine.
+func (r *Room) deliver(clients []*Client, msg []byte) []*Client {
+	maxFailures := max(r.backpressure.MaxFailures, 1)
+
+	var deadline *time.Timer
+	expired := r.backpressure.SendTimeout <= 0
+	defer func() {
+		if deadline != nil {
+			deadline.Stop()
+		}
+	}()
+
+	failedClients := make([]*Client, 0)
+	for _, c := range clients {
+		select {
+		case c.send <- msg:
+			c.sendFailures = 0
+			continue
+		default:
+		}
+
+		if !expired {
+			if deadline == nil {
+				deadline = time.NewTimer(r.backpressure.SendTimeout)
 			}
+			select {
+			case c.send <- msg:
+				c.sendFailures = 0
+				continue
+			case <-deadline.C:
+				expired = true
+			}
+		}
+
+		c.sendFailures++
+		r.recordDrop(c, msg)
+		if c.sendFailures >= maxFailures {
+			failedClients = append(failedClients, c)
 		}
 	}
+	return failedClients
+}
+
+// isPermanent reports whether the room has "permanent": true in its
+// additionalInfo, which exempts it from automatic deletion.
+func (r *Room) isPermanent() bool {
+	r.infoMu.RLock()
+	defer r.infoMu.RUnlock()
+	return r.additionalInfo["permanent"] == true
+}
+
+// idleTimedOut reports whether the room has been inactive for longer than
+// RoomTimeout. Rooms with "permanent": true in their additionalInfo never
+// time out; the flag is read on every check, so toggling it via PATCH takes
+// effect on the next tick.
+func (r *Room) idleTimedOut(now time.Time) bool {
+	if r.isPermanent() {
+		return false
+	}
+	return now.Sub(r.LastActivity()) > RoomTimeout
+}
+
+// jitter returns d shifted randomly by up to ±fraction of d.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*fraction*float64(d))
 }
 
 func (r *Room) deleteRoomWithNoActivity(ctx context.Context) {
-	ticker := time.NewTicker(RoomTimeoutInterval)
+	ticker := time.NewTicker(jitter(RoomTimeoutInterval, RoomTimeoutJitter))
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			r.activityMu.RLock()
-			timeSinceActivity := time.Since(r.lastActivity)
-			r.activityMu.RUnlock()
-
-			if timeSinceActivity > RoomTimeout {
+			if r.idleTimedOut(time.Now()) {
 				r.shutdownOnce.Do(func() {
 					close(r.shutdown)
 				})
@@ -217,73 +739,576 @@ func (r *Room) deleteRoomWithNoActivity(ctx context.Context) {
 	}
 }
 
-func (r *Room) StoreMessage(msg model.OutgoingMessage) {
+func (r *Room) sweepExpiredMessages(ctx context.Context) {
+	ticker := time.NewTicker(MessageExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, msg := range r.removeExpiredMessages(timeNow()) {
+				r.BroadcastDeletion(msg, "expired")
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// removeExpiredMessages drops every stored message whose expiry is not after
+// now and returns the removed messages. The write lock is only taken when
+// something actually expired.
+func (r *Room) removeExpiredMessages(now time.Time) []model.OutgoingMessage {
+	r.messagesMu.RLock()
+	pending := false
+	for _, expiresAt := range r.expiries {
+		if !expiresAt.After(now) {
+			pending = true
+			break
+		}
+	}
+	r.messagesMu.RUnlock()
+	if !pending {
+		return nil
+	}
+
 	r.messagesMu.Lock()
 	defer r.messagesMu.Unlock()
+
+	expired := make(map[uuid.UUID]struct{})
+	for id, expiresAt := range r.expiries {
+		if !expiresAt.After(now) {
+			expired[id] = struct{}{}
+			delete(r.expiries, id)
+		}
+	}
+
+	removed := make([]model.OutgoingMessage, 0, len(expired))
+	for id := range expired {
+		msg, ok := r.messages().Get(id)
+		if !ok {
+			continue
+		}
+		removed = append(removed, msg)
+		r.storedBytes -= messageSize(msg)
+		if r.index != nil {
+			r.index.remove(id)
+		}
+	}
+	r.messages().Delete(slices.Collect(maps.Keys(expired))...)
+	slices.SortFunc(removed, func(a, b model.OutgoingMessage) int {
+		return cmp.Compare(a.Seq, b.Seq)
+	})
+
+	if len(removed) > 0 {
+		r.logger.Info("removed expired messages", "roomID", r.id, "count", len(removed))
+	}
+	return removed
+}
+
+// BroadcastDeletion tells the clients that may see msg that it is gone.
+func (r *Room) BroadcastDeletion(msg model.OutgoingMessage, reason string) {
+	event := model.OutgoingMessage{
+		ID:          uuid.New(),
+		MessageType: model.MessageDeleted,
+		Timestamp:   timeNow(),
+		User:        r.systemUser,
+		AdditionalInfo: model.AdditionalInfo{
+			"messageId": msg.ID,
+			"reason":    reason,
+		},
+	}
+	b, _ := json.Marshal(event)
+	r.tryBroadcastFor(msg, b)
+}
+
+// BroadcastUpdate tells all clients that a stored message was edited. The
+// event carries the new text and additionalInfo rather than the message
+// itself, so it can't be mistaken for a new message. Edits of a message
+// with an audience only reach that audience.
+func (r *Room) BroadcastUpdate(msg model.OutgoingMessage) {
+	event := model.OutgoingMessage{
+		ID:          uuid.New(),
+		MessageType: model.MessageUpdated,
+		Message:     msg.Message,
+		Timestamp:   timeNow(),
+		User:        r.systemUser,
+		AdditionalInfo: model.AdditionalInfo{
+			"messageId":      msg.ID,
+			"additionalInfo": msg.AdditionalInfo,
+		},
+	}
+	b, _ := json.Marshal(event)
+	if !r.tryBroadcastFor(msg, b) {
+		r.logger.Debug("failed to broadcast message update, room may be closing", "roomID", r.id)
+	}
+}
+
+// BroadcastUpdates announces several edited messages in one message_updated
+// event whose additionalInfo.updates lists them. Messages with an audience
+// are announced to that audience separately.
+func (r *Room) BroadcastUpdates(msgs []model.OutgoingMessage) {
+	updates := make([]model.AdditionalInfo, 0, len(msgs))
+	for _, msg := range msgs {
+		if Audience(msg) != "" {
+			r.BroadcastUpdate(msg)
+			continue
+		}
+		updates = append(updates, model.AdditionalInfo{
+			"messageId":      msg.ID,
+			"message":        msg.Message,
+			"additionalInfo": msg.AdditionalInfo,
+		})
+	}
+	if len(updates) == 0 {
+		return
+	}
+
+	event := model.OutgoingMessage{
+		ID:          uuid.New(),
+		MessageType: model.MessageUpdated,
+		Timestamp:   timeNow(),
+		User:        r.systemUser,
+		AdditionalInfo: model.AdditionalInfo{
+			"updates": updates,
+		},
+	}
+	b, _ := json.Marshal(event)
+	if !r.TryBroadcast(b) {
+		r.logger.Debug("failed to broadcast message updates, room may be closing", "roomID", r.id)
+	}
+}
+
+// isExpiredLocked reports whether the message has passed its expiry. The
+// caller must hold messagesMu.
+func (r *Room) isExpiredLocked(messageID uuid.UUID, now time.Time) bool {
+	expiresAt, ok := r.expiries[messageID]
+	return ok && !expiresAt.After(now)
+}
+
+// messages returns the room's message store. Rooms without a configured
+// store keep their history in memory. The caller must hold messagesMu.
+func (r *Room) messages() MessageStore {
+	if r.store == nil {
+		return &r.memStore
+	}
+	return r.store
+}
+
+// StoreMessage adds a message to the room's history and returns it with its
+// sequence number set. Sequence numbers start at 1 and increase with every
+// stored message, so they order the history even when timestamps collide.
+func (r *Room) StoreMessage(msg model.OutgoingMessage) model.OutgoingMessage {
+	r.messagesMu.Lock()
+	defer r.messagesMu.Unlock()
+	return r.storeMessageLocked(msg)
+}
+
+// ImportMessages adds historical messages to the store without broadcasting
+// them. With replace the existing history, pins included, is dropped first.
+// Messages whose ID is missing or already stored get a new one; replies to
+// them are relinked, so IDs must be unique within messages. Imported messages get new sequence numbers. It returns
+// the number of stored messages afterwards.
+func (r *Room) ImportMessages(messages []model.OutgoingMessage, replace bool) int {
+	r.messagesMu.Lock()
+	defer r.messagesMu.Unlock()
+
+	if replace {
+		all := r.messages().GetAll()
+		ids := make([]uuid.UUID, len(all))
+		for i, msg := range all {
+			ids[i] = msg.ID
+		}
+		r.messages().Delete(ids...)
+		r.pins = nil
+		r.replies = nil
+		r.expiries = nil
+		r.storedBytes = 0
+		if r.index != nil {
+			r.index = newSearchIndex()
+		}
+	}
+
+	taken := make(map[uuid.UUID]struct{}, r.messages().Len()+len(messages))
+	for _, msg := range r.messages().GetAll() {
+		taken[msg.ID] = struct{}{}
+	}
+	renamed := make(map[uuid.UUID]uuid.UUID)
+	for _, msg := range messages {
+		if _, ok := taken[msg.ID]; ok || msg.ID == uuid.Nil {
+			newID := uuid.New()
+			renamed[msg.ID] = newID
+			msg.ID = newID
+		}
+		taken[msg.ID] = struct{}{}
+		if msg.ParentID != nil {
+			if newID, ok := renamed[*msg.ParentID]; ok {
+				msg.ParentID = &newID
+			}
+		}
+		r.storeMessageLocked(msg)
+	}
+
+	r.logger.Info("imported messages", "roomID", r.id, "count", len(messages), "renamed", len(renamed), "replace", replace)
+	return r.messages().Len()
+}
+
+// storeMessageLocked must be called with messagesMu held for writing.
+func (r *Room) storeMessageLocked(msg model.OutgoingMessage) model.OutgoingMessage {
 	if msg.AdditionalInfo == nil {
 		msg.AdditionalInfo = make(model.AdditionalInfo)
 	}
-	r.messages = append(r.messages, msg)
+	r.nextSeq++
+	msg.Seq = r.nextSeq
+	if r.index != nil {
+		r.index.add(msg)
+	}
+	stored := r.sealMessage(msg)
+	r.messages().Store(stored)
+	r.storedBytes += messageSize(stored)
+
+	if msg.ParentID != nil {
+		if r.replies == nil {
+			r.replies = make(map[uuid.UUID][]uuid.UUID)
+		}
+		r.replies[*msg.ParentID] = append(r.replies[*msg.ParentID], msg.ID)
+	}
+
+	if expiresAt, ok := msg.AdditionalInfo["expiresAt"].(time.Time); ok {
+		if r.expiries == nil {
+			r.expiries = make(map[uuid.UUID]time.Time)
+		}
+		r.expiries[msg.ID] = expiresAt
+	}
+
+	r.enforceBudgetLocked()
+	return msg
+}
+
+// StoredBytes returns the JSON size of all stored messages.
+func (r *Room) StoredBytes() int {
+	r.messagesMu.RLock()
+	defer r.messagesMu.RUnlock()
+	return r.storedBytes
+}
+
+// MaxStoredBytes returns the room's message byte budget; 0 means unlimited.
+func (r *Room) MaxStoredBytes() int { return r.maxStoredBytes }
+
+// enforceBudgetLocked evicts the oldest messages until the stored bytes fit
+// the room's budget. The newest message is always kept. The caller must hold
+// messagesMu for writing.
+func (r *Room) enforceBudgetLocked() {
+	if r.maxStoredBytes <= 0 || r.storedBytes <= r.maxStoredBytes {
+		return
+	}
+
+	all := r.messages().GetAll()
+	var evicted []uuid.UUID
+	for len(evicted) < len(all)-1 && r.storedBytes > r.maxStoredBytes {
+		msg := all[len(evicted)]
+		r.storedBytes -= messageSize(msg)
+		delete(r.expiries, msg.ID)
+		if r.index != nil {
+			r.index.remove(msg.ID)
+		}
+		evicted = append(evicted, msg.ID)
+	}
+	if len(evicted) == 0 {
+		return
+	}
+
+	r.messages().Delete(evicted...)
+	r.logger.Debug("evicted messages over byte budget", "roomID", r.id, "count", len(evicted), "storedBytes", r.storedBytes)
+}
+
+// messageSize is the number of bytes a message takes up in the room's
+// budget, measured as its JSON encoding.
+func messageSize(msg model.OutgoingMessage) int {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return 0
+	}
+	return len(b)
 }
 
 func (r *Room) GetMessages() []model.OutgoingMessage {
 	r.messagesMu.RLock()
 	defer r.messagesMu.RUnlock()
-	messages := make([]model.OutgoingMessage, len(r.messages))
-	copy(messages, r.messages)
+	now := timeNow()
+	resolve := r.authorResolver()
+	stored := r.messages().GetAll()
+	messages := make([]model.OutgoingMessage, 0, len(stored))
+	for _, msg := range stored {
+		if !r.isExpiredLocked(msg.ID, now) {
+			messages = append(messages, withCurrentAuthor(resolve, r.openMessage(msg)))
+		}
+	}
 	return messages
 }
 
+// LatestMessage returns the newest stored message that skip doesn't reject.
+// It walks the history from the end, so only the messages it looks at are
+// decrypted.
+func (r *Room) LatestMessage(skip func(model.OutgoingMessage) bool) (model.OutgoingMessage, bool) {
+	r.messagesMu.RLock()
+	defer r.messagesMu.RUnlock()
+	now := timeNow()
+	resolve := r.authorResolver()
+	stored := r.messages().GetAll()
+	for i := len(stored) - 1; i >= 0; i-- {
+		if r.isExpiredLocked(stored[i].ID, now) {
+			continue
+		}
+		msg := withCurrentAuthor(resolve, r.openMessage(stored[i]))
+		if skip == nil || !skip(msg) {
+			return msg, true
+		}
+	}
+	return model.OutgoingMessage{}, false
+}
+
+func (r *Room) GetMessageCount() int {
+	r.messagesMu.RLock()
+	defer r.messagesMu.RUnlock()
+	return r.messages().Len()
+}
+
 func (r *Room) GetMessage(messageID uuid.UUID) (*model.OutgoingMessage, bool) {
 	r.messagesMu.RLock()
 	defer r.messagesMu.RUnlock()
-	for _, msg := range r.messages {
-		if msg.ID == messageID {
-			return &msg, true
+	msg, ok := r.findMessageLocked(messageID)
+	if !ok {
+		return nil, false
+	}
+	return &msg, true
+}
+
+// MarkDelivered records that user received the message and returns it with
+// the updated list of user IDs in additionalInfo.deliveredTo. added is false
+// when the user had already acknowledged it; ok is false when the message
+// isn't stored or user may not see it.
+func (r *Room) MarkDelivered(messageID uuid.UUID, user model.User) (msg model.OutgoingMessage, added bool, ok bool) {
+	r.messagesMu.Lock()
+	defer r.messagesMu.Unlock()
+
+	if r.isExpiredLocked(messageID, timeNow()) {
+		return model.OutgoingMessage{}, false, false
+	}
+	msg, ok = r.messages().Get(messageID)
+	if !ok || !CanSee(user, msg) {
+		return model.OutgoingMessage{}, false, false
+	}
+
+	current := deliveredToOf(msg)
+	if slices.Contains(current, user.ID) {
+		return r.openMessage(msg), false, true
+	}
+
+	oldSize := messageSize(msg)
+	msg, _ = r.messages().Patch(messageID, model.AdditionalInfo{"deliveredTo": append(slices.Clone(current), user.ID)})
+	r.storedBytes += messageSize(msg) - oldSize
+	r.enforceBudgetLocked()
+	return r.openMessage(msg), true, true
+}
+
+// GetReceipts returns the IDs of the users that acknowledged the message.
+func (r *Room) GetReceipts(messageID uuid.UUID) ([]uuid.UUID, bool) {
+	r.messagesMu.RLock()
+	defer r.messagesMu.RUnlock()
+
+	msg, ok := r.findMessageLocked(messageID)
+	if !ok {
+		return nil, false
+	}
+	return slices.Clone(deliveredToOf(msg)), true
+}
+
+func deliveredToOf(msg model.OutgoingMessage) []uuid.UUID {
+	deliveredTo, _ := msg.AdditionalInfo["deliveredTo"].([]uuid.UUID)
+	if deliveredTo == nil {
+		return []uuid.UUID{}
+	}
+	return deliveredTo
+}
+
+// GetReplies returns the thread children of parentID sorted by timestamp.
+// parentDeleted reports whether the parent was deleted or is no longer
+// stored; ok is false when neither the parent nor any reply is known.
+func (r *Room) GetReplies(parentID uuid.UUID) (replies []model.OutgoingMessage, parentDeleted bool, ok bool) {
+	r.messagesMu.RLock()
+	defer r.messagesMu.RUnlock()
+
+	childIDs := r.replies[parentID]
+	parent, parentFound := r.findMessageLocked(parentID)
+	if !parentFound && len(childIDs) == 0 {
+		return nil, false, false
+	}
+	parentDeleted = !parentFound || parent.AdditionalInfo["deleted"] == true
+
+	replies = make([]model.OutgoingMessage, 0, len(childIDs))
+	for _, id := range childIDs {
+		if msg, found := r.findMessageLocked(id); found {
+			replies = append(replies, msg)
 		}
 	}
-	return nil, false
+	sort.SliceStable(replies, func(i, j int) bool {
+		return replies[i].Timestamp.Before(replies[j].Timestamp)
+	})
+	return replies, parentDeleted, true
 }
 
-func (r *Room) UpdateMessage(messageID uuid.UUID, newContent string, newAdditionalInfo model.AdditionalInfo) bool {
+// Pin adds the message to the end of the room's pinned list. It reports
+// whether the message was newly pinned; deleted messages can't be pinned.
+func (r *Room) Pin(messageID uuid.UUID) (bool, error) {
 	r.messagesMu.Lock()
 	defer r.messagesMu.Unlock()
-	for i := range r.messages {
-		if r.messages[i].ID == messageID {
-			if r.messages[i].MessageType == model.SystemMessage {
-				return false
-			}
 
-			r.messages[i].Message = newContent
-			if newAdditionalInfo != nil {
-				r.messages[i].AdditionalInfo = newAdditionalInfo
-			}
+	msg, ok := r.findMessageLocked(messageID)
+	if !ok {
+		return false, ErrMessageNotFound
+	}
+	if deleted, _ := msg.AdditionalInfo["deleted"].(bool); deleted {
+		return false, ErrMessageDeleted
+	}
+	if slices.Contains(r.pins, messageID) {
+		return false, nil
+	}
+	r.pins = append(r.pins, messageID)
+	return true, nil
+}
 
-			r.messages[i].AdditionalInfo["modified"] = true
-			return true
+// Unpin removes the message from the pinned list and reports whether it was
+// pinned.
+func (r *Room) Unpin(messageID uuid.UUID) bool {
+	r.messagesMu.Lock()
+	defer r.messagesMu.Unlock()
+
+	i := slices.Index(r.pins, messageID)
+	if i < 0 {
+		return false
+	}
+	r.pins = slices.Delete(r.pins, i, i+1)
+	return true
+}
+
+// GetPins returns the pinned messages in the order they were pinned.
+// Messages that have since expired or been evicted are skipped.
+func (r *Room) GetPins() []model.OutgoingMessage {
+	r.messagesMu.RLock()
+	defer r.messagesMu.RUnlock()
+
+	pinned := make([]model.OutgoingMessage, 0, len(r.pins))
+	for _, id := range r.pins {
+		if msg, ok := r.findMessageLocked(id); ok {
+			pinned = append(pinned, msg)
 		}
 	}
-	return false
+	return pinned
+}
+
+// BroadcastPins tells all clients that the pinned list changed. action is
+// "pinned" or "unpinned"; the event carries the full list of pinned IDs.
+func (r *Room) BroadcastPins(action string, messageID uuid.UUID) {
+	pins := r.GetPins()
+	ids := make([]uuid.UUID, len(pins))
+	for i, msg := range pins {
+		ids[i] = msg.ID
+	}
+
+	event := model.OutgoingMessage{
+		ID:          uuid.New(),
+		MessageType: model.PinsUpdated,
+		Timestamp:   timeNow(),
+		User:        r.systemUser,
+		AdditionalInfo: model.AdditionalInfo{
+			"action":    action,
+			"messageId": messageID,
+			"pinned":    ids,
+		},
+	}
+	b, _ := json.Marshal(event)
+	if !r.TryBroadcast(b) {
+		r.logger.Debug("failed to broadcast pin update, room may be closing", "roomID", r.id)
+	}
 }
 
-func (r *Room) PatchMessage(messageID uuid.UUID, newContent *string, newAdditionalInfo model.AdditionalInfo) bool {
+// BroadcastInfo tells the room's clients about a change of its
+// additionalInfo. The event carries a copy of the new info and is not stored.
+func (r *Room) BroadcastInfo() {
+	event := model.OutgoingMessage{
+		ID:             uuid.New(),
+		MessageType:    model.RoomUpdated,
+		Timestamp:      timeNow(),
+		User:           r.systemUser,
+		AdditionalInfo: r.GetAdditionalInfo(),
+	}
+	b, _ := json.Marshal(event)
+	if !r.TryBroadcast(b) {
+		r.logger.Debug("failed to broadcast room update, room may be closing", "roomID", r.id)
+	}
+}
+
+func (r *Room) findMessageLocked(messageID uuid.UUID) (model.OutgoingMessage, bool) {
+	if r.isExpiredLocked(messageID, timeNow()) {
+		return model.OutgoingMessage{}, false
+	}
+	msg, ok := r.messages().Get(messageID)
+	if !ok {
+		return model.OutgoingMessage{}, false
+	}
+	return withCurrentAuthor(r.authorResolver(), r.openMessage(msg)), true
+}
+
+// serverOwnedInfo lists the additionalInfo keys of a message that only the
+// server sets. Edits can't change or remove them.
+var serverOwnedInfo = []string{"audience", "expiresAt", "deliveredTo"}
+
+func (r *Room) UpdateMessage(messageID uuid.UUID, newContent string, newAdditionalInfo model.AdditionalInfo) (model.OutgoingMessage, bool) {
+	return r.PatchMessage(messageID, &newContent, newAdditionalInfo)
+}
+
+// PatchMessage changes a stored message and returns it as updated. A nil
+// newContent or newAdditionalInfo keeps the stored value; a new
+// additionalInfo replaces the stored one except for the server-owned keys.
+// ok is false for unknown, expired and system messages.
+func (r *Room) PatchMessage(messageID uuid.UUID, newContent *string, newAdditionalInfo model.AdditionalInfo) (model.OutgoingMessage, bool) {
 	r.messagesMu.Lock()
 	defer r.messagesMu.Unlock()
-	for i := range r.messages {
-		if r.messages[i].ID == messageID {
-			if r.messages[i].MessageType == model.SystemMessage {
-				return false
-			}
-			if newContent != nil {
-				r.messages[i].Message = *newContent
-			}
-			if newAdditionalInfo != nil {
-				r.messages[i].AdditionalInfo = newAdditionalInfo
-			}
 
-			r.messages[i].AdditionalInfo["modified"] = true
-			return true
+	if r.isExpiredLocked(messageID, timeNow()) {
+		return model.OutgoingMessage{}, false
+	}
+	stored, ok := r.messages().Get(messageID)
+	if !ok || stored.MessageType == model.SystemMessage {
+		return model.OutgoingMessage{}, false
+	}
+	oldSize := messageSize(stored)
+	msg := r.openMessage(stored)
+	if newContent != nil {
+		msg.Message = *newContent
+	}
+
+	info := make(model.AdditionalInfo, len(msg.AdditionalInfo)+len(newAdditionalInfo)+1)
+	for key, value := range msg.AdditionalInfo {
+		if newAdditionalInfo == nil || slices.Contains(serverOwnedInfo, key) {
+			info[key] = value
 		}
 	}
-	return false
+	for key, value := range newAdditionalInfo {
+		if !slices.Contains(serverOwnedInfo, key) {
+			info[key] = value
+		}
+	}
+	info["modified"] = true
+	msg.AdditionalInfo = info
+	if r.index != nil {
+		r.index.reindex(msg)
+	}
+	stored = r.sealMessage(msg)
+	r.messages().Update(stored)
+	r.storedBytes += messageSize(stored) - oldSize
+	r.enforceBudgetLocked()
+	return withCurrentAuthor(r.authorResolver(), msg), true
 }
@@ -3,7 +3,10 @@ package chat
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -65,6 +68,68 @@ func TestRoomBroadcastToAllClients(t *testing.T) {
 	<-room.closed
 }
 
+func TestRoomJoinOrdering(t *testing.T) {
+	room := newTestRoom(t)
+
+	clients := []*Client{newTestClient(room, nil, ""), newTestClient(room, nil, "")}
+	clients[0].user = model.User{ID: uuid.New(), Name: "alice"}
+	clients[1].user = model.User{ID: uuid.New(), Name: "bob"}
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Go(func() {
+			if !room.Join(c) {
+				t.Error("expected join to succeed")
+			}
+		})
+	}
+	wg.Wait()
+	time.Sleep(50 * time.Millisecond)
+
+	stored := room.GetMessages()
+	if len(stored) != 2 {
+		t.Fatalf("expected 2 stored join messages, got %d", len(stored))
+	}
+	joinedID := func(msg model.OutgoingMessage) string {
+		id, _ := msg.AdditionalInfo["joinedUserId"].(string)
+		return id
+	}
+
+	// The client registered first sees both joins in stored order; the
+	// second one sees only its own.
+	first, second := clients[0], clients[1]
+	if joinedID(stored[0]) != first.user.ID.String() {
+		first, second = second, first
+	}
+	for _, tc := range []struct {
+		client *Client
+		want   []model.OutgoingMessage
+	}{
+		{first, stored},
+		{second, stored[1:]},
+	} {
+		for _, want := range tc.want {
+			select {
+			case b := <-tc.client.send:
+				var got model.OutgoingMessage
+				if err := json.Unmarshal(b, &got); err != nil {
+					t.Fatalf("unmarshal: %v", err)
+				}
+				if got.ID != want.ID {
+					t.Errorf("%s: expected join of %s, got %s", tc.client.user.Name, joinedID(want), joinedID(got))
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s: timed out waiting for join message", tc.client.user.Name)
+			}
+		}
+		select {
+		case b := <-tc.client.send:
+			t.Errorf("%s: unexpected extra message %s", tc.client.user.Name, b)
+		default:
+		}
+	}
+}
+
 func TestRoomRegisterAndUnregister(t *testing.T) {
 	h := NewHub(testLogger())
 
@@ -306,6 +371,41 @@ func TestRoomTimeoutPreventedByActivity(t *testing.T) {
 	}
 }
 
+func TestRoomIdleTimedOutPermanent(t *testing.T) {
+	now := time.Now()
+	room := &Room{id: 1, lastActivity: now.Add(-4 * time.Hour), logger: testLogger()}
+
+	if !room.idleTimedOut(now) {
+		t.Error("expected idle room to time out")
+	}
+
+	room.UpdateAdditionalInfo(model.AdditionalInfo{"permanent": true})
+	if room.idleTimedOut(now) {
+		t.Error("expected permanent room not to time out")
+	}
+
+	room.PatchAdditionalInfo(model.AdditionalInfo{"permanent": false})
+	if !room.idleTimedOut(now) {
+		t.Error("expected room to time out once permanent is cleared")
+	}
+}
+
+func TestJitterStaysWithinFraction(t *testing.T) {
+	lower := RoomTimeoutInterval - RoomTimeoutInterval/5
+	upper := RoomTimeoutInterval + RoomTimeoutInterval/5
+	seen := make(map[time.Duration]bool)
+	for range 1000 {
+		d := jitter(RoomTimeoutInterval, RoomTimeoutJitter)
+		if d < lower || d > upper {
+			t.Fatalf("jittered interval %v outside [%v, %v]", d, lower, upper)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Error("expected jittered intervals to differ")
+	}
+}
+
 func TestRoomDisconnectAllClients(t *testing.T) {
 	room := &Room{
 		id:      1,
@@ -337,6 +437,9 @@ func TestRoomDisconnectAllClients(t *testing.T) {
 		case <-time.After(100 * time.Millisecond):
 			t.Errorf("client %d: send channel was not closed", i)
 		}
+		if client.closeReason == nil || *client.closeReason != CloseRoomClosed {
+			t.Errorf("client %d: expected close reason %v, got %v", i, CloseRoomClosed, client.closeReason)
+		}
 	}
 }
 
@@ -547,3 +650,582 @@ func TestRoomUpdateActivityOnBroadcast(t *testing.T) {
 	close(room.shutdown)
 	<-room.closed
 }
+
+func TestRoomBackpressureKeepsTransientlySlowClient(t *testing.T) {
+	h := NewHub(testLogger())
+
+	room := &Room{
+		id:           1,
+		hub:          h,
+		clients:      make(map[*Client]bool),
+		broadcast:    make(chan []byte, 10),
+		register:     make(chan *Client),
+		unregister:   make(chan *Client),
+		closed:       make(chan struct{}),
+		shutdown:     make(chan struct{}),
+		backpressure: BackpressurePolicy{SendTimeout: 10 * time.Millisecond, MaxFailures: 3},
+		logger:       testLogger(),
+	}
+
+	go room.Run()
+
+	slowClient := &Client{
+		room:   room,
+		user:   model.User{ID: uuid.New(), Name: "SlowClient"},
+		send:   make(chan []byte, 1),
+		logger: testLogger(),
+	}
+	slowClient.send <- []byte("block")
+
+	room.register <- slowClient
+	time.Sleep(50 * time.Millisecond)
+
+	room.broadcast <- []byte("first")
+	room.broadcast <- []byte("second")
+	time.Sleep(100 * time.Millisecond)
+
+	if count := room.GetClientCount(); count != 1 {
+		t.Fatalf("expected slow client to stay connected after 2 failures, got %d clients", count)
+	}
+
+	// Draining the buffer resets the failure counter on the next delivery.
+	<-slowClient.send
+	room.broadcast <- []byte("third")
+	time.Sleep(50 * time.Millisecond)
+
+	select {
+	case msg := <-slowClient.send:
+		if string(msg) != "third" {
+			t.Errorf("expected 'third', got %s", msg)
+		}
+	default:
+		t.Fatal("expected slow client to receive message after draining")
+	}
+
+	close(room.shutdown)
+	<-room.closed
+}
+
+func TestRoomBackpressureDropsPermanentlyStuckClient(t *testing.T) {
+	h := NewHub(testLogger())
+
+	room := &Room{
+		id:           1,
+		hub:          h,
+		clients:      make(map[*Client]bool),
+		broadcast:    make(chan []byte, 10),
+		register:     make(chan *Client),
+		unregister:   make(chan *Client),
+		closed:       make(chan struct{}),
+		shutdown:     make(chan struct{}),
+		backpressure: BackpressurePolicy{SendTimeout: 5 * time.Millisecond, MaxFailures: 3},
+		logger:       testLogger(),
+	}
+
+	go room.Run()
+
+	stuckClient := &Client{
+		room:   room,
+		user:   model.User{ID: uuid.New(), Name: "StuckClient"},
+		send:   make(chan []byte, 1),
+		logger: testLogger(),
+	}
+	stuckClient.send <- []byte("block")
+
+	room.register <- stuckClient
+	time.Sleep(50 * time.Millisecond)
+
+	for range 3 {
+		room.broadcast <- []byte("message")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if count := room.GetClientCount(); count != 0 {
+		t.Errorf("expected stuck client to be removed after 3 failures, got %d clients", count)
+	}
+
+	close(room.shutdown)
+	<-room.closed
+}
+
+func TestRoomBoundsEvictionsPerBroadcast(t *testing.T) {
+	room := &Room{
+		id:           1,
+		hub:          NewHub(testLogger()),
+		clients:      make(map[*Client]bool),
+		broadcast:    make(chan []byte, 10),
+		register:     make(chan *Client),
+		unregister:   make(chan *Client),
+		ping:         make(chan chan struct{}),
+		closed:       make(chan struct{}),
+		shutdown:     make(chan struct{}),
+		backpressure: BackpressurePolicy{SendTimeout: 500 * time.Millisecond, MaxFailures: 1, MaxEvictions: 5},
+		logger:       testLogger(),
+	}
+	go room.Run()
+	defer func() {
+		close(room.shutdown)
+		<-room.closed
+	}()
+
+	const stuck = 50
+	for i := range stuck {
+		room.register <- &Client{
+			room:   room,
+			user:   model.User{ID: uuid.New(), Name: fmt.Sprintf("stuck %d", i)},
+			send:   make(chan []byte),
+			logger: testLogger(),
+		}
+	}
+	healthy := &Client{
+		room:   room,
+		user:   model.User{ID: uuid.New(), Name: "healthy"},
+		send:   make(chan []byte, 10),
+		logger: testLogger(),
+	}
+	room.register <- healthy
+
+	room.broadcast <- []byte("first")
+	select {
+	case <-healthy.send:
+	case <-time.After(2 * time.Second):
+		t.Fatal("healthy client didn't receive the first broadcast")
+	}
+	if !room.Ping(time.Second) {
+		t.Fatal("room loop stalled while evicting")
+	}
+
+	// Clients waiting to be disconnected don't hold up later broadcasts.
+	start := time.Now()
+	room.broadcast <- []byte("second")
+	select {
+	case <-healthy.send:
+		if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+			t.Errorf("expected the second broadcast to skip stuck clients, took %v", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("healthy client didn't receive the second broadcast")
+	}
+
+	deadline := time.After(2 * time.Second)
+	for room.GetClientCount() != 1 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected all stuck clients to be evicted, %d clients left", room.GetClientCount())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestRoomReplaysHistoryOnRegister(t *testing.T) {
+	room := &Room{
+		id:         1,
+		hub:        NewHub(testLogger()),
+		clients:    make(map[*Client]bool),
+		broadcast:  make(chan []byte, 10),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		closed:     make(chan struct{}),
+		shutdown:   make(chan struct{}),
+		logger:     testLogger(),
+	}
+
+	base := time.Now()
+	for i := range 5 {
+		room.StoreMessage(model.OutgoingMessage{
+			ID:          uuid.New(),
+			MessageType: model.UserMessage,
+			Message:     string(rune('a' + i)),
+			Timestamp:   base.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	client := &Client{
+		room:         room,
+		user:         model.User{ID: uuid.New(), Name: "Latecomer"},
+		send:         make(chan []byte, 256),
+		historyReady: make(chan struct{}, 1),
+		logger:       testLogger(),
+	}
+	client.SetHistoryReplay(3)
+
+	go room.Run()
+	room.register <- client
+	room.broadcast <- []byte("live")
+
+	select {
+	case <-client.historyReady:
+	case <-time.After(time.Second):
+		t.Fatal("history was not queued")
+	}
+	history := client.takeHistory()
+	if len(history) != 3 {
+		t.Fatalf("expected 3 history messages, got %d", len(history))
+	}
+	for i, expected := range []string{"c", "d", "e"} {
+		var msg model.OutgoingMessage
+		if err := json.Unmarshal(history[i], &msg); err != nil {
+			t.Fatalf("failed to unmarshal history message: %v", err)
+		}
+		if msg.Message != expected {
+			t.Errorf("expected history message %q, got %q", expected, msg.Message)
+		}
+	}
+
+	select {
+	case b := <-client.send:
+		if string(b) != "live" {
+			t.Errorf("expected live message after history, got %s", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("did not receive live message")
+	}
+
+	close(room.shutdown)
+	<-room.closed
+}
+
+func TestRoomHistoryReplayLeavesSendBufferFree(t *testing.T) {
+	room := &Room{
+		id:           1,
+		hub:          NewHub(testLogger()),
+		clients:      make(map[*Client]bool),
+		broadcast:    make(chan []byte, 10),
+		register:     make(chan *Client),
+		unregister:   make(chan *Client),
+		closed:       make(chan struct{}),
+		shutdown:     make(chan struct{}),
+		backpressure: BackpressurePolicy{MaxFailures: 1},
+		logger:       testLogger(),
+	}
+	for i := range 4 {
+		room.StoreMessage(model.OutgoingMessage{
+			ID:          uuid.New(),
+			MessageType: model.UserMessage,
+			Message:     string(rune('a' + i)),
+		})
+	}
+
+	client := &Client{
+		room:         room,
+		user:         model.User{ID: uuid.New(), Name: "Latecomer"},
+		send:         make(chan []byte, 4),
+		historyReady: make(chan struct{}, 1),
+		logger:       testLogger(),
+	}
+	client.SetHistoryReplay(4)
+
+	go room.Run()
+	defer func() {
+		close(room.shutdown)
+		<-room.closed
+	}()
+	room.register <- client
+
+	// A full replay plus a full buffer of live messages must not drop the
+	// client before its writer got a chance to drain anything.
+	for range 4 {
+		room.broadcast <- []byte("live")
+	}
+	for range 4 {
+		select {
+		case b := <-client.send:
+			if string(b) != "live" {
+				t.Errorf("expected live message, got %s", b)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("did not receive live message, client was dropped")
+		}
+	}
+
+	if history := client.takeHistory(); len(history) != 4 {
+		t.Errorf("expected 4 queued history messages, got %d", len(history))
+	}
+}
+
+func TestSetHistoryReplayCapsAtBuffer(t *testing.T) {
+	client := &Client{send: make(chan []byte, 4)}
+
+	client.SetHistoryReplay(100)
+	if client.historySize != 4 {
+		t.Errorf("expected history size capped at 4, got %d", client.historySize)
+	}
+
+	client.SetHistoryReplay(-1)
+	if client.historySize != 0 {
+		t.Errorf("expected negative history size to be clamped to 0, got %d", client.historySize)
+	}
+}
+
+func TestRoomRemoveExpiredMessages(t *testing.T) {
+	now := time.Now()
+	room := &Room{id: 1, logger: testLogger()}
+
+	expiring := model.OutgoingMessage{
+		ID:             uuid.New(),
+		MessageType:    model.UserMessage,
+		Message:        "gone soon",
+		Timestamp:      now,
+		AdditionalInfo: model.AdditionalInfo{"expiresAt": now.Add(time.Minute)},
+	}
+	permanent := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "stays", Timestamp: now}
+	room.StoreMessage(expiring)
+	room.StoreMessage(permanent)
+
+	if removed := room.removeExpiredMessages(now); len(removed) != 0 {
+		t.Fatalf("expected nothing to expire yet, got %d", len(removed))
+	}
+
+	origTimeNow := timeNow
+	timeNow = func() time.Time { return now.Add(2 * time.Minute) }
+	defer func() { timeNow = origTimeNow }()
+
+	msgs := room.GetMessages()
+	if len(msgs) != 1 || msgs[0].ID != permanent.ID {
+		t.Fatalf("expected expired message to be hidden before sweeping, got %+v", msgs)
+	}
+	if _, ok := room.GetMessage(expiring.ID); ok {
+		t.Error("expected expired message to be hidden from GetMessage")
+	}
+
+	removed := room.removeExpiredMessages(timeNow())
+	if len(removed) != 1 || removed[0].ID != expiring.ID {
+		t.Fatalf("expected expired message to be removed, got %+v", removed)
+	}
+	if count := room.GetMessageCount(); count != 1 {
+		t.Errorf("expected 1 stored message after sweep, got %d", count)
+	}
+	if len(room.expiries) != 0 {
+		t.Errorf("expected expiry index to be empty, got %d entries", len(room.expiries))
+	}
+}
+
+func TestRoomBroadcastDeletion(t *testing.T) {
+	systemUser := model.User{ID: uuid.New(), Name: "system"}
+	room := &Room{
+		id:         1,
+		broadcast:  make(chan []byte, 1),
+		shutdown:   make(chan struct{}),
+		systemUser: systemUser,
+		logger:     testLogger(),
+	}
+
+	messageID := uuid.New()
+	room.BroadcastDeletion(model.OutgoingMessage{ID: messageID}, "expired")
+
+	var event model.OutgoingMessage
+	if err := json.Unmarshal(<-room.broadcast, &event); err != nil {
+		t.Fatalf("failed to unmarshal event: %v", err)
+	}
+	if event.MessageType != model.MessageDeleted {
+		t.Errorf("expected type %q, got %q", model.MessageDeleted, event.MessageType)
+	}
+	if event.User.ID != systemUser.ID {
+		t.Errorf("expected event from system user, got %v", event.User)
+	}
+	if event.AdditionalInfo["messageId"] != messageID.String() || event.AdditionalInfo["reason"] != "expired" {
+		t.Errorf("unexpected additionalInfo: %v", event.AdditionalInfo)
+	}
+}
+
+func TestRoomEvictsOldestMessagesOverByteBudget(t *testing.T) {
+	timestamp := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	newMessage := func(text string) model.OutgoingMessage {
+		return model.OutgoingMessage{
+			ID:             uuid.New(),
+			MessageType:    model.UserMessage,
+			Message:        text,
+			Timestamp:      timestamp,
+			AdditionalInfo: model.AdditionalInfo{},
+		}
+	}
+	// Stored messages carry a single-digit sequence number here.
+	probe := newMessage("0123456789")
+	probe.Seq = 1
+	size := messageSize(probe)
+	room := &Room{id: 1, maxStoredBytes: 3 * size, logger: testLogger()}
+
+	var stored []model.OutgoingMessage
+	for range 5 {
+		msg := newMessage("0123456789")
+		stored = append(stored, msg)
+		room.StoreMessage(msg)
+	}
+
+	msgs := room.GetMessages()
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages within budget, got %d", len(msgs))
+	}
+	if msgs[0].ID != stored[2].ID || msgs[2].ID != stored[4].ID {
+		t.Error("expected the oldest messages to be evicted")
+	}
+	if room.StoredBytes() != 3*size {
+		t.Errorf("expected %d stored bytes, got %d", 3*size, room.StoredBytes())
+	}
+
+	if _, ok := room.UpdateMessage(stored[4].ID, strings.Repeat("x", 2*size), nil); !ok {
+		t.Fatal("expected update to succeed")
+	}
+	msgs = room.GetMessages()
+	if len(msgs) != 1 || msgs[0].ID != stored[4].ID {
+		t.Fatalf("expected only the updated newest message to remain, got %d messages", len(msgs))
+	}
+	if room.StoredBytes() != messageSize(msgs[0]) {
+		t.Errorf("expected stored bytes to match remaining message, got %d", room.StoredBytes())
+	}
+}
+
+func TestRoomPresenceHook(t *testing.T) {
+	hub := NewHub(testLogger())
+	events := make(chan PresenceEvent, 4)
+	hub.SetOnPresence(func(e PresenceEvent) { events <- e })
+	room := newHubRoom(t, hub)
+
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	room.unregister <- client
+	// A second unregister of the same client is not a new leave.
+	room.unregister <- client
+
+	for _, want := range []string{PresenceJoined, PresenceLeft} {
+		select {
+		case e := <-events:
+			if e.Type != want || e.RoomID != room.ID() || e.User.ID != client.user.ID {
+				t.Errorf("expected %s for %s in room %d, got %+v", want, client.user.ID, room.ID(), e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestRoomImportMessages(t *testing.T) {
+	room := newTestRoom(t)
+	existing := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "existing"}
+	room.StoreMessage(existing)
+	room.Pin(existing.ID)
+
+	// The imported parent collides with a stored message, so it and the
+	// reply pointing at it must be relinked to a fresh ID.
+	parent := model.OutgoingMessage{ID: existing.ID, MessageType: model.UserMessage, Message: "imported parent"}
+	reply := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "reply", ParentID: &existing.ID}
+	if total := room.ImportMessages([]model.OutgoingMessage{parent, reply}, false); total != 3 {
+		t.Fatalf("expected 3 messages after append, got %d", total)
+	}
+
+	msgs := room.GetMessages()
+	if msgs[1].ID == existing.ID || msgs[1].Message != "imported parent" {
+		t.Fatalf("expected colliding ID to be replaced, got %+v", msgs[1])
+	}
+	if msgs[2].ParentID == nil || *msgs[2].ParentID != msgs[1].ID {
+		t.Errorf("expected reply to point at %s, got %v", msgs[1].ID, msgs[2].ParentID)
+	}
+	if replies, _, _ := room.GetReplies(msgs[1].ID); len(replies) != 1 {
+		t.Errorf("expected imported reply to be linked, got %d", len(replies))
+	}
+
+	if found := room.SearchMessages("existing"); len(found) != 1 {
+		t.Fatalf("expected search to find the existing message, got %d", len(found))
+	}
+
+	if total := room.ImportMessages([]model.OutgoingMessage{reply}, true); total != 1 {
+		t.Fatalf("expected 1 message after replace, got %d", total)
+	}
+	if found := room.SearchMessages("existing"); len(found) != 0 {
+		t.Errorf("expected replaced messages to drop out of search, got %d", len(found))
+	}
+	if found := room.SearchMessages("reply"); len(found) != 1 {
+		t.Errorf("expected search to find the imported message, got %d", len(found))
+	}
+	if pins := room.GetPins(); len(pins) != 0 {
+		t.Errorf("expected replace to drop pins, got %d", len(pins))
+	}
+	if got := room.GetMessages()[0].ID; got != reply.ID {
+		t.Errorf("expected original ID %s to be kept, got %s", reply.ID, got)
+	}
+}
+
+func TestStoreMessageAssignsSeq(t *testing.T) {
+	room := newTestRoom(t)
+
+	first := room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "a"})
+	second := room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "b"})
+	if first.Seq != 1 || second.Seq != 2 {
+		t.Fatalf("expected seqs 1 and 2, got %d and %d", first.Seq, second.Seq)
+	}
+
+	// Replacing the history keeps sequence numbers increasing.
+	room.ImportMessages([]model.OutgoingMessage{{ID: uuid.New(), MessageType: model.UserMessage, Message: "c", Seq: 1}}, true)
+	msgs := room.GetMessages()
+	if len(msgs) != 1 || msgs[0].Seq != 3 {
+		t.Errorf("expected imported message to get seq 3, got %+v", msgs)
+	}
+	if msg, _ := room.GetMessage(msgs[0].ID); msg.Seq != 3 {
+		t.Errorf("expected GetMessage to return seq 3, got %d", msg.Seq)
+	}
+}
+
+func TestBroadcastMessagesCarrySeq(t *testing.T) {
+	room := newTestRoom(t)
+	client := newTestClient(room, nil, "")
+	room.register <- client
+	time.Sleep(10 * time.Millisecond)
+
+	client.handleTextMessage([]byte(`{"type":"message","message":"hi"}`))
+
+	select {
+	case b := <-client.send:
+		var msg model.OutgoingMessage
+		json.Unmarshal(b, &msg)
+		if msg.Seq != 1 {
+			t.Errorf("expected broadcast with seq 1, got %d", msg.Seq)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for broadcast")
+	}
+}
+
+// BenchmarkRoomActivityAndInfo compares broadcasts bumping the activity time
+// while info is read concurrently, with the separate locks and with an outer
+// lock serializing both as the shared mutex did. Run it with -cpu 4 or more
+// to see the difference.
+func BenchmarkRoomActivityAndInfo(b *testing.B) {
+	room := &Room{additionalInfo: model.AdditionalInfo{"theme": "dark", "permanent": false}}
+
+	b.Run("split", func(b *testing.B) {
+		var n atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			writer := n.Add(1)%2 == 0
+			for pb.Next() {
+				if writer {
+					room.UpdateActivityNow()
+				} else {
+					room.GetAdditionalInfo()
+				}
+			}
+		})
+	})
+	b.Run("shared", func(b *testing.B) {
+		var mu sync.RWMutex
+		var n atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			writer := n.Add(1)%2 == 0
+			for pb.Next() {
+				if writer {
+					mu.Lock()
+					room.UpdateActivityNow()
+					mu.Unlock()
+				} else {
+					mu.RLock()
+					room.GetAdditionalInfo()
+					mu.RUnlock()
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,177 @@
+package chat
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+// searchIndex is an in-memory inverted index over the text of a room's
+// stored messages. It remembers every stored message's sequence number so
+// matches can be located in the room's message slice by binary search; only
+// searchable messages are tokenized.
+type searchIndex struct {
+	seqs     map[uuid.UUID]uint64
+	terms    map[uuid.UUID][]string
+	postings map[string]map[uuid.UUID]struct{}
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		seqs:     make(map[uuid.UUID]uint64),
+		terms:    make(map[uuid.UUID][]string),
+		postings: make(map[string]map[uuid.UUID]struct{}),
+	}
+}
+
+// tokenize splits text into lowercase words made of letters and digits. Each
+// word is returned once.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+// searchable reports whether a message's text belongs in the index. System
+// messages and deleted messages are never returned by a search.
+func searchable(msg model.OutgoingMessage) bool {
+	if msg.MessageType == model.SystemMessage {
+		return false
+	}
+	deleted, _ := msg.AdditionalInfo["deleted"].(bool)
+	return !deleted
+}
+
+// add indexes a newly stored message.
+func (idx *searchIndex) add(msg model.OutgoingMessage) {
+	idx.seqs[msg.ID] = msg.Seq
+	idx.reindex(msg)
+}
+
+// reindex replaces the terms of an already stored message, e.g. after an
+// edit or deletion.
+func (idx *searchIndex) reindex(msg model.OutgoingMessage) {
+	idx.dropTerms(msg.ID)
+	if !searchable(msg) {
+		return
+	}
+	terms := tokenize(msg.Message)
+	if len(terms) == 0 {
+		return
+	}
+	idx.terms[msg.ID] = terms
+	for _, term := range terms {
+		ids, ok := idx.postings[term]
+		if !ok {
+			ids = make(map[uuid.UUID]struct{})
+			idx.postings[term] = ids
+		}
+		ids[msg.ID] = struct{}{}
+	}
+}
+
+// remove forgets a message that is no longer stored.
+func (idx *searchIndex) remove(messageID uuid.UUID) {
+	idx.dropTerms(messageID)
+	delete(idx.seqs, messageID)
+}
+
+func (idx *searchIndex) dropTerms(messageID uuid.UUID) {
+	for _, term := range idx.terms[messageID] {
+		ids := idx.postings[term]
+		delete(ids, messageID)
+		if len(ids) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.terms, messageID)
+}
+
+// lookup returns the sequence numbers of the messages containing every term,
+// in storage order. It walks the shortest posting list and probes the others.
+func (idx *searchIndex) lookup(terms []string) []uint64 {
+	if len(terms) == 0 {
+		return nil
+	}
+	lists := make([]map[uuid.UUID]struct{}, 0, len(terms))
+	for _, term := range terms {
+		ids, ok := idx.postings[term]
+		if !ok {
+			return nil
+		}
+		lists = append(lists, ids)
+	}
+	slices.SortFunc(lists, func(a, b map[uuid.UUID]struct{}) int { return len(a) - len(b) })
+
+	var seqs []uint64
+candidates:
+	for id := range lists[0] {
+		for _, ids := range lists[1:] {
+			if _, ok := ids[id]; !ok {
+				continue candidates
+			}
+		}
+		seqs = append(seqs, idx.seqs[id])
+	}
+	slices.Sort(seqs)
+	return seqs
+}
+
+// SearchMessages returns the stored messages whose text contains every word
+// of query, oldest first. Matching is case-insensitive on whole words. The
+// room's index is built on the first search and kept up to date afterwards.
+func (r *Room) SearchMessages(query string) []model.OutgoingMessage {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	r.messagesMu.RLock()
+	if r.index == nil {
+		r.messagesMu.RUnlock()
+		r.messagesMu.Lock()
+		if r.index == nil {
+			r.rebuildIndexLocked()
+		}
+		r.messagesMu.Unlock()
+		r.messagesMu.RLock()
+	}
+	defer r.messagesMu.RUnlock()
+
+	now := timeNow()
+	resolve := r.authorResolver()
+	seqs := r.index.lookup(terms)
+	stored := r.messages().GetAll()
+	results := make([]model.OutgoingMessage, 0, len(seqs))
+	for _, seq := range seqs {
+		i, found := slices.BinarySearchFunc(stored, seq, func(msg model.OutgoingMessage, seq uint64) int {
+			return cmp.Compare(msg.Seq, seq)
+		})
+		if found && !r.isExpiredLocked(stored[i].ID, now) {
+			results = append(results, withCurrentAuthor(resolve, r.openMessage(stored[i])))
+		}
+	}
+	return results
+}
+
+// RebuildSearchIndex discards the room's search index and indexes all stored
+// messages again.
+func (r *Room) RebuildSearchIndex() {
+	r.messagesMu.Lock()
+	defer r.messagesMu.Unlock()
+	r.rebuildIndexLocked()
+}
+
+// rebuildIndexLocked must be called with messagesMu held for writing.
+func (r *Room) rebuildIndexLocked() {
+	r.index = newSearchIndex()
+	for _, msg := range r.messages().GetAll() {
+		r.index.add(r.openMessage(msg))
+	}
+}
@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+func storeText(r *Room, text string) uuid.UUID {
+	msg := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: text, Timestamp: time.Now()}
+	r.StoreMessage(msg)
+	return msg.ID
+}
+
+func messageTexts(msgs []model.OutgoingMessage) []string {
+	texts := make([]string, len(msgs))
+	for i, msg := range msgs {
+		texts[i] = msg.Message
+	}
+	return texts
+}
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Hello, hello WORLD! it's 2024")
+	want := []string{"2024", "hello", "it", "s", "world"}
+	if !slices.Equal(got, want) {
+		t.Errorf("tokenize = %v, want %v", got, want)
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	room := newTestRoom(t)
+	storeText(room, "the quick brown fox")
+	storeText(room, "a lazy dog")
+	storeText(room, "Quick thinking, lazy fox")
+	room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.SystemMessage, Message: "fox joined"})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"fox", []string{"the quick brown fox", "Quick thinking, lazy fox"}},
+		{"QUICK fox", []string{"the quick brown fox", "Quick thinking, lazy fox"}},
+		{"lazy fox", []string{"Quick thinking, lazy fox"}},
+		{"cat", []string{}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		got := messageTexts(room.SearchMessages(tt.query))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SearchMessages(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchMessagesFollowsEdits(t *testing.T) {
+	room := newTestRoom(t)
+	edited := storeText(room, "original words")
+	deleted := storeText(room, "original too")
+	room.SearchMessages("original")
+
+	newText := "replacement words"
+	room.PatchMessage(edited, &newText, nil)
+	room.UpdateMessage(deleted, "deleted", model.AdditionalInfo{"deleted": true})
+	storeText(room, "original late")
+
+	if got := messageTexts(room.SearchMessages("original")); !slices.Equal(got, []string{"original late"}) {
+		t.Errorf("expected only the new message, got %v", got)
+	}
+	if got := messageTexts(room.SearchMessages("replacement")); !slices.Equal(got, []string{newText}) {
+		t.Errorf("expected edited message, got %v", got)
+	}
+	if got := room.SearchMessages("deleted"); len(got) != 0 {
+		t.Errorf("expected deleted message to be unsearchable, got %v", messageTexts(got))
+	}
+}
+
+func TestSearchMessagesAfterEviction(t *testing.T) {
+	room := newTestRoom(t)
+	storeText(room, "needle first")
+	room.SearchMessages("needle")
+
+	room.messagesMu.Lock()
+	room.maxStoredBytes = 1
+	room.messagesMu.Unlock()
+	storeText(room, "needle second")
+
+	if got := messageTexts(room.SearchMessages("needle")); !slices.Equal(got, []string{"needle second"}) {
+		t.Errorf("expected evicted message to be gone, got %v", got)
+	}
+
+	room.RebuildSearchIndex()
+	if got := messageTexts(room.SearchMessages("needle")); !slices.Equal(got, []string{"needle second"}) {
+		t.Errorf("expected same result after rebuild, got %v", got)
+	}
+}
+
+// naiveSearch is the linear scan the index replaces.
+func naiveSearch(r *Room, query string) []model.OutgoingMessage {
+	terms := tokenize(query)
+	var results []model.OutgoingMessage
+	for _, msg := range r.GetMessages() {
+		if !searchable(msg) {
+			continue
+		}
+		words := tokenize(msg.Message)
+		if !slices.ContainsFunc(terms, func(term string) bool { return !slices.Contains(words, term) }) {
+			results = append(results, msg)
+		}
+	}
+	return results
+}
+
+func benchmarkRoom(b *testing.B, n int) *Room {
+	b.Helper()
+	room, _ := NewHub(testLogger()).CreateRoom(nil)
+	b.Cleanup(func() {
+		room.shutdownOnce.Do(func() { close(room.shutdown) })
+		<-room.closed
+	})
+	for i := range n {
+		room.StoreMessage(model.OutgoingMessage{
+			ID:          uuid.New(),
+			MessageType: model.UserMessage,
+			Message:     fmt.Sprintf("message %d about topic%d and word%d", i, i%50, i%7),
+		})
+	}
+	return room
+}
+
+func BenchmarkSearchMessages(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		room := benchmarkRoom(b, n)
+		room.SearchMessages("warmup")
+		b.Run(fmt.Sprintf("index/%d", n), func(b *testing.B) {
+			for b.Loop() {
+				room.SearchMessages("topic7 word3")
+			}
+		})
+		b.Run(fmt.Sprintf("scan/%d", n), func(b *testing.B) {
+			for b.Loop() {
+				naiveSearch(room, "topic7 word3")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+// MessageStore holds the message history of a room. The room serializes all
+// calls and keeps its own indexes for threads, expiries, pins and search on
+// top of it, so implementations need no locking of their own. Messages are
+// passed in as they should be persisted, i.e. already encrypted when the room
+// has a MessageCipher.
+type MessageStore interface {
+	// Store appends msg to the history.
+	Store(msg model.OutgoingMessage)
+	// Get returns the message with the given ID.
+	Get(id uuid.UUID) (model.OutgoingMessage, bool)
+	// GetAll returns the history, oldest first. The caller must not modify
+	// the returned slice.
+	GetAll() []model.OutgoingMessage
+	// Patch merges info into the additionalInfo of the message with the
+	// given ID and returns the patched message.
+	Patch(id uuid.UUID, info model.AdditionalInfo) (model.OutgoingMessage, bool)
+	// Update replaces the message with the same ID as msg and reports
+	// whether it was found.
+	Update(msg model.OutgoingMessage) bool
+	// Delete removes the messages with the given IDs. Unknown IDs are
+	// ignored.
+	Delete(ids ...uuid.UUID)
+	// Len returns the number of stored messages.
+	Len() int
+}
+
+// MessageStoreFactory returns the store for a newly created room.
+type MessageStoreFactory func(roomID uint) MessageStore
+
+// memoryStore is the default MessageStore, keeping the history in memory.
+// Its zero value is an empty store.
+type memoryStore struct {
+	messages []model.OutgoingMessage
+}
+
+func (s *memoryStore) Store(msg model.OutgoingMessage) {
+	s.messages = append(s.messages, msg)
+}
+
+func (s *memoryStore) Get(id uuid.UUID) (model.OutgoingMessage, bool) {
+	if i := s.index(id); i >= 0 {
+		return s.messages[i], true
+	}
+	return model.OutgoingMessage{}, false
+}
+
+func (s *memoryStore) GetAll() []model.OutgoingMessage {
+	return s.messages
+}
+
+func (s *memoryStore) Patch(id uuid.UUID, info model.AdditionalInfo) (model.OutgoingMessage, bool) {
+	i := s.index(id)
+	if i < 0 {
+		return model.OutgoingMessage{}, false
+	}
+	// Replace the map instead of mutating it, it may be shared with readers
+	// holding a copy of the message.
+	patched := maps.Clone(s.messages[i].AdditionalInfo)
+	if patched == nil {
+		patched = make(model.AdditionalInfo, len(info))
+	}
+	maps.Copy(patched, info)
+	s.messages[i].AdditionalInfo = patched
+	return s.messages[i], true
+}
+
+func (s *memoryStore) Update(msg model.OutgoingMessage) bool {
+	i := s.index(msg.ID)
+	if i < 0 {
+		return false
+	}
+	s.messages[i] = msg
+	return true
+}
+
+func (s *memoryStore) Delete(ids ...uuid.UUID) {
+	if len(ids) == 0 {
+		return
+	}
+	remove := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		remove[id] = struct{}{}
+	}
+	kept := slices.DeleteFunc(s.messages, func(msg model.OutgoingMessage) bool {
+		_, ok := remove[msg.ID]
+		return ok
+	})
+	s.messages = kept
+}
+
+func (s *memoryStore) Len() int {
+	return len(s.messages)
+}
+
+func (s *memoryStore) index(id uuid.UUID) int {
+	return slices.IndexFunc(s.messages, func(msg model.OutgoingMessage) bool {
+		return msg.ID == id
+	})
+}
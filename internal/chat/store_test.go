@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestMemoryStore(t *testing.T) {
+	var s memoryStore
+	a := model.OutgoingMessage{ID: uuid.New(), Message: "a", AdditionalInfo: model.AdditionalInfo{"format": "text"}}
+	b := model.OutgoingMessage{ID: uuid.New(), Message: "b"}
+	c := model.OutgoingMessage{ID: uuid.New(), Message: "c"}
+	s.Store(a)
+	s.Store(b)
+	s.Store(c)
+
+	if s.Len() != 3 {
+		t.Fatalf("expected 3 messages, got %d", s.Len())
+	}
+	if msg, ok := s.Get(b.ID); !ok || msg.Message != "b" {
+		t.Errorf("expected to get message b, got %q (found %v)", msg.Message, ok)
+	}
+	if _, ok := s.Get(uuid.New()); ok {
+		t.Error("expected unknown message not to be found")
+	}
+
+	original := a.AdditionalInfo
+	patched, ok := s.Patch(a.ID, model.AdditionalInfo{"pinned": true})
+	if !ok || patched.AdditionalInfo["format"] != "text" || patched.AdditionalInfo["pinned"] != true {
+		t.Errorf("expected patch to merge additionalInfo, got %v", patched.AdditionalInfo)
+	}
+	if _, ok := original["pinned"]; ok {
+		t.Error("expected patch not to mutate the previous additionalInfo map")
+	}
+
+	b.Message = "b2"
+	if !s.Update(b) {
+		t.Error("expected update of stored message to succeed")
+	}
+	if s.Update(model.OutgoingMessage{ID: uuid.New()}) {
+		t.Error("expected update of unknown message to fail")
+	}
+
+	s.Delete(a.ID, uuid.New())
+	all := s.GetAll()
+	if len(all) != 2 || all[0].Message != "b2" || all[1].Message != "c" {
+		t.Errorf("unexpected history after delete: %v", messageTexts(all))
+	}
+}
+
+// recordingStore wraps a memoryStore and counts the messages stored in it.
+type recordingStore struct {
+	memoryStore
+	stored int
+}
+
+func (s *recordingStore) Store(msg model.OutgoingMessage) {
+	s.stored++
+	s.memoryStore.Store(msg)
+}
+
+func TestHubMessageStoreFactory(t *testing.T) {
+	hub := NewHub(testLogger())
+	stores := make(map[uint]*recordingStore)
+	hub.SetMessageStoreFactory(func(roomID uint) MessageStore {
+		s := &recordingStore{}
+		stores[roomID] = s
+		return s
+	})
+
+	room := newHubRoom(t, hub)
+	stored := room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello"})
+	room.PatchMessage(stored.ID, nil, model.AdditionalInfo{"format": "markdown"})
+
+	s := stores[room.ID()]
+	if s == nil || s.stored != 1 {
+		t.Fatalf("expected the room to store into its configured store")
+	}
+	msg, ok := s.Get(stored.ID)
+	if !ok || msg.AdditionalInfo["format"] != "markdown" || msg.AdditionalInfo["modified"] != true {
+		t.Errorf("expected patched message in the configured store, got %v", msg.AdditionalInfo)
+	}
+	if got := room.GetMessages(); len(got) != 1 || got[0].Message != "hello" {
+		t.Errorf("expected room to read from the configured store, got %v", messageTexts(got))
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"runtime/debug"
+	"time"
 )
 
 var (
@@ -11,6 +12,10 @@ var (
 	BuildTime     string = "unknown"
 )
 
+// StartTime is when the process started serving. It is set in main and used
+// to report uptime.
+var StartTime time.Time
+
 func init() {
 	bi, ok := debug.ReadBuildInfo()
 	if !ok {
@@ -1,8 +1,15 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/choffmann/chat-room/internal/schema"
 )
 
 func BaseURL() string {
@@ -24,3 +31,331 @@ func LegacyRoutes() bool {
 	}
 	return v == "true" || v == "1"
 }
+
+// ShutdownMessage is the notice clients receive when the server shuts down.
+// Setting SHUTDOWN_MESSAGE to an empty string disables it.
+func ShutdownMessage() string {
+	v, ok := os.LookupEnv("SHUTDOWN_MESSAGE")
+	if !ok {
+		return "Server is restarting, please reconnect shortly"
+	}
+	return strings.TrimSpace(v)
+}
+
+// MessageAuthorOnly restricts editing and deleting messages over REST to
+// requests naming their author. The author's ID is not verified.
+func MessageAuthorOnly() bool {
+	v := strings.TrimSpace(os.Getenv("MESSAGE_AUTHOR_ONLY"))
+	return v == "true" || v == "1"
+}
+
+// RequireRoomName rejects creating or updating a room without a name in
+// additionalInfo.
+func RequireRoomName() bool {
+	v := strings.TrimSpace(os.Getenv("REQUIRE_ROOM_NAME"))
+	return v == "true" || v == "1"
+}
+
+// TimestampLayout returns the layout of timestamps in API responses, picked
+// by TIMESTAMP_FORMAT: "nano" (default, up to nine fractional digits),
+// "millis" (always three) or "seconds" (none).
+func TimestampLayout() (string, error) {
+	switch v := strings.TrimSpace(os.Getenv("TIMESTAMP_FORMAT")); v {
+	case "", "nano":
+		return model.TimestampNano, nil
+	case "millis":
+		return model.TimestampMillis, nil
+	case "seconds":
+		return model.TimestampSeconds, nil
+	default:
+		return "", fmt.Errorf("unknown timestamp format %q", v)
+	}
+}
+
+// WebhookURL is where join and leave events are POSTed. Webhooks are
+// disabled when it is empty.
+func WebhookURL() string {
+	return strings.TrimSpace(os.Getenv("WEBHOOK_URL"))
+}
+
+// RoomsFile is where rooms are saved on shutdown and restored from on
+// startup. Rooms are not persisted when it is empty.
+func RoomsFile() string {
+	return strings.TrimSpace(os.Getenv("ROOMS_FILE"))
+}
+
+// RoomsPersistWindow limits the saved rooms to permanent rooms and rooms
+// active within it. 0 saves every room.
+func RoomsPersistWindow() time.Duration {
+	return durationEnv("ROOMS_PERSIST_WINDOW", 3*time.Hour)
+}
+
+// MessageEncryptionKey returns the base64-encoded MESSAGE_ENCRYPTION_KEY
+// used to encrypt stored messages. It returns nil if the variable is unset.
+func MessageEncryptionKey() ([]byte, error) {
+	v := strings.TrimSpace(os.Getenv("MESSAGE_ENCRYPTION_KEY"))
+	if v == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(v)
+}
+
+func AdminToken() string {
+	return strings.TrimSpace(os.Getenv("ADMIN_TOKEN"))
+}
+
+// WSAuthToken is the token WebSocket clients must send in an auth frame
+// before they take part in a room. Empty disables the handshake.
+func WSAuthToken() string {
+	return strings.TrimSpace(os.Getenv("WS_AUTH_TOKEN"))
+}
+
+// WSAuthTimeout is how long a WebSocket client has to authenticate.
+func WSAuthTimeout() time.Duration {
+	return durationEnv("WS_AUTH_TIMEOUT", 10*time.Second)
+}
+
+// AnonNames returns the configured name pool for anonymous users. Names are
+// read from ANON_NAMES_FILE (one per line, "#" starts a comment) or from the
+// comma-separated ANON_NAMES. It returns nil when neither is set.
+func AnonNames() ([]string, error) {
+	return listEnv("ANON_NAMES_FILE", "ANON_NAMES")
+}
+
+// FilterWords returns the words masked in chat messages, read from
+// FILTER_WORDS_FILE or FILTER_WORDS like AnonNames.
+func FilterWords() ([]string, error) {
+	return listEnv("FILTER_WORDS_FILE", "FILTER_WORDS")
+}
+
+// listEnv reads a list from the file named by fileKey, one entry per line
+// with "#" starting a comment, or else from the comma-separated listKey.
+func listEnv(fileKey, listKey string) ([]string, error) {
+	if path := strings.TrimSpace(os.Getenv(fileKey)); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var entries []string
+		for line := range strings.Lines(string(data)) {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		return entries, nil
+	}
+
+	var entries []string
+	for entry := range strings.SplitSeq(os.Getenv(listKey), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// HTTPReadTimeout limits how long the server reads a request, including its
+// body.
+func HTTPReadTimeout() time.Duration {
+	return durationEnv("HTTP_READ_TIMEOUT", 15*time.Second)
+}
+
+// HTTPWriteTimeout limits how long the server takes to write a response.
+// WebSocket connections are exempt.
+func HTTPWriteTimeout() time.Duration {
+	return durationEnv("HTTP_WRITE_TIMEOUT", 15*time.Second)
+}
+
+// HTTPIdleTimeout is how long an idle keep-alive connection is kept open.
+func HTTPIdleTimeout() time.Duration {
+	return durationEnv("HTTP_IDLE_TIMEOUT", 60*time.Second)
+}
+
+// WriteTimeout is how long a single WebSocket write may take before it
+// counts as slow.
+func WriteTimeout() time.Duration {
+	return durationEnv("WS_WRITE_TIMEOUT", 10*time.Second)
+}
+
+// MaxSlowWrites is the number of consecutive slow writes after which a client
+// is dropped as a stuck writer.
+func MaxSlowWrites() int {
+	return intEnv("WS_MAX_SLOW_WRITES", 3)
+}
+
+func SendTimeout() time.Duration {
+	return durationEnv("WS_SEND_TIMEOUT", 100*time.Millisecond)
+}
+
+func MaxSendFailures() int {
+	return intEnv("WS_MAX_SEND_FAILURES", 3)
+}
+
+// MaxEvictions is how many slow clients a room disconnects at once; the rest
+// follow between other work. 0 disconnects them all at once.
+func MaxEvictions() int {
+	return intEnv("WS_MAX_EVICTIONS", 100)
+}
+
+// FloodMaxPerSecond is how many user messages per second a room tolerates
+// before it enters slow mode. 0 disables flood protection.
+func FloodMaxPerSecond() int {
+	return intEnv("FLOOD_MAX_PER_SECOND", 0)
+}
+
+// FloodCooldown is how long a flooded room stays in slow mode after the last
+// second that exceeded FloodMaxPerSecond.
+func FloodCooldown() time.Duration {
+	return durationEnv("FLOOD_COOLDOWN", 10*time.Second)
+}
+
+// RoomMaxStoredBytes is the per-room message history budget in bytes. 0
+// disables the limit.
+func RoomMaxStoredBytes() int {
+	return intEnv("ROOM_MAX_STORED_BYTES", 16*1024*1024)
+}
+
+// IdempotencyTTL is how long responses to requests with an Idempotency-Key
+// are replayed.
+func IdempotencyTTL() time.Duration {
+	return durationEnv("IDEMPOTENCY_TTL", time.Hour)
+}
+
+// CreateRateLimit is how many rooms and users a single IP may create per
+// minute. 0 disables the limit.
+func CreateRateLimit() int {
+	return intEnv("CREATE_RATE_LIMIT", 30)
+}
+
+// CreateRateBurst is how many creations a single IP may make at once before
+// CreateRateLimit applies.
+func CreateRateBurst() int {
+	return intEnv("CREATE_RATE_BURST", 10)
+}
+
+// JoinRateLimit is how many WebSocket joins a single IP may open per minute,
+// counted separately for ephemeral joins and joins with a userId. 0 disables
+// the limit.
+func JoinRateLimit() int {
+	return intEnv("JOIN_RATE_LIMIT", 60)
+}
+
+// JoinRateBurst is how many joins a single IP may open at once before
+// JoinRateLimit applies.
+func JoinRateBurst() int {
+	return intEnv("JOIN_RATE_BURST", 20)
+}
+
+// ReconnectGrace is how long a dropped client may resume with its reconnect
+// token before its leave is announced. 0 disables reconnect tokens.
+func ReconnectGrace() time.Duration {
+	return durationEnv("RECONNECT_GRACE", 30*time.Second)
+}
+
+// CloseGrace is how long a removed client keeps writing its queued messages
+// before the close frame is sent. 0 flushes the whole queue.
+func CloseGrace() time.Duration {
+	return durationEnv("CLOSE_GRACE", 5*time.Second)
+}
+
+// EmptyRoomTimeout is how long a room may stay empty after its last client
+// left before it is deleted. 0 disables the cleanup.
+func EmptyRoomTimeout() time.Duration {
+	return durationEnv("EMPTY_ROOM_TIMEOUT", 0)
+}
+
+// MaxInfoBytes limits the JSON size of additionalInfo on rooms, users and
+// messages. 0 disables the limit.
+func MaxInfoBytes() int {
+	return intEnv("MAX_INFO_BYTES", 16*1024)
+}
+
+// HistoryMaxBytes caps the JSON size of the messages in one message list or
+// search response. 0 disables the cap.
+func HistoryMaxBytes() int {
+	return intEnv("HISTORY_MAX_BYTES", 4*1024*1024)
+}
+
+// UserTTL is how long a registered user may go unseen before being deleted.
+// Connected users are kept. 0 keeps users forever.
+func UserTTL() time.Duration {
+	return durationEnv("USER_TTL", 0)
+}
+
+// UserNameMaxLength turns on validation of user names with the given
+// maximum length. 0 disables the validation.
+func UserNameMaxLength() int {
+	return intEnv("USER_NAME_MAX_LENGTH", 0)
+}
+
+// MaxImageBytes limits the size of image uploads over WebSocket. 0 leaves
+// only the general upload limit.
+func MaxImageBytes() int {
+	return intEnv("MAX_IMAGE_BYTES", 5*1024*1024)
+}
+
+// MaxRooms caps the number of rooms held at once. 0 disables the limit.
+func MaxRooms() int {
+	return intEnv("MAX_ROOMS", 0)
+}
+
+// MaxRoomsPerOwner caps the rooms open at once for a single ownerId. 0
+// disables the limit.
+func MaxRoomsPerOwner() int {
+	return intEnv("MAX_ROOMS_PER_OWNER", 0)
+}
+
+// MaxConnections caps concurrent WebSocket connections server-wide. 0
+// disables the limit.
+func MaxConnections() int {
+	return intEnv("MAX_CONNECTIONS", 0)
+}
+
+// RoomInfoSchema, UserInfoSchema and MessageInfoSchema load the optional
+// JSON Schema files that additionalInfo must match. They return nil if the
+// variable is unset.
+func RoomInfoSchema() (*schema.Schema, error) {
+	return schemaEnv("ROOM_INFO_SCHEMA")
+}
+
+func UserInfoSchema() (*schema.Schema, error) {
+	return schemaEnv("USER_INFO_SCHEMA")
+}
+
+func MessageInfoSchema() (*schema.Schema, error) {
+	return schemaEnv("MESSAGE_INFO_SCHEMA")
+}
+
+func schemaEnv(key string) (*schema.Schema, error) {
+	path := strings.TrimSpace(os.Getenv(key))
+	if path == "" {
+		return nil, nil
+	}
+	return schema.Load(path)
+}
+
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return fallback
+	}
+	return d
+}
+
+func intEnv(key string, fallback int) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"io"
 	"log/slog"
 	"os"
 	"strings"
@@ -26,17 +27,37 @@ func NewLogger() *slog.Logger {
 	}
 
 	opts := &slog.HandlerOptions{Level: levelVar}
+	out, logFile, openErr := logOutput()
 
 	format := strings.TrimSpace(os.Getenv("LOG_FORMAT"))
 	var handler slog.Handler
 	switch strings.ToLower(format) {
 	case "text":
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(out, opts)
 	case "json":
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(out, opts)
 	default:
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(out, opts)
 	}
 
-	return slog.New(handler)
+	logger := slog.New(handler)
+	if openErr != nil {
+		logger.Warn("failed to open log file, logging to stdout", "path", logFile, "error", openErr)
+	}
+	return logger
+}
+
+// logOutput returns the file named by LOG_FILE, opened for appending, or
+// stdout if it is unset or can't be opened. The file stays open for the
+// lifetime of the process.
+func logOutput() (io.Writer, string, error) {
+	path := strings.TrimSpace(os.Getenv("LOG_FILE"))
+	if path == "" {
+		return os.Stdout, "", nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return os.Stdout, path, err
+	}
+	return f, path, nil
 }
@@ -0,0 +1,33 @@
+// Package filter masks unwanted words in chat messages.
+package filter
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// WordMasker returns a filter that replaces every occurrence of words with
+// asterisks, ignoring case. Matches are substrings, so "ass" also masks part
+// of "passage". It returns nil when words is empty.
+func WordMasker(words []string) func(string) string {
+	words = slices.DeleteFunc(slices.Clone(words), func(w string) bool { return w == "" })
+	if len(words) == 0 {
+		return nil
+	}
+	// Longer words first so that they win over their own prefixes.
+	slices.SortFunc(words, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	return func(text string) string {
+		return re.ReplaceAllStringFunc(text, func(match string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(match))
+		})
+	}
+}
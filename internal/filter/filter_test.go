@@ -0,0 +1,29 @@
+package filter
+
+import "testing"
+
+func TestWordMasker(t *testing.T) {
+	mask := WordMasker([]string{"darn", "heck", "", "dar"})
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"hello", "hello"},
+		{"darn it", "**** it"},
+		{"DaRn, what the HECK", "****, what the ****"},
+		{"darnation", "****ation"},
+		{"dart", "***t"},
+	}
+	for _, tt := range tests {
+		if got := mask(tt.in); got != tt.want {
+			t.Errorf("mask(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWordMaskerEmpty(t *testing.T) {
+	if WordMasker(nil) != nil || WordMasker([]string{""}) != nil {
+		t.Fatal("expected no filter without words")
+	}
+}
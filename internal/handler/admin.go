@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/chat"
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/gorilla/mux"
+)
+
+// SetAdminToken enables the admin API. Requests to admin routes must carry
+// the token as "Authorization: Bearer <token>". An empty token keeps the
+// admin routes unregistered.
+func (h *Handler) SetAdminToken(token string) {
+	h.adminToken = token
+}
+
+func (h *Handler) isAdmin(r *http.Request) bool {
+	if h.adminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1
+}
+
+func (h *Handler) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.isAdmin(r) {
+			h.logger.Warn("unauthorized admin request", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// getAdminRoomsHandler godoc
+// @Summary      List all rooms with full detail
+// @Description  Returns every active room including internal statistics (message count, creation time, last activity). Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         admin
+// @Produce      json
+// @Security     AdminToken
+// @Success      200  {object}  AdminRoomsListResponse
+// @Failure      401  {string}  string  "unauthorized"
+// @Router       /admin/rooms [get]
+func (h *Handler) getAdminRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	rooms := h.hub.GetAllRoomDetails()
+	writeJSON(w, r, http.StatusOK, map[string][]model.RoomDetail{"rooms": rooms})
+}
+
+// getAdminRoomDeadLettersHandler godoc
+// @Summary      List broadcasts dropped in a room
+// @Description  Returns the last 100 broadcasts the room dropped for clients whose send buffer was full, oldest first, to find out why a client missed messages. The message is left out in rooms that encrypt their messages. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         admin
+// @Produce      json
+// @Security     AdminToken
+// @Param        roomID  path      int  true  "Room ID"
+// @Success      200     {object}  DeadLettersResponse
+// @Failure      400     {string}  string  "can't parse room id to uint"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /admin/rooms/{roomID}/dead-letters [get]
+func (h *Handler) getAdminRoomDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for dead letters", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for dead letters", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string][]chat.DeadLetter{"deadLetters": room.DeadLetters()})
+}
+
+// getRoomUserDetailsHandler godoc
+// @Summary      List a room's connections with their origin
+// @Description  Returns every connection in the room with its user, remote address, user agent and connection time, for moderation. Users with several connections are listed once per connection. The regular user listings never include this data. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         admin
+// @Produce      json
+// @Security     AdminToken
+// @Param        roomID  path      int  true  "Room ID"
+// @Success      200     {object}  ConnectionDetailsResponse
+// @Failure      400     {string}  string  "can't parse room id to uint"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/users/detail [get]
+func (h *Handler) getRoomUserDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for user details", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for user details", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string][]chat.ConnectionDetail{"connections": room.GetConnectionDetails()})
+}
+
+type AnnouncementRequest struct {
+	Message string `json:"message" example:"Server maintenance in 10 minutes"`
+} // @name AnnouncementRequest
+
+type AnnouncementResponse struct {
+	Rooms int `json:"rooms" example:"12"`
+} // @name AnnouncementResponse
+
+// adminBroadcastHandler godoc
+// @Summary      Announce a message in every room
+// @Description  Stores and broadcasts a system message with `"announcement": true` in its additionalInfo to every room, e.g. for maintenance notices. Rooms that are shutting down are skipped. Returns the number of rooms reached.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminToken
+// @Param        body  body      AnnouncementRequest  true  "Announcement"
+// @Success      200   {object}  AnnouncementResponse
+// @Failure      400   {string}  string  "invalid request body"
+// @Failure      401   {string}  string  "unauthorized"
+// @Router       /admin/broadcast [post]
+func (h *Handler) adminBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	var req AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid announcement request", "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		h.logger.Warn("empty announcement", "remoteAddr", r.RemoteAddr)
+		http.Error(w, "message cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	rooms := h.hub.Announce(req.Message)
+
+	writeJSON(w, r, http.StatusOK, AnnouncementResponse{Rooms: rooms})
+}
+
+type UsersPurgeResponse struct {
+	Deleted int `json:"deleted" example:"25"`
+} // @name UsersPurgeResponse
+
+// deleteUsersHandler godoc
+// @Summary      Purge the user registry
+// @Description  Deletes all registered users, or with `olderThan` (a duration such as `720h`) only those not seen for that long. Users that never connected count as seen when they were created. Connected clients keep their current user data; only the registry is cleared.
+// @Tags         admin
+// @Produce      json
+// @Security     AdminToken
+// @Param        olderThan  query     string  false  "Only delete users not seen for this duration, e.g. 720h"
+// @Success      200        {object}  UsersPurgeResponse
+// @Failure      400        {string}  string  "invalid olderThan"
+// @Failure      401        {string}  string  "unauthorized"
+// @Router       /users [delete]
+func (h *Handler) deleteUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var deleted int
+	if v := r.URL.Query().Get("olderThan"); v != "" {
+		age, err := time.ParseDuration(v)
+		if err != nil || age <= 0 {
+			h.logger.Warn("invalid olderThan for purging users", "olderThan", v, "remoteAddr", r.RemoteAddr, "error", err)
+			http.Error(w, "olderThan must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		deleted = h.userRegistry.DeleteOlderThan(time.Now().Add(-age))
+	} else {
+		deleted = h.userRegistry.DeleteAll()
+	}
+
+	writeJSON(w, r, http.StatusOK, UsersPurgeResponse{Deleted: deleted})
+}
@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/chat"
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func setupAdminHandler(t *testing.T) (*Handler, *mux.Router) {
+	t.Helper()
+	h := setupHandler(t)
+	h.SetAdminToken("secret")
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	return h, r
+}
+
+func TestAdminRoutesDisabledWithoutToken(t *testing.T) {
+	h := setupHandler(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/rooms", nil)
+	match := mux.RouteMatch{}
+	if r.Match(req, &match) && match.MatchErr == nil {
+		t.Error("expected admin routes to be unregistered without a token")
+	}
+}
+
+func TestAdminRoomsAuthorization(t *testing.T) {
+	_, r := setupAdminHandler(t)
+
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+	}{
+		{name: "Missing header", header: "", expectedStatus: http.StatusUnauthorized},
+		{name: "Wrong token", header: "Bearer wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "Missing bearer prefix", header: "secret", expectedStatus: http.StatusUnauthorized},
+		{name: "Valid token", header: "Bearer secret", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/admin/rooms", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAdminRoomsDetail(t *testing.T) {
+	h, r := setupAdminHandler(t)
+
+	room, _ := h.hub.CreateRoom(model.AdditionalInfo{"name": "Monitored"})
+	close(room.Shutdown())
+	room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hi"})
+	room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "there"})
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/rooms", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string][]model.RoomDetail
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	rooms := response["rooms"]
+	if len(rooms) != 1 {
+		t.Fatalf("expected 1 room, got %d", len(rooms))
+	}
+	if rooms[0].MessageCount != 2 {
+		t.Errorf("expected messageCount 2, got %d", rooms[0].MessageCount)
+	}
+	if rooms[0].CreatedAt.IsZero() || rooms[0].LastActivity.IsZero() {
+		t.Error("expected createdAt and lastActivity to be set")
+	}
+	if rooms[0].AdditionalInfo["name"] != "Monitored" {
+		t.Errorf("expected additionalInfo to be included, got %v", rooms[0].AdditionalInfo)
+	}
+}
+
+func TestAdminBroadcast(t *testing.T) {
+	h, r := setupAdminHandler(t)
+	live := newRunningRoom(t, h)
+	client := connectTestClient(t, h, live, model.User{ID: uuid.New(), Name: "listener"})
+	closing, _ := h.hub.CreateRoom(nil)
+	close(closing.Shutdown())
+
+	req := httptest.NewRequest("POST", "/api/v1/admin/broadcast", strings.NewReader(`{"message":"Maintenance at 22:00"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var response AnnouncementResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Rooms != 1 {
+		t.Errorf("expected 1 room reached, got %d", response.Rooms)
+	}
+
+	select {
+	case b := <-client.Send():
+		var msg model.OutgoingMessage
+		json.Unmarshal(b, &msg)
+		if msg.MessageType != model.SystemMessage || msg.Message != "Maintenance at 22:00" || msg.AdditionalInfo["announcement"] != true {
+			t.Errorf("unexpected announcement: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("announcement was not broadcast")
+	}
+	if n := live.GetMessageCount(); n != 1 {
+		t.Errorf("expected announcement to be stored, got %d messages", n)
+	}
+	if n := closing.GetMessageCount(); n != 0 {
+		t.Errorf("expected closing room to be skipped, got %d messages", n)
+	}
+}
+
+func TestAdminBroadcastEmptyMessage(t *testing.T) {
+	_, r := setupAdminHandler(t)
+
+	req := httptest.NewRequest("POST", "/api/v1/admin/broadcast", strings.NewReader(`{"message":"  "}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAdminDeleteUsers(t *testing.T) {
+	h, r := setupAdminHandler(t)
+	h.userRegistry.CreateUser("", "", "alice", "", "", nil)
+	h.userRegistry.CreateUser("", "", "bob", "", "", nil)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{name: "Invalid olderThan", query: "?olderThan=soon", expectedStatus: http.StatusBadRequest},
+		{name: "Nobody inactive", query: "?olderThan=1h", expectedStatus: http.StatusOK, expectedCount: 0},
+		{name: "Everyone", query: "", expectedStatus: http.StatusOK, expectedCount: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", "/api/v1/users"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var response UsersPurgeResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Deleted != tt.expectedCount {
+				t.Errorf("expected %d deleted, got %d", tt.expectedCount, response.Deleted)
+			}
+		})
+	}
+
+	if users := h.userRegistry.GetAllUsers(); len(users) != 0 {
+		t.Errorf("expected empty registry, got %d users", len(users))
+	}
+}
+
+func TestAdminRoomDeadLetters(t *testing.T) {
+	h, r := setupAdminHandler(t)
+	room := newRunningRoom(t, h)
+
+	tests := []struct {
+		name           string
+		roomID         string
+		expectedStatus int
+	}{
+		{name: "Existing room", roomID: strconv.FormatUint(uint64(room.ID()), 10), expectedStatus: http.StatusOK},
+		{name: "Unknown room", roomID: "999", expectedStatus: http.StatusNotFound},
+		{name: "Invalid room id", roomID: "abc", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/admin/rooms/"+tt.roomID+"/dead-letters", nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var response map[string][]any
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if letters, ok := response["deadLetters"]; !ok || len(letters) != 0 {
+				t.Errorf("expected an empty deadLetters list, got %v", response)
+			}
+		})
+	}
+}
+
+func TestRoomUserDetails(t *testing.T) {
+	h, r := setupAdminHandler(t)
+	room := newRunningRoom(t, h)
+
+	u := model.User{ID: uuid.New(), Name: "watcher"}
+	client := chat.NewClient(room, nil, u, h.systemUser, h.logger, nil, "")
+	client.SetConnInfo(connInfo(&http.Request{RemoteAddr: "203.0.113.7:51234", Header: http.Header{"User-Agent": {"test-agent"}}}))
+	if !room.TryRegister(client) {
+		t.Fatal("failed to register client")
+	}
+	time.Sleep(20 * time.Millisecond)
+	path := "/api/v1/rooms/" + strconv.FormatUint(uint64(room.ID()), 10) + "/users"
+
+	req := httptest.NewRequest("GET", path+"/detail", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d without token, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", path+"/detail", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var response map[string][]chat.ConnectionDetail
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	conns := response["connections"]
+	if len(conns) != 1 {
+		t.Fatalf("expected 1 connection, got %d", len(conns))
+	}
+	if conns[0].User.ID != u.ID || conns[0].RemoteAddr != "203.0.113.7:51234" || conns[0].UserAgent != "test-agent" || conns[0].ConnectedAt.IsZero() {
+		t.Errorf("unexpected connection detail: %+v", conns[0])
+	}
+
+	req = httptest.NewRequest("GET", path, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if body := w.Body.String(); strings.Contains(body, "203.0.113.7") || strings.Contains(body, "test-agent") {
+		t.Errorf("expected the roster to leave out connection info, got %s", body)
+	}
+}
+
+func TestModerationRoutesRequireAdmin(t *testing.T) {
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{method: "DELETE", path: "/api/v1/rooms/1/users/" + uuid.NewString()},
+		{method: "GET", path: "/api/v1/rooms/1/bans"},
+		{method: "POST", path: "/api/v1/rooms/1/bans"},
+		{method: "DELETE", path: "/api/v1/rooms/1/bans/" + uuid.NewString()},
+		{method: "GET", path: "/api/v1/rooms/1/mutes"},
+		{method: "POST", path: "/api/v1/rooms/1/mutes"},
+		{method: "DELETE", path: "/api/v1/rooms/1/mutes/" + uuid.NewString()},
+		{method: "POST", path: "/api/v1/rooms/1/messages/" + uuid.NewString() + "/pin"},
+		{method: "DELETE", path: "/api/v1/rooms/1/messages/" + uuid.NewString() + "/pin"},
+		{method: "POST", path: "/api/v1/rooms/1/import"},
+	}
+
+	_, r := setupAdminHandler(t)
+	for _, route := range routes {
+		req := httptest.NewRequest(route.method, route.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: expected status %d without token, got %d", route.method, route.path, http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	h := setupHandler(t)
+	r = mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	for _, route := range routes {
+		req := httptest.NewRequest(route.method, route.path, nil)
+		match := mux.RouteMatch{}
+		if r.Match(req, &match) && match.MatchErr == nil {
+			t.Errorf("%s %s: expected route to be unregistered without a token", route.method, route.path)
+		}
+	}
+}
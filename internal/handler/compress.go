@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// minCompressSize is the smallest body worth compressing. Smaller bodies are
+// sent as-is since the encoding overhead outweighs the savings.
+const minCompressSize = 1024
+
+// compress wraps a JSON handler and encodes its response with gzip or deflate
+// when the client accepts it. Responses below minCompressSize and binary
+// content (images, octet streams) are passed through unchanged.
+func compress(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer cw.Close()
+		next(cw, r)
+	}
+}
+
+// negotiateEncoding picks gzip over deflate and ignores encodings with q=0.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err != nil || weight == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+// compressWriter buffers the response until it knows whether the body is
+// large enough to compress, then either streams it through the encoder or
+// writes it unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	status      int
+	buf         bytes.Buffer
+	decided     bool
+	wroteHeader bool
+	enc         io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	cw.wroteHeader = true
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf.Write(p)
+	if cw.buf.Len() >= minCompressSize {
+		if err := cw.flush(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes any buffered body and finishes the encoded stream.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if err := cw.flush(false); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		return cw.enc.Close()
+	}
+	return nil
+}
+
+func (cw *compressWriter) flush(large bool) error {
+	cw.decided = true
+	header := cw.Header()
+
+	if header.Get("Content-Type") == "" && cw.buf.Len() > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buf.Bytes()))
+	}
+
+	if large && header.Get("Content-Encoding") == "" && isCompressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		switch cw.encoding {
+		case "gzip":
+			cw.enc = gzip.NewWriter(cw.ResponseWriter)
+		default:
+			fw, err := flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+			if err != nil {
+				return err
+			}
+			cw.enc = fw
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.enc != nil {
+		_, err := cw.enc.Write(cw.buf.Bytes())
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+	return err
+}
+
+func isCompressible(contentType string) bool {
+	switch {
+	case strings.HasPrefix(contentType, "image/"),
+		strings.HasPrefix(contentType, "application/octet-stream"):
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func jsonBody(size int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"data":"`+strings.Repeat("a", size)+`"}`)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		handler          http.HandlerFunc
+		expectedEncoding string
+	}{
+		{name: "gzip", acceptEncoding: "gzip, deflate", handler: jsonBody(4096), expectedEncoding: "gzip"},
+		{name: "deflate", acceptEncoding: "deflate", handler: jsonBody(4096), expectedEncoding: "deflate"},
+		{name: "gzip disabled via q=0", acceptEncoding: "gzip;q=0, deflate", handler: jsonBody(4096), expectedEncoding: "deflate"},
+		{name: "no accept-encoding", acceptEncoding: "", handler: jsonBody(4096), expectedEncoding: ""},
+		{name: "small body", acceptEncoding: "gzip", handler: jsonBody(10), expectedEncoding: ""},
+		{
+			name:           "binary content",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.Write(make([]byte, 4096))
+			},
+			expectedEncoding: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			reference := httptest.NewRecorder()
+
+			compress(tt.handler)(w, req)
+			tt.handler(reference, req)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Fatalf("expected Content-Encoding %q, got %q", tt.expectedEncoding, got)
+			}
+			if got := w.Header().Get("Content-Type"); got != reference.Header().Get("Content-Type") {
+				t.Errorf("expected Content-Type %q, got %q", reference.Header().Get("Content-Type"), got)
+			}
+
+			var body io.Reader = w.Body
+			switch tt.expectedEncoding {
+			case "gzip":
+				gr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("failed to create gzip reader: %v", err)
+				}
+				body = gr
+			case "deflate":
+				body = flate.NewReader(w.Body)
+			}
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			if string(decoded) != reference.Body.String() {
+				t.Error("decoded body does not match uncompressed response")
+			}
+		})
+	}
+}
+
+func TestCompressKeepsStatus(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	compress(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "room not found", http.StatusNotFound)
+	})(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Error("expected small error response to stay uncompressed")
+	}
+}
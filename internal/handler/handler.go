@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"encoding/binary"
 	"log/slog"
+	"math/rand"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/choffmann/chat-room/internal/chat"
 	"github.com/choffmann/chat-room/internal/model"
@@ -14,17 +18,91 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
+// defaultUserNames is the built-in pool of names for anonymous users.
+var defaultUserNames = []string{
+	"Toni Tester",
+	"Harald Hüftschmerz",
+	"Andre Android",
+	"Hans Hotfix",
+	"Peter Push",
+	"Rebase Randy",
+	"Prof. Prokrastination",
+	"Mira Mobil",
+	"Lars Launcher",
+	"Paul Pixel",
+	"Nora Nexus",
+	"Timo Touch",
+	"Benny Bluetooth",
+	"Hanna Hotspot",
+	"Pixel Peter",
+	"APK Alex",
+	"Touchscreen Toni",
+	"Kotlin Kevin",
+	"Async Andy",
+	"Compose Chris",
+	"Composable Clara",
+	"SideEffect Susi",
+	"Gradle Gero",
+	"Activity Anni",
+	"Manifest Mona",
+	"Resource Rhea",
+	"ViewModel Viktor",
+	"Intent Ingo",
+}
+
+// anonymousColors is the palette ephemeral users get their color from.
+var anonymousColors = []string{
+	"#e6194b",
+	"#3cb44b",
+	"#4363d8",
+	"#f58231",
+	"#911eb4",
+	"#42d4f4",
+	"#f032e6",
+	"#9a6324",
+	"#469990",
+	"#800000",
+	"#808000",
+	"#000075",
+}
+
+// anonymousColor picks the palette entry for an ephemeral user: the last
+// eight hex digits of the UUID read as an unsigned number, modulo the size of
+// the palette.
+func anonymousColor(id uuid.UUID) string {
+	return anonymousColors[binary.BigEndian.Uint32(id[12:])%uint32(len(anonymousColors))]
+}
+
 type Handler struct {
-	hub          *chat.Hub
-	userRegistry *user.Registry
-	upgrader     websocket.Upgrader
-	systemUser   model.User
-	defaultNames []string
-	uploadStore  *upload.Store
-	logger       *slog.Logger
+	hub            *chat.Hub
+	userRegistry   *user.Registry
+	upgrader       websocket.Upgrader
+	systemUser     model.User
+	defaultNames   []string
+	uploadStore    *upload.Store
+	adminToken     string
+	wsAuthToken    string
+	wsAuthTimeout  time.Duration
+	idempotency    *idempotencyCache
+	creationLimit  *rateLimiter
+	joinLimit      *rateLimiter
+	userJoinLimit  *rateLimiter
+	schemas        InfoSchemas
+	roomValidators []RoomValidator
+	authorOnly     bool
+	maxNameLength  int
+	historyBytes   int
+	logger         *slog.Logger
 }
 
 func New(hub *chat.Hub, userRegistry *user.Registry, logger *slog.Logger, uploadStore *upload.Store) *Handler {
+	systemUser := model.User{
+		ID:   uuid.New(),
+		Name: "system",
+	}
+	hub.SetSystemUser(systemUser)
+	hub.SetUserResolver(userRegistry.Lookup)
+
 	return &Handler{
 		hub:          hub,
 		userRegistry: userRegistry,
@@ -36,48 +114,38 @@ func New(hub *chat.Hub, userRegistry *user.Registry, logger *slog.Logger, upload
 				return true
 			},
 		},
-		systemUser: model.User{
-			ID:   uuid.New(),
-			Name: "system",
-		},
-		defaultNames: []string{
-			"Toni Tester",
-			"Harald Hüftschmerz",
-			"Andre Android",
-			"Hans Hotfix",
-			"Peter Push",
-			"Rebase Randy",
-			"Prof. Prokrastination",
-			"Mira Mobil",
-			"Lars Launcher",
-			"Paul Pixel",
-			"Nora Nexus",
-			"Timo Touch",
-			"Benny Bluetooth",
-			"Hanna Hotspot",
-			"Pixel Peter",
-			"APK Alex",
-			"Touchscreen Toni",
-			"Kotlin Kevin",
-			"Async Andy",
-			"Compose Chris",
-			"Composable Clara",
-			"SideEffect Susi",
-			"Gradle Gero",
-			"Activity Anni",
-			"Manifest Mona",
-			"Resource Rhea",
-			"ViewModel Viktor",
-			"Intent Ingo",
-		},
-		logger: logger,
+		systemUser:   systemUser,
+		defaultNames: defaultUserNames,
+		idempotency:  newIdempotencyCache(defaultIdempotencyTTL),
+		logger:       logger,
 	}
 }
 
+// SetDefaultNames replaces the pool of names assigned to anonymous users.
+// An empty list keeps the built-in names.
+func (h *Handler) SetDefaultNames(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	h.defaultNames = names
+}
+
+func (h *Handler) randomUserName() string {
+	if len(h.defaultNames) == 0 {
+		return "Anonymous"
+	}
+	return h.defaultNames[rand.Intn(len(h.defaultNames))]
+}
+
 func (h *Handler) RegisterRoutes(r *mux.Router, legacyRoutes bool) {
 	v1 := r.PathPrefix("/api/v1").Subrouter()
 	h.registerV1Routes(v1)
 
+	// mux loses method mismatches inside subrouters and reports them as not
+	// found, so unmatched requests are checked against the other methods.
+	r.NotFoundHandler = methodNotAllowed(r)
+	r.MethodNotAllowedHandler = r.NotFoundHandler
+
 	v1.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
 		httpSwagger.URL("/api/v1/swagger/doc.json"),
 	))
@@ -94,40 +162,99 @@ func (h *Handler) RegisterRoutes(r *mux.Router, legacyRoutes bool) {
 
 func (h *Handler) registerV1Routes(r *mux.Router) {
 	// Room routes
-	r.HandleFunc("/rooms", h.createRoomHandler).Methods("POST")
+	r.HandleFunc("/rooms", h.rateLimited(h.idempotent(h.createRoomHandler))).Methods("POST")
 	r.HandleFunc("/rooms", h.getAllRoomsHandler).Methods("GET")
 	r.HandleFunc("/rooms/users", h.getAllUsersInRoomsHandler).Methods("GET")
 	r.HandleFunc("/rooms/{roomID}", h.getRoomIDHandler).Methods("GET")
 	r.HandleFunc("/rooms/{roomID}", h.patchRoomHandler).Methods("PATCH")
 	r.HandleFunc("/rooms/{roomID}", h.putRoomHandler).Methods("PUT")
+	r.HandleFunc("/rooms/{roomID}/stats", h.getRoomStatsHandler).Methods("GET")
 	r.HandleFunc("/rooms/{roomID}/users", h.getRoomUsersHandler).Methods("GET")
-	r.HandleFunc("/rooms/{roomID}/messages", h.getRoomMessagesHandler).Methods("GET")
-	r.HandleFunc("/rooms/{roomID}/messages/{messageID}", h.getRoomMessageHandler).Methods("GET")
+	r.HandleFunc("/rooms/{roomID}/users/count", h.getRoomUserCountHandler).Methods("GET")
+	r.HandleFunc("/rooms/{roomID}/pins", h.getRoomPinsHandler).Methods("GET")
+	r.HandleFunc("/rooms/{roomID}/export", h.exportRoomMessagesHandler).Methods("GET")
+	r.HandleFunc("/rooms/{roomID}/messages", compress(h.getRoomMessagesHandler)).Methods("GET")
+	r.HandleFunc("/rooms/{roomID}/messages", h.patchRoomMessagesHandler).Methods("PATCH")
+	r.HandleFunc("/rooms/{roomID}/messages/search", compress(h.searchRoomMessagesHandler)).Methods("GET")
+	r.HandleFunc("/rooms/{roomID}/messages/latest", h.getRoomLatestMessageHandler).Methods("GET")
+	r.HandleFunc("/rooms/{roomID}/messages/{messageID}", compress(h.getRoomMessageHandler)).Methods("GET")
 	r.HandleFunc("/rooms/{roomID}/messages/{messageID}", h.patchRoomMessageHandler).Methods("PATCH")
 	r.HandleFunc("/rooms/{roomID}/messages/{messageID}", h.putRoomMessageHandler).Methods("PUT")
 	r.HandleFunc("/rooms/{roomID}/messages/{messageID}", h.deleteRoomMessageHandler).Methods("DELETE")
+	r.HandleFunc("/rooms/{roomID}/messages/{messageID}/replies", compress(h.getRoomMessageRepliesHandler)).Methods("GET")
+	r.HandleFunc("/rooms/{roomID}/messages/{messageID}/receipts", h.getRoomMessageReceiptsHandler).Methods("GET")
 
 	// User routes
-	r.HandleFunc("/users", h.getAllUsersHandler).Methods("GET")
-	r.HandleFunc("/users", h.createUserHandler).Methods("POST")
-	r.HandleFunc("/users/{userID}", h.getUserHandler).Methods("GET")
+	r.HandleFunc("/users", compress(h.getAllUsersHandler)).Methods("GET")
+	r.HandleFunc("/users", h.rateLimited(h.idempotent(h.createUserHandler))).Methods("POST")
+	r.HandleFunc("/users/online", compress(h.getOnlineUsersHandler)).Methods("GET")
+	r.HandleFunc("/users/{userID}", compress(h.getUserHandler)).Methods("GET")
 	r.HandleFunc("/users/{userID}", h.putUserHandler).Methods("PUT")
 	r.HandleFunc("/users/{userID}", h.patchUserHandler).Methods("PATCH")
 	r.HandleFunc("/users/{userID}", h.deleteUserHandler).Methods("DELETE")
+	r.HandleFunc("/users/{userID}/rooms", h.getUserRoomsHandler).Methods("GET")
 
 	// WebSocket route
+	r.HandleFunc("/join", h.multiWsHandler).Methods("GET")
 	r.HandleFunc("/join/{roomID}", h.wsHandler).Methods("GET")
 
 	// Info routes
 	r.HandleFunc("/info", h.getInfoHandler).Methods("GET")
+	r.HandleFunc("/version", h.getInfoHandler).Methods("GET")
 	r.HandleFunc("/healthz", h.healthzHandler).Methods("GET")
+
+	// Admin routes
+	if h.adminToken != "" {
+		r.HandleFunc("/admin/rooms", h.requireAdmin(h.getAdminRoomsHandler)).Methods("GET")
+		r.HandleFunc("/admin/rooms/{roomID}/dead-letters", h.requireAdmin(h.getAdminRoomDeadLettersHandler)).Methods("GET")
+		r.HandleFunc("/rooms/{roomID}/users/detail", h.requireAdmin(h.getRoomUserDetailsHandler)).Methods("GET")
+		r.HandleFunc("/rooms/{roomID}/users/{userID}", h.requireAdmin(h.kickRoomUserHandler)).Methods("DELETE")
+		r.HandleFunc("/rooms/{roomID}/bans", h.requireAdmin(h.getRoomBansHandler)).Methods("GET")
+		r.HandleFunc("/rooms/{roomID}/bans", h.requireAdmin(h.createRoomBanHandler)).Methods("POST")
+		r.HandleFunc("/rooms/{roomID}/bans/{userID}", h.requireAdmin(h.deleteRoomBanHandler)).Methods("DELETE")
+		r.HandleFunc("/rooms/{roomID}/messages/{messageID}/pin", h.requireAdmin(h.pinRoomMessageHandler)).Methods("POST")
+		r.HandleFunc("/rooms/{roomID}/messages/{messageID}/pin", h.requireAdmin(h.unpinRoomMessageHandler)).Methods("DELETE")
+		r.HandleFunc("/rooms/{roomID}/mutes", h.requireAdmin(h.getRoomMutesHandler)).Methods("GET")
+		r.HandleFunc("/rooms/{roomID}/mutes", h.requireAdmin(h.createRoomMuteHandler)).Methods("POST")
+		r.HandleFunc("/rooms/{roomID}/mutes/{userID}", h.requireAdmin(h.deleteRoomMuteHandler)).Methods("DELETE")
+		r.HandleFunc("/rooms/{roomID}/import", h.requireAdmin(h.importRoomMessagesHandler)).Methods("POST")
+		r.HandleFunc("/admin/broadcast", h.requireAdmin(h.adminBroadcastHandler)).Methods("POST")
+		r.HandleFunc("/users", h.requireAdmin(h.deleteUsersHandler)).Methods("DELETE")
+	}
+}
+
+// routeMethods are the methods checked when listing the Allow header of a
+// 405 response.
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// methodNotAllowed answers requests to a known path with an unsupported
+// method with 405; the Allow header lists the methods router serves for the
+// path. Requests to unknown paths get 404.
+func methodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := make([]string, 0, len(routeMethods))
+		for _, method := range routeMethods {
+			req := r.Clone(r.Context())
+			req.Method = method
+			var match mux.RouteMatch
+			if router.Match(req, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+		if len(allowed) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	})
 }
 
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -6,9 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/choffmann/chat-room/internal/chat"
+	"github.com/choffmann/chat-room/internal/model"
 	"github.com/choffmann/chat-room/internal/user"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -43,7 +46,7 @@ func TestRegisterRoutes_VersionedPrefix(t *testing.T) {
 	for _, p := range paths {
 		req := httptest.NewRequest(p.method, p.path, nil)
 		match := mux.RouteMatch{}
-		if !r.Match(req, &match) {
+		if !r.Match(req, &match) || match.MatchErr != nil {
 			t.Errorf("expected %s %s to match a route", p.method, p.path)
 		}
 	}
@@ -51,7 +54,7 @@ func TestRegisterRoutes_VersionedPrefix(t *testing.T) {
 	// Legacy routes should not be registered
 	req := httptest.NewRequest("GET", "/rooms", nil)
 	match := mux.RouteMatch{}
-	if r.Match(req, &match) {
+	if r.Match(req, &match) && match.MatchErr == nil {
 		t.Error("expected /rooms to not match when legacy routes are disabled")
 	}
 }
@@ -64,12 +67,46 @@ func TestRegisterRoutes_LegacyEnabled(t *testing.T) {
 	for _, path := range []string{"/rooms", "/api/v1/rooms"} {
 		req := httptest.NewRequest(http.MethodGet, path, nil)
 		match := mux.RouteMatch{}
-		if !r.Match(req, &match) {
+		if !r.Match(req, &match) || match.MatchErr != nil {
 			t.Errorf("expected GET %s to match a route", path)
 		}
 	}
 }
 
+func TestMethodNotAllowed(t *testing.T) {
+	h := setupHandler(t)
+	h.SetAdminToken("secret")
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, true)
+
+	tests := []struct {
+		method         string
+		path           string
+		expectedStatus int
+		expectedAllow  string
+	}{
+		{"DELETE", "/api/v1/rooms", http.StatusMethodNotAllowed, "GET, POST"},
+		{"DELETE", "/rooms", http.StatusMethodNotAllowed, "GET, POST"},
+		{"POST", "/api/v1/rooms/1", http.StatusMethodNotAllowed, "GET, PUT, PATCH"},
+		{"PUT", "/api/v1/rooms/1/messages/abc/pin", http.StatusMethodNotAllowed, "POST, DELETE"},
+		{"DELETE", "/api/v1/nothing", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("Allow"); got != tt.expectedAllow {
+				t.Errorf("expected Allow %q, got %q", tt.expectedAllow, got)
+			}
+		})
+	}
+}
+
 func TestWebSocketUpgrader(t *testing.T) {
 	h := setupHandler(t)
 
@@ -85,3 +122,137 @@ func TestWebSocketUpgrader(t *testing.T) {
 		t.Error("WriteBufferSize should be set")
 	}
 }
+
+func TestSetDefaultNames(t *testing.T) {
+	h := setupHandler(t)
+
+	h.SetDefaultNames(nil)
+	if len(h.defaultNames) != len(defaultUserNames) {
+		t.Errorf("expected empty list to keep %d built-in names, got %d", len(defaultUserNames), len(h.defaultNames))
+	}
+
+	h.SetDefaultNames([]string{"Brand Bot"})
+	if name := h.randomUserName(); name != "Brand Bot" {
+		t.Errorf("expected configured name, got %q", name)
+	}
+
+	h.defaultNames = nil
+	if name := h.randomUserName(); name != "Anonymous" {
+		t.Errorf("expected fallback name for empty pool, got %q", name)
+	}
+}
+
+func TestAnonymousColor(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"550e8400-e29b-41d4-a716-446655440000", "#e6194b"},
+		{"550e8400-e29b-41d4-a716-446655440001", "#3cb44b"},
+		{"550e8400-e29b-41d4-a716-44665544000b", "#000075"},
+		{"550e8400-e29b-41d4-a716-4466ffffffff", "#f58231"},
+	}
+	for _, tt := range tests {
+		if got := anonymousColor(uuid.MustParse(tt.id)); got != tt.want {
+			t.Errorf("anonymousColor(%s) = %s, want %s", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestResolveJoinUserColor(t *testing.T) {
+	h := setupHandler(t)
+
+	req := httptest.NewRequest("GET", "/join/1?userName=guest", nil)
+	user, ok := h.resolveJoinUser(httptest.NewRecorder(), req)
+	if !ok {
+		t.Fatal("expected ephemeral user to resolve")
+	}
+	if got := user.AdditionalInfo["color"]; got != anonymousColor(user.ID) {
+		t.Errorf("expected color %s for ephemeral user, got %v", anonymousColor(user.ID), got)
+	}
+
+	registered := h.userRegistry.CreateUser("", "", "member", "", "", nil)
+	req = httptest.NewRequest("GET", "/join/1?userId="+registered.ID.String(), nil)
+	user, ok = h.resolveJoinUser(httptest.NewRecorder(), req)
+	if !ok {
+		t.Fatal("expected registered user to resolve")
+	}
+	if _, ok := user.AdditionalInfo["color"]; ok {
+		t.Errorf("expected registered user to keep its own additionalInfo, got %v", user.AdditionalInfo)
+	}
+}
+
+func TestWSHandlerConnectionLimit(t *testing.T) {
+	h := setupHandler(t)
+	room, _ := h.hub.CreateRoom(nil)
+	defer close(room.Shutdown())
+
+	h.hub.SetMaxConnections(1)
+	h.hub.AcquireConnection()
+
+	req := httptest.NewRequest("GET", "/join/1", nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+	w := httptest.NewRecorder()
+
+	h.wsHandler(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if count := h.hub.ConnectionCount(); count != 1 {
+		t.Errorf("expected rejected join not to hold a slot, got %d", count)
+	}
+}
+
+func TestWSHandlerInvalidReconnectToken(t *testing.T) {
+	h := setupHandler(t)
+	h.hub.SetReconnectGrace(time.Minute)
+	room, _ := h.hub.CreateRoom(nil)
+	defer close(room.Shutdown())
+
+	req := httptest.NewRequest("GET", "/join/1?reconnectToken=bogus", nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+	w := httptest.NewRecorder()
+
+	h.wsHandler(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if count := h.hub.ConnectionCount(); count != 0 {
+		t.Errorf("expected rejected join not to hold a slot, got %d", count)
+	}
+}
+
+func TestWSHandlerRequireRegisteredUsers(t *testing.T) {
+	h := setupHandler(t)
+	room, _ := h.hub.CreateRoom(model.AdditionalInfo{"requireRegisteredUsers": true})
+	defer close(room.Shutdown())
+	registered := h.userRegistry.CreateUser("", "", "member", "", "", nil)
+
+	tests := []struct {
+		name         string
+		query        string
+		unauthorized bool
+	}{
+		{name: "Ephemeral user", query: "?userName=guest", unauthorized: true},
+		{name: "Anonymous user", query: "", unauthorized: true},
+		{name: "Registered user", query: "?userId=" + registered.ID.String(), unauthorized: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/join/1"+tt.query, nil)
+			req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+			w := httptest.NewRecorder()
+
+			h.wsHandler(w, req)
+
+			// The recorder can't be upgraded, so an accepted join fails
+			// later with a different status.
+			if got := w.Code == http.StatusUnauthorized; got != tt.unauthorized {
+				t.Errorf("expected unauthorized %v, got status %d", tt.unauthorized, w.Code)
+			}
+		})
+	}
+}
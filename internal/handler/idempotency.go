@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"bytes"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyHeader     = "Idempotency-Key"
+	maxIdempotencyKeyLen  = 255
+	defaultIdempotencyTTL = time.Hour
+)
+
+// idempotencyCache remembers the responses of create requests by their
+// Idempotency-Key so that retried requests don't create duplicates.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+	now     func() time.Time
+}
+
+type idempotencyEntry struct {
+	done      chan struct{}
+	expiresAt time.Time
+	header    http.Header
+	status    int
+	body      []byte
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+		now:     time.Now,
+	}
+}
+
+// acquire returns the entry for key and whether the caller owns it. The owner
+// must call finish once the response is known; everyone else waits on done
+// and replays the stored response.
+func (c *idempotencyCache) acquire(key string) (*idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, e := range c.entries {
+		if !e.expiresAt.IsZero() && !now.Before(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+
+	if e, ok := c.entries[key]; ok {
+		return e, false
+	}
+	e := &idempotencyEntry{done: make(chan struct{})}
+	c.entries[key] = e
+	return e, true
+}
+
+// finish stores the response of the owning request. Failed requests are
+// forgotten so that a retry can succeed, but concurrent waiters still get
+// the failure.
+func (c *idempotencyCache) finish(key string, e *idempotencyEntry, rec *responseCapture) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	e.header = rec.header
+	e.status = rec.status
+	e.body = rec.body.Bytes()
+	if e.status >= 200 && e.status < 300 {
+		e.expiresAt = c.now().Add(c.ttl)
+	} else {
+		delete(c.entries, key)
+	}
+	close(e.done)
+}
+
+// responseCapture buffers a handler's response so it can be cached.
+type responseCapture struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rc *responseCapture) Header() http.Header { return rc.header }
+
+func (rc *responseCapture) WriteHeader(status int) {
+	if rc.status == 0 {
+		rc.status = status
+	}
+}
+
+func (rc *responseCapture) Write(p []byte) (int, error) {
+	rc.WriteHeader(http.StatusOK)
+	return rc.body.Write(p)
+}
+
+// SetIdempotencyTTL sets how long responses of requests carrying an
+// Idempotency-Key are replayed.
+func (h *Handler) SetIdempotencyTTL(ttl time.Duration) {
+	h.idempotency.mu.Lock()
+	defer h.idempotency.mu.Unlock()
+	h.idempotency.ttl = ttl
+}
+
+// idempotent makes a create handler honor the Idempotency-Key header. A
+// repeated request with the same key gets the original response instead of
+// creating another resource. Requests without the header are passed through.
+func (h *Handler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			h.logger.Warn("idempotency key too long", "remoteAddr", r.RemoteAddr, "length", len(key))
+			http.Error(w, "idempotency key too long", http.StatusBadRequest)
+			return
+		}
+
+		cacheKey := r.Method + " " + r.URL.Path + " " + key
+		entry, owner := h.idempotency.acquire(cacheKey)
+		if owner {
+			rec := &responseCapture{header: make(http.Header)}
+			next(rec, r)
+			h.idempotency.finish(cacheKey, entry, rec)
+		} else {
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			h.logger.Debug("replaying idempotent response", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+		}
+
+		maps.Copy(w.Header(), entry.header)
+		w.WriteHeader(entry.status)
+		_, _ = w.Write(entry.body)
+	}
+}
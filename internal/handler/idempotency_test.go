@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+)
+
+func postWithKey(t *testing.T, handler http.HandlerFunc, path, body, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestIdempotentCreateUser(t *testing.T) {
+	h := setupHandler(t)
+	create := h.idempotent(h.createUserHandler)
+
+	first := postWithKey(t, create, "/users", `{"name":"Alice"}`, "abc")
+	second := postWithKey(t, create, "/users", `{"name":"Alice"}`, "abc")
+
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+		t.Fatalf("expected both requests to return %d, got %d and %d", http.StatusCreated, first.Code, second.Code)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("expected replayed body %q, got %q", first.Body.String(), second.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("expected replayed response to be marked")
+	}
+	if second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected replayed Content-Type, got %q", second.Header().Get("Content-Type"))
+	}
+	if count := len(h.userRegistry.GetAllUsers()); count != 1 {
+		t.Errorf("expected 1 user, got %d", count)
+	}
+
+	postWithKey(t, create, "/users", `{"name":"Alice"}`, "other")
+	postWithKey(t, create, "/users", `{"name":"Alice"}`, "")
+	if count := len(h.userRegistry.GetAllUsers()); count != 3 {
+		t.Errorf("expected new key and missing key to create users, got %d users", count)
+	}
+}
+
+func TestIdempotentCreateRoomConcurrent(t *testing.T) {
+	h := setupHandler(t)
+	create := h.idempotent(h.createRoomHandler)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies[i] = postWithKey(t, create, "/rooms", `{}`, "retry-me").Body.String()
+		}()
+	}
+	wg.Wait()
+
+	for _, body := range bodies[1:] {
+		if body != bodies[0] {
+			t.Errorf("expected all responses to match %q, got %q", bodies[0], body)
+		}
+	}
+	if rooms := h.hub.GetAllRoomIDs(); len(rooms) != 1 {
+		t.Errorf("expected 1 room, got %d", len(rooms))
+	}
+	for _, room := range h.hub.GetAllRoomIDs() {
+		r, _ := h.hub.GetRoom(room.ID)
+		close(r.Shutdown())
+	}
+}
+
+func TestIdempotentFailureIsNotCached(t *testing.T) {
+	h := setupHandler(t)
+	create := h.idempotent(h.createUserHandler)
+
+	if w := postWithKey(t, create, "/users", `not json`, "abc"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := postWithKey(t, create, "/users", `{"name":"Bob"}`, "abc")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected retry after failure to succeed, got %d", w.Code)
+	}
+	var user model.User
+	if err := json.NewDecoder(w.Body).Decode(&user); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if user.Name != "Bob" {
+		t.Errorf("expected user Bob, got %q", user.Name)
+	}
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	h := setupHandler(t)
+	now := time.Now()
+	h.idempotency.now = func() time.Time { return now }
+	create := h.idempotent(h.createUserHandler)
+
+	postWithKey(t, create, "/users", `{"name":"Alice"}`, "abc")
+	now = now.Add(defaultIdempotencyTTL)
+	postWithKey(t, create, "/users", `{"name":"Alice"}`, "abc")
+
+	if count := len(h.userRegistry.GetAllUsers()); count != 2 {
+		t.Errorf("expected expired key to create a new user, got %d users", count)
+	}
+}
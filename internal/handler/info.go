@@ -1,42 +1,104 @@
 package handler
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/choffmann/chat-room/internal/config"
+	"github.com/choffmann/chat-room/internal/model"
 )
 
 type Info struct {
-	Version       string    `json:"version" example:"v1.0.0"`
-	GitCommit     string    `json:"commit" example:"a1b2c3d"`
-	GitRepository string    `json:"repository" example:"https://github.com/choffmann/chat-room"`
-	BuildTime     time.Time `json:"build_time" example:"2024-04-09T12:45:00Z"`
-	GoVersion     string    `json:"go_version" example:"go1.25.0"`
+	Version       string `json:"version" example:"v1.0.0"`
+	GitCommit     string `json:"commit" example:"a1b2c3d"`
+	GitRepository string `json:"repository" example:"https://github.com/choffmann/chat-room"`
+	BuildTime     string `json:"build_time" example:"2024-04-09T12:45:00Z"`
+	GoVersion     string `json:"go_version" example:"go1.25.0"`
 } // @name BuildInfo
 
+type HealthResponse struct {
+	Status     string `json:"status" example:"ok"`
+	Uptime     string `json:"uptime" example:"3h12m5s"`
+	Rooms      int    `json:"rooms" example:"4"`
+	Clients    int    `json:"clients" example:"17"`
+	StuckRooms []uint `json:"stuckRooms,omitempty" example:"3"`
+} // @name HealthResponse
+
+const (
+	// healthCheckSample is how many rooms a deep health check pings.
+	healthCheckSample = 100
+	// healthCheckTimeout is how long a room may take to answer a ping.
+	healthCheckTimeout = time.Second
+)
+
 // healthzHandler godoc
 // @Summary      Health check
-// @Description  Simple liveness probe. Returns plain text "OK".
+// @Description  Simple liveness probe. Returns plain text "OK", or with `Accept: application/json` the process uptime and the current number of rooms and WebSocket clients.
+// @Description  With `deep=1` up to 100 rooms are pinged to check that their goroutines still respond. Rooms that don't answer within a second are reported as stuck with status 503.
 // @Tags         info
 // @Produce      plain
-// @Success      200  {string}  string  "OK"
+// @Produce      json
+// @Param        deep  query     bool  false  "Check that room goroutines respond"
+// @Success      200   {object}  HealthResponse
+// @Failure      503   {object}  HealthResponse
 // @Router       /healthz [get]
 func (h *Handler) healthzHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte("OK"))
+	status, code := "ok", http.StatusOK
+	var stuck []uint
+	if deep := r.URL.Query().Get("deep"); deep == "1" || deep == "true" {
+		stuck = h.hub.StuckRooms(healthCheckSample, healthCheckTimeout)
+		if len(stuck) > 0 {
+			h.logger.Error("health check found stuck rooms", "rooms", stuck)
+			status, code = "degraded", http.StatusServiceUnavailable
+		}
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.WriteHeader(code)
+		if len(stuck) > 0 {
+			_, _ = fmt.Fprintf(w, "stuck rooms: %v", stuck)
+			return
+		}
+		_, _ = w.Write([]byte("OK"))
+		return
+	}
+
+	var uptime time.Duration
+	if !config.StartTime.IsZero() {
+		uptime = time.Since(config.StartTime).Round(time.Second)
+	}
+	rooms, _ := h.hub.RoomLimit()
+
+	writeJSON(w, r, code, HealthResponse{
+		Status:     status,
+		Uptime:     uptime.String(),
+		Rooms:      rooms,
+		Clients:    h.hub.ConnectionCount(),
+		StuckRooms: stuck,
+	})
 }
 
 // getInfoHandler godoc
 // @Summary      Get build info
 // @Description  Exposes metadata about the running binary. Field values are populated at build time; when unavailable, they default to "unknown".
+// @Description  With `format=text` or `Accept: text/plain` only the version and commit are returned on one line, e.g. `v1.0.0 a1b2c3d`. `/version` is an alias.
 // @Tags         info
 // @Produce      json
-// @Success      200  {object}  Info
+// @Produce      plain
+// @Param        format  query     string  false  "Response format"  Enums(json, text)
+// @Success      200     {object}  Info
 // @Router       /info [get]
+// @Router       /version [get]
 func (h *Handler) getInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if wantsPlainText(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(config.Version + " " + config.GitCommit + "\n"))
+		return
+	}
+
 	bi, _ := debug.ReadBuildInfo()
 
 	var goVersion string
@@ -63,10 +125,33 @@ func (h *Handler) getInfoHandler(w http.ResponseWriter, r *http.Request) {
 		Version:       config.Version,
 		GitCommit:     config.GitCommit,
 		GitRepository: config.GitRepository,
-		BuildTime:     bt,
+		BuildTime:     model.FormatTimestamp(bt),
 		GoVersion:     goVersion,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(info)
+	writeJSON(w, r, http.StatusOK, info)
+}
+
+// wantsPlainText reports whether the client asked for the one-line text
+// format. The format query parameter wins over the Accept header, and JSON
+// stays the default when both types are accepted.
+func wantsPlainText(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "text":
+		return true
+	case "json":
+		return false
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")
+}
+
+// VersionMiddleware adds the running build's version and commit to every
+// response so a request can be traced to a build without calling /info.
+func VersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-App-Version", config.Version)
+		w.Header().Set("X-App-Commit", config.GitCommit)
+		next.ServeHTTP(w, r)
+	})
 }
@@ -4,11 +4,43 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/choffmann/chat-room/internal/config"
 )
 
+func TestHealthzHandlerJSON(t *testing.T) {
+	h := setupHandler(t)
+	room, _ := h.hub.CreateRoom(nil)
+	defer close(room.Shutdown())
+	h.hub.AcquireConnection()
+
+	start := config.StartTime
+	config.StartTime = time.Now().Add(-90 * time.Second)
+	defer func() { config.StartTime = start }()
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	h.healthzHandler(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+	var resp HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := HealthResponse{Status: "ok", Uptime: "1m30s", Rooms: 1, Clients: 1}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("expected %+v, got %+v", want, resp)
+	}
+}
+
 func TestHealthzHandler(t *testing.T) {
 	h := setupHandler(t)
 
@@ -27,6 +59,21 @@ func TestHealthzHandler(t *testing.T) {
 	}
 }
 
+func TestHealthzHandlerDeep(t *testing.T) {
+	h := setupHandler(t)
+	room, _ := h.hub.CreateRoom(nil)
+	defer close(room.Shutdown())
+
+	req := httptest.NewRequest("GET", "/healthz?deep=1", nil)
+	w := httptest.NewRecorder()
+
+	h.healthzHandler(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Errorf("expected 200 OK for responsive rooms, got %d %q", w.Code, w.Body.String())
+	}
+}
+
 func TestGetInfoHandler(t *testing.T) {
 	h := setupHandler(t)
 
@@ -57,11 +104,96 @@ func TestGetInfoHandler(t *testing.T) {
 		t.Errorf("expected gitCommit %s, got %s", config.GitCommit, info.GitCommit)
 	}
 
-	if info.BuildTime.IsZero() {
-		t.Error("expected buildTime to be set")
+	if info.BuildTime != config.BuildTime {
+		t.Errorf("expected buildTime %s, got %s", config.BuildTime, info.BuildTime)
 	}
 
 	if info.GitRepository != config.GitRepository {
 		t.Errorf("expected gitRepository %s, got %s", config.GitRepository, info.GitRepository)
 	}
 }
+
+func TestGetInfoHandlerMalformedBuildTime(t *testing.T) {
+	h := setupHandler(t)
+
+	origBuildTime := config.BuildTime
+	config.BuildTime = "not-a-time"
+	defer func() { config.BuildTime = origBuildTime }()
+
+	req := httptest.NewRequest("GET", "/info", nil)
+	w := httptest.NewRecorder()
+
+	h.getInfoHandler(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); strings.HasPrefix(ct, "application/json") {
+		t.Errorf("expected plain text error, got Content-Type %q", ct)
+	}
+	if body := w.Body.String(); body != "can't parse build time\n" {
+		t.Errorf("expected only the error message in body, got %q", body)
+	}
+}
+
+func TestVersionMiddleware(t *testing.T) {
+	h := setupHandler(t)
+
+	config.Version = "v1.2.3"
+	config.GitCommit = "def456"
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+
+	VersionMiddleware(http.HandlerFunc(h.healthzHandler)).ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-App-Version"); got != "v1.2.3" {
+		t.Errorf("expected X-App-Version v1.2.3, got %q", got)
+	}
+	if got := w.Header().Get("X-App-Commit"); got != "def456" {
+		t.Errorf("expected X-App-Commit def456, got %q", got)
+	}
+	if w.Body.String() != "OK" {
+		t.Errorf("expected wrapped handler to run, got body %q", w.Body.String())
+	}
+}
+
+func TestGetInfoHandlerPlainText(t *testing.T) {
+	h := setupHandler(t)
+
+	config.Version = "v1.0.0"
+	config.GitCommit = "abc123"
+
+	tests := []struct {
+		name      string
+		target    string
+		accept    string
+		wantPlain bool
+	}{
+		{"default", "/info", "", false},
+		{"format param", "/info?format=text", "", true},
+		{"accept header", "/info", "text/plain", true},
+		{"json preferred when both accepted", "/info", "application/json, text/plain", false},
+		{"format param overrides accept", "/info?format=json", "text/plain", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			h.getInfoHandler(w, req)
+
+			isPlain := strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain")
+			if isPlain != tt.wantPlain {
+				t.Fatalf("expected plain=%v, got Content-Type %q", tt.wantPlain, w.Header().Get("Content-Type"))
+			}
+			if isPlain && w.Body.String() != "v1.0.0 abc123\n" {
+				t.Errorf("expected body %q, got %q", "v1.0.0 abc123\n", w.Body.String())
+			}
+		})
+	}
+}
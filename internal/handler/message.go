@@ -1,10 +1,17 @@
 package handler
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/choffmann/chat-room/internal/chat"
 	"github.com/choffmann/chat-room/internal/model"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -20,14 +27,66 @@ type MessagePutRequest struct {
 	AdditionalInfo model.AdditionalInfo `json:"additionalInfo,omitempty" swaggertype:"object"`
 }
 
+type MessagesPageResponse struct {
+	Messages   []model.OutgoingMessage `json:"messages"`
+	Total      int                     `json:"total"`
+	HasMore    bool                    `json:"hasMore"`
+	NextOffset int                     `json:"nextOffset,omitempty"`
+	NotFound   []uuid.UUID             `json:"notFound,omitempty"`
+}
+
+type MessageBatchPatchEntry struct {
+	ID             uuid.UUID            `json:"id"`
+	Message        *string              `json:"message,omitempty"`
+	AdditionalInfo model.AdditionalInfo `json:"additionalInfo,omitempty" swaggertype:"object"`
+}
+
+type MessageBatchPatchResult struct {
+	ID      uuid.UUID              `json:"id"`
+	Updated bool                   `json:"updated"`
+	Error   string                 `json:"error,omitempty"`
+	Message *model.OutgoingMessage `json:"message,omitempty"`
+}
+
+type MessageBatchPatchResponse struct {
+	Results []MessageBatchPatchResult `json:"results"`
+}
+
+type MessageReceiptsResponse struct {
+	MessageID   uuid.UUID   `json:"messageId"`
+	DeliveredTo []uuid.UUID `json:"deliveredTo"`
+}
+
+type MessageRepliesResponse struct {
+	Messages      []model.OutgoingMessage `json:"messages"`
+	ParentDeleted bool                    `json:"parentDeleted"`
+}
+
 // getRoomMessagesHandler godoc
 // @Summary      Get all messages in a room
-// @Description  Returns all messages that have been sent in a specific room. Messages are stored in memory and include system messages (joins/leaves) as well as user messages. Only messages smaller than 2 MiB are stored.
+// @Description  Returns the messages that have been sent in a specific room. Messages are stored in memory and include system messages (joins/leaves) as well as user messages. Only messages smaller than 2 MiB are stored.
+// @Description
+// @Description  Every stored message has a `seq` number that increases by one per stored message in the room. Use `since` to only return messages with a higher `seq`, e.g. to fetch what was missed after a reconnect.
+// @Description
+// @Description  Use `type` to only return messages of one built-in type. Without `limit` and `offset` all matching messages are returned. With them, the most recent `limit` matching messages are returned after skipping the newest `offset` ones. The result is ordered oldest to newest, or newest to oldest with `order=desc`; the order doesn't change which messages a page contains. `total` is the number of matching messages and `hasMore` tells whether older ones exist.
+// @Description
+// @Description  With `ids`, a comma-separated list of up to 100 message UUIDs, just those messages are returned in the listed order and all other parameters are ignored. IDs of unknown or expired messages, and of messages the requester may not see, are reported in `notFound`.
+// @Description
+// @Description  Messages sent with an `audience` role are only returned with a `userId` of their author or of a user with that role, or with the admin token.
+// @Description
+// @Description  A response is cut short once its messages exceed the server's history byte budget; the oldest messages of the page are left out, `hasMore` is true and `nextOffset` is the `offset` that continues with them.
 // @Tags         messages
 // @Produce      json
-// @Param        roomID  path      int  true  "Room ID"
+// @Param        roomID  path      int     true   "Room ID"
+// @Param        ids     query     string  false  "Comma-separated message UUIDs to fetch"
+// @Param        type    query     string  false  "Only return messages of this type"  Enums(message, system, image, message_deleted)
+// @Param        since   query     int     false  "Only return messages with a higher seq"
+// @Param        limit   query     int     false  "Maximum number of messages to return (max 500)"
+// @Param        offset  query     int     false  "Number of newest matching messages to skip"
+// @Param        order   query     string  false  "asc (default) or desc"  Enums(asc, desc)
+// @Param        userId  query     string  false  "Show the messages sent to this user's role"
 // @Success      200     {object}  MessagesListResponse
-// @Failure      400     {string}  string  "can't parse room id to uint"
+// @Failure      400     {string}  string  "can't parse room id to uint, invalid ids, type, since, limit, offset, order or userId"
 // @Failure      404     {string}  string  "room not found"
 // @Router       /rooms/{roomID}/messages [get]
 func (h *Handler) getRoomMessagesHandler(w http.ResponseWriter, r *http.Request) {
@@ -39,6 +98,51 @@ func (h *Handler) getRoomMessagesHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	query := r.URL.Query()
+	if query.Has("ids") {
+		h.getRoomMessagesByIDs(w, r, uint(roomID))
+		return
+	}
+
+	msgType := model.MessageType(query.Get("type"))
+	if msgType != "" && !model.IsKnownMessageType(msgType) {
+		h.logger.Warn("invalid message type filter", "roomID", roomID, "type", msgType, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "invalid message type", http.StatusBadRequest)
+		return
+	}
+
+	var since uint64
+	if v := query.Get("since"); v != "" {
+		since, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			h.logger.Warn("invalid since for getting messages", "roomID", roomID, "since", v, "remoteAddr", r.RemoteAddr, "error", err)
+			http.Error(w, "since must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	order := query.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		h.logger.Warn("invalid order for getting messages", "roomID", roomID, "order", order, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "invalid order, must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	paginate := query.Has("limit") || query.Has("offset")
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		h.logger.Warn("invalid pagination for getting messages", "roomID", roomID, "query", r.URL.RawQuery, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hidden, err := h.hiddenMessages(r)
+	if err != nil {
+		h.logger.Warn("invalid user id for getting messages", "roomID", roomID, "userID", query.Get("userId"), "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid userId", http.StatusBadRequest)
+		return
+	}
+
 	room, ok := h.hub.GetRoom(uint(roomID))
 	if !ok {
 		h.logger.Warn("room not found for getting messages", "roomID", roomID, "remoteAddr", r.RemoteAddr)
@@ -46,20 +150,405 @@ func (h *Handler) getRoomMessagesHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	messages := room.GetMessages()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string][]model.OutgoingMessage{"messages": messages})
+	messages := slices.DeleteFunc(room.GetMessages(), func(m model.OutgoingMessage) bool {
+		return (msgType != "" && m.MessageType != msgType) || m.Seq <= since || hidden(m)
+	})
+
+	total := len(messages)
+	hasMore := false
+	if paginate {
+		end := max(total-offset, 0)
+		start := max(end-limit, 0)
+		messages = messages[start:end]
+		hasMore = start > 0
+	}
+	resp := h.messagesPage(messages, total, offset, hasMore)
+	if order == "desc" {
+		slices.Reverse(resp.Messages)
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// messagesPage builds the response for page, the messages ordered oldest to
+// newest that start offset messages before the newest match. Pages larger
+// than the history byte budget lose their oldest messages; nextOffset then
+// points at them.
+func (h *Handler) messagesPage(page []model.OutgoingMessage, total, offset int, hasMore bool) MessagesPageResponse {
+	resp := MessagesPageResponse{Messages: page, Total: total, HasMore: hasMore}
+	if h.historyBytes <= 0 {
+		return resp
+	}
+
+	size := 0
+	for i := len(page) - 1; i >= 0; i-- {
+		b, err := json.Marshal(page[i])
+		if err != nil {
+			continue
+		}
+		size += len(b)
+		// The newest message is always returned, however large.
+		if size > h.historyBytes && i < len(page)-1 {
+			resp.Messages = page[i+1:]
+			resp.HasMore = true
+			resp.NextOffset = offset + len(resp.Messages)
+			break
+		}
+	}
+	return resp
+}
+
+// hiddenMessages returns a filter for the messages the requester may not
+// see. With a userId query parameter, messages sent to an audience are only
+// shown to their author and users with the audience's role; without one
+// they are left out. Requests with the admin token see everything.
+func (h *Handler) hiddenMessages(r *http.Request) (func(model.OutgoingMessage) bool, error) {
+	if h.isAdmin(r) {
+		return func(model.OutgoingMessage) bool { return false }, nil
+	}
+	v := r.URL.Query().Get("userId")
+	if v == "" {
+		return func(m model.OutgoingMessage) bool { return chat.Audience(m) != "" }, nil
+	}
+	userID, err := uuid.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	viewer, ok := h.userRegistry.Lookup(userID)
+	if !ok {
+		viewer = model.User{ID: userID}
+	}
+	return func(m model.OutgoingMessage) bool { return !chat.CanSee(viewer, m) }, nil
+}
+
+// visibilityFilter is hiddenMessages for handlers that have no other query
+// errors to report. It answers an invalid userId with 400 and returns false.
+func (h *Handler) visibilityFilter(w http.ResponseWriter, r *http.Request) (func(model.OutgoingMessage) bool, bool) {
+	hidden, err := h.hiddenMessages(r)
+	if err != nil {
+		h.logger.Warn("invalid user id for reading messages", "path", r.URL.Path, "userID", r.URL.Query().Get("userId"), "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid userId", http.StatusBadRequest)
+		return nil, false
+	}
+	return hidden, true
+}
+
+// getRoomMessagesByIDs serves GET /rooms/{roomID}/messages?ids=.
+func (h *Handler) getRoomMessagesByIDs(w http.ResponseWriter, r *http.Request, roomID uint) {
+	ids, err := parseIDs(r)
+	if err != nil {
+		h.logger.Warn("invalid ids for getting messages", "roomID", roomID, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hidden, ok := h.visibilityFilter(w, r)
+	if !ok {
+		return
+	}
+
+	room, ok := h.hub.GetRoom(roomID)
+	if !ok {
+		h.logger.Warn("room not found for getting messages", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	messages := make([]model.OutgoingMessage, 0, len(ids))
+	var notFound []uuid.UUID
+	for _, id := range ids {
+		msg, ok := room.GetMessage(id)
+		if !ok || hidden(*msg) {
+			notFound = append(notFound, id)
+			continue
+		}
+		messages = append(messages, *msg)
+	}
+
+	writeJSON(w, r, http.StatusOK, MessagesPageResponse{
+		Messages: messages,
+		Total:    len(messages),
+		NotFound: notFound,
+	})
+}
+
+// maxImportBytes caps the request body of an import.
+const maxImportBytes = 64 * chat.MiB
+
+type MessagesImportResponse struct {
+	Imported int `json:"imported" example:"120"`
+	Total    int `json:"total" example:"120"`
+} // @name MessagesImportResponse
+
+// importRoomMessagesHandler godoc
+// @Summary      Import messages into a room
+// @Description  Loads messages in the JSON export format into a room's history without broadcasting them. By default they are appended to the existing messages; `mode=replace` drops the existing history and pins first. Every message needs a `type` and a `timestamp`, and IDs may appear only once per import. Messages whose `id` is missing or already stored get a new ID and replies to them are relinked. `additionalInfo` is subject to the same limits as for new messages; an `expiresAt` in it makes the message expire like one sent with `expiresIn`. The request body may be at most 64 MiB. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         messages
+// @Accept       json
+// @Produce      json
+// @Security     AdminToken
+// @Param        roomID  path      int                   true   "Room ID"
+// @Param        mode    query     string                false  "append (default) or replace"  Enums(append, replace)
+// @Param        body    body      []OutgoingMessageDoc  true   "Messages from an export"
+// @Success      200     {object}  MessagesImportResponse
+// @Failure      400     {string}  string  "can't parse room id to uint, invalid mode, request body or message"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found"
+// @Failure      413     {string}  string  "request body or additionalInfo too large"
+// @Failure      422     {object}  ValidationErrorResponse
+// @Router       /rooms/{roomID}/import [post]
+func (h *Handler) importRoomMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for import", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "append" && mode != "replace" {
+		h.logger.Warn("invalid import mode", "roomID", roomID, "mode", mode, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "invalid mode, must be append or replace", http.StatusBadRequest)
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for import", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	var messages []model.OutgoingMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes)).Decode(&messages); err != nil {
+		h.logger.Warn("failed to decode import request", "roomID", roomID, "remoteAddr", r.RemoteAddr, "error", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	seen := make(map[uuid.UUID]struct{}, len(messages))
+	for i, msg := range messages {
+		if msg.MessageType == "" || msg.Timestamp.IsZero() {
+			h.logger.Warn("invalid message in import", "roomID", roomID, "index", i, "remoteAddr", r.RemoteAddr)
+			http.Error(w, fmt.Sprintf("message %d: type and timestamp are required", i), http.StatusBadRequest)
+			return
+		}
+		// Replies are relinked by the original ID, so it has to be unique.
+		if msg.ID != uuid.Nil {
+			if _, dup := seen[msg.ID]; dup {
+				h.logger.Warn("duplicate message id in import", "roomID", roomID, "index", i, "messageID", msg.ID, "remoteAddr", r.RemoteAddr)
+				http.Error(w, fmt.Sprintf("message %d: duplicate id", i), http.StatusBadRequest)
+				return
+			}
+			seen[msg.ID] = struct{}{}
+		}
+		// Server-generated messages carry their own additionalInfo, only
+		// the size limit applies to them.
+		infoSchema := h.schemas.Message
+		if msg.MessageType == model.SystemMessage {
+			infoSchema = nil
+		}
+		if !h.validateInfo(w, r, infoSchema, msg.AdditionalInfo) {
+			return
+		}
+		// Exports carry expiresAt as a string; the room only tracks the
+		// expiry of a time.Time, as set for messages sent with expiresIn.
+		if s, ok := msg.AdditionalInfo["expiresAt"].(string); ok {
+			expiresAt, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				h.logger.Warn("invalid expiresAt in import", "roomID", roomID, "index", i, "remoteAddr", r.RemoteAddr, "error", err)
+				http.Error(w, fmt.Sprintf("message %d: invalid expiresAt", i), http.StatusBadRequest)
+				return
+			}
+			msg.AdditionalInfo["expiresAt"] = expiresAt
+		}
+	}
+
+	total := room.ImportMessages(messages, mode == "replace")
+
+	writeJSON(w, r, http.StatusOK, MessagesImportResponse{
+		Imported: len(messages),
+		Total:    total,
+	})
+}
+
+// exportRoomMessagesHandler godoc
+// @Summary      Export a room's messages
+// @Description  Downloads every stored message of a room, oldest first, as an attachment. `json` returns the raw message array; `csv` has one row per message with the columns `id`, `timestamp`, `user`, `type` and `message`, where `user` is the author's display name. The response is streamed. Messages sent to an audience are only included as for `GET /rooms/{roomID}/messages`.
+// @Tags         messages
+// @Produce      json
+// @Produce      text/csv
+// @Param        roomID  path      int     true   "Room ID"
+// @Param        format  query     string  false  "Export format (default json)"  Enums(json, csv)
+// @Param        userId  query     string  false  "Include the messages sent to this user's role"
+// @Success      200     {array}   OutgoingMessageDoc
+// @Failure      400     {string}  string  "can't parse room id to uint, invalid format or userId"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/export [get]
+func (h *Handler) exportRoomMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for export", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		h.logger.Warn("invalid export format", "roomID", roomID, "format", format, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "invalid format, must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	hidden, ok := h.visibilityFilter(w, r)
+	if !ok {
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for export", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	messages := slices.DeleteFunc(room.GetMessages(), hidden)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="room-%d-messages.%s"`, roomID, format))
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = writeMessagesCSV(w, messages)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = writeMessagesJSON(w, messages)
+	}
+	if err != nil {
+		h.logger.Warn("failed to stream room export", "roomID", roomID, "remoteAddr", r.RemoteAddr, "error", err)
+		return
+	}
+	h.logger.Info("room exported", "roomID", roomID, "format", format, "messages", len(messages))
+}
+
+// writeMessagesJSON writes messages as a JSON array one element at a time,
+// so only a single encoded message is held in memory.
+func writeMessagesJSON(w http.ResponseWriter, messages []model.OutgoingMessage) error {
+	if _, err := w.Write([]byte("[")); err != nil {
+		return err
+	}
+	for i, msg := range messages {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b = append([]byte(","), b...)
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte("]\n"))
+	return err
+}
+
+func writeMessagesCSV(w http.ResponseWriter, messages []model.OutgoingMessage) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "timestamp", "user", "type", "message"}); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		err := cw.Write([]string{
+			msg.ID.String(),
+			model.FormatTimestamp(msg.Timestamp),
+			model.GetDisplayName(msg.User),
+			string(msg.MessageType),
+			msg.Message,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// searchRoomMessagesHandler godoc
+// @Summary      Search messages in a room
+// @Description  Returns the stored messages whose text contains every word of `q`. Matching is case-insensitive on whole words; system and deleted messages are never returned. Pagination, audience restrictions and the history byte budget work like `GET /rooms/{roomID}/messages`.
+// @Tags         messages
+// @Produce      json
+// @Param        roomID  path      int     true   "Room ID"
+// @Param        q       query     string  true   "Words that must all appear in a message"
+// @Param        limit   query     int     false  "Maximum number of messages to return (max 500)"
+// @Param        offset  query     int     false  "Number of newest matching messages to skip"
+// @Param        userId  query     string  false  "Show the messages sent to this user's role"
+// @Success      200     {object}  MessagesListResponse
+// @Failure      400     {string}  string  "can't parse room id to uint, missing q, invalid limit, offset or userId"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/messages/search [get]
+func (h *Handler) searchRoomMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for searching messages", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		h.logger.Warn("invalid pagination for searching messages", "roomID", roomID, "query", r.URL.RawQuery, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hidden, err := h.hiddenMessages(r)
+	if err != nil {
+		h.logger.Warn("invalid user id for searching messages", "roomID", roomID, "userID", r.URL.Query().Get("userId"), "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid userId", http.StatusBadRequest)
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for searching messages", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	messages := slices.DeleteFunc(room.SearchMessages(query), hidden)
+	total := len(messages)
+	end := max(total-offset, 0)
+	start := max(end-limit, 0)
+
+	writeJSON(w, r, http.StatusOK, h.messagesPage(messages[start:end], total, offset, start > 0))
 }
 
 // getRoomMessageHandler godoc
 // @Summary      Get a specific message
-// @Description  Retrieves a specific message from a room by its ID.
+// @Description  Retrieves a specific message from a room by its ID. Messages sent to an audience are only returned as for `GET /rooms/{roomID}/messages`; for everyone else they don't exist.
 // @Tags         messages
 // @Produce      json
-// @Param        roomID     path      int     true  "Room ID"
-// @Param        messageID  path      string  true  "Message UUID"
+// @Param        roomID     path      int     true   "Room ID"
+// @Param        messageID  path      string  true   "Message UUID"
+// @Param        userId     query     string  false  "Show the messages sent to this user's role"
 // @Success      200        {object}  OutgoingMessageDoc
-// @Failure      400        {string}  string  "can't parse room id or message id"
+// @Failure      400        {string}  string  "can't parse room id, message id or userId"
 // @Failure      404        {string}  string  "room or message not found"
 // @Router       /rooms/{roomID}/messages/{messageID} [get]
 func (h *Handler) getRoomMessageHandler(w http.ResponseWriter, r *http.Request) {
@@ -78,6 +567,11 @@ func (h *Handler) getRoomMessageHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	hidden, ok := h.visibilityFilter(w, r)
+	if !ok {
+		return
+	}
+
 	room, ok := h.hub.GetRoom(uint(roomID))
 	if !ok {
 		h.logger.Warn("room not found for getting message", "roomID", roomID, "remoteAddr", r.RemoteAddr)
@@ -86,28 +580,234 @@ func (h *Handler) getRoomMessageHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	message, success := room.GetMessage(messageID)
-	if !success {
+	if !success || hidden(*message) {
 		h.logger.Warn("message not found for getting", "roomID", roomID, "messageID", messageID, "remoteAddr", r.RemoteAddr)
 		http.Error(w, "message not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(message)
+	writeJSON(w, r, http.StatusOK, message)
+}
+
+// getRoomLatestMessageHandler godoc
+// @Summary      Get the newest message
+// @Description  Returns the most recently stored message of a room, e.g. for a room preview, without fetching the whole history. With `skipDeleted=1` deleted messages are passed over. Messages sent to an audience are only considered as for `GET /rooms/{roomID}/messages`.
+// @Tags         messages
+// @Produce      json
+// @Param        roomID       path      int     true   "Room ID"
+// @Param        skipDeleted  query     bool    false  "Pass over deleted messages"
+// @Param        userId       query     string  false  "Show the messages sent to this user's role"
+// @Success      200          {object}  OutgoingMessageDoc
+// @Success      204          "room has no messages"
+// @Failure      400          {string}  string  "can't parse room id to uint or invalid userId"
+// @Failure      404          {string}  string  "room not found"
+// @Router       /rooms/{roomID}/messages/latest [get]
+func (h *Handler) getRoomLatestMessageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for getting latest message", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	hidden, err := h.hiddenMessages(r)
+	if err != nil {
+		h.logger.Warn("invalid user id for getting latest message", "roomID", roomID, "userID", r.URL.Query().Get("userId"), "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid userId", http.StatusBadRequest)
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for getting latest message", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	v := r.URL.Query().Get("skipDeleted")
+	skipDeleted := v == "1" || v == "true"
+	message, ok := room.LatestMessage(func(m model.OutgoingMessage) bool {
+		return hidden(m) || (skipDeleted && m.AdditionalInfo["deleted"] == true)
+	})
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, message)
+}
+
+// getRoomMessageRepliesHandler godoc
+// @Summary      Get thread replies of a message
+// @Description  Returns all messages sent with `parentId` set to the given message, sorted by timestamp. Replies stay retrievable after the parent was deleted or expired; `parentDeleted` is set in that case. Messages sent to an audience, the parent included, are only considered as for `GET /rooms/{roomID}/messages`.
+// @Tags         messages
+// @Produce      json
+// @Param        roomID     path      int     true   "Room ID"
+// @Param        messageID  path      string  true   "Parent message UUID"
+// @Param        userId     query     string  false  "Show the messages sent to this user's role"
+// @Success      200        {object}  MessageRepliesResponseDoc
+// @Failure      400        {string}  string  "can't parse room id, message id or userId"
+// @Failure      404        {string}  string  "room or message not found"
+// @Router       /rooms/{roomID}/messages/{messageID}/replies [get]
+func (h *Handler) getRoomMessageRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for getting replies", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	messageID, err := uuid.Parse(vars["messageID"])
+	if err != nil {
+		h.logger.Warn("invalid message id for getting replies", "messageID", vars["messageID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse message id to uuid", http.StatusBadRequest)
+		return
+	}
+
+	hidden, ok := h.visibilityFilter(w, r)
+	if !ok {
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for getting replies", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	replies, parentDeleted, ok := room.GetReplies(messageID)
+	if parent, found := room.GetMessage(messageID); found && hidden(*parent) {
+		ok = false
+	}
+	if !ok {
+		h.logger.Warn("message not found for getting replies", "roomID", roomID, "messageID", messageID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, MessageRepliesResponse{
+		Messages:      slices.DeleteFunc(replies, hidden),
+		ParentDeleted: parentDeleted,
+	})
+}
+
+// getRoomMessageReceiptsHandler godoc
+// @Summary      Get delivery receipts of a message
+// @Description  Returns the IDs of the users that acknowledged the message by sending a `receipt` event over the WebSocket. Messages sent to an audience are only found as for `GET /rooms/{roomID}/messages`.
+// @Tags         messages
+// @Produce      json
+// @Param        roomID     path      int     true   "Room ID"
+// @Param        messageID  path      string  true   "Message UUID"
+// @Param        userId     query     string  false  "Show the messages sent to this user's role"
+// @Success      200        {object}  MessageReceiptsResponseDoc
+// @Failure      400        {string}  string  "can't parse room id, message id or userId"
+// @Failure      404        {string}  string  "room or message not found"
+// @Router       /rooms/{roomID}/messages/{messageID}/receipts [get]
+func (h *Handler) getRoomMessageReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for getting receipts", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	messageID, err := uuid.Parse(vars["messageID"])
+	if err != nil {
+		h.logger.Warn("invalid message id for getting receipts", "messageID", vars["messageID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse message id to uuid", http.StatusBadRequest)
+		return
+	}
+
+	hidden, ok := h.visibilityFilter(w, r)
+	if !ok {
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for getting receipts", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	deliveredTo, ok := room.GetReceipts(messageID)
+	if msg, found := room.GetMessage(messageID); found && hidden(*msg) {
+		ok = false
+	}
+	if !ok {
+		h.logger.Warn("message not found for getting receipts", "roomID", roomID, "messageID", messageID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, MessageReceiptsResponse{
+		MessageID:   messageID,
+		DeliveredTo: deliveredTo,
+	})
+}
+
+// SetAuthorOnlyEdits makes the message PATCH, PUT and DELETE handlers require
+// the author's userId query parameter. Requests with the admin token bypass
+// the check. User IDs are public, so this only guards against mistakes by
+// well-behaved clients, not against someone impersonating the author.
+func (h *Handler) SetAuthorOnlyEdits(enabled bool) {
+	h.authorOnly = enabled
+}
+
+// SetHistoryByteLimit caps the JSON size of the messages in one message list
+// or search response. 0 disables the cap.
+func (h *Handler) SetHistoryByteLimit(bytes int) {
+	h.historyBytes = bytes
+}
+
+// authorizeMessageChange reports whether the request may change the message.
+// It writes a 403 response when it may not. Unknown messages pass so that the
+// caller answers with its usual 404.
+func (h *Handler) authorizeMessageChange(w http.ResponseWriter, r *http.Request, room *chat.Room, messageID uuid.UUID) bool {
+	if !h.authorOnly || h.isAdmin(r) {
+		return true
+	}
+	msg, ok := room.GetMessage(messageID)
+	if !ok || h.mayChangeMessage(r, *msg) {
+		return true
+	}
+	h.logger.Warn("message change by non-author rejected", "roomID", room.ID(), "messageID", messageID, "userID", r.URL.Query().Get("userId"), "remoteAddr", r.RemoteAddr)
+	http.Error(w, "only the author can change this message", http.StatusForbidden)
+	return false
+}
+
+// mayChangeMessage reports whether the request may change msg: always,
+// unless MESSAGE_AUTHOR_ONLY is set and the request carries neither the
+// admin token nor the author's userId. The userId is taken on trust; the
+// server has no per-user authentication to check it against.
+func (h *Handler) mayChangeMessage(r *http.Request, msg model.OutgoingMessage) bool {
+	if !h.authorOnly || h.isAdmin(r) {
+		return true
+	}
+	userID, err := uuid.Parse(r.URL.Query().Get("userId"))
+	return err == nil && msg.User.ID == userID
 }
 
 // patchRoomMessageHandler godoc
 // @Summary      Partially update a message
-// @Description  Partially updates a specific message. You can update the message text, additionalInfo, or both. Only provided fields are updated. The server automatically sets modified: true in additionalInfo.
+// @Description  Partially updates a specific message. You can update the message text, additionalInfo, or both. Only provided fields are updated. A provided additionalInfo replaces the existing one, except for the server-owned keys audience, expiresAt and deliveredTo, which are kept. The server automatically sets modified: true in additionalInfo and broadcasts a message_updated event.
 // @Tags         messages
 // @Accept       json
 // @Produce      json
 // @Param        roomID     path      int                  true  "Room ID"
 // @Param        messageID  path      string               true  "Message UUID"
 // @Param        body       body      MessagePatchRequestDoc  true  "Fields to update"
+// @Param        userId     query     string  false  "Author's user ID, required when MESSAGE_AUTHOR_ONLY is enabled (not verified)"
 // @Success      200        {object}  OutgoingMessageDoc
 // @Failure      400        {string}  string  "invalid request"
+// @Failure      403        {string}  string  "not the message's author"
 // @Failure      404        {string}  string  "room or message not found"
+// @Failure      413        {string}  string  "additionalInfo too large"
+// @Failure      422        {object}  ValidationErrorResponse
 // @Router       /rooms/{roomID}/messages/{messageID} [patch]
 func (h *Handler) patchRoomMessageHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -132,6 +832,10 @@ func (h *Handler) patchRoomMessageHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if !h.authorizeMessageChange(w, r, room, messageID) {
+		return
+	}
+
 	var patchRequest MessagePatchRequest
 	decoder := json.NewDecoder(r.Body)
 	err = decoder.Decode(&patchRequest)
@@ -153,8 +857,12 @@ func (h *Handler) patchRoomMessageHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	success := room.PatchMessage(messageID, patchRequest.Message, patchRequest.AdditionalInfo)
-	if !success {
+	if patchRequest.AdditionalInfo != nil && !h.validateInfo(w, r, h.schemas.Message, patchRequest.AdditionalInfo) {
+		return
+	}
+
+	updatedMessage, ok := room.PatchMessage(messageID, patchRequest.Message, patchRequest.AdditionalInfo)
+	if !ok {
 		h.logger.Warn("message not found for patch", "roomID", roomID, "messageID", messageID, "remoteAddr", r.RemoteAddr)
 		http.Error(w, "message not found", http.StatusNotFound)
 		return
@@ -162,26 +870,119 @@ func (h *Handler) patchRoomMessageHandler(w http.ResponseWriter, r *http.Request
 
 	h.logger.Info("message patched", "roomID", roomID, "messageID", messageID)
 
-	updatedMessage, _ := room.GetMessage(messageID)
-	b, _ := json.Marshal(updatedMessage)
-	room.TryBroadcast(b)
+	room.BroadcastUpdate(updatedMessage)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedMessage)
+	writeJSON(w, r, http.StatusOK, updatedMessage)
+}
+
+// patchRoomMessagesHandler godoc
+// @Summary      Partially update several messages
+// @Description  Applies up to 100 partial updates in one request, each like `PATCH /rooms/{roomID}/messages/{messageID}`. Every entry is reported in `results`; unknown messages, invalid entries and messages the requester may not change are skipped with an `error` instead of failing the whole request.
+// @Description
+// @Description  The applied changes are announced in a single `message_updated` event whose `additionalInfo.updates` lists each message's `messageId`, new `message` and `additionalInfo`.
+// @Tags         messages
+// @Accept       json
+// @Produce      json
+// @Param        roomID  path      int                          true   "Room ID"
+// @Param        body    body      []MessageBatchPatchEntryDoc  true   "Updates to apply"
+// @Param        userId  query     string                       false  "Author's user ID, required when MESSAGE_AUTHOR_ONLY is enabled (not verified)"
+// @Success      200     {object}  MessageBatchPatchResponseDoc
+// @Failure      400     {string}  string  "invalid request"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/messages [patch]
+func (h *Handler) patchRoomMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for patching messages", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for patching messages", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	var entries []MessageBatchPatchEntry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		h.logger.Warn("failed to decode message batch patch request", "roomID", roomID, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(entries) == 0 || len(entries) > maxQueryIDs {
+		http.Error(w, fmt.Sprintf("between 1 and %d updates must be provided", maxQueryIDs), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]MessageBatchPatchResult, 0, len(entries))
+	updated := make([]model.OutgoingMessage, 0, len(entries))
+	for _, entry := range entries {
+		result := MessageBatchPatchResult{ID: entry.ID}
+		if msg, problem := h.patchMessageEntry(r, room, entry); problem != "" {
+			result.Error = problem
+		} else {
+			result.Updated = true
+			result.Message = &msg
+			updated = append(updated, msg)
+		}
+		results = append(results, result)
+	}
+
+	if len(updated) > 0 {
+		room.BroadcastUpdates(updated)
+	}
+	h.logger.Info("messages patched", "roomID", roomID, "updated", len(updated), "skipped", len(entries)-len(updated))
+
+	writeJSON(w, r, http.StatusOK, MessageBatchPatchResponse{Results: results})
+}
+
+// patchMessageEntry applies one entry of a batch update. It returns the
+// updated message, or why the entry was skipped.
+func (h *Handler) patchMessageEntry(r *http.Request, room *chat.Room, entry MessageBatchPatchEntry) (model.OutgoingMessage, string) {
+	if entry.Message == nil && entry.AdditionalInfo == nil {
+		return model.OutgoingMessage{}, "at least one field (message or additionalInfo) must be provided"
+	}
+	if entry.Message != nil && *entry.Message == "" {
+		return model.OutgoingMessage{}, "message content cannot be empty"
+	}
+	msg, ok := room.GetMessage(entry.ID)
+	if !ok {
+		return model.OutgoingMessage{}, "message not found"
+	}
+	if !h.mayChangeMessage(r, *msg) {
+		return model.OutgoingMessage{}, "only the author can change this message"
+	}
+	if entry.AdditionalInfo != nil {
+		if problem := h.checkInfo(h.schemas.Message, entry.AdditionalInfo); problem != "" {
+			return model.OutgoingMessage{}, problem
+		}
+	}
+	updated, ok := room.PatchMessage(entry.ID, entry.Message, entry.AdditionalInfo)
+	if !ok {
+		return model.OutgoingMessage{}, "message not found"
+	}
+	return updated, ""
 }
 
 // putRoomMessageHandler godoc
 // @Summary      Replace a message
-// @Description  Completely replaces a message. Unlike PATCH, this requires all fields and replaces the entire message content. The server automatically sets modified: true in additionalInfo.
+// @Description  Completely replaces a message. Unlike PATCH, this requires all fields and replaces the entire message content, except for the server-owned additionalInfo keys audience, expiresAt and deliveredTo. The server automatically sets modified: true in additionalInfo and broadcasts a message_updated event.
 // @Tags         messages
 // @Accept       json
 // @Produce      json
 // @Param        roomID     path      int                true  "Room ID"
 // @Param        messageID  path      string             true  "Message UUID"
 // @Param        body       body      MessagePutRequestDoc  true  "New message content"
+// @Param        userId     query     string  false  "Author's user ID, required when MESSAGE_AUTHOR_ONLY is enabled (not verified)"
 // @Success      200        {object}  OutgoingMessageDoc
 // @Failure      400        {string}  string  "invalid request"
+// @Failure      403        {string}  string  "not the message's author"
 // @Failure      404        {string}  string  "room or message not found"
+// @Failure      413        {string}  string  "additionalInfo too large"
+// @Failure      422        {object}  ValidationErrorResponse
 // @Router       /rooms/{roomID}/messages/{messageID} [put]
 func (h *Handler) putRoomMessageHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -206,6 +1007,10 @@ func (h *Handler) putRoomMessageHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !h.authorizeMessageChange(w, r, room, messageID) {
+		return
+	}
+
 	var putRequest MessagePutRequest
 	decoder := json.NewDecoder(r.Body)
 	err = decoder.Decode(&putRequest)
@@ -215,8 +1020,12 @@ func (h *Handler) putRoomMessageHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	success := room.UpdateMessage(messageID, putRequest.Message, putRequest.AdditionalInfo)
-	if !success {
+	if !h.validateInfo(w, r, h.schemas.Message, putRequest.AdditionalInfo) {
+		return
+	}
+
+	updatedMessage, ok := room.UpdateMessage(messageID, putRequest.Message, putRequest.AdditionalInfo)
+	if !ok {
 		h.logger.Warn("message not found for updating", "roomID", roomID, "messageID", messageID, "remoteAddr", r.RemoteAddr)
 		http.Error(w, "message not found", http.StatusNotFound)
 		return
@@ -224,23 +1033,22 @@ func (h *Handler) putRoomMessageHandler(w http.ResponseWriter, r *http.Request)
 
 	h.logger.Info("message updated", "roomID", roomID, "messageID", messageID)
 
-	updatedMessage, _ := room.GetMessage(messageID)
-	b, _ := json.Marshal(updatedMessage)
-	room.TryBroadcast(b)
+	room.BroadcastUpdate(updatedMessage)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedMessage)
+	writeJSON(w, r, http.StatusOK, updatedMessage)
 }
 
 // deleteRoomMessageHandler godoc
 // @Summary      Delete a message
-// @Description  Marks a message as deleted. The message is not actually removed but its content is replaced with "deleted" and a deleted flag is added to additionalInfo.
+// @Description  Marks a message as deleted. The message is not actually removed but its content is replaced with "deleted" and a deleted flag is added to additionalInfo. A message_deleted event is broadcast and a pinned message is unpinned.
 // @Tags         messages
 // @Produce      json
 // @Param        roomID     path      int     true  "Room ID"
 // @Param        messageID  path      string  true  "Message UUID"
+// @Param        userId     query     string  false  "Author's user ID, required when MESSAGE_AUTHOR_ONLY is enabled (not verified)"
 // @Success      200        {object}  OutgoingMessageDoc
 // @Failure      400        {string}  string  "can't parse room id or message id"
+// @Failure      403        {string}  string  "not the message's author"
 // @Failure      404        {string}  string  "room or message not found"
 // @Router       /rooms/{roomID}/messages/{messageID} [delete]
 func (h *Handler) deleteRoomMessageHandler(w http.ResponseWriter, r *http.Request) {
@@ -266,8 +1074,12 @@ func (h *Handler) deleteRoomMessageHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	success := room.UpdateMessage(messageID, "deleted", model.AdditionalInfo{"deleted": true})
-	if !success {
+	if !h.authorizeMessageChange(w, r, room, messageID) {
+		return
+	}
+
+	deletedMessage, ok := room.UpdateMessage(messageID, "deleted", model.AdditionalInfo{"deleted": true})
+	if !ok {
 		h.logger.Warn("message not found for deleting", "roomID", roomID, "messageID", messageID, "remoteAddr", r.RemoteAddr)
 		http.Error(w, "message not found", http.StatusNotFound)
 		return
@@ -275,10 +1087,11 @@ func (h *Handler) deleteRoomMessageHandler(w http.ResponseWriter, r *http.Reques
 
 	h.logger.Info("message deleted", "roomID", roomID, "messageID", messageID)
 
-	deletedMessage, _ := room.GetMessage(messageID)
-	b, _ := json.Marshal(deletedMessage)
-	room.TryBroadcast(b)
+	room.BroadcastDeletion(deletedMessage, "deleted")
+
+	if room.Unpin(messageID) {
+		room.BroadcastPins("unpinned", messageID)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(deletedMessage)
+	writeJSON(w, r, http.StatusOK, deletedMessage)
 }
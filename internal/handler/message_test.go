@@ -2,11 +2,17 @@ package handler
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/choffmann/chat-room/internal/chat"
 	"github.com/choffmann/chat-room/internal/model"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -15,7 +21,7 @@ import (
 func setupMessageTests(t *testing.T) *Handler {
 	t.Helper()
 	h := setupHandler(t)
-	room := h.hub.CreateRoom(model.AdditionalInfo{"name": "Test Room"})
+	room, _ := h.hub.CreateRoom(model.AdditionalInfo{"name": "Test Room"})
 	close(room.Shutdown())
 	return h
 }
@@ -36,8 +42,7 @@ func TestPatchMessage_OnlyMessage(t *testing.T) {
 	room.StoreMessage(originalMsg)
 
 	newContent := "Updated message"
-	success := room.PatchMessage(originalMsg.ID, &newContent, nil)
-	if !success {
+	if _, ok := room.PatchMessage(originalMsg.ID, &newContent, nil); !ok {
 		t.Fatal("expected PatchMessage to return true")
 	}
 
@@ -75,8 +80,7 @@ func TestPatchMessage_OnlyAdditionalInfo(t *testing.T) {
 		"editedAt":     "2024-01-01T00:00:00Z",
 		"editedReason": "Fixed typo",
 	}
-	success := room.PatchMessage(originalMsg.ID, nil, newInfo)
-	if !success {
+	if _, ok := room.PatchMessage(originalMsg.ID, nil, newInfo); !ok {
 		t.Fatal("expected PatchMessage to return true")
 	}
 
@@ -122,8 +126,7 @@ func TestPatchMessage_BothFields(t *testing.T) {
 		"edited":   true,
 		"editedAt": "2024-01-01T00:00:00Z",
 	}
-	success := room.PatchMessage(originalMsg.ID, &newContent, newInfo)
-	if !success {
+	if _, ok := room.PatchMessage(originalMsg.ID, &newContent, newInfo); !ok {
 		t.Fatal("expected PatchMessage to return true")
 	}
 
@@ -147,12 +150,76 @@ func TestPatchMessage_NonExistentMessage(t *testing.T) {
 	room, _ := h.hub.GetRoom(1)
 	nonExistentID := uuid.New()
 	newContent := "Updated message"
-	success := room.PatchMessage(nonExistentID, &newContent, nil)
-	if success {
+	if _, ok := room.PatchMessage(nonExistentID, &newContent, nil); ok {
 		t.Error("expected PatchMessage to return false for non-existent message")
 	}
 }
 
+func TestPatchMessage_ExpiredMessage(t *testing.T) {
+	h := setupMessageTests(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	room, _ := h.hub.GetRoom(1)
+	expired := room.StoreMessage(model.OutgoingMessage{
+		ID:             uuid.New(),
+		MessageType:    model.UserMessage,
+		Message:        "gone",
+		AdditionalInfo: model.AdditionalInfo{"expiresAt": time.Now().Add(-time.Second)},
+	})
+
+	path := fmt.Sprintf("/api/v1/rooms/1/messages/%s", expired.ID)
+	if w := doJSON(r, http.MethodPatch, path, `{"message":"edited"}`); w.Code != http.StatusNotFound {
+		t.Errorf("patch: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, path, `{"message":"edited","additionalInfo":{}}`); w.Code != http.StatusNotFound {
+		t.Errorf("put: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestPatchMessage_KeepsServerOwnedInfo(t *testing.T) {
+	h := setupMessageTests(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	room, _ := h.hub.GetRoom(1)
+	expiresAt := time.Now().Add(time.Hour)
+	staff := room.StoreMessage(model.OutgoingMessage{
+		ID:             uuid.New(),
+		MessageType:    model.UserMessage,
+		Message:        "staff note",
+		AdditionalInfo: model.AdditionalInfo{"audience": "agent", "expiresAt": expiresAt},
+	})
+
+	path := fmt.Sprintf("/api/v1/rooms/1/messages/%s", staff.ID)
+	requests := []struct {
+		method string
+		body   string
+	}{
+		{http.MethodPatch, `{"additionalInfo":{"audience":null,"expiresAt":null,"tag":"edited"}}`},
+		{http.MethodPut, `{"message":"replaced","additionalInfo":{"tag":"replaced"}}`},
+	}
+	for _, req := range requests {
+		if w := doJSON(r, req.method, path, req.body); w.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d", req.method, http.StatusOK, w.Code)
+		}
+		msg, ok := room.GetMessage(staff.ID)
+		if !ok {
+			t.Fatalf("%s: message not found", req.method)
+		}
+		if msg.AdditionalInfo["audience"] != "agent" {
+			t.Errorf("%s: expected the audience to be kept, got %v", req.method, msg.AdditionalInfo["audience"])
+		}
+		if got, _ := msg.AdditionalInfo["expiresAt"].(time.Time); !got.Equal(expiresAt) {
+			t.Errorf("%s: expected expiresAt %v to be kept, got %v", req.method, expiresAt, msg.AdditionalInfo["expiresAt"])
+		}
+	}
+
+	if w := doJSON(r, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the edited message to stay hidden without a user, got %d", w.Code)
+	}
+}
+
 func TestPatchRoomMessageHandler_OnlyMessage(t *testing.T) {
 	h := setupMessageTests(t)
 
@@ -465,18 +532,380 @@ func TestGetRoomMessages(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
 	}
 
-	var response map[string][]model.OutgoingMessage
+	var response MessagesPageResponse
 	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 		t.Fatalf("failed to decode response: %v", err)
 	}
 
-	messages, ok := response["messages"]
-	if !ok {
-		t.Fatal("expected 'messages' key in response")
+	if len(response.Messages) != 2 {
+		t.Errorf("expected 2 messages, got %d", len(response.Messages))
+	}
+	if response.Total != 2 || response.HasMore {
+		t.Errorf("expected total 2 without more pages, got total %d hasMore %v", response.Total, response.HasMore)
+	}
+}
+
+func TestGetRoomMessagesFilterAndPaginate(t *testing.T) {
+	h := setupMessageTests(t)
+
+	room, _ := h.hub.GetRoom(1)
+	for i := range 5 {
+		room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.SystemMessage, Message: fmt.Sprintf("join %d", i)})
+		room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: fmt.Sprintf("chat %d", i)})
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		expectedStatus   int
+		expectedMessages []string
+		expectedTotal    int
+		expectedHasMore  bool
+	}{
+		{
+			name:             "Filter by type",
+			query:            "type=message",
+			expectedStatus:   http.StatusOK,
+			expectedMessages: []string{"chat 0", "chat 1", "chat 2", "chat 3", "chat 4"},
+			expectedTotal:    5,
+		},
+		{
+			name:             "Filter with limit returns most recent",
+			query:            "type=message&limit=2",
+			expectedStatus:   http.StatusOK,
+			expectedMessages: []string{"chat 3", "chat 4"},
+			expectedTotal:    5,
+			expectedHasMore:  true,
+		},
+		{
+			name:             "Filter with limit and offset",
+			query:            "type=message&limit=2&offset=3",
+			expectedStatus:   http.StatusOK,
+			expectedMessages: []string{"chat 0", "chat 1"},
+			expectedTotal:    5,
+		},
+		{
+			name:             "Offset past all messages",
+			query:            "type=system&offset=10",
+			expectedStatus:   http.StatusOK,
+			expectedMessages: []string{},
+			expectedTotal:    5,
+		},
+		{
+			name:             "Since seq",
+			query:            "since=8",
+			expectedStatus:   http.StatusOK,
+			expectedMessages: []string{"join 4", "chat 4"},
+			expectedTotal:    2,
+		},
+		{
+			name:             "Since seq with type filter",
+			query:            "type=message&since=6",
+			expectedStatus:   http.StatusOK,
+			expectedMessages: []string{"chat 3", "chat 4"},
+			expectedTotal:    2,
+		},
+		{
+			name:             "Descending order",
+			query:            "type=message&order=desc",
+			expectedStatus:   http.StatusOK,
+			expectedMessages: []string{"chat 4", "chat 3", "chat 2", "chat 1", "chat 0"},
+			expectedTotal:    5,
+		},
+		{
+			name:             "Descending order with limit returns most recent first",
+			query:            "type=message&order=desc&limit=2",
+			expectedStatus:   http.StatusOK,
+			expectedMessages: []string{"chat 4", "chat 3"},
+			expectedTotal:    5,
+			expectedHasMore:  true,
+		},
+		{
+			name:             "Descending order with offset",
+			query:            "type=message&order=desc&limit=2&offset=2",
+			expectedStatus:   http.StatusOK,
+			expectedMessages: []string{"chat 2", "chat 1"},
+			expectedTotal:    5,
+			expectedHasMore:  true,
+		},
+		{
+			name:           "Invalid order",
+			query:          "order=newest",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid since",
+			query:          "since=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown type",
+			query:          "type=poll",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid limit",
+			query:          "type=message&limit=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/rooms/1/messages?"+tt.query, nil)
+			req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+			w := httptest.NewRecorder()
+
+			h.getRoomMessagesHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response MessagesPageResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			got := make([]string, 0, len(response.Messages))
+			for _, m := range response.Messages {
+				got = append(got, m.Message)
+			}
+			if !slices.Equal(got, tt.expectedMessages) {
+				t.Errorf("expected messages %v, got %v", tt.expectedMessages, got)
+			}
+			if response.Total != tt.expectedTotal {
+				t.Errorf("expected total %d, got %d", tt.expectedTotal, response.Total)
+			}
+			if response.HasMore != tt.expectedHasMore {
+				t.Errorf("expected hasMore %v, got %v", tt.expectedHasMore, response.HasMore)
+			}
+		})
+	}
+}
+
+func TestGetRoomMessagesByteBudget(t *testing.T) {
+	h := setupMessageTests(t)
+	h.SetHistoryByteLimit(2500)
+
+	room, _ := h.hub.GetRoom(1)
+	padding := strings.Repeat("x", 1000)
+	for i := range 5 {
+		room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: fmt.Sprintf("word%d %s", i, padding)})
+	}
+
+	tests := []struct {
+		name               string
+		path               string
+		handler            func(http.ResponseWriter, *http.Request)
+		expectedMessages   []string
+		expectedNextOffset int
+	}{
+		{"All messages", "/rooms/1/messages", h.getRoomMessagesHandler, []string{"word3", "word4"}, 2},
+		{"Continue with next offset", "/rooms/1/messages?offset=2&limit=10", h.getRoomMessagesHandler, []string{"word1", "word2"}, 4},
+		{"Descending order", "/rooms/1/messages?order=desc&limit=5", h.getRoomMessagesHandler, []string{"word4", "word3"}, 2},
+		{"Search", "/rooms/1/messages/search?q=" + padding, h.searchRoomMessagesHandler, []string{"word3", "word4"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			var response MessagesPageResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			got := make([]string, 0, len(response.Messages))
+			for _, m := range response.Messages {
+				got = append(got, strings.Fields(m.Message)[0])
+			}
+			if !slices.Equal(got, tt.expectedMessages) {
+				t.Errorf("expected messages %v, got %v", tt.expectedMessages, got)
+			}
+			if response.Total != 5 {
+				t.Errorf("expected total 5, got %d", response.Total)
+			}
+			if !response.HasMore || response.NextOffset != tt.expectedNextOffset {
+				t.Errorf("expected hasMore with nextOffset %d, got %v and %d", tt.expectedNextOffset, response.HasMore, response.NextOffset)
+			}
+		})
+	}
+
+	h.SetHistoryByteLimit(10)
+	req := httptest.NewRequest("GET", "/rooms/1/messages", nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+	w := httptest.NewRecorder()
+	h.getRoomMessagesHandler(w, req)
+
+	var response MessagesPageResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response.Messages) != 1 {
+		t.Errorf("expected the newest message despite the budget, got %d messages", len(response.Messages))
+	}
+}
+
+func TestGetRoomMessagesAudience(t *testing.T) {
+	h := setupMessageTests(t)
+	h.SetAdminToken("secret")
+
+	agent := h.userRegistry.CreateUser("", "", "agent", "", "", model.AdditionalInfo{"role": "agent"})
+	customer := h.userRegistry.CreateUser("", "", "customer", "", "", model.AdditionalInfo{"role": "customer"})
+	author := model.User{ID: uuid.New(), Name: "author"}
+
+	room, _ := h.hub.GetRoom(1)
+	room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "staff note", User: author, AdditionalInfo: model.AdditionalInfo{"audience": "agent"}})
+	room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello everyone", User: author})
+
+	tests := []struct {
+		name             string
+		query            string
+		admin            bool
+		expectedStatus   int
+		expectedMessages []string
+	}{
+		{"Without user", "", false, http.StatusOK, []string{"hello everyone"}},
+		{"Audience role", "userId=" + agent.ID.String(), false, http.StatusOK, []string{"staff note", "hello everyone"}},
+		{"Other role", "userId=" + customer.ID.String(), false, http.StatusOK, []string{"hello everyone"}},
+		{"Author", "userId=" + author.ID.String(), false, http.StatusOK, []string{"staff note", "hello everyone"}},
+		{"Admin", "", true, http.StatusOK, []string{"staff note", "hello everyone"}},
+		{"Invalid user", "userId=nope", false, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/rooms/1/messages?"+tt.query, nil)
+			req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+			if tt.admin {
+				req.Header.Set("Authorization", "Bearer secret")
+			}
+			w := httptest.NewRecorder()
+
+			h.getRoomMessagesHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var response MessagesPageResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			got := make([]string, 0, len(response.Messages))
+			for _, m := range response.Messages {
+				got = append(got, m.Message)
+			}
+			if !slices.Equal(got, tt.expectedMessages) {
+				t.Errorf("expected messages %v, got %v", tt.expectedMessages, got)
+			}
+			if response.Total != len(tt.expectedMessages) {
+				t.Errorf("expected total %d, got %d", len(tt.expectedMessages), response.Total)
+			}
+		})
 	}
+}
+
+func TestReadPathsHideAudienceMessages(t *testing.T) {
+	h := setupMessageTests(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	agent := h.userRegistry.CreateUser("", "", "agent", "", "", model.AdditionalInfo{"role": "agent"})
+	customer := h.userRegistry.CreateUser("", "", "customer", "", "", model.AdditionalInfo{"role": "customer"})
 
-	if len(messages) != 2 {
-		t.Errorf("expected 2 messages, got %d", len(messages))
+	room, _ := h.hub.GetRoom(1)
+	staff := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "staff note", AdditionalInfo: model.AdditionalInfo{"audience": "agent"}}
+	room.StoreMessage(staff)
+	public := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello", AdditionalInfo: model.AdditionalInfo{}}
+	room.StoreMessage(public)
+	reply := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "staff reply", ParentID: &public.ID, AdditionalInfo: model.AdditionalInfo{"audience": "agent"}}
+	room.StoreMessage(reply)
+	room.Pin(staff.ID)
+	room.Pin(public.ID)
+
+	base := "/api/v1/rooms/1"
+	asCustomer := "userId=" + customer.ID.String()
+	asAgent := "userId=" + agent.ID.String()
+
+	countMessages := func(t *testing.T, path string, decode func(*httptest.ResponseRecorder) []model.OutgoingMessage) (int, bool) {
+		t.Helper()
+		w := doJSON(r, http.MethodGet, path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status %d, got %d", path, http.StatusOK, w.Code)
+		}
+		messages := decode(w)
+		return len(messages), slices.ContainsFunc(messages, func(m model.OutgoingMessage) bool { return m.Message == "staff note" || m.Message == "staff reply" })
+	}
+
+	byIDs := func(w *httptest.ResponseRecorder) []model.OutgoingMessage {
+		var response MessagesPageResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		return response.Messages
+	}
+	replies := func(w *httptest.ResponseRecorder) []model.OutgoingMessage {
+		var response MessageRepliesResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		return response.Messages
+	}
+	pins := func(w *httptest.ResponseRecorder) []model.OutgoingMessage {
+		var response PinsResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		return response.Pins
+	}
+	export := func(w *httptest.ResponseRecorder) []model.OutgoingMessage {
+		var messages []model.OutgoingMessage
+		json.NewDecoder(w.Body).Decode(&messages)
+		return messages
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		decode  func(*httptest.ResponseRecorder) []model.OutgoingMessage
+		visible int
+		hidden  int
+	}{
+		{"By IDs", base + "/messages?ids=" + staff.ID.String() + "," + public.ID.String() + "&", byIDs, 2, 1},
+		{"Replies", base + "/messages/" + public.ID.String() + "/replies?", replies, 1, 0},
+		{"Pins", base + "/pins?", pins, 2, 1},
+		{"Export", base + "/export?", export, 3, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if n, leaked := countMessages(t, tt.path+asCustomer, tt.decode); leaked || n != tt.hidden {
+				t.Errorf("other role: expected %d messages without audience ones, got %d (leaked %v)", tt.hidden, n, leaked)
+			}
+			if n, _ := countMessages(t, tt.path+asAgent, tt.decode); n != tt.visible {
+				t.Errorf("audience role: expected %d messages, got %d", tt.visible, n)
+			}
+			if w := doJSON(r, http.MethodGet, tt.path+"userId=nope", ""); w.Code != http.StatusBadRequest {
+				t.Errorf("invalid user: expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+
+	for _, path := range []string{"/messages/" + staff.ID.String(), "/messages/" + staff.ID.String() + "/replies", "/messages/" + staff.ID.String() + "/receipts"} {
+		if w := doJSON(r, http.MethodGet, base+path+"?"+asCustomer, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s as other role: expected status %d, got %d", path, http.StatusNotFound, w.Code)
+		}
+		if w := doJSON(r, http.MethodGet, base+path+"?"+asAgent, ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s as audience role: expected status %d, got %d", path, http.StatusOK, w.Code)
+		}
 	}
 }
 
@@ -536,6 +965,52 @@ func TestGetRoomMessageHandler_Success(t *testing.T) {
 	}
 }
 
+func TestGetRoomLatestMessageHandler(t *testing.T) {
+	h := setupMessageTests(t)
+	room, _ := h.hub.GetRoom(1)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	latest := func(query string) (*httptest.ResponseRecorder, model.OutgoingMessage) {
+		t.Helper()
+		w := doJSON(r, http.MethodGet, "/api/v1/rooms/1/messages/latest"+query, "")
+		var msg model.OutgoingMessage
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&msg); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+		}
+		return w, msg
+	}
+
+	if w, _ := latest(""); w.Code != http.StatusNoContent {
+		t.Fatalf("empty room: expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	older := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "older", AdditionalInfo: model.AdditionalInfo{}}
+	newer := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "newer", AdditionalInfo: model.AdditionalInfo{}}
+	staff := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "staff only", AdditionalInfo: model.AdditionalInfo{"audience": "agent"}}
+	room.StoreMessage(older)
+	room.StoreMessage(newer)
+	room.StoreMessage(staff)
+
+	if w, msg := latest(""); w.Code != http.StatusOK || msg.ID != newer.ID {
+		t.Errorf("expected the newest visible message %s, got %d %s", newer.ID, w.Code, msg.ID)
+	}
+
+	room.UpdateMessage(newer.ID, "deleted", model.AdditionalInfo{"deleted": true})
+	if _, msg := latest(""); msg.ID != newer.ID {
+		t.Errorf("expected the deleted message without skipDeleted, got %s", msg.ID)
+	}
+	if _, msg := latest("?skipDeleted=1"); msg.ID != older.ID {
+		t.Errorf("expected skipDeleted to pass over the deleted message, got %s", msg.ID)
+	}
+
+	if w := doJSON(r, http.MethodGet, "/api/v1/rooms/999/messages/latest", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown room: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
 func TestGetRoomMessageHandler_InvalidRoomID(t *testing.T) {
 	h := setupMessageTests(t)
 
@@ -865,3 +1340,530 @@ func TestDeleteRoomMessageHandler_MessageNotFound(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
 	}
 }
+
+func TestGetRoomMessageReplies(t *testing.T) {
+	h := setupMessageTests(t)
+
+	room, _ := h.hub.GetRoom(1)
+	now := time.Now()
+	parent := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "parent", Timestamp: now}
+	room.StoreMessage(parent)
+	late := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "late", Timestamp: now.Add(2 * time.Second), ParentID: &parent.ID}
+	early := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "early", Timestamp: now.Add(time.Second), ParentID: &parent.ID}
+	room.StoreMessage(late)
+	room.StoreMessage(early)
+	room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "unrelated", Timestamp: now})
+
+	request := func(messageID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/rooms/1/messages/"+messageID+"/replies", nil)
+		req = mux.SetURLVars(req, map[string]string{"roomID": "1", "messageID": messageID})
+		w := httptest.NewRecorder()
+		h.getRoomMessageRepliesHandler(w, req)
+		return w
+	}
+
+	w := request(parent.ID.String())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response MessageRepliesResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response.Messages) != 2 {
+		t.Fatalf("expected 2 replies, got %d", len(response.Messages))
+	}
+	if response.Messages[0].Message != "early" || response.Messages[1].Message != "late" {
+		t.Errorf("expected replies sorted by timestamp, got %q, %q", response.Messages[0].Message, response.Messages[1].Message)
+	}
+	if response.ParentDeleted {
+		t.Error("expected parentDeleted to be false")
+	}
+
+	// Deleting the parent keeps the thread retrievable.
+	room.UpdateMessage(parent.ID, "deleted", model.AdditionalInfo{"deleted": true})
+	w = request(parent.ID.String())
+	response = MessageRepliesResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response.Messages) != 2 || !response.ParentDeleted {
+		t.Errorf("expected 2 replies with parentDeleted, got %d replies, parentDeleted=%v", len(response.Messages), response.ParentDeleted)
+	}
+
+	if w := request(uuid.New().String()); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for unknown message, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := request("invalid"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for invalid message id, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestGetRoomMessageReceipts(t *testing.T) {
+	h := setupMessageTests(t)
+
+	room, _ := h.hub.GetRoom(1)
+	msg := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello"}
+	room.StoreMessage(msg)
+	reader := uuid.New()
+	room.MarkDelivered(msg.ID, model.User{ID: reader})
+
+	tests := []struct {
+		name           string
+		messageID      string
+		expectedStatus int
+	}{
+		{name: "Existing message", messageID: msg.ID.String(), expectedStatus: http.StatusOK},
+		{name: "Unknown message", messageID: uuid.New().String(), expectedStatus: http.StatusNotFound},
+		{name: "Invalid message id", messageID: "invalid", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/rooms/1/messages/"+tt.messageID+"/receipts", nil)
+			req = mux.SetURLVars(req, map[string]string{"roomID": "1", "messageID": tt.messageID})
+			w := httptest.NewRecorder()
+
+			h.getRoomMessageReceiptsHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response MessageReceiptsResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.MessageID != msg.ID || len(response.DeliveredTo) != 1 || response.DeliveredTo[0] != reader {
+				t.Errorf("unexpected receipts: %+v", response)
+			}
+		})
+	}
+}
+
+func TestSearchRoomMessagesHandler(t *testing.T) {
+	h := setupMessageTests(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	room, _ := h.hub.GetRoom(1)
+	for _, text := range []string{"deploy failed on staging", "deploy succeeded", "lunch?", "Staging deploy fixed"} {
+		room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: text})
+	}
+
+	w := doJSON(r, http.MethodGet, "/api/v1/rooms/1/messages/search?q=deploy+staging&limit=1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var page MessagesPageResponse
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if page.Total != 2 || !page.HasMore || len(page.Messages) != 1 || page.Messages[0].Message != "Staging deploy fixed" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	if w := doJSON(r, http.MethodGet, "/api/v1/rooms/1/messages/search", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d without q, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/rooms/99/messages/search?q=deploy", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected %d for unknown room, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestExportRoomMessagesHandler(t *testing.T) {
+	h := setupMessageTests(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	room, _ := h.hub.GetRoom(1)
+	first := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello, world", User: model.User{Name: "alice"}}
+	second := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "line\nbreak", User: model.User{FirstName: "Bob"}}
+	room.StoreMessage(first)
+	room.StoreMessage(second)
+
+	w := doJSON(r, http.MethodGet, "/api/v1/rooms/1/export", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="room-1-messages.json"` {
+		t.Errorf("unexpected Content-Disposition %q", got)
+	}
+	var messages []model.OutgoingMessage
+	if err := json.NewDecoder(w.Body).Decode(&messages); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(messages) != 2 || messages[0].ID != first.ID || messages[1].ID != second.ID {
+		t.Errorf("unexpected export %+v", messages)
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/rooms/1/export?format=csv", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "id" || rows[1][2] != "alice" || rows[1][4] != "hello, world" || rows[2][2] != "Bob" || rows[2][4] != "line\nbreak" {
+		t.Errorf("unexpected csv %q", rows)
+	}
+
+	if w := doJSON(r, http.MethodGet, "/api/v1/rooms/1/export?format=xml", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d for unknown format, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/rooms/99/export", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected %d for unknown room, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestImportRoomMessagesHandler(t *testing.T) {
+	h := setupMessageTests(t)
+	h.SetAdminToken("secret")
+	router := mux.NewRouter()
+	h.RegisterRoutes(router, false)
+	r := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.Header.Set("Authorization", "Bearer secret")
+		router.ServeHTTP(w, req)
+	})
+
+	room, _ := h.hub.GetRoom(1)
+	room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "old", Timestamp: time.Now()})
+
+	export := doJSON(r, http.MethodGet, "/api/v1/rooms/1/export", "").Body.String()
+	w := doJSON(r, http.MethodPost, "/api/v1/rooms/1/import", export)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp MessagesImportResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Imported != 1 || resp.Total != 2 {
+		t.Errorf("unexpected append response %+v", resp)
+	}
+
+	w = doJSON(r, http.MethodPost, "/api/v1/rooms/1/import?mode=replace", export)
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.Total != 1 {
+		t.Errorf("expected replace to leave 1 message, got %d %+v", w.Code, resp)
+	}
+
+	tests := []struct {
+		name, path, body string
+		want             int
+	}{
+		{"missing timestamp", "/api/v1/rooms/1/import", `[{"type":"message","message":"hi"}]`, http.StatusBadRequest},
+		{"not an array", "/api/v1/rooms/1/import", `{"type":"message"}`, http.StatusBadRequest},
+		{"invalid mode", "/api/v1/rooms/1/import?mode=merge", `[]`, http.StatusBadRequest},
+		{"unknown room", "/api/v1/rooms/99/import", `[]`, http.StatusNotFound},
+		{"invalid expiresAt", "/api/v1/rooms/1/import", `[{"type":"message","timestamp":"2024-01-01T00:00:00Z","additionalInfo":{"expiresAt":"soon"}}]`, http.StatusBadRequest},
+		{"duplicate id", "/api/v1/rooms/1/import", fmt.Sprintf(`[{"id":%[1]q,"type":"message","timestamp":"2024-01-01T00:00:00Z"},{"id":%[1]q,"type":"message","timestamp":"2024-01-01T00:00:01Z"}]`, uuid.New()), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := doJSON(r, http.MethodPost, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+	if n := room.GetMessageCount(); n != 1 {
+		t.Errorf("expected rejected imports to leave 1 message, got %d", n)
+	}
+
+	expired := uuid.New()
+	body := fmt.Sprintf(`[{"id":%q,"type":"message","message":"gone","timestamp":"2024-01-01T00:00:00Z","additionalInfo":{"expiresAt":"2024-01-01T00:01:00Z"}}]`, expired)
+	if w := doJSON(r, http.MethodPost, "/api/v1/rooms/1/import", body); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if _, ok := room.GetMessage(expired); ok {
+		t.Error("expected imported message to have expired")
+	}
+}
+
+func TestMessageEditEvents(t *testing.T) {
+	h := setupHandler(t)
+	room := newRunningRoom(t, h)
+	client := connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "watcher"})
+
+	msg := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello", AdditionalInfo: model.AdditionalInfo{}}
+	room.StoreMessage(msg)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	path := fmt.Sprintf("/api/v1/rooms/%d/messages/%s", room.ID(), msg.ID)
+
+	receive := func() model.OutgoingMessage {
+		t.Helper()
+		select {
+		case b := <-client.Send():
+			var event model.OutgoingMessage
+			if err := json.Unmarshal(b, &event); err != nil {
+				t.Fatalf("failed to unmarshal event: %v", err)
+			}
+			return event
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return model.OutgoingMessage{}
+	}
+
+	if w := doJSON(r, http.MethodPatch, path, `{"message":"edited"}`); w.Code != http.StatusOK {
+		t.Fatalf("patch: expected %d, got %d", http.StatusOK, w.Code)
+	}
+	event := receive()
+	if event.MessageType != model.MessageUpdated || event.Message != "edited" || event.AdditionalInfo["messageId"] != msg.ID.String() {
+		t.Errorf("unexpected update event: %+v", event)
+	}
+	if info, _ := event.AdditionalInfo["additionalInfo"].(map[string]any); info["modified"] != true {
+		t.Errorf("expected updated additionalInfo in event, got %v", event.AdditionalInfo)
+	}
+
+	if w := doJSON(r, http.MethodDelete, path, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete: expected %d, got %d", http.StatusOK, w.Code)
+	}
+	event = receive()
+	if event.MessageType != model.MessageDeleted || event.AdditionalInfo["messageId"] != msg.ID.String() || event.AdditionalInfo["reason"] != "deleted" {
+		t.Errorf("unexpected delete event: %+v", event)
+	}
+
+	stored, _ := room.GetMessage(msg.ID)
+	if stored.MessageType != model.UserMessage {
+		t.Errorf("expected stored message to keep its type, got %q", stored.MessageType)
+	}
+	if n := room.GetMessageCount(); n != 1 {
+		t.Errorf("expected events not to be stored, got %d messages", n)
+	}
+}
+
+func TestMessageAuthorOnly(t *testing.T) {
+	h, r := setupAdminHandler(t)
+	h.SetAuthorOnlyEdits(true)
+	room, _ := h.hub.CreateRoom(nil)
+	close(room.Shutdown())
+
+	author := model.User{ID: uuid.New(), Name: "Alice"}
+	path := fmt.Sprintf("/api/v1/rooms/%d/messages/", room.ID())
+
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		admin  bool
+		want   int
+	}{
+		{"patch without user", http.MethodPatch, "", false, http.StatusForbidden},
+		{"patch by other user", http.MethodPatch, "?userId=" + uuid.NewString(), false, http.StatusForbidden},
+		{"patch by author", http.MethodPatch, "?userId=" + author.ID.String(), false, http.StatusOK},
+		{"put by other user", http.MethodPut, "?userId=" + uuid.NewString(), false, http.StatusForbidden},
+		{"put by author", http.MethodPut, "?userId=" + author.ID.String(), false, http.StatusOK},
+		{"delete with invalid user", http.MethodDelete, "?userId=nope", false, http.StatusForbidden},
+		{"delete by admin", http.MethodDelete, "", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := room.StoreMessage(model.OutgoingMessage{
+				ID:          uuid.New(),
+				MessageType: model.UserMessage,
+				Message:     "original",
+				User:        author,
+			})
+
+			req := httptest.NewRequest(tt.method, path+msg.ID.String()+tt.query, bytes.NewBufferString(`{"message":"edited"}`))
+			if tt.admin {
+				req.Header.Set("Authorization", "Bearer secret")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			stored, _ := room.GetMessage(msg.ID)
+			if changed := stored.Message != "original"; changed != (tt.want == http.StatusOK) {
+				t.Errorf("unexpected stored message %q", stored.Message)
+			}
+		})
+	}
+
+	missing := doJSON(r, http.MethodDelete, path+uuid.NewString(), "")
+	if missing.Code != http.StatusNotFound {
+		t.Errorf("expected %d for unknown message, got %d", http.StatusNotFound, missing.Code)
+	}
+}
+
+func TestGetRoomMessagesByIDs(t *testing.T) {
+	h := setupMessageTests(t)
+	room, _ := h.hub.GetRoom(1)
+	var stored []model.OutgoingMessage
+	for i := range 3 {
+		stored = append(stored, room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: fmt.Sprintf("chat %d", i)}))
+	}
+	unknown := uuid.New()
+
+	get := func(ids string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/rooms/1/messages?ids="+ids, nil)
+		req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+		w := httptest.NewRecorder()
+		h.getRoomMessagesHandler(w, req)
+		return w
+	}
+
+	w := get(stored[2].ID.String() + "," + unknown.String() + "," + stored[0].ID.String() + "," + stored[2].ID.String())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response MessagesPageResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	var texts []string
+	for _, msg := range response.Messages {
+		texts = append(texts, msg.Message)
+	}
+	if !slices.Equal(texts, []string{"chat 2", "chat 0"}) || response.Total != 2 {
+		t.Errorf("expected the requested messages in order, got %v (total %d)", texts, response.Total)
+	}
+	if !slices.Equal(response.NotFound, []uuid.UUID{unknown}) {
+		t.Errorf("expected %s to be reported as not found, got %v", unknown, response.NotFound)
+	}
+
+	tooMany := make([]string, maxQueryIDs+1)
+	for i := range tooMany {
+		tooMany[i] = uuid.NewString()
+	}
+	for _, ids := range []string{"", "not-a-uuid", stored[0].ID.String() + ",nope", strings.Join(tooMany, ",")} {
+		if w := get(ids); w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for ids %.40q, got %d", http.StatusBadRequest, ids, w.Code)
+		}
+	}
+}
+
+func TestRoomMessagesShowCurrentAuthor(t *testing.T) {
+	h := setupHandler(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	author := h.userRegistry.CreateUser("", "", "alice", "", "", nil)
+	ephemeral := model.User{ID: uuid.New(), Name: "guest"}
+	live, _ := h.hub.CreateRoom(nil)
+	frozen, _ := h.hub.CreateRoom(model.AdditionalInfo{"immutableAuthors": true})
+	close(live.Shutdown())
+	close(frozen.Shutdown())
+	for _, room := range []*chat.Room{live, frozen} {
+		room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hi", User: *author})
+		room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hey", User: ephemeral})
+	}
+
+	if w := doJSON(r, http.MethodPatch, "/api/v1/users/"+author.ID.String(), `{"name":"alicia"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected rename to succeed, got %d", w.Code)
+	}
+
+	authors := func(roomID uint) []string {
+		t.Helper()
+		w := doJSON(r, http.MethodGet, fmt.Sprintf("/api/v1/rooms/%d/messages", roomID), "")
+		var response MessagesPageResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		var names []string
+		for _, msg := range response.Messages {
+			names = append(names, msg.User.Name)
+		}
+		return names
+	}
+
+	if got := authors(live.ID()); !slices.Equal(got, []string{"alicia", "guest"}) {
+		t.Errorf("expected the current name of registered authors, got %v", got)
+	}
+	if got := authors(frozen.ID()); !slices.Equal(got, []string{"alice", "guest"}) {
+		t.Errorf("expected immutableAuthors to keep the sent name, got %v", got)
+	}
+}
+
+func TestPatchRoomMessagesHandler(t *testing.T) {
+	h := setupHandler(t)
+	room := newRunningRoom(t, h)
+	client := connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "watcher"})
+
+	first := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "first", AdditionalInfo: model.AdditionalInfo{}}
+	second := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "second", AdditionalInfo: model.AdditionalInfo{}}
+	room.StoreMessage(first)
+	room.StoreMessage(second)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	path := fmt.Sprintf("/api/v1/rooms/%d/messages", room.ID())
+
+	missing := uuid.New()
+	body := fmt.Sprintf(`[
+		{"id":%q,"message":"first, edited"},
+		{"id":%q},
+		{"id":%q,"message":"gone"},
+		{"id":%q,"additionalInfo":{"format":"markdown"}}
+	]`, first.ID, second.ID, missing, second.ID)
+	w := doJSON(r, http.MethodPatch, path, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var resp MessageBatchPatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(resp.Results))
+	}
+	want := []struct {
+		id      uuid.UUID
+		updated bool
+		error   string
+	}{
+		{first.ID, true, ""},
+		{second.ID, false, "at least one field (message or additionalInfo) must be provided"},
+		{missing, false, "message not found"},
+		{second.ID, true, ""},
+	}
+	for i, res := range resp.Results {
+		if res.ID != want[i].id || res.Updated != want[i].updated || res.Error != want[i].error {
+			t.Errorf("result %d: expected %+v, got %+v", i, want[i], res)
+		}
+		if res.Updated && res.Message == nil {
+			t.Errorf("result %d: expected the updated message", i)
+		}
+	}
+
+	if msg, _ := room.GetMessage(first.ID); msg.Message != "first, edited" {
+		t.Errorf("expected first message to be edited, got %q", msg.Message)
+	}
+	if msg, _ := room.GetMessage(second.ID); msg.Message != "second" || msg.AdditionalInfo["format"] != "markdown" {
+		t.Errorf("expected second message info to be edited, got %+v", msg)
+	}
+
+	select {
+	case b := <-client.Send():
+		var event model.OutgoingMessage
+		if err := json.Unmarshal(b, &event); err != nil {
+			t.Fatalf("failed to unmarshal event: %v", err)
+		}
+		updates, _ := event.AdditionalInfo["updates"].([]any)
+		if event.MessageType != model.MessageUpdated || len(updates) != 2 {
+			t.Fatalf("expected one batch event with 2 updates, got %+v", event)
+		}
+		if update, _ := updates[0].(map[string]any); update["messageId"] != first.ID.String() || update["message"] != "first, edited" {
+			t.Errorf("unexpected first update: %v", updates[0])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for batch event")
+	}
+	select {
+	case b := <-client.Send():
+		t.Errorf("expected a single event, got %s", b)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if w := doJSON(r, http.MethodPatch, path, `[]`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty batch: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := doJSON(r, http.MethodPatch, "/api/v1/rooms/999/messages", body); w.Code != http.StatusNotFound {
+		t.Errorf("unknown room: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
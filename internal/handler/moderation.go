@@ -0,0 +1,405 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/choffmann/chat-room/internal/chat"
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type KickResponse struct {
+	RoomID      uint      `json:"roomId" example:"1"`
+	UserID      uuid.UUID `json:"userId" example:"9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"`
+	Connections int       `json:"connections" example:"1"`
+} // @name KickResponse
+
+// kickRoomUserHandler godoc
+// @Summary      Kick a user from a room
+// @Description  Disconnects every connection of the user from the room. The room receives a system message that the user was removed; the kicked client receives it as well before its socket is closed. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         moderation
+// @Produce      json
+// @Security     AdminToken
+// @Param        roomID  path      int     true  "Room ID"
+// @Param        userID  path      string  true  "User UUID"
+// @Success      200     {object}  KickResponse
+// @Failure      400     {string}  string  "invalid room or user id"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found or user not connected"
+// @Router       /rooms/{roomID}/users/{userID} [delete]
+func (h *Handler) kickRoomUserHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+	roomID := room.ID()
+
+	vars := mux.Vars(r)
+	userID, err := uuid.Parse(vars["userID"])
+	if err != nil {
+		h.logger.Warn("invalid user id for kick", "userID", vars["userID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	connections := room.KickUser(userID)
+	if connections == 0 {
+		h.logger.Warn("user not connected for kick", "roomID", roomID, "userID", userID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "user not connected", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, KickResponse{
+		RoomID:      roomID,
+		UserID:      userID,
+		Connections: connections,
+	})
+}
+
+type BanRequest struct {
+	UserID uuid.UUID `json:"userId" example:"9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"`
+} // @name BanRequest
+
+type BansResponse struct {
+	Bans []uuid.UUID `json:"bans"`
+} // @name BansResponse
+
+// roomFromVars resolves the room of a moderation request and writes the
+// error response if it can't be found.
+func (h *Handler) roomFromVars(w http.ResponseWriter, r *http.Request) (*chat.Room, bool) {
+	vars := mux.Vars(r)
+	roomID, err := model.ParseRoomID(vars["roomID"])
+	if err != nil {
+		h.logger.Warn("invalid room id for moderation", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid room id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	room, ok := h.hub.GetRoom(roomID)
+	if !ok {
+		h.logger.Warn("room not found for moderation", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return nil, false
+	}
+	return room, true
+}
+
+// getRoomBansHandler godoc
+// @Summary      List banned users of a room
+// @Description  Returns the IDs of all users banned from the room. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         moderation
+// @Produce      json
+// @Security     AdminToken
+// @Param        roomID  path      int  true  "Room ID"
+// @Success      200     {object}  BansResponse
+// @Failure      400     {string}  string  "invalid room id"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/bans [get]
+func (h *Handler) getRoomBansHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, BansResponse{Bans: room.GetBans()})
+}
+
+// createRoomBanHandler godoc
+// @Summary      Ban a user from a room
+// @Description  Adds the user to the room's ban list and kicks any open connections. Banned users are rejected with 403 when joining. Bans match the user ID, so they only make sense for registered users; ephemeral users get a new random ID on every join. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         moderation
+// @Accept       json
+// @Produce      json
+// @Security     AdminToken
+// @Param        roomID  path      int         true  "Room ID"
+// @Param        ban     body      BanRequest  true  "User to ban"
+// @Success      201     {object}  BansResponse
+// @Success      200     {object}  BansResponse  "user was already banned"
+// @Failure      400     {string}  string  "invalid room id or request body"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/bans [post]
+func (h *Handler) createRoomBanHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+
+	var req BanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == uuid.Nil {
+		h.logger.Warn("invalid ban request", "roomID", room.ID(), "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	if room.Ban(req.UserID) {
+		status = http.StatusCreated
+		h.logger.Info("user banned from room", "roomID", room.ID(), "userID", req.UserID)
+	}
+	room.KickUser(req.UserID)
+
+	writeJSON(w, r, status, BansResponse{Bans: room.GetBans()})
+}
+
+// deleteRoomBanHandler godoc
+// @Summary      Unban a user from a room
+// @Description  Removes the user from the room's ban list. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         moderation
+// @Security     AdminToken
+// @Param        roomID  path  int     true  "Room ID"
+// @Param        userID  path  string  true  "User UUID"
+// @Success      204
+// @Failure      400     {string}  string  "invalid room or user id"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found or user not banned"
+// @Router       /rooms/{roomID}/bans/{userID} [delete]
+func (h *Handler) deleteRoomBanHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID, err := uuid.Parse(vars["userID"])
+	if err != nil {
+		h.logger.Warn("invalid user id for unban", "userID", vars["userID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	if !room.Unban(userID) {
+		http.Error(w, "user not banned", http.StatusNotFound)
+		return
+	}
+	h.logger.Info("user unbanned from room", "roomID", room.ID(), "userID", userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type MuteRequest struct {
+	UserID uuid.UUID `json:"userId" example:"9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"`
+} // @name MuteRequest
+
+type MutesResponse struct {
+	Mutes []uuid.UUID `json:"mutes"`
+} // @name MutesResponse
+
+// getRoomMutesHandler godoc
+// @Summary      List muted users of a room
+// @Description  Returns the IDs of all users muted in the room. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         moderation
+// @Produce      json
+// @Security     AdminToken
+// @Param        roomID  path      int  true  "Room ID"
+// @Success      200     {object}  MutesResponse
+// @Failure      400     {string}  string  "invalid room id"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/mutes [get]
+func (h *Handler) getRoomMutesHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, MutesResponse{Mutes: room.GetMutes()})
+}
+
+// createRoomMuteHandler godoc
+// @Summary      Mute a user in a room
+// @Description  Adds the user to the room's mute list. Muted users stay connected and keep receiving messages, but their messages and uploads are neither stored nor broadcast; each attempt gets a private `system` error instead. Like bans, mutes match the user ID. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         moderation
+// @Accept       json
+// @Produce      json
+// @Security     AdminToken
+// @Param        roomID  path      int          true  "Room ID"
+// @Param        mute    body      MuteRequest  true  "User to mute"
+// @Success      201     {object}  MutesResponse
+// @Success      200     {object}  MutesResponse  "user was already muted"
+// @Failure      400     {string}  string  "invalid room id or request body"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/mutes [post]
+func (h *Handler) createRoomMuteHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+
+	var req MuteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == uuid.Nil {
+		h.logger.Warn("invalid mute request", "roomID", room.ID(), "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	if room.Mute(req.UserID) {
+		status = http.StatusCreated
+		h.logger.Info("user muted in room", "roomID", room.ID(), "userID", req.UserID)
+	}
+
+	writeJSON(w, r, status, MutesResponse{Mutes: room.GetMutes()})
+}
+
+// deleteRoomMuteHandler godoc
+// @Summary      Unmute a user in a room
+// @Description  Removes the user from the room's mute list. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         moderation
+// @Security     AdminToken
+// @Param        roomID  path  int     true  "Room ID"
+// @Param        userID  path  string  true  "User UUID"
+// @Success      204
+// @Failure      400     {string}  string  "invalid room or user id"
+// @Failure      401     {string}  string  "unauthorized"
+// @Failure      404     {string}  string  "room not found or user not muted"
+// @Router       /rooms/{roomID}/mutes/{userID} [delete]
+func (h *Handler) deleteRoomMuteHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID, err := uuid.Parse(vars["userID"])
+	if err != nil {
+		h.logger.Warn("invalid user id for unmute", "userID", vars["userID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	if !room.Unmute(userID) {
+		http.Error(w, "user not muted", http.StatusNotFound)
+		return
+	}
+	h.logger.Info("user unmuted in room", "roomID", room.ID(), "userID", userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type PinsResponse struct {
+	Pins []model.OutgoingMessage `json:"pins"`
+} // @name PinsResponse
+
+// messageIDFromVars parses the messageID path variable and writes the error
+// response if it is invalid.
+func (h *Handler) messageIDFromVars(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	vars := mux.Vars(r)
+	messageID, err := uuid.Parse(vars["messageID"])
+	if err != nil {
+		h.logger.Warn("invalid message id for moderation", "messageID", vars["messageID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse message id to uuid", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return messageID, true
+}
+
+// getRoomPinsHandler godoc
+// @Summary      List pinned messages
+// @Description  Returns the pinned messages of a room in the order they were pinned. Pinned messages that have expired or been evicted from the history are left out, and so are messages sent to an audience the requester isn't part of, as for `GET /rooms/{roomID}/messages`.
+// @Tags         moderation
+// @Produce      json
+// @Param        roomID  path      int     true   "Room ID"
+// @Param        userId  query     string  false  "Show the messages sent to this user's role"
+// @Success      200     {object}  PinsResponseDoc
+// @Failure      400     {string}  string  "invalid room id or userId"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/pins [get]
+func (h *Handler) getRoomPinsHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+	hidden, ok := h.visibilityFilter(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, PinsResponse{Pins: slices.DeleteFunc(room.GetPins(), hidden)})
+}
+
+// pinRoomMessageHandler godoc
+// @Summary      Pin a message
+// @Description  Appends a stored message to the room's pinned list and broadcasts a `pins_updated` event with the full list of pinned message IDs. Pinning an already pinned message changes nothing. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         moderation
+// @Produce      json
+// @Security     AdminToken
+// @Param        roomID     path      int     true  "Room ID"
+// @Param        messageID  path      string  true  "Message UUID"
+// @Success      201        {object}  PinsResponseDoc
+// @Success      200        {object}  PinsResponseDoc  "message was already pinned"
+// @Failure      400        {string}  string  "invalid room or message id"
+// @Failure      401        {string}  string  "unauthorized"
+// @Failure      404        {string}  string  "room or message not found"
+// @Failure      409        {string}  string  "message is deleted"
+// @Router       /rooms/{roomID}/messages/{messageID}/pin [post]
+func (h *Handler) pinRoomMessageHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+	messageID, ok := h.messageIDFromVars(w, r)
+	if !ok {
+		return
+	}
+
+	added, err := room.Pin(messageID)
+	switch {
+	case errors.Is(err, chat.ErrMessageNotFound):
+		h.logger.Warn("message not found for pin", "roomID", room.ID(), "messageID", messageID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	case errors.Is(err, chat.ErrMessageDeleted):
+		h.logger.Warn("attempt to pin deleted message", "roomID", room.ID(), "messageID", messageID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "message is deleted", http.StatusConflict)
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+		h.logger.Info("message pinned", "roomID", room.ID(), "messageID", messageID)
+		room.BroadcastPins("pinned", messageID)
+	}
+
+	writeJSON(w, r, status, PinsResponse{Pins: room.GetPins()})
+}
+
+// unpinRoomMessageHandler godoc
+// @Summary      Unpin a message
+// @Description  Removes a message from the room's pinned list and broadcasts a `pins_updated` event. Only available when the server is started with `ADMIN_TOKEN`.
+// @Tags         moderation
+// @Security     AdminToken
+// @Param        roomID     path      int     true  "Room ID"
+// @Param        messageID  path      string  true  "Message UUID"
+// @Success      204        "No Content"
+// @Failure      400        {string}  string  "invalid room or message id"
+// @Failure      401        {string}  string  "unauthorized"
+// @Failure      404        {string}  string  "room not found or message not pinned"
+// @Router       /rooms/{roomID}/messages/{messageID}/pin [delete]
+func (h *Handler) unpinRoomMessageHandler(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromVars(w, r)
+	if !ok {
+		return
+	}
+	messageID, ok := h.messageIDFromVars(w, r)
+	if !ok {
+		return
+	}
+
+	if !room.Unpin(messageID) {
+		h.logger.Warn("message not pinned for unpin", "roomID", room.ID(), "messageID", messageID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "message not pinned", http.StatusNotFound)
+		return
+	}
+	h.logger.Info("message unpinned", "roomID", room.ID(), "messageID", messageID)
+	room.BroadcastPins("unpinned", messageID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/chat"
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// connectTestClient registers a client without a WebSocket connection.
+func connectTestClient(t *testing.T, h *Handler, room *chat.Room, u model.User) *chat.Client {
+	t.Helper()
+	client := chat.NewClient(room, nil, u, h.systemUser, h.logger, nil, "")
+	if !room.TryRegister(client) {
+		t.Fatal("failed to register client")
+	}
+	time.Sleep(20 * time.Millisecond)
+	return client
+}
+
+func newRunningRoom(t *testing.T, h *Handler) *chat.Room {
+	t.Helper()
+	room, _ := h.hub.CreateRoom(nil)
+	t.Cleanup(func() {
+		room.ShutdownOnce(func() { close(room.Shutdown()) })
+		<-room.Closed()
+	})
+	return room
+}
+
+func TestKickRoomUser(t *testing.T) {
+	h := setupHandler(t)
+	room := newRunningRoom(t, h)
+
+	target := model.User{ID: uuid.New(), Name: "troll"}
+	bystander := model.User{ID: uuid.New(), Name: "bystander"}
+	targetClient := connectTestClient(t, h, room, target)
+	bystanderClient := connectTestClient(t, h, room, bystander)
+
+	roomID := room.ID()
+	req := httptest.NewRequest("DELETE", "/rooms/1/users/"+target.ID.String(), nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1", "userID": target.ID.String()})
+	w := httptest.NewRecorder()
+
+	h.kickRoomUserHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response KickResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.RoomID != roomID || response.UserID != target.ID || response.Connections != 1 {
+		t.Errorf("unexpected response: %+v", response)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if count := room.GetClientCount(); count != 1 {
+		t.Errorf("expected 1 remaining client, got %d", count)
+	}
+
+	for name, client := range map[string]*chat.Client{"kicked": targetClient, "bystander": bystanderClient} {
+		select {
+		case msg := <-client.Send():
+			var out model.OutgoingMessage
+			if err := json.Unmarshal(msg, &out); err != nil {
+				t.Fatalf("%s: failed to unmarshal: %v", name, err)
+			}
+			if !strings.Contains(out.Message, "was removed") {
+				t.Errorf("%s: expected removal notice, got %q", name, out.Message)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: did not receive removal notice", name)
+		}
+	}
+
+	select {
+	case _, ok := <-targetClient.Send():
+		if ok {
+			t.Error("expected kicked client's send channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("kicked client's send channel was not closed")
+	}
+}
+
+func TestKickRoomUserNotConnected(t *testing.T) {
+	h := setupHandler(t)
+	newRunningRoom(t, h)
+
+	tests := []struct {
+		name           string
+		roomID         string
+		userID         string
+		expectedStatus int
+	}{
+		{name: "User not connected", roomID: "1", userID: uuid.New().String(), expectedStatus: http.StatusNotFound},
+		{name: "Room not found", roomID: "999", userID: uuid.New().String(), expectedStatus: http.StatusNotFound},
+		{name: "Invalid user id", roomID: "1", userID: "invalid", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid room id", roomID: "invalid", userID: uuid.New().String(), expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", "/rooms/"+tt.roomID+"/users/"+tt.userID, nil)
+			req = mux.SetURLVars(req, map[string]string{"roomID": tt.roomID, "userID": tt.userID})
+			w := httptest.NewRecorder()
+
+			h.kickRoomUserHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRoomBans(t *testing.T) {
+	h := setupHandler(t)
+	room := newRunningRoom(t, h)
+
+	registered := h.userRegistry.CreateUser("", "", "troll", "", "", nil)
+	client := connectTestClient(t, h, room, *registered)
+
+	body := strings.NewReader(`{"userId":"` + registered.ID.String() + `"}`)
+	req := httptest.NewRequest("POST", "/rooms/1/bans", body)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+	w := httptest.NewRecorder()
+	h.createRoomBanHandler(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	var bans BansResponse
+	if err := json.NewDecoder(w.Body).Decode(&bans); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(bans.Bans) != 1 || bans.Bans[0] != registered.ID {
+		t.Errorf("unexpected bans: %v", bans.Bans)
+	}
+
+	select {
+	case <-client.Send():
+	case <-time.After(time.Second):
+		t.Fatal("banned client was not kicked")
+	}
+
+	req = httptest.NewRequest("GET", "/join/1?userId="+registered.ID.String(), nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+	w = httptest.NewRecorder()
+	h.wsHandler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected banned join to return %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	req = httptest.NewRequest("DELETE", "/rooms/1/bans/"+registered.ID.String(), nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1", "userID": registered.ID.String()})
+	w = httptest.NewRecorder()
+	h.deleteRoomBanHandler(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/rooms/1/bans", nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+	w = httptest.NewRecorder()
+	h.getRoomBansHandler(w, req)
+	bans = BansResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&bans); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(bans.Bans) != 0 {
+		t.Errorf("expected empty ban list, got %v", bans.Bans)
+	}
+
+	req = httptest.NewRequest("DELETE", "/rooms/1/bans/"+registered.ID.String(), nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1", "userID": registered.ID.String()})
+	w = httptest.NewRecorder()
+	h.deleteRoomBanHandler(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for unknown ban, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestRoomMutes(t *testing.T) {
+	h := setupHandler(t)
+	room := newRunningRoom(t, h)
+	roomVar := strconv.FormatUint(uint64(room.ID()), 10)
+
+	registered := h.userRegistry.CreateUser("", "", "loud", "", "", nil)
+	connectTestClient(t, h, room, *registered)
+
+	body := strings.NewReader(`{"userId":"` + registered.ID.String() + `"}`)
+	req := httptest.NewRequest("POST", "/rooms/"+roomVar+"/mutes", body)
+	req = mux.SetURLVars(req, map[string]string{"roomID": roomVar})
+	w := httptest.NewRecorder()
+	h.createRoomMuteHandler(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	var mutes MutesResponse
+	if err := json.NewDecoder(w.Body).Decode(&mutes); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(mutes.Mutes) != 1 || mutes.Mutes[0] != registered.ID {
+		t.Errorf("unexpected mutes: %v", mutes.Mutes)
+	}
+	if !room.IsMuted(registered.ID) {
+		t.Error("expected user to be muted")
+	}
+	if n := room.GetClientCount(); n != 1 {
+		t.Errorf("expected muted user to stay connected, got %d clients", n)
+	}
+
+	req = httptest.NewRequest("GET", "/rooms/"+roomVar+"/mutes", nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": roomVar})
+	w = httptest.NewRecorder()
+	h.getRoomMutesHandler(w, req)
+	mutes = MutesResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&mutes); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(mutes.Mutes) != 1 {
+		t.Errorf("expected one muted user, got %v", mutes.Mutes)
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		req = httptest.NewRequest("DELETE", "/rooms/"+roomVar+"/mutes/"+registered.ID.String(), nil)
+		req = mux.SetURLVars(req, map[string]string{"roomID": roomVar, "userID": registered.ID.String()})
+		w = httptest.NewRecorder()
+		h.deleteRoomMuteHandler(w, req)
+		if w.Code != want {
+			t.Errorf("expected status %d, got %d", want, w.Code)
+		}
+	}
+	if room.IsMuted(registered.ID) {
+		t.Error("expected user to be unmuted")
+	}
+}
+
+func TestRoomPins(t *testing.T) {
+	h := setupHandler(t)
+	room := newRunningRoom(t, h)
+	roomVar := strconv.FormatUint(uint64(room.ID()), 10)
+	listener := connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "listener"})
+
+	first := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "first"}
+	second := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "second"}
+	room.StoreMessage(first)
+	room.StoreMessage(second)
+
+	pin := func(id uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/rooms/1/messages/"+id.String()+"/pin", nil)
+		req = mux.SetURLVars(req, map[string]string{"roomID": roomVar, "messageID": id.String()})
+		w := httptest.NewRecorder()
+		h.pinRoomMessageHandler(w, req)
+		return w
+	}
+
+	if w := pin(second.ID); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if w := pin(first.ID); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if w := pin(first.ID); w.Code != http.StatusOK {
+		t.Errorf("expected repeated pin to return %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := pin(uuid.New()); w.Code != http.StatusNotFound {
+		t.Errorf("expected unknown message to return %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	select {
+	case b := <-listener.Send():
+		var event model.OutgoingMessage
+		if err := json.Unmarshal(b, &event); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if event.MessageType != model.PinsUpdated || event.AdditionalInfo["action"] != "pinned" {
+			t.Errorf("expected pins_updated event, got %s %v", event.MessageType, event.AdditionalInfo)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for pin event")
+	}
+
+	req := httptest.NewRequest("GET", "/rooms/1/pins", nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": roomVar})
+	w := httptest.NewRecorder()
+	h.getRoomPinsHandler(w, req)
+	var pins PinsResponse
+	if err := json.NewDecoder(w.Body).Decode(&pins); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(pins.Pins) != 2 || pins.Pins[0].ID != second.ID || pins.Pins[1].ID != first.ID {
+		t.Errorf("expected pins in pin order, got %v", pins.Pins)
+	}
+
+	req = httptest.NewRequest("DELETE", "/rooms/1/messages/"+second.ID.String()+"/pin", nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": roomVar, "messageID": second.ID.String()})
+	w = httptest.NewRecorder()
+	h.unpinRoomMessageHandler(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.unpinRoomMessageHandler(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected unpinning twice to return %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	room.UpdateMessage(second.ID, "deleted", model.AdditionalInfo{"deleted": true})
+	if w := pin(second.ID); w.Code != http.StatusConflict {
+		t.Errorf("expected pinning a deleted message to return %d, got %d", http.StatusConflict, w.Code)
+	}
+}
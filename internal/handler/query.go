@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 500
+	// maxQueryIDs caps how many IDs the "ids" query parameter may list.
+	maxQueryIDs = 100
+)
+
+// parseLimitOffset reads the optional "limit" and "offset" query parameters.
+// limit defaults to defaultPageLimit and is capped at maxPageLimit.
+func parseLimitOffset(r *http.Request) (limit, offset int, err error) {
+	limit = defaultPageLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("limit must be a positive integer")
+		}
+		limit = min(limit, maxPageLimit)
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// parseUserRange reads the optional "minUsers" and "maxUsers" query
+// parameters. An absent maxUsers is returned as -1, meaning no upper bound.
+func parseUserRange(r *http.Request) (minUsers, maxUsers int, err error) {
+	maxUsers = -1
+	if v := r.URL.Query().Get("minUsers"); v != "" {
+		minUsers, err = strconv.Atoi(v)
+		if err != nil || minUsers < 0 {
+			return 0, 0, fmt.Errorf("minUsers must be a non-negative integer")
+		}
+	}
+	if v := r.URL.Query().Get("maxUsers"); v != "" {
+		maxUsers, err = strconv.Atoi(v)
+		if err != nil || maxUsers < 0 {
+			return 0, 0, fmt.Errorf("maxUsers must be a non-negative integer")
+		}
+		if minUsers > maxUsers {
+			return 0, 0, fmt.Errorf("minUsers must not be greater than maxUsers")
+		}
+	}
+	return minUsers, maxUsers, nil
+}
+
+// parseIDs reads the comma-separated UUIDs of the "ids" query parameter.
+// Duplicates are dropped; more than maxQueryIDs IDs are an error.
+func parseIDs(r *http.Request) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for v := range strings.SplitSeq(r.URL.Query().Get("ids"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", v)
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("ids must list at least one message id")
+	}
+	if len(ids) > maxQueryIDs {
+		return nil, fmt.Errorf("at most %d ids are allowed", maxQueryIDs)
+	}
+	return ids, nil
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often idle buckets are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter is a per-key token bucket. Each key starts with burst tokens
+// and regains rate tokens per second.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token for key. If none is left it returns false and how long
+// until the next token is available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely; they behave exactly
+// like a new bucket. The caller must hold mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// SetCreationRateLimit limits how many rooms and users a single client IP
+// may create: perMinute requests on average with bursts of up to burst. A
+// perMinute of 0 disables the limit.
+func (h *Handler) SetCreationRateLimit(perMinute, burst int) {
+	if perMinute <= 0 {
+		h.creationLimit = nil
+		return
+	}
+	h.creationLimit = newRateLimiter(perMinute, burst)
+}
+
+// SetJoinRateLimit limits how many WebSocket joins a single client IP may
+// open: perMinute joins on average with bursts of up to burst. Joins with a
+// userId get a budget of the same size of their own, so ephemeral joins can't
+// use up the one of registered users behind the same IP. Resumes with a
+// reconnect token don't count. A perMinute of 0 disables the limit.
+func (h *Handler) SetJoinRateLimit(perMinute, burst int) {
+	if perMinute <= 0 {
+		h.joinLimit = nil
+		h.userJoinLimit = nil
+		return
+	}
+	h.joinLimit = newRateLimiter(perMinute, burst)
+	h.userJoinLimit = newRateLimiter(perMinute, burst)
+}
+
+// rateLimited rejects requests with 429 once the client IP has used up its
+// creation budget.
+func (h *Handler) rateLimited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.allowRate(w, r, h.creationLimit, "creation rate limit exceeded") {
+			next(w, r)
+		}
+	}
+}
+
+// allowRate takes a token for the client IP from limiter. If none is left it
+// logs msg, answers 429 with Retry-After and returns false. A nil limiter
+// allows every request.
+func (h *Handler) allowRate(w http.ResponseWriter, r *http.Request, limiter *rateLimiter, msg string) bool {
+	if limiter == nil {
+		return true
+	}
+	ok, wait := limiter.allow(clientIP(r))
+	if !ok {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		h.logger.Warn(msg, "path", r.URL.Path, "remoteAddr", r.RemoteAddr, "retryAfter", retryAfter)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// clientIP returns the host part of the request's remote address, so that
+// all connections of a client share one bucket.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(60, 2)
+	l.now = func() time.Time { return now }
+
+	for i := range 2 {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("request %d: expected burst to be allowed", i)
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok || wait != time.Second {
+		t.Fatalf("expected rejection with 1s wait, got %v %v", ok, wait)
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Error("expected other keys to have their own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("expected a token after one second")
+	}
+
+	now = now.Add(rateLimitSweepInterval)
+	l.allow("c")
+	if _, ok := l.buckets["b"]; ok {
+		t.Error("expected idle bucket to be swept")
+	}
+}
+
+func TestCreationRateLimit(t *testing.T) {
+	h := setupHandler(t)
+	h.SetCreationRateLimit(1, 2)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	post := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	post("/api/v1/rooms", "10.0.0.1:1000")
+	post("/api/v1/users", "10.0.0.1:1001")
+	w := post("/api/v1/rooms", "10.0.0.1:1002")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("expected Retry-After 60, got %q", got)
+	}
+
+	if w := post("/api/v1/rooms", "10.0.0.2:1000"); w.Code == http.StatusTooManyRequests {
+		t.Error("expected another IP to be allowed")
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/rooms", ""); w.Code != http.StatusOK {
+		t.Errorf("expected reads to be unaffected, got %d", w.Code)
+	}
+}
+
+func TestJoinRateLimit(t *testing.T) {
+	h := setupHandler(t)
+	h.SetJoinRateLimit(1, 2)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	registered := h.userRegistry.CreateUser("", "", "alice", "", "", nil)
+
+	join := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// The room doesn't exist, so joins that pass the limit end with 404.
+	join("/api/v1/join/99", "10.0.0.1:1000")
+	join("/api/v1/join", "10.0.0.1:1001")
+	w := join("/api/v1/join/99?userName=bob", "10.0.0.1:1002")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	// Joins with a userId have a budget of their own, but are limited too.
+	userJoin := "/api/v1/join/99?userId=" + registered.ID.String()
+	for i := range 2 {
+		if w := join(userJoin, "10.0.0.1:1003"); w.Code != http.StatusNotFound {
+			t.Errorf("join %d: expected joins with userId to use their own budget, got %d", i, w.Code)
+		}
+	}
+	if w := join(userJoin, "10.0.0.1:1003"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected joins with userId to be limited, got %d", w.Code)
+	}
+	if w := join("/api/v1/join/99?reconnectToken=abc", "10.0.0.1:1004"); w.Code != http.StatusNotFound {
+		t.Errorf("expected resumes to be exempt, got %d", w.Code)
+	}
+	if w := join("/api/v1/join/99", "10.0.0.2:1000"); w.Code != http.StatusNotFound {
+		t.Errorf("expected other IPs to be unaffected, got %d", w.Code)
+	}
+}
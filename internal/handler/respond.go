@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeJSON writes v as the JSON body of a response with status. With
+// ?pretty=1 or ?pretty=true the output is indented, which makes responses
+// easier to read when testing with curl.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	if pretty := r.URL.Query().Get("pretty"); pretty == "1" || pretty == "true" {
+		enc.SetIndent("", "  ")
+	}
+	enc.Encode(v)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestWriteJSONPretty(t *testing.T) {
+	h := setupHandler(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	tests := []struct {
+		query    string
+		indented bool
+	}{
+		{"", false},
+		{"?pretty=1", true},
+		{"?pretty=true", true},
+		{"?pretty=0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := doJSON(r, http.MethodGet, "/api/v1/rooms"+tt.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("expected JSON content type, got %q", ct)
+			}
+			want := "{\"rooms\":[]}\n"
+			if tt.indented {
+				want = "{\n  \"rooms\": []\n}\n"
+			}
+			if got := w.Body.String(); got != want {
+				t.Errorf("expected body %q, got %q", want, got)
+			}
+		})
+	}
+}
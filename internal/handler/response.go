@@ -27,15 +27,18 @@ type MessageAdditionalInfoDoc struct {
 type CreateRoomRequestDoc struct {
 	Theme       string `json:"theme,omitempty" example:"dark"`
 	Description string `json:"description,omitempty" example:"General chat room"`
+	Slug        string `json:"slug,omitempty" example:"general"`
 } // @name CreateRoomRequest
 
 type PatchRoomRequestDoc struct {
 	Theme string `json:"theme,omitempty" example:"light"`
+	Slug  string `json:"slug,omitempty" example:"general-chat"`
 } // @name PatchRoomRequest
 
 type PutRoomRequestDoc struct {
 	Theme       string `json:"theme,omitempty" example:"dark"`
 	Description string `json:"description,omitempty" example:"Updated chat room"`
+	Slug        string `json:"slug,omitempty" example:"general"`
 } // @name PutRoomRequest
 
 type MessagePatchRequestDoc struct {
@@ -52,6 +55,8 @@ type CreateUserRequestDoc struct {
 	FirstName      string                 `json:"firstName,omitempty" example:"John"`
 	LastName       string                 `json:"lastName,omitempty" example:"Doe"`
 	Name           string                 `json:"name,omitempty" example:"johndoe"`
+	Color          string                 `json:"color,omitempty" example:"#1e90ff"`
+	AvatarURL      string                 `json:"avatarUrl,omitempty" example:"https://example.com/avatars/johndoe.png"`
 	AdditionalInfo *UserAdditionalInfoDoc `json:"additionalInfo,omitempty"`
 } // @name CreateUserRequest
 
@@ -59,12 +64,16 @@ type UpdateUserRequestDoc struct {
 	FirstName      string                 `json:"firstName,omitempty" example:"Jane"`
 	LastName       string                 `json:"lastName,omitempty" example:"Smith"`
 	Name           string                 `json:"name,omitempty" example:"janesmith"`
+	Color          string                 `json:"color,omitempty" example:"#ff8c00"`
+	AvatarURL      string                 `json:"avatarUrl,omitempty" example:"https://example.com/avatars/janesmith.png"`
 	AdditionalInfo *UserAdditionalInfoDoc `json:"additionalInfo,omitempty"`
 } // @name UpdateUserRequest
 
 type PatchUserRequestDoc struct {
 	FirstName      string                 `json:"firstName,omitempty" example:"Jane"`
 	Name           string                 `json:"name,omitempty" example:"janesmith"`
+	Color          string                 `json:"color,omitempty" example:"#ff8c00"`
+	AvatarURL      string                 `json:"avatarUrl,omitempty" example:"https://example.com/avatars/janesmith.png"`
 	AdditionalInfo *UserAdditionalInfoDoc `json:"additionalInfo,omitempty"`
 } // @name PatchUserRequest
 
@@ -79,16 +88,23 @@ type UserDoc struct {
 	FirstName      string                 `json:"firstName,omitempty" example:"John"`
 	LastName       string                 `json:"lastName,omitempty" example:"Doe"`
 	Name           string                 `json:"name,omitempty" example:"johndoe"`
+	Color          string                 `json:"color,omitempty" example:"#1e90ff"`
+	AvatarURL      string                 `json:"avatarUrl,omitempty" example:"https://example.com/avatars/johndoe.png"`
+	CreatedAt      string                 `json:"createdAt,omitempty" example:"2024-04-09T12:00:00Z"`
+	LastSeen       string                 `json:"lastSeen,omitempty" example:"2024-04-09T12:35:10Z"`
 	AdditionalInfo *UserAdditionalInfoDoc `json:"additionalInfo,omitempty"`
 } // @name User
 
 type OutgoingMessageDoc struct {
+	Version        int                       `json:"v" example:"1"`
 	ID             uuid.UUID                 `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Seq            uint64                    `json:"seq,omitempty" example:"42"`
 	MessageType    string                    `json:"type" example:"message"`
 	Message        string                    `json:"message" example:"Hello everyone!"`
 	Timestamp      string                    `json:"timestamp" example:"2024-04-09T12:35:10.123456789Z"`
 	User           UserDoc                   `json:"user"`
-	AdditionalInfo *MessageAdditionalInfoDoc `json:"additionalInfo"`
+	ParentID       *uuid.UUID                `json:"parentId,omitempty" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	AdditionalInfo *MessageAdditionalInfoDoc `json:"additionalInfo,omitempty"`
 } // @name OutgoingMessage
 
 type RoomResponseDoc struct {
@@ -97,6 +113,15 @@ type RoomResponseDoc struct {
 	AdditionalInfo *RoomAdditionalInfoDoc `json:"additionalInfo,omitempty"`
 } // @name RoomResponse
 
+type RoomDetailDoc struct {
+	ID             uint                   `json:"id" example:"1"`
+	UserCount      int                    `json:"onlineUser" example:"3"`
+	MessageCount   int                    `json:"messageCount" example:"42"`
+	CreatedAt      string                 `json:"createdAt" example:"2024-04-09T12:00:00Z"`
+	LastActivity   string                 `json:"lastActivity" example:"2024-04-09T12:35:10Z"`
+	AdditionalInfo *RoomAdditionalInfoDoc `json:"additionalInfo,omitempty"`
+} // @name RoomDetail
+
 type UserWithRoomDoc struct {
 	User   UserDoc `json:"user"`
 	RoomID uint    `json:"roomId" example:"1"`
@@ -106,14 +131,90 @@ type RoomsListResponse struct {
 	Rooms []RoomResponseDoc `json:"rooms"`
 } // @name RoomsListResponse
 
+type AdminRoomsListResponse struct {
+	Rooms []RoomDetailDoc `json:"rooms"`
+} // @name AdminRoomsListResponse
+
+type DeadLetterDoc struct {
+	MessageID string             `json:"messageId" example:"550e8400-e29b-41d4-a716-446655440000"`
+	UserID    string             `json:"userId" example:"9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"`
+	DroppedAt string             `json:"droppedAt" example:"2024-04-09T12:35:10Z"`
+	Message   OutgoingMessageDoc `json:"message"`
+} // @name DeadLetter
+
+type DeadLettersResponse struct {
+	DeadLetters []DeadLetterDoc `json:"deadLetters"`
+} // @name DeadLettersResponse
+
+type MessageBatchPatchEntryDoc struct {
+	ID             string                    `json:"id" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	Message        *string                   `json:"message,omitempty" example:"Hello everyone! (edited)"`
+	AdditionalInfo *MessageAdditionalInfoDoc `json:"additionalInfo,omitempty"`
+} // @name MessageBatchPatchEntry
+
+type MessageBatchPatchResultDoc struct {
+	ID      string              `json:"id" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	Updated bool                `json:"updated" example:"false"`
+	Error   string              `json:"error,omitempty" example:"message not found"`
+	Message *OutgoingMessageDoc `json:"message,omitempty"`
+} // @name MessageBatchPatchResult
+
+type MessageBatchPatchResponseDoc struct {
+	Results []MessageBatchPatchResultDoc `json:"results"`
+} // @name MessageBatchPatchResponse
+
+type ConnectionDetailDoc struct {
+	User        UserDoc `json:"user"`
+	RemoteAddr  string  `json:"remoteAddr" example:"203.0.113.7:51234"`
+	UserAgent   string  `json:"userAgent,omitempty" example:"Mozilla/5.0 (X11; Linux x86_64)"`
+	ConnectedAt string  `json:"connectedAt" example:"2024-04-09T12:30:00Z"`
+} // @name ConnectionDetail
+
+type ConnectionDetailsResponse struct {
+	Connections []ConnectionDetailDoc `json:"connections"`
+} // @name ConnectionDetailsResponse
+
+type MessageReceiptsResponseDoc struct {
+	MessageID   string   `json:"messageId" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	DeliveredTo []string `json:"deliveredTo" example:"9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"`
+} // @name MessageReceiptsResponse
+
 type MessagesListResponse struct {
-	Messages []OutgoingMessageDoc `json:"messages"`
+	Messages   []OutgoingMessageDoc `json:"messages"`
+	Total      int                  `json:"total" example:"42"`
+	HasMore    bool                 `json:"hasMore" example:"true"`
+	NextOffset int                  `json:"nextOffset,omitempty" example:"20"`
+	NotFound   []string             `json:"notFound,omitempty" example:"1b4e28ba-2fa1-11d2-883f-0016d3cca427"`
 } // @name MessagesListResponse
 
+type MessageRepliesResponseDoc struct {
+	Messages      []OutgoingMessageDoc `json:"messages"`
+	ParentDeleted bool                 `json:"parentDeleted" example:"false"`
+} // @name MessageRepliesResponse
+
 type UsersListResponse struct {
 	Users []UserDoc `json:"users"`
 } // @name UsersListResponse
 
+type UsersPageResponseDoc struct {
+	Users   []UserDoc `json:"users"`
+	Total   int       `json:"total" example:"42"`
+	HasMore bool      `json:"hasMore" example:"true"`
+} // @name UsersPageResponse
+
 type UsersWithRoomListResponse struct {
 	Users []UserWithRoomDoc `json:"users"`
 } // @name UsersWithRoomListResponse
+
+type PinsResponseDoc struct {
+	Pins []OutgoingMessageDoc `json:"pins"`
+} // @name PinsResponse
+
+type OnlineUserDoc struct {
+	User    UserDoc `json:"user"`
+	RoomIDs []uint  `json:"roomIds" example:"1,3"`
+} // @name OnlineUser
+
+type OnlineUsersListResponse struct {
+	Users []OnlineUserDoc `json:"users"`
+} // @name OnlineUsersListResponse
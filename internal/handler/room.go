@@ -2,21 +2,47 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
 	"strconv"
 
+	"github.com/choffmann/chat-room/internal/chat"
 	"github.com/choffmann/chat-room/internal/model"
 	"github.com/gorilla/mux"
 )
 
+type RoomStats struct {
+	ID              uint  `json:"id" example:"1"`
+	UserCount       int   `json:"onlineUser" example:"3"`
+	MessageCount    int   `json:"messageCount" example:"42"`
+	StoredBytes     int   `json:"storedBytes" example:"18432"`
+	MaxStoredBytes  int   `json:"maxStoredBytes" example:"16777216"`
+	SlowMode        bool  `json:"slowMode" example:"false"`
+	DroppedMessages int64 `json:"droppedMessages" example:"0"`
+} // @name RoomStats
+
+type RoomLimitResponse struct {
+	Error    string `json:"error" example:"room limit reached"`
+	Rooms    int    `json:"rooms" example:"1000"`
+	MaxRooms int    `json:"maxRooms" example:"1000"`
+} // @name RoomLimitResponse
+
 // createRoomHandler godoc
 // @Summary      Create a new room
-// @Description  Creates a new chat room. The request body is optional and can carry additional metadata that will be echoed back when the room is queried. If the JSON payload cannot be decoded, an empty additionalInfo is used instead.
+// @Description  Creates a new chat room. The request body is optional and can carry additional metadata that will be echoed back when the room is queried. If the JSON payload cannot be decoded, an empty additionalInfo is used instead. An optional `slug` must be unique across rooms. With `MAX_ROOMS_PER_OWNER` set, an `ownerId` may only have that many rooms open at once; rooms without an `ownerId` aren't limited. With `REQUIRE_ROOM_NAME` set, rooms without a non-empty `name` are rejected with `422`.
 // @Tags         rooms
 // @Accept       json
 // @Produce      json
-// @Param        body  body      CreateRoomRequestDoc  false  "Optional room metadata (arbitrary JSON object)"
-// @Success      200   {object}  CreateRoomResponse
+// @Param        body             body      CreateRoomRequestDoc  false  "Optional room metadata (arbitrary JSON object)"
+// @Param        Idempotency-Key  header    string                false  "Repeated requests with the same key return the originally created room"
+// @Success      200              {object}  CreateRoomResponse
+// @Failure      400              {string}  string  "slug must be a non-empty string"
+// @Failure      409              {string}  string  "slug already in use"
+// @Failure      413              {string}  string  "additionalInfo too large"
+// @Failure      422              {object}  ValidationErrorResponse
+// @Failure      429              {string}  string  "too many requests or too many rooms for this owner"
+// @Failure      503              {object}  RoomLimitResponse
 // @Router       /rooms [post]
 func (h *Handler) createRoomHandler(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
@@ -26,22 +52,57 @@ func (h *Handler) createRoomHandler(w http.ResponseWriter, r *http.Request) {
 		h.logger.Warn("failed to decode additional room info", "remoteAddr", r.RemoteAddr, "error", err)
 		additionalInfo = map[string]any{}
 	}
-	room := h.hub.CreateRoom(additionalInfo)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]uint{"roomID": room.ID()})
+	if !h.validateInfo(w, r, h.schemas.Room, additionalInfo) {
+		return
+	}
+	if !h.validateRoom(w, r, additionalInfo) {
+		return
+	}
+	room, err := h.hub.CreateRoom(additionalInfo)
+	if errors.Is(err, chat.ErrTooManyRooms) {
+		count, limit := h.hub.RoomLimit()
+		h.logger.Warn("room limit reached, rejecting room creation", "rooms", count, "maxRooms", limit, "remoteAddr", r.RemoteAddr)
+		writeJSON(w, r, http.StatusServiceUnavailable, RoomLimitResponse{
+			Error:    err.Error(),
+			Rooms:    count,
+			MaxRooms: limit,
+		})
+		return
+	}
+	if errors.Is(err, chat.ErrTooManyOwnerRooms) {
+		h.logger.Warn("owner room limit reached, rejecting room creation", "ownerID", additionalInfo["ownerId"], "remoteAddr", r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		h.writeSlugError(w, r, 0, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, map[string]uint{"roomID": room.ID()})
 }
 
 // getAllRoomsHandler godoc
 // @Summary      List all rooms
-// @Description  Retrieves all currently active rooms with user counts and metadata.
+// @Description  Retrieves all currently active rooms with user counts and metadata. `minUsers` and `maxUsers` limit the list to rooms whose online user count lies in that range, e.g. to find rooms with space left.
 // @Tags         rooms
 // @Produce      json
-// @Success      200  {object}  RoomsListResponse
+// @Param        minUsers  query     int     false  "Minimum number of online users"
+// @Param        maxUsers  query     int     false  "Maximum number of online users"
+// @Success      200       {object}  RoomsListResponse
+// @Failure      400       {string}  string  "minUsers must not be greater than maxUsers"
 // @Router       /rooms [get]
 func (h *Handler) getAllRoomsHandler(w http.ResponseWriter, r *http.Request) {
-	rooms := h.hub.GetAllRoomIDs()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string][]model.RoomResponse{"rooms": rooms})
+	minUsers, maxUsers, err := parseUserRange(r)
+	if err != nil {
+		h.logger.Warn("invalid occupancy range for listing rooms", "query", r.URL.RawQuery, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rooms := slices.DeleteFunc(h.hub.GetAllRoomIDs(), func(room model.RoomResponse) bool {
+		return room.UserCount < minUsers || (maxUsers >= 0 && room.UserCount > maxUsers)
+	})
+	writeJSON(w, r, http.StatusOK, map[string][]model.RoomResponse{"rooms": rooms})
 }
 
 // getRoomIDHandler godoc
@@ -75,13 +136,12 @@ func (h *Handler) getRoomIDHandler(w http.ResponseWriter, r *http.Request) {
 		UserCount:      room.GetClientCount(),
 		AdditionalInfo: room.GetAdditionalInfo(),
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(payload)
+	writeJSON(w, r, http.StatusOK, payload)
 }
 
 // patchRoomHandler godoc
 // @Summary      Partially update room metadata
-// @Description  Partially updates room metadata. The provided fields are merged with existing additionalInfo, preserving fields not included in the request.
+// @Description  Partially updates room metadata. The provided fields are merged with existing additionalInfo, preserving fields not included in the request. Changing `slug` fails with 409 if another room uses it, without applying any of the other fields; a `null` slug removes it. An `ownerId` in the body is ignored; the room keeps the owner it was created with. With `REQUIRE_ROOM_NAME` set, an update that would leave the room without a non-empty `name` is rejected with `422`. Connected clients receive a `room_updated` event with the new additionalInfo.
 // @Tags         rooms
 // @Accept       json
 // @Produce      json
@@ -90,6 +150,9 @@ func (h *Handler) getRoomIDHandler(w http.ResponseWriter, r *http.Request) {
 // @Success      200     {object}  RoomResponseDoc
 // @Failure      400     {string}  string  "invalid request body"
 // @Failure      404     {string}  string  "room not found"
+// @Failure      409     {string}  string  "slug already in use"
+// @Failure      413     {string}  string  "additionalInfo too large"
+// @Failure      422     {object}  ValidationErrorResponse
 // @Router       /rooms/{roomID} [patch]
 func (h *Handler) patchRoomHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -116,20 +179,37 @@ func (h *Handler) patchRoomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room.PatchAdditionalInfo(updates)
+	current := room.GetAdditionalInfo()
+	updates = keepOwner(current, updates)
+	merged := mergeInfo(current, updates)
+	if slug, ok := updates["slug"]; ok && slug == nil {
+		delete(merged, "slug")
+	}
+	if !h.validateInfo(w, r, h.schemas.Room, merged) {
+		return
+	}
+	if !h.validateRoom(w, r, merged) {
+		return
+	}
+
+	if err := h.hub.PatchRoomInfo(room, updates); err != nil {
+		h.writeSlugError(w, r, room.ID(), err)
+		return
+	}
 	h.logger.Info("room patched", "roomID", roomID)
+	room.BroadcastInfo()
 
 	payload := model.RoomResponse{
 		ID:             room.ID(),
+		UserCount:      room.GetClientCount(),
 		AdditionalInfo: room.GetAdditionalInfo(),
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(payload)
+	writeJSON(w, r, http.StatusOK, payload)
 }
 
 // putRoomHandler godoc
 // @Summary      Replace room metadata
-// @Description  Replaces all room metadata. This completely overwrites the existing additionalInfo.
+// @Description  Replaces all room metadata. This completely overwrites the existing additionalInfo. A `slug` already used by another room fails with 409 and leaves the room unchanged. The room keeps the `ownerId` it was created with, whatever the body says. With `REQUIRE_ROOM_NAME` set, the new metadata must include a non-empty `name`, or the request fails with `422`. Connected clients receive a `room_updated` event with the new additionalInfo.
 // @Tags         rooms
 // @Accept       json
 // @Produce      json
@@ -138,6 +218,9 @@ func (h *Handler) patchRoomHandler(w http.ResponseWriter, r *http.Request) {
 // @Success      200     {object}  RoomResponseDoc
 // @Failure      400     {string}  string  "invalid request body"
 // @Failure      404     {string}  string  "room not found"
+// @Failure      409     {string}  string  "slug already in use"
+// @Failure      413     {string}  string  "additionalInfo too large"
+// @Failure      422     {object}  ValidationErrorResponse
 // @Router       /rooms/{roomID} [put]
 func (h *Handler) putRoomHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -163,14 +246,79 @@ func (h *Handler) putRoomHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	newInfo = keepOwner(room.GetAdditionalInfo(), newInfo)
+
+	if !h.validateInfo(w, r, h.schemas.Room, newInfo) {
+		return
+	}
+	if !h.validateRoom(w, r, newInfo) {
+		return
+	}
 
-	room.UpdateAdditionalInfo(newInfo)
+	if err := h.hub.ReplaceRoomInfo(room, newInfo); err != nil {
+		h.writeSlugError(w, r, room.ID(), err)
+		return
+	}
 	h.logger.Info("room updated", "roomID", roomID)
+	room.BroadcastInfo()
 
 	payload := model.RoomResponse{
 		ID:             room.ID(),
+		UserCount:      room.GetClientCount(),
 		AdditionalInfo: room.GetAdditionalInfo(),
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(payload)
+	writeJSON(w, r, http.StatusOK, payload)
+}
+
+// getRoomStatsHandler godoc
+// @Summary      Get room statistics
+// @Description  Returns usage figures for a room. storedBytes is the JSON size of the stored message history; once it exceeds maxStoredBytes the oldest messages are evicted. A maxStoredBytes of 0 means the history is unlimited. slowMode is true while the room rejects client messages because it was flooded. droppedMessages counts broadcasts that were dropped for clients whose send buffer was full.
+// @Tags         rooms
+// @Produce      json
+// @Param        roomID  path      int  true  "Room ID"
+// @Success      200     {object}  RoomStats
+// @Failure      400     {string}  string  "can't parse room id to uint"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/stats [get]
+func (h *Handler) getRoomStatsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["roomID"], 10, 64)
+	if err != nil {
+		h.logger.Warn("invalid room id for stats", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "can't parse room id to uint", http.StatusBadRequest)
+		return
+	}
+
+	room, ok := h.hub.GetRoom(uint(roomID))
+	if !ok {
+		h.logger.Warn("room not found for stats", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	stats := RoomStats{
+		ID:              room.ID(),
+		UserCount:       room.GetClientCount(),
+		MessageCount:    room.GetMessageCount(),
+		StoredBytes:     room.StoredBytes(),
+		MaxStoredBytes:  room.MaxStoredBytes(),
+		SlowMode:        room.SlowMode(),
+		DroppedMessages: room.DroppedMessages(),
+	}
+	writeJSON(w, r, http.StatusOK, stats)
+}
+
+// writeSlugError maps slug index errors from the hub to HTTP responses.
+func (h *Handler) writeSlugError(w http.ResponseWriter, r *http.Request, roomID uint, err error) {
+	switch {
+	case errors.Is(err, chat.ErrSlugTaken):
+		h.logger.Warn("room slug already in use", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, chat.ErrInvalidSlug):
+		h.logger.Warn("invalid room slug", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error("failed to update room", "roomID", roomID, "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
 }
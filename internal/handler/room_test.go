@@ -3,11 +3,18 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/choffmann/chat-room/internal/chat"
 	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -82,11 +89,169 @@ func TestCreateRoomInvalidJSON(t *testing.T) {
 	}
 }
 
+func TestCreateRoomRequireName(t *testing.T) {
+	h := setupHandler(t)
+	h.AddRoomValidator(RequireRoomName)
+
+	for _, body := range []string{`{}`, `{"name":"  "}`, `{"name":42}`, "invalid json"} {
+		req := httptest.NewRequest("POST", "/rooms", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		h.createRoomHandler(w, req)
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status %d, got %d", body, http.StatusUnprocessableEntity, w.Code)
+			continue
+		}
+		var response ValidationErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(response.Violations) != 1 || response.Violations[0] != "/name: is required" {
+			t.Errorf("%s: unexpected violations %v", body, response.Violations)
+		}
+	}
+	if ids := h.hub.GetAllRoomIDs(); len(ids) != 0 {
+		t.Errorf("expected no rooms to be created, got %d", len(ids))
+	}
+
+	req := httptest.NewRequest("POST", "/rooms", bytes.NewBufferString(`{"name":"Lobby"}`))
+	w := httptest.NewRecorder()
+	h.createRoomHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestUpdateRoomRequireName(t *testing.T) {
+	h := setupHandler(t)
+	h.AddRoomValidator(RequireRoomName)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	room, _ := h.hub.CreateRoom(model.AdditionalInfo{"name": "Lobby"})
+	path := fmt.Sprintf("/api/v1/rooms/%d", room.ID())
+
+	tests := []struct {
+		method string
+		body   string
+		want   int
+	}{
+		{http.MethodPatch, `{"name": null}`, http.StatusUnprocessableEntity},
+		{http.MethodPatch, `{"name": "  "}`, http.StatusUnprocessableEntity},
+		{http.MethodPut, `{"topic": "news"}`, http.StatusUnprocessableEntity},
+		{http.MethodPatch, `{"topic": "news"}`, http.StatusOK},
+		{http.MethodPut, `{"name": "Hall"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := doJSON(r, tt.method, path, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.body, tt.want, w.Code)
+		}
+		if name, _ := room.GetAdditionalInfo()["name"].(string); name == "" {
+			t.Fatalf("%s %s: left the room without a name", tt.method, tt.body)
+		}
+	}
+	if name := room.GetAdditionalInfo()["name"]; name != "Hall" {
+		t.Errorf("expected the room to be renamed to Hall, got %v", name)
+	}
+}
+
+func TestCreateRoomLimit(t *testing.T) {
+	h := setupHandler(t)
+	h.hub.SetMaxRooms(1)
+
+	create := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/rooms", bytes.NewBufferString("{}"))
+		w := httptest.NewRecorder()
+		h.createRoomHandler(w, req)
+		return w
+	}
+
+	if w := create(); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w := create()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	var response RoomLimitResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Rooms != 1 || response.MaxRooms != 1 {
+		t.Errorf("expected rooms=1 maxRooms=1, got %+v", response)
+	}
+}
+
+func TestCreateRoomOwnerLimit(t *testing.T) {
+	h := setupHandler(t)
+	h.hub.SetMaxRoomsPerOwner(2)
+
+	create := func(body string) int {
+		req := httptest.NewRequest("POST", "/rooms", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		h.createRoomHandler(w, req)
+		return w.Code
+	}
+
+	for range 2 {
+		if code := create(`{"ownerId":"alice"}`); code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+		}
+	}
+	if code := create(`{"ownerId":"alice"}`); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d for a third room, got %d", http.StatusTooManyRequests, code)
+	}
+	if code := create(`{"ownerId":"bob"}`); code != http.StatusOK {
+		t.Errorf("expected other owners to be unaffected, got %d", code)
+	}
+	if code := create(`{}`); code != http.StatusOK {
+		t.Errorf("expected rooms without owner to be unaffected, got %d", code)
+	}
+}
+
+func TestUpdateRoomKeepsOwner(t *testing.T) {
+	h := setupHandler(t)
+	h.hub.SetMaxRoomsPerOwner(1)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	owned, _ := h.hub.CreateRoom(model.AdditionalInfo{"ownerId": "alice"})
+	unowned, _ := h.hub.CreateRoom(nil)
+
+	tests := []struct {
+		method string
+		room   *chat.Room
+		body   string
+		want   any
+	}{
+		{http.MethodPatch, owned, `{"ownerId": "bob"}`, "alice"},
+		{http.MethodPatch, owned, `{"ownerId": null}`, "alice"},
+		{http.MethodPut, owned, `{"name": "renamed"}`, "alice"},
+		{http.MethodPut, owned, `{"ownerId": "bob"}`, "alice"},
+		{http.MethodPatch, unowned, `{"ownerId": "carol"}`, nil},
+		{http.MethodPut, unowned, `{"ownerId": "carol"}`, nil},
+	}
+	for _, tt := range tests {
+		path := fmt.Sprintf("/api/v1/rooms/%d", tt.room.ID())
+		if w := doJSON(r, tt.method, path, tt.body); w.Code != http.StatusOK {
+			t.Fatalf("%s %s %s: expected %d, got %d", tt.method, path, tt.body, http.StatusOK, w.Code)
+		}
+		if got := tt.room.GetAdditionalInfo()["ownerId"]; got != tt.want {
+			t.Errorf("%s %s %s: expected ownerId %v, got %v", tt.method, path, tt.body, tt.want, got)
+		}
+	}
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/rooms", `{"ownerId": "alice"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected alice to still be at the room limit, got %d", w.Code)
+	}
+}
+
 func TestGetAllRooms(t *testing.T) {
 	h := setupHandler(t)
 
-	room1 := h.hub.CreateRoom(model.AdditionalInfo{"name": "Room 1"})
-	room2 := h.hub.CreateRoom(model.AdditionalInfo{"name": "Room 2"})
+	room1, _ := h.hub.CreateRoom(model.AdditionalInfo{"name": "Room 1"})
+	room2, _ := h.hub.CreateRoom(model.AdditionalInfo{"name": "Room 2"})
 
 	close(room1.Shutdown())
 	close(room2.Shutdown())
@@ -119,10 +284,62 @@ func TestGetAllRooms(t *testing.T) {
 	}
 }
 
+func TestGetAllRoomsOccupancyRange(t *testing.T) {
+	h := setupHandler(t)
+	empty := newRunningRoom(t, h)
+	single := newRunningRoom(t, h)
+	pair := newRunningRoom(t, h)
+	connectTestClient(t, h, single, model.User{ID: uuid.New(), Name: "alice"})
+	connectTestClient(t, h, pair, model.User{ID: uuid.New(), Name: "bob"})
+	connectTestClient(t, h, pair, model.User{ID: uuid.New(), Name: "carol"})
+
+	tests := []struct {
+		query          string
+		expectedStatus int
+		expectedIDs    []uint
+	}{
+		{"", http.StatusOK, []uint{empty.ID(), single.ID(), pair.ID()}},
+		{"minUsers=1", http.StatusOK, []uint{single.ID(), pair.ID()}},
+		{"maxUsers=1", http.StatusOK, []uint{empty.ID(), single.ID()}},
+		{"minUsers=1&maxUsers=1", http.StatusOK, []uint{single.ID()}},
+		{"minUsers=3", http.StatusOK, []uint{}},
+		{"minUsers=2&maxUsers=1", http.StatusBadRequest, nil},
+		{"minUsers=-1", http.StatusBadRequest, nil},
+		{"maxUsers=many", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/rooms?"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			h.getAllRoomsHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var response map[string][]model.RoomResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			ids := []uint{}
+			for _, room := range response["rooms"] {
+				ids = append(ids, room.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.expectedIDs) {
+				t.Errorf("expected rooms %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
 func TestGetRoomByID(t *testing.T) {
 	h := setupHandler(t)
 
-	room := h.hub.CreateRoom(model.AdditionalInfo{"name": "Test Room"})
+	room, _ := h.hub.CreateRoom(model.AdditionalInfo{"name": "Test Room"})
 	close(room.Shutdown())
 
 	tests := []struct {
@@ -176,7 +393,7 @@ func TestGetRoomByID(t *testing.T) {
 func TestPatchRoom(t *testing.T) {
 	h := setupHandler(t)
 
-	room := h.hub.CreateRoom(model.AdditionalInfo{"name": "Original Name", "description": "Original"})
+	room, _ := h.hub.CreateRoom(model.AdditionalInfo{"name": "Original Name", "description": "Original"})
 	close(room.Shutdown())
 
 	tests := []struct {
@@ -238,7 +455,7 @@ func TestPatchRoom(t *testing.T) {
 func TestPutRoom(t *testing.T) {
 	h := setupHandler(t)
 
-	room := h.hub.CreateRoom(model.AdditionalInfo{"name": "Original Name", "description": "Original"})
+	room, _ := h.hub.CreateRoom(model.AdditionalInfo{"name": "Original Name", "description": "Original"})
 	close(room.Shutdown())
 
 	tests := []struct {
@@ -299,3 +516,187 @@ func TestPutRoom(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRoomStats(t *testing.T) {
+	h := setupHandler(t)
+	h.hub.SetMessageByteBudget(4096)
+
+	room, _ := h.hub.CreateRoom(nil)
+	close(room.Shutdown())
+	room.StoreMessage(model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hello"})
+
+	req := httptest.NewRequest("GET", "/rooms/1/stats", nil)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "1"})
+	w := httptest.NewRecorder()
+
+	h.getRoomStatsHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var stats RoomStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if stats.MessageCount != 1 {
+		t.Errorf("expected 1 message, got %d", stats.MessageCount)
+	}
+	if stats.StoredBytes <= 0 || stats.StoredBytes != room.StoredBytes() {
+		t.Errorf("expected storedBytes %d, got %d", room.StoredBytes(), stats.StoredBytes)
+	}
+	if stats.MaxStoredBytes != 4096 {
+		t.Errorf("expected maxStoredBytes 4096, got %d", stats.MaxStoredBytes)
+	}
+}
+
+func TestPatchRoomSlugConflict(t *testing.T) {
+	h := setupHandler(t)
+
+	taken, _ := h.hub.CreateRoom(model.AdditionalInfo{"slug": "general"})
+	defer close(taken.Shutdown())
+	room, _ := h.hub.CreateRoom(model.AdditionalInfo{"slug": "random", "theme": "dark"})
+	defer close(room.Shutdown())
+
+	body := bytes.NewBufferString(`{"slug": "general", "theme": "light"}`)
+	req := httptest.NewRequest("PATCH", "/rooms/2", body)
+	req = mux.SetURLVars(req, map[string]string{"roomID": "2"})
+	w := httptest.NewRecorder()
+
+	h.patchRoomHandler(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	if info := room.GetAdditionalInfo(); info["slug"] != "random" || info["theme"] != "dark" {
+		t.Errorf("expected room to be unchanged, got %v", info)
+	}
+
+	req = httptest.NewRequest("POST", "/rooms", bytes.NewBufferString(`{"slug": "general"}`))
+	w = httptest.NewRecorder()
+	h.createRoomHandler(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected create with taken slug to return %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestCreateRoomConcurrentSlug(t *testing.T) {
+	h := setupHandler(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	const creates = 50
+	codes := make(chan int, creates)
+	var wg sync.WaitGroup
+	for range creates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- doJSON(r, http.MethodPost, "/api/v1/rooms", `{"slug": "general"}`).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	var created, conflicts int
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if created != 1 || conflicts != creates-1 {
+		t.Errorf("expected 1 created and %d conflicts, got %d and %d", creates-1, created, conflicts)
+	}
+	if rooms := h.hub.GetAllRoomIDs(); len(rooms) != 1 {
+		t.Errorf("expected 1 room, got %d", len(rooms))
+	}
+	if room, ok := h.hub.GetRoomBySlug("general"); ok {
+		defer close(room.Shutdown())
+	}
+}
+
+func TestRoomResponsesReportUserCount(t *testing.T) {
+	h := setupHandler(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	room := newRunningRoom(t, h)
+	connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "alice"})
+	connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "bob"})
+	path := "/api/v1/rooms/" + strconv.FormatUint(uint64(room.ID()), 10)
+
+	for _, tt := range []struct{ method, body string }{
+		{http.MethodGet, ""},
+		{http.MethodPatch, `{"name":"patched"}`},
+		{http.MethodPut, `{"name":"replaced"}`},
+	} {
+		w := doJSON(r, tt.method, path, tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d", tt.method, http.StatusOK, w.Code)
+		}
+		var resp model.RoomResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode: %v", tt.method, err)
+		}
+		if resp.UserCount != 2 {
+			t.Errorf("%s: expected 2 online users, got %d", tt.method, resp.UserCount)
+		}
+	}
+}
+
+func TestRoomUpdateBroadcast(t *testing.T) {
+	h := setupHandler(t)
+	room := newRunningRoom(t, h)
+	listener := connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "listener"})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	path := fmt.Sprintf("/api/v1/rooms/%d", room.ID())
+
+	tests := []struct {
+		method string
+		body   string
+		want   model.AdditionalInfo
+	}{
+		{http.MethodPatch, `{"theme":"dark"}`, model.AdditionalInfo{"theme": "dark"}},
+		{http.MethodPut, `{"description":"new"}`, model.AdditionalInfo{"description": "new"}},
+	}
+
+	for _, tt := range tests {
+		if w := doJSON(r, tt.method, path, tt.body); w.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d", tt.method, http.StatusOK, w.Code)
+		}
+		event := nextRoomUpdate(t, listener)
+		if !reflect.DeepEqual(event.AdditionalInfo, tt.want) {
+			t.Errorf("%s: expected room_updated with %v, got %v", tt.method, tt.want, event.AdditionalInfo)
+		}
+	}
+
+	if room.GetMessageCount() != 0 {
+		t.Errorf("expected room updates not to be stored, got %d messages", room.GetMessageCount())
+	}
+}
+
+// nextRoomUpdate returns the next room_updated event sent to c, skipping
+// other events such as occupancy updates.
+func nextRoomUpdate(t *testing.T, c *chat.Client) model.OutgoingMessage {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case b := <-c.Send():
+			var event model.OutgoingMessage
+			if err := json.Unmarshal(b, &event); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if event.MessageType == model.RoomUpdated {
+				return event
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for room_updated event")
+		}
+	}
+}
@@ -2,38 +2,155 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/choffmann/chat-room/internal/model"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// validateAppearance checks the styling fields of a user. Empty values are
+// allowed and clear the field.
+func validateAppearance(color, avatarURL string) error {
+	if color != "" && !hexColorPattern.MatchString(color) {
+		return errors.New("color must be a hex color like #1e90ff")
+	}
+	if avatarURL != "" {
+		u, err := url.Parse(avatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("avatarUrl must be an absolute http or https URL")
+		}
+	}
+	return nil
+}
+
+// SetMaxNameLength turns on validation of the name fields of users: they are
+// trimmed, must not contain control characters and must not be longer than n
+// characters. 0 turns the validation off.
+func (h *Handler) SetMaxNameLength(n int) {
+	h.maxNameLength = max(n, 0)
+}
+
+// normalizeNames trims the given name fields in place and validates them
+// against the configured maximum length. It does nothing while validation is
+// off.
+func (h *Handler) normalizeNames(firstName, lastName, name *string) error {
+	if h.maxNameLength == 0 {
+		return nil
+	}
+	for _, f := range []struct {
+		field string
+		value *string
+	}{{"firstName", firstName}, {"lastName", lastName}, {"name", name}} {
+		*f.value = strings.TrimSpace(*f.value)
+		if strings.ContainsFunc(*f.value, unicode.IsControl) {
+			return fmt.Errorf("%s must not contain control characters", f.field)
+		}
+		if utf8.RuneCountInString(*f.value) > h.maxNameLength {
+			return fmt.Errorf("%s must not be longer than %d characters", f.field, h.maxNameLength)
+		}
+	}
+	return nil
+}
+
+// normalizePatchNames applies normalizeNames to the name fields present in a
+// patch request.
+func (h *Handler) normalizePatchNames(updates map[string]any) error {
+	if h.maxNameLength == 0 {
+		return nil
+	}
+	var names [3]string
+	keys := [3]string{"firstName", "lastName", "name"}
+	for i, key := range keys {
+		if v, ok := updates[key]; ok {
+			if names[i], ok = v.(string); !ok {
+				return fmt.Errorf("%s must be a string", key)
+			}
+		}
+	}
+	if err := h.normalizeNames(&names[0], &names[1], &names[2]); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if _, ok := updates[key]; ok {
+			updates[key] = names[i]
+		}
+	}
+	return nil
+}
+
+type UsersPageResponse struct {
+	Users   []*model.User `json:"users"`
+	Total   int           `json:"total"`
+	HasMore bool          `json:"hasMore"`
+}
+
 // getAllUsersHandler godoc
 // @Summary      List all registered users
-// @Description  Returns all users registered in the user registry. Returns an empty array if no users are registered.
+// @Description  Returns users registered in the user registry ordered by creation time, one page at a time. `total` is the number of users matching the filter, `hasMore` tells whether another page exists.
 // @Tags         users
 // @Produce      json
-// @Success      200  {array}  UserDoc
+// @Param        limit   query     int     false  "Maximum number of users to return (default 100, max 500)"
+// @Param        offset  query     int     false  "Number of users to skip"
+// @Param        q       query     string  false  "Case-insensitive substring filter over name, firstName and lastName"
+// @Success      200     {object}  UsersPageResponseDoc
+// @Failure      400     {string}  string  "invalid limit or offset"
 // @Router       /users [get]
 func (h *Handler) getAllUsersHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		h.logger.Warn("invalid pagination for listing users", "query", r.URL.RawQuery, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	users := h.userRegistry.GetAllUsers()
-	if users == nil {
-		users = make([]*model.User, 0)
+
+	if q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q"))); q != "" {
+		users = slices.DeleteFunc(users, func(u *model.User) bool {
+			return !strings.Contains(strings.ToLower(u.Name), q) &&
+				!strings.Contains(strings.ToLower(u.FirstName), q) &&
+				!strings.Contains(strings.ToLower(u.LastName), q)
+		})
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+
+	total := len(users)
+	start := min(offset, total)
+	end := min(start+limit, total)
+
+	page := make([]*model.User, 0, end-start)
+	page = append(page, users[start:end]...)
+
+	writeJSON(w, r, http.StatusOK, UsersPageResponse{
+		Users:   page,
+		Total:   total,
+		HasMore: end < total,
+	})
 }
 
 // createUserHandler godoc
 // @Summary      Create a user
-// @Description  Creates a new user in the user registry. All fields are optional. This allows pre-registering users before they join rooms.
+// @Description  Creates a new user in the user registry. All fields are optional. This allows pre-registering users before they join rooms. `color` (hex, e.g. `#1e90ff`) and `avatarUrl` are carried in the user of every message they send.
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        body  body      CreateUserRequestDoc  true  "User data"
-// @Success      201   {object}  UserDoc
-// @Failure      400   {string}  string  "invalid request body"
+// @Param        body             body      CreateUserRequestDoc  true   "User data"
+// @Param        Idempotency-Key  header    string                false  "Repeated requests with the same key return the originally created user"
+// @Success      201              {object}  UserDoc
+// @Failure      400              {string}  string  "invalid request body, name, color or avatarUrl"
+// @Failure      413              {string}  string  "additionalInfo too large"
+// @Failure      422              {object}  ValidationErrorResponse
+// @Failure      429              {string}  string  "too many requests"
 // @Router       /users [post]
 func (h *Handler) createUserHandler(w http.ResponseWriter, r *http.Request) {
 	var req model.CreateUserRequest
@@ -43,11 +160,25 @@ func (h *Handler) createUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := h.userRegistry.CreateUser(req.FirstName, req.LastName, req.Name, req.AdditionalInfo)
+	if err := h.normalizeNames(&req.FirstName, &req.LastName, &req.Name); err != nil {
+		h.logger.Warn("invalid name for user creation", "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	if err := validateAppearance(req.Color, req.AvatarURL); err != nil {
+		h.logger.Warn("invalid appearance for user creation", "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !h.validateInfo(w, r, h.schemas.User, req.AdditionalInfo) {
+		return
+	}
+
+	user := h.userRegistry.CreateUser(req.FirstName, req.LastName, req.Name, req.Color, req.AvatarURL, req.AdditionalInfo)
+
+	writeJSON(w, r, http.StatusCreated, user)
 }
 
 // getUserHandler godoc
@@ -76,8 +207,7 @@ func (h *Handler) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, r, http.StatusOK, user)
 }
 
 // putUserHandler godoc
@@ -89,8 +219,10 @@ func (h *Handler) getUserHandler(w http.ResponseWriter, r *http.Request) {
 // @Param        userID  path      string                  true  "User UUID"
 // @Param        body    body      UpdateUserRequestDoc  true  "New user data"
 // @Success      200     {object}  UserDoc
-// @Failure      400     {string}  string  "invalid user id or request body"
+// @Failure      400     {string}  string  "invalid user id, request body, name, color or avatarUrl"
 // @Failure      404     {string}  string  "user not found"
+// @Failure      413     {string}  string  "additionalInfo too large"
+// @Failure      422     {object}  ValidationErrorResponse
 // @Router       /users/{userID} [put]
 func (h *Handler) putUserHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -108,15 +240,30 @@ func (h *Handler) putUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, ok := h.userRegistry.UpdateUser(userID, req.FirstName, req.LastName, req.Name, req.AdditionalInfo)
+	if err := h.normalizeNames(&req.FirstName, &req.LastName, &req.Name); err != nil {
+		h.logger.Warn("invalid name for user update", "userID", userID, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateAppearance(req.Color, req.AvatarURL); err != nil {
+		h.logger.Warn("invalid appearance for user update", "userID", userID, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !h.validateInfo(w, r, h.schemas.User, req.AdditionalInfo) {
+		return
+	}
+
+	user, ok := h.userRegistry.UpdateUser(userID, req.FirstName, req.LastName, req.Name, req.Color, req.AvatarURL, req.AdditionalInfo)
 	if !ok {
 		h.logger.Warn("user not found for update", "userID", userID, "remoteAddr", r.RemoteAddr)
 		http.Error(w, "user not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, r, http.StatusOK, user)
 }
 
 // patchUserHandler godoc
@@ -128,8 +275,10 @@ func (h *Handler) putUserHandler(w http.ResponseWriter, r *http.Request) {
 // @Param        userID  path      string  true  "User UUID"
 // @Param        body    body      PatchUserRequestDoc  true  "Fields to update"
 // @Success      200     {object}  UserDoc
-// @Failure      400     {string}  string  "invalid user id or request body"
+// @Failure      400     {string}  string  "invalid user id, request body, name, color or avatarUrl"
 // @Failure      404     {string}  string  "user not found"
+// @Failure      413     {string}  string  "additionalInfo too large"
+// @Failure      422     {object}  ValidationErrorResponse
 // @Router       /users/{userID} [patch]
 func (h *Handler) patchUserHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -147,6 +296,30 @@ func (h *Handler) patchUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.normalizePatchNames(updates); err != nil {
+		h.logger.Warn("invalid name for user patch", "userID", userID, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePatchAppearance(updates); err != nil {
+		h.logger.Warn("invalid appearance for user patch", "userID", userID, "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if info, ok := updates["additionalInfo"].(map[string]any); ok {
+		current, ok := h.userRegistry.GetUser(userID)
+		if !ok {
+			h.logger.Warn("user not found for patch", "userID", userID, "remoteAddr", r.RemoteAddr)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		if !h.validateInfo(w, r, h.schemas.User, mergeInfo(current.AdditionalInfo, info)) {
+			return
+		}
+	}
+
 	user, ok := h.userRegistry.PatchUser(userID, updates)
 	if !ok {
 		h.logger.Warn("user not found for patch", "userID", userID, "remoteAddr", r.RemoteAddr)
@@ -154,8 +327,24 @@ func (h *Handler) patchUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, r, http.StatusOK, user)
+}
+
+// validatePatchAppearance validates the color and avatarUrl of a patch
+// request, if present.
+func validatePatchAppearance(updates map[string]any) error {
+	var color, avatarURL string
+	if v, ok := updates["color"]; ok {
+		if color, ok = v.(string); !ok {
+			return errors.New("color must be a string")
+		}
+	}
+	if v, ok := updates["avatarUrl"]; ok {
+		if avatarURL, ok = v.(string); !ok {
+			return errors.New("avatarUrl must be a string")
+		}
+	}
+	return validateAppearance(color, avatarURL)
 }
 
 // deleteUserHandler godoc
@@ -187,10 +376,11 @@ func (h *Handler) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 
 // getRoomUsersHandler godoc
 // @Summary      Get users in a room
-// @Description  Returns all users currently connected to a specific room.
+// @Description  Returns all users currently connected to a specific room. With `role` only users whose `additionalInfo.role` equals it are returned; no match yields an empty list.
 // @Tags         rooms
 // @Produce      json
-// @Param        roomID  path      int  true  "Room ID"
+// @Param        roomID  path      int     true   "Room ID"
+// @Param        role    query     string  false  "Only return users with this additionalInfo.role"
 // @Success      200     {object}  UsersListResponse
 // @Failure      400     {string}  string  "invalid room id"
 // @Failure      404     {string}  string  "room not found"
@@ -212,8 +402,45 @@ func (h *Handler) getRoomUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	users := room.GetUsers()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string][]model.User{"users": users})
+	if role := r.URL.Query().Get("role"); role != "" {
+		users = slices.DeleteFunc(users, func(u model.User) bool {
+			return u.AdditionalInfo["role"] != role
+		})
+	}
+	writeJSON(w, r, http.StatusOK, map[string][]model.User{"users": users})
+}
+
+type UserCountResponse struct {
+	Count int `json:"count" example:"3"`
+} // @name UserCountResponse
+
+// getRoomUserCountHandler godoc
+// @Summary      Count users in a room
+// @Description  Returns the number of connections in a room without building the user list, for badges and lobby views that poll often.
+// @Tags         rooms
+// @Produce      json
+// @Param        roomID  path      int  true  "Room ID"
+// @Success      200     {object}  UserCountResponse
+// @Failure      400     {string}  string  "invalid room id"
+// @Failure      404     {string}  string  "room not found"
+// @Router       /rooms/{roomID}/users/count [get]
+func (h *Handler) getRoomUserCountHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID, err := model.ParseRoomID(vars["roomID"])
+	if err != nil {
+		h.logger.Warn("invalid room id for user count", "roomID", vars["roomID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid room id", http.StatusBadRequest)
+		return
+	}
+
+	room, ok := h.hub.GetRoom(roomID)
+	if !ok {
+		h.logger.Warn("room not found for user count", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, UserCountResponse{Count: room.GetClientCount()})
 }
 
 // getAllUsersInRoomsHandler godoc
@@ -225,6 +452,46 @@ func (h *Handler) getRoomUsersHandler(w http.ResponseWriter, r *http.Request) {
 // @Router       /rooms/users [get]
 func (h *Handler) getAllUsersInRoomsHandler(w http.ResponseWriter, r *http.Request) {
 	usersWithRooms := h.hub.GetAllUsersWithRooms()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string][]model.UserWithRoom{"users": usersWithRooms})
+	writeJSON(w, r, http.StatusOK, map[string][]model.UserWithRoom{"users": usersWithRooms})
+}
+
+// getUserRoomsHandler godoc
+// @Summary      List a user's rooms
+// @Description  Returns the rooms the user is currently connected to. The list is empty if the user isn't connected anywhere.
+// @Tags         users
+// @Produce      json
+// @Param        userID  path      string  true  "User UUID"
+// @Success      200     {object}  RoomsListResponse
+// @Failure      400     {string}  string  "invalid user id"
+// @Failure      404     {string}  string  "user id not found"
+// @Router       /users/{userID}/rooms [get]
+func (h *Handler) getUserRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := uuid.Parse(vars["userID"])
+	if err != nil {
+		h.logger.Warn("invalid user id for rooms", "userID", vars["userID"], "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := h.userRegistry.GetUser(userID); !ok {
+		h.logger.Warn("user id not found in user registry", "userID", vars["userID"], "remoteAddr", r.RemoteAddr)
+		http.Error(w, "user id not found", http.StatusNotFound)
+		return
+	}
+
+	rooms := h.hub.GetUserRooms(userID)
+	writeJSON(w, r, http.StatusOK, map[string][]model.RoomResponse{"rooms": rooms})
+}
+
+// getOnlineUsersHandler godoc
+// @Summary      List online users
+// @Description  Returns every user connected to at least one room exactly once, with the IDs of all rooms they are in. Use `/rooms/users` for one entry per room membership.
+// @Tags         users
+// @Produce      json
+// @Success      200  {object}  OnlineUsersListResponse
+// @Router       /users/online [get]
+func (h *Handler) getOnlineUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users := h.hub.GetOnlineUsers()
+	writeJSON(w, r, http.StatusOK, map[string][]model.OnlineUser{"users": users})
 }
@@ -3,8 +3,12 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/choffmann/chat-room/internal/chat"
@@ -46,6 +50,25 @@ func TestCreateUser(t *testing.T) {
 			payload:        model.CreateUserRequest{},
 			expectedStatus: http.StatusCreated,
 		},
+		{
+			name: "Create user with appearance",
+			payload: model.CreateUserRequest{
+				Name:      "styled",
+				Color:     "#1E90ff",
+				AvatarURL: "https://example.com/a.png",
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Create user with invalid color",
+			payload:        model.CreateUserRequest{Color: "blue"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Create user with invalid avatar URL",
+			payload:        model.CreateUserRequest{AvatarURL: "/avatars/a.png"},
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -73,6 +96,10 @@ func TestCreateUser(t *testing.T) {
 				if user.FirstName != tt.payload.FirstName {
 					t.Errorf("expected firstName %s, got %s", tt.payload.FirstName, user.FirstName)
 				}
+
+				if user.Color != tt.payload.Color || user.AvatarURL != tt.payload.AvatarURL {
+					t.Errorf("expected appearance %q/%q, got %q/%q", tt.payload.Color, tt.payload.AvatarURL, user.Color, user.AvatarURL)
+				}
 			}
 		})
 	}
@@ -94,7 +121,7 @@ func TestCreateUserInvalidJSON(t *testing.T) {
 func TestPutUser(t *testing.T) {
 	h := setupHandler(t)
 
-	u := h.userRegistry.CreateUser("John", "Doe", "johndoe", nil)
+	u := h.userRegistry.CreateUser("John", "Doe", "johndoe", "", "", nil)
 
 	tests := []struct {
 		name           string
@@ -161,7 +188,7 @@ func TestPutUser(t *testing.T) {
 func TestPatchUser(t *testing.T) {
 	h := setupHandler(t)
 
-	u := h.userRegistry.CreateUser("John", "Doe", "johndoe", model.AdditionalInfo{"role": "user"})
+	u := h.userRegistry.CreateUser("John", "Doe", "johndoe", "", "", model.AdditionalInfo{"role": "user"})
 
 	tests := []struct {
 		name           string
@@ -242,7 +269,7 @@ func TestPatchUser(t *testing.T) {
 func TestGetUser(t *testing.T) {
 	h := setupHandler(t)
 
-	u := h.userRegistry.CreateUser("John", "Doe", "johndoe", model.AdditionalInfo{"email": "john@example.com"})
+	u := h.userRegistry.CreateUser("John", "Doe", "johndoe", "", "", model.AdditionalInfo{"email": "john@example.com"})
 
 	tests := []struct {
 		name           string
@@ -301,10 +328,36 @@ func TestGetUser(t *testing.T) {
 	}
 }
 
+func TestGetUserLastSeen(t *testing.T) {
+	h := setupHandler(t)
+	u := h.userRegistry.CreateUser("", "", "johndoe", "", "", nil)
+
+	get := func() map[string]any {
+		req := httptest.NewRequest("GET", "/users/"+u.ID.String(), nil)
+		req = mux.SetURLVars(req, map[string]string{"userID": u.ID.String()})
+		w := httptest.NewRecorder()
+		h.getUserHandler(w, req)
+		var body map[string]any
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return body
+	}
+
+	if _, ok := get()["lastSeen"]; ok {
+		t.Error("expected lastSeen to be absent for a user never seen")
+	}
+
+	h.userRegistry.UpdateLastSeen(u.ID)
+	if _, ok := get()["lastSeen"].(string); !ok {
+		t.Error("expected lastSeen to be set after activity")
+	}
+}
+
 func TestDeleteUser(t *testing.T) {
 	h := setupHandler(t)
 
-	u := h.userRegistry.CreateUser("John", "Doe", "johndoe", nil)
+	u := h.userRegistry.CreateUser("John", "Doe", "johndoe", "", "", nil)
 
 	tests := []struct {
 		name           string
@@ -349,7 +402,7 @@ func TestGetRoomUsers(t *testing.T) {
 	ur := user.NewRegistry(logger)
 	h := New(hub, ur, logger, nil)
 
-	room := hub.CreateRoom(nil)
+	room, _ := hub.CreateRoom(nil)
 	close(room.Shutdown())
 
 	// We can't directly add clients from outside the chat package,
@@ -410,9 +463,9 @@ func TestGetAllUsers(t *testing.T) {
 		{
 			name: "Get all users with multiple users",
 			setupFunc: func(h *Handler) {
-				h.userRegistry.CreateUser("John", "Doe", "johndoe", model.AdditionalInfo{"role": "admin"})
-				h.userRegistry.CreateUser("Jane", "Smith", "janesmith", nil)
-				h.userRegistry.CreateUser("Bob", "Johnson", "bobjohnson", model.AdditionalInfo{"email": "bob@example.com"})
+				h.userRegistry.CreateUser("John", "Doe", "johndoe", "", "", model.AdditionalInfo{"role": "admin"})
+				h.userRegistry.CreateUser("Jane", "Smith", "janesmith", "", "", nil)
+				h.userRegistry.CreateUser("Bob", "Johnson", "bobjohnson", "", "", model.AdditionalInfo{"email": "bob@example.com"})
 			},
 			expectedCount: 3,
 		},
@@ -424,7 +477,7 @@ func TestGetAllUsers(t *testing.T) {
 		{
 			name: "Get all users with single user",
 			setupFunc: func(h *Handler) {
-				h.userRegistry.CreateUser("Alice", "Wonder", "alice", nil)
+				h.userRegistry.CreateUser("Alice", "Wonder", "alice", "", "", nil)
 			},
 			expectedCount: 1,
 		},
@@ -444,10 +497,15 @@ func TestGetAllUsers(t *testing.T) {
 				t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
 			}
 
-			var users []*model.User
-			if err := json.NewDecoder(w.Body).Decode(&users); err != nil {
+			var response UsersPageResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 				t.Fatalf("failed to decode response: %v", err)
 			}
+			users := response.Users
+
+			if response.Total != tt.expectedCount {
+				t.Errorf("expected total %d, got %d", tt.expectedCount, response.Total)
+			}
 
 			if len(users) != tt.expectedCount {
 				t.Errorf("expected %d users, got %d", tt.expectedCount, len(users))
@@ -466,7 +524,7 @@ func TestGetAllUsersInRooms(t *testing.T) {
 	h := setupHandler(t)
 
 	// Create rooms - they'll be empty since we can't add clients from handler level
-	room1 := h.hub.CreateRoom(nil)
+	room1, _ := h.hub.CreateRoom(nil)
 	close(room1.Shutdown())
 
 	req := httptest.NewRequest("GET", "/rooms/users", nil)
@@ -488,3 +546,331 @@ func TestGetAllUsersInRooms(t *testing.T) {
 		t.Fatal("expected 'users' key in response")
 	}
 }
+
+func TestGetOnlineUsers(t *testing.T) {
+	h := setupHandler(t)
+	first := newRunningRoom(t, h)
+	second := newRunningRoom(t, h)
+
+	alice := model.User{ID: uuid.New(), Name: "alice"}
+	connectTestClient(t, h, first, alice)
+	connectTestClient(t, h, second, alice)
+	connectTestClient(t, h, second, model.User{ID: uuid.New(), Name: "bob"})
+
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	req := httptest.NewRequest("GET", "/api/v1/users/online", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string][]model.OnlineUser
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	users := response["users"]
+	if len(users) != 2 {
+		t.Fatalf("expected 2 online users, got %d", len(users))
+	}
+	if users[0].User.ID != alice.ID || len(users[0].RoomIDs) != 2 {
+		t.Errorf("expected alice in 2 rooms, got %s in %v", users[0].User.Name, users[0].RoomIDs)
+	}
+	if users[1].User.Name != "bob" || len(users[1].RoomIDs) != 1 || users[1].RoomIDs[0] != second.ID() {
+		t.Errorf("expected bob in room %d, got %s in %v", second.ID(), users[1].User.Name, users[1].RoomIDs)
+	}
+}
+
+func TestGetAllUsersPagination(t *testing.T) {
+	h := setupHandler(t)
+	for _, name := range []string{"alice", "bob", "carol", "dave", "alfred"} {
+		h.userRegistry.CreateUser("", "", name, "", "", nil)
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		expectedStatus  int
+		expectedUsers   int
+		expectedTotal   int
+		expectedHasMore bool
+	}{
+		{name: "First page", query: "limit=2", expectedStatus: http.StatusOK, expectedUsers: 2, expectedTotal: 5, expectedHasMore: true},
+		{name: "Last page", query: "limit=2&offset=4", expectedStatus: http.StatusOK, expectedUsers: 1, expectedTotal: 5, expectedHasMore: false},
+		{name: "Offset past end", query: "offset=10", expectedStatus: http.StatusOK, expectedUsers: 0, expectedTotal: 5, expectedHasMore: false},
+		{name: "Filter", query: "q=AL", expectedStatus: http.StatusOK, expectedUsers: 2, expectedTotal: 2, expectedHasMore: false},
+		{name: "Invalid limit", query: "limit=0", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid offset", query: "offset=-1", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users?"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			h.getAllUsersHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response UsersPageResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(response.Users) != tt.expectedUsers {
+				t.Errorf("expected %d users, got %d", tt.expectedUsers, len(response.Users))
+			}
+			if response.Total != tt.expectedTotal {
+				t.Errorf("expected total %d, got %d", tt.expectedTotal, response.Total)
+			}
+			if response.HasMore != tt.expectedHasMore {
+				t.Errorf("expected hasMore %v, got %v", tt.expectedHasMore, response.HasMore)
+			}
+		})
+	}
+}
+
+func TestGetAllUsersDeterministicOrder(t *testing.T) {
+	h := setupHandler(t)
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		h.userRegistry.CreateUser("", "", name, "", "", nil)
+	}
+
+	var first []uuid.UUID
+	for i := range 5 {
+		req := httptest.NewRequest("GET", "/users", nil)
+		w := httptest.NewRecorder()
+		h.getAllUsersHandler(w, req)
+
+		var response UsersPageResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+
+		ids := make([]uuid.UUID, 0, len(response.Users))
+		for _, u := range response.Users {
+			ids = append(ids, u.ID)
+		}
+		if i == 0 {
+			first = ids
+			continue
+		}
+		for j := range ids {
+			if ids[j] != first[j] {
+				t.Fatalf("expected stable order across requests, got %v then %v", first, ids)
+			}
+		}
+	}
+}
+
+func TestPatchUserAppearance(t *testing.T) {
+	h := setupHandler(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	u := h.userRegistry.CreateUser("", "", "painter", "#000", "", nil)
+	path := "/api/v1/users/" + u.ID.String()
+
+	w := doJSON(r, http.MethodPatch, path, `{"color":"#ff8c00","avatarUrl":"http://example.com/p.png"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if u.Color != "#ff8c00" || u.AvatarURL != "http://example.com/p.png" {
+		t.Errorf("unexpected appearance %q/%q", u.Color, u.AvatarURL)
+	}
+
+	for _, body := range []string{`{"color":"#ff8c0"}`, `{"color":123}`, `{"avatarUrl":"ftp://example.com/p.png"}`} {
+		if w := doJSON(r, http.MethodPatch, path, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+	if u.Color != "#ff8c00" {
+		t.Errorf("expected rejected patch to leave color unchanged, got %q", u.Color)
+	}
+}
+
+func TestUserNameValidation(t *testing.T) {
+	h := setupHandler(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	u := h.userRegistry.CreateUser("", "", "existing", "", "", nil)
+	path := "/api/v1/users/" + u.ID.String()
+
+	tests := []struct {
+		name      string
+		maxLength int
+		method    string
+		path      string
+		body      string
+		wantCode  int
+		wantError string
+	}{
+		{"off by default", 0, http.MethodPost, "/api/v1/users", `{"name":"  a very long name with a tab\t"}`, http.StatusCreated, ""},
+		{"create trims", 8, http.MethodPost, "/api/v1/users", `{"name":"  alice  "}`, http.StatusCreated, ""},
+		{"create too long", 8, http.MethodPost, "/api/v1/users", `{"name":"alexandria"}`, http.StatusBadRequest, "name must not be longer than 8 characters"},
+		{"create counts characters", 4, http.MethodPost, "/api/v1/users", `{"name":"Jörg"}`, http.StatusCreated, ""},
+		{"create control character", 8, http.MethodPost, "/api/v1/users", `{"firstName":"al\u0007ce"}`, http.StatusBadRequest, "firstName must not contain control characters"},
+		{"put too long", 8, http.MethodPut, path, `{"lastName":"Montgomery"}`, http.StatusBadRequest, "lastName must not be longer than 8 characters"},
+		{"patch control character", 8, http.MethodPatch, path, `{"name":"bo\nb"}`, http.StatusBadRequest, "name must not contain control characters"},
+		{"patch wrong type", 8, http.MethodPatch, path, `{"name":42}`, http.StatusBadRequest, "name must be a string"},
+		{"patch trims", 8, http.MethodPatch, path, `{"name":" bob "}`, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.SetMaxNameLength(tt.maxLength)
+			w := doJSON(r, tt.method, tt.path, tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantError != "" {
+				if got := strings.TrimSpace(w.Body.String()); got != tt.wantError {
+					t.Errorf("expected error %q, got %q", tt.wantError, got)
+				}
+				return
+			}
+			var user model.User
+			if err := json.NewDecoder(w.Body).Decode(&user); err != nil {
+				t.Fatalf("failed to decode user: %v", err)
+			}
+			if tt.maxLength > 0 && user.Name != strings.TrimSpace(user.Name) {
+				t.Errorf("expected name to be trimmed, got %q", user.Name)
+			}
+		})
+	}
+
+	if u.Name != "bob" {
+		t.Errorf("expected patched name %q, got %q", "bob", u.Name)
+	}
+}
+
+func TestGetRoomUserCount(t *testing.T) {
+	h := setupHandler(t)
+	room := newRunningRoom(t, h)
+	connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "alice"})
+	connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "bob"})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	w := doJSON(r, "GET", fmt.Sprintf("/api/v1/rooms/%d/users/count", room.ID()), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var response UserCountResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Count != 2 {
+		t.Errorf("expected count 2, got %d", response.Count)
+	}
+
+	if w := doJSON(r, "GET", "/api/v1/rooms/999/users/count", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for unknown room, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestGetRoomUsersByRole(t *testing.T) {
+	h := setupHandler(t)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	room := newRunningRoom(t, h)
+	agent := model.User{ID: uuid.New(), Name: "agent", AdditionalInfo: model.AdditionalInfo{"role": "agent"}}
+	connectTestClient(t, h, room, agent)
+	connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "customer", AdditionalInfo: model.AdditionalInfo{"role": "customer"}})
+	connectTestClient(t, h, room, model.User{ID: uuid.New(), Name: "anonymous"})
+	path := "/api/v1/rooms/" + strconv.FormatUint(uint64(room.ID()), 10) + "/users"
+
+	tests := []struct {
+		role string
+		want []uuid.UUID
+	}{
+		{"agent", []uuid.UUID{agent.ID}},
+		{"supervisor", []uuid.UUID{}},
+	}
+	for _, tt := range tests {
+		w := doJSON(r, http.MethodGet, path+"?role="+tt.role, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("role %s: expected %d, got %d", tt.role, http.StatusOK, w.Code)
+		}
+		var resp map[string][]model.User
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		users, ok := resp["users"]
+		if !ok || users == nil {
+			t.Fatalf("role %s: expected a users list, got %v", tt.role, resp)
+		}
+		if len(users) != len(tt.want) || (len(users) == 1 && users[0].ID != tt.want[0]) {
+			t.Errorf("role %s: expected %v, got %v", tt.role, tt.want, users)
+		}
+	}
+
+	if w := doJSON(r, http.MethodGet, path, ""); !strings.Contains(w.Body.String(), "anonymous") {
+		t.Error("expected unfiltered list to include every user")
+	}
+}
+
+func TestGetUserRooms(t *testing.T) {
+	h := setupHandler(t)
+	first := newRunningRoom(t, h)
+	second := newRunningRoom(t, h)
+	third := newRunningRoom(t, h)
+
+	alice := h.userRegistry.CreateUser("", "", "alice", "", "", nil)
+	bob := h.userRegistry.CreateUser("", "", "bob", "", "", nil)
+	connectTestClient(t, h, third, *alice)
+	connectTestClient(t, h, first, *alice)
+	connectTestClient(t, h, first, *alice)
+	connectTestClient(t, h, second, model.User{ID: uuid.New(), Name: "carol"})
+
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+
+	tests := []struct {
+		name       string
+		userID     string
+		wantStatus int
+		wantRooms  []uint
+	}{
+		{"connected user", alice.ID.String(), http.StatusOK, []uint{first.ID(), third.ID()}},
+		{"offline user", bob.ID.String(), http.StatusOK, []uint{}},
+		{"unknown user", uuid.New().String(), http.StatusNotFound, nil},
+		{"invalid user id", "not-a-uuid", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/users/"+tt.userID+"/rooms", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantRooms == nil {
+				return
+			}
+
+			var response map[string][]model.RoomResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			rooms, ok := response["rooms"]
+			if !ok || rooms == nil {
+				t.Fatal("expected a rooms array in the response")
+			}
+			ids := make([]uint, len(rooms))
+			for i, room := range rooms {
+				ids[i] = room.ID
+			}
+			if !slices.Equal(ids, tt.wantRooms) {
+				t.Errorf("expected rooms %v, got %v", tt.wantRooms, ids)
+			}
+		})
+	}
+}
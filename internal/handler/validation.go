@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/choffmann/chat-room/internal/chat"
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/choffmann/chat-room/internal/schema"
+)
+
+type ValidationErrorResponse struct {
+	Error      string   `json:"error" example:"additionalInfo does not match schema"`
+	Violations []string `json:"violations" example:"/theme: must be one of [light dark]"`
+} // @name ValidationError
+
+// InfoSchemas holds the optional JSON Schemas that additionalInfo of rooms,
+// users and messages must satisfy. A nil schema accepts anything.
+type InfoSchemas struct {
+	Room    *schema.Schema
+	User    *schema.Schema
+	Message *schema.Schema
+}
+
+// SetInfoSchemas enables additionalInfo validation. Message schemas also
+// apply to messages sent over WebSocket.
+func (h *Handler) SetInfoSchemas(schemas InfoSchemas) {
+	h.schemas = schemas
+	if schemas.Message != nil {
+		h.hub.SetMessageInfoValidator(func(info model.AdditionalInfo) []string {
+			return schemas.Message.Validate(info)
+		})
+	}
+}
+
+// validateInfo checks info against the hub's size limit and s. It writes a
+// 413 response if info is too large and a 422 response listing the
+// violations if it doesn't match s. It reports whether info is valid.
+func (h *Handler) validateInfo(w http.ResponseWriter, r *http.Request, s *schema.Schema, info model.AdditionalInfo) bool {
+	if limit := h.hub.MaxInfoBytes(); chat.InfoTooLarge(info, limit) {
+		h.logger.Warn("additionalInfo too large", "path", r.URL.Path, "remoteAddr", r.RemoteAddr, "maxInfoBytes", limit)
+		http.Error(w, fmt.Sprintf("additionalInfo exceeds %d bytes", limit), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	if s == nil {
+		return true
+	}
+	if info == nil {
+		info = model.AdditionalInfo{}
+	}
+
+	violations := s.Validate(info)
+	if len(violations) == 0 {
+		return true
+	}
+
+	h.logger.Warn("additionalInfo rejected by schema", "path", r.URL.Path, "remoteAddr", r.RemoteAddr, "violations", len(violations))
+	writeJSON(w, r, http.StatusUnprocessableEntity, ValidationErrorResponse{
+		Error:      "additionalInfo does not match schema",
+		Violations: violations,
+	})
+	return false
+}
+
+// checkInfo is validateInfo for callers that report problems themselves. It
+// returns why info is rejected, or "" if it is valid.
+func (h *Handler) checkInfo(s *schema.Schema, info model.AdditionalInfo) string {
+	if limit := h.hub.MaxInfoBytes(); chat.InfoTooLarge(info, limit) {
+		return fmt.Sprintf("additionalInfo exceeds %d bytes", limit)
+	}
+	if s == nil {
+		return ""
+	}
+	if info == nil {
+		info = model.AdditionalInfo{}
+	}
+	if violations := s.Validate(info); len(violations) > 0 {
+		return "additionalInfo does not match schema: " + strings.Join(violations, "; ")
+	}
+	return ""
+}
+
+// RoomValidator checks the additionalInfo of a room being created or updated
+// and returns the rules it breaks. Updates are checked on the resulting
+// additionalInfo.
+type RoomValidator func(info model.AdditionalInfo) []string
+
+// RequireRoomName rejects rooms without a non-empty string
+// additionalInfo.name.
+func RequireRoomName(info model.AdditionalInfo) []string {
+	if name, _ := info["name"].(string); strings.TrimSpace(name) == "" {
+		return []string{"/name: is required"}
+	}
+	return nil
+}
+
+// AddRoomValidator adds a check that rooms must pass to be created or
+// updated. Without validators any additionalInfo is accepted.
+func (h *Handler) AddRoomValidator(v RoomValidator) {
+	h.roomValidators = append(h.roomValidators, v)
+}
+
+// validateRoom runs the room validators on info. It writes a 422 response
+// listing the violations and reports whether info is valid.
+func (h *Handler) validateRoom(w http.ResponseWriter, r *http.Request, info model.AdditionalInfo) bool {
+	var violations []string
+	for _, validate := range h.roomValidators {
+		violations = append(violations, validate(info)...)
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	h.logger.Warn("room rejected by validator", "remoteAddr", r.RemoteAddr, "violations", len(violations))
+	writeJSON(w, r, http.StatusUnprocessableEntity, ValidationErrorResponse{
+		Error:      "room validation failed",
+		Violations: violations,
+	})
+	return false
+}
+
+// mergeInfo returns current with updates applied, the way PATCH requests
+// merge additionalInfo.
+func mergeInfo(current, updates model.AdditionalInfo) model.AdditionalInfo {
+	merged := maps.Clone(current)
+	if merged == nil {
+		merged = make(model.AdditionalInfo, len(updates))
+	}
+	maps.Copy(merged, updates)
+	return merged
+}
+
+// keepOwner returns info with the room's current ownerId. The owner is fixed
+// when the room is created, so PATCH and PUT can't move a room out of its
+// owner's MAX_ROOMS_PER_OWNER count.
+func keepOwner(current, info model.AdditionalInfo) model.AdditionalInfo {
+	kept := maps.Clone(info)
+	if kept == nil {
+		kept = make(model.AdditionalInfo)
+	}
+	if owner, ok := current["ownerId"]; ok {
+		kept["ownerId"] = owner
+	} else {
+		delete(kept, "ownerId")
+	}
+	return kept
+}
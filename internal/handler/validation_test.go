@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/choffmann/chat-room/internal/schema"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const themeSchema = `{
+	"type": "object",
+	"properties": {"theme": {"enum": ["light", "dark"]}}
+}`
+
+func setupSchemaHandler(t *testing.T) (*Handler, *mux.Router) {
+	t.Helper()
+	s, err := schema.Compile([]byte(themeSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := setupHandler(t)
+	h.SetInfoSchemas(InfoSchemas{Room: s, User: s, Message: s})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	return h, r
+}
+
+func doJSON(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSchemaValidationRooms(t *testing.T) {
+	h, r := setupSchemaHandler(t)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/rooms", `{"theme":"blue"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	var resp ValidationErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Violations) != 1 || resp.Violations[0] != "/theme: must be one of [light dark]" {
+		t.Errorf("unexpected violations: %q", resp.Violations)
+	}
+	if len(h.hub.GetAllRoomIDs()) != 0 {
+		t.Error("expected no room to be created")
+	}
+
+	room, _ := h.hub.CreateRoom(model.AdditionalInfo{"theme": "dark", "name": "Lobby"})
+	path := "/api/v1/rooms/" + strconv.FormatUint(uint64(room.ID()), 10)
+
+	if w := doJSON(r, http.MethodPatch, path, `{"theme":"blue"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("patch: expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, path, `{"theme":"blue"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("put: expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	if got := room.GetAdditionalInfo()["theme"]; got != "dark" {
+		t.Errorf("expected rejected updates to leave theme unchanged, got %v", got)
+	}
+
+	if w := doJSON(r, http.MethodPatch, path, `{"theme":"light"}`); w.Code != http.StatusOK {
+		t.Errorf("valid patch: expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestSchemaValidationUsers(t *testing.T) {
+	_, r := setupSchemaHandler(t)
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/users", `{"name":"Alice","additionalInfo":{"theme":"blue"}}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("create: expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/v1/users", `{"name":"Alice","additionalInfo":{"theme":"dark"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected %d, got %d", http.StatusCreated, w.Code)
+	}
+	var u model.User
+	json.NewDecoder(w.Body).Decode(&u)
+	path := "/api/v1/users/" + u.ID.String()
+
+	if w := doJSON(r, http.MethodPatch, path, `{"additionalInfo":{"theme":"blue"}}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("patch: expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, path, `{"name":"Alice","additionalInfo":{"theme":"blue"}}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("put: expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	if w := doJSON(r, http.MethodPatch, path, `{"name":"Bob"}`); w.Code != http.StatusOK {
+		t.Errorf("patch without additionalInfo: expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestSchemaValidationMessages(t *testing.T) {
+	h, r := setupSchemaHandler(t)
+	room, _ := h.hub.CreateRoom(nil)
+	msg := model.OutgoingMessage{ID: uuid.New(), MessageType: model.UserMessage, Message: "hi"}
+	room.StoreMessage(msg)
+	path := "/api/v1/rooms/" + strconv.FormatUint(uint64(room.ID()), 10) + "/messages/" + msg.ID.String()
+
+	if w := doJSON(r, http.MethodPatch, path, `{"additionalInfo":{"theme":"blue"}}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("patch: expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, path, `{"message":"edited","additionalInfo":{"theme":"blue"}}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("put: expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	if w := doJSON(r, http.MethodPatch, path, `{"message":"edited"}`); w.Code != http.StatusOK {
+		t.Errorf("patch without additionalInfo: expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestInfoSizeLimit(t *testing.T) {
+	h := setupHandler(t)
+	h.hub.SetMaxInfoBytes(64)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, false)
+	big := fmt.Sprintf(`{"blob":%q}`, strings.Repeat("x", 100))
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/rooms", big); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("room create: expected %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/users", `{"additionalInfo":`+big+`}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("user create: expected %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	// Patches are limited by the size of the merged result.
+	u := h.userRegistry.CreateUser("", "", "grower", "", "", model.AdditionalInfo{"a": strings.Repeat("x", 30)})
+	path := "/api/v1/users/" + u.ID.String()
+	if w := doJSON(r, http.MethodPatch, path, `{"additionalInfo":{"b":"`+strings.Repeat("y", 30)+`"}}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("user patch: expected %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	if w := doJSON(r, http.MethodPatch, path, `{"additionalInfo":{"b":"small"}}`); w.Code != http.StatusOK {
+		t.Errorf("user patch: expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
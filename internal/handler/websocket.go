@@ -3,7 +3,6 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"strconv"
 	"time"
@@ -25,19 +24,41 @@ import (
 // @Description  - `userName` (string): Join as an ephemeral user with the given display name.
 // @Description  - Neither: Server assigns a random display name.
 // @Description
+// @Description  Ephemeral users get `additionalInfo.color` picked from a fixed palette by their ID, see the README for the derivation.
+// @Description
+// @Description  Rooms with `"requireRegisteredUsers": true` in their additionalInfo reject joins without a registered `userId` with 401.
+// @Description
 // @Description  **User info extraction:** Set `userInfo=true` to receive a self-join message with a `self` flag, allowing clients to extract their user information.
 // @Description
+// @Description  **Reconnects:** If enabled, the self-join message carries a `reconnectToken` in `additionalInfo`. Joining again with `reconnectToken` restores the same user, including ephemeral ones, without leave and join messages. The token is valid while connected and for the reconnect grace period after the connection drops; a connection still holding it is closed with `4004`. Each token works once and the self-join message of the resumed connection has `resumed` set and a new token.
+// @Description
 // @Description  **Message types:** The `type` field in client messages accepts any string value. Built-in types are `"message"` and `"image"`, but clients can send custom types (e.g. `"poll"`, `"reaction"`, `"file"`). If the `type` field is omitted, it defaults to `"message"`. All message types are stored in room history except `"image"`. System messages (`"system"`) are server-generated and cannot be sent by clients.
 // @Description
+// @Description  **Threads:** Set `parentId` to the UUID of a stored message to send a threaded reply. Replies to unknown messages are rejected with a private error message.
+// @Description
+// @Description  **Expiry:** Set `expiresIn` (seconds, max 7 days) to make a message disappear. The server stores `expiresAt` in `additionalInfo`, removes the message once it expires and broadcasts a `message_deleted` event with the removed `messageId`.
+// @Description
 // @Description  **Connection management:** Server sends ping every 30s, expects pong within 60s. Max message size: 10 MiB.
+// @Description
+// @Description  **Receipts:** Send `{"type": "receipt", "messageId": "<uuid>"}` to acknowledge a stored message. The server adds the user to the message's `additionalInfo.deliveredTo` and broadcasts a `receipt` event with the `messageId` and the full `deliveredTo` list. Messages sent to an audience can only be acknowledged by that audience and their receipt events only reach it. Receipts are not stored.
+// @Description
+// @Description  **Authentication:** With `WS_AUTH_TOKEN` set, the first frame must be `{"type": "auth", "token": "<token>"}`, sent within `WS_AUTH_TIMEOUT`. The client joins the room only afterwards, so until then it receives nothing and no join is announced. Any other first frame, a wrong token or a timeout closes the connection with `4005`.
+// @Description
+// @Description  **Close codes:** When the server ends a connection, the close frame carries a code and reason: `4001` "room closed", `4002` "kicked", `4003` "slow consumer", `4004` "replaced by reconnect", `4005` "authentication failed".
 // @Tags         websocket
 // @Param        roomID    path   int     true   "Room ID"
 // @Param        userId    query  string  false  "Registered user UUID"
 // @Param        userName  query  string  false  "Ephemeral display name"
 // @Param        userInfo  query  bool    false  "Enable self-join message with user info"
+// @Param        history   query  int     false  "Replay the last N stored messages (oldest first, max 256) right after joining"
+// @Param        reconnectToken  query  string  false  "Token from a previous self-join message to resume that user"
 // @Success      101       "Switching Protocols - WebSocket connection established"
 // @Failure      400       {string}  string  "invalid room or user ID"
+// @Failure      401       {string}  string  "invalid or expired reconnect token, or room requires a registered user"
+// @Failure      403       {string}  string  "user is banned from this room"
 // @Failure      404       {string}  string  "room or user not found"
+// @Failure      429       {string}  string  "too many requests"
+// @Failure      503       {string}  string  "too many connections"
 // @Router       /join/{roomID} [get]
 func (h *Handler) wsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -48,39 +69,16 @@ func (h *Handler) wsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	resumeToken := r.URL.Query().Get("reconnectToken")
 	var user model.User
-
-	userIDStr := r.URL.Query().Get("userId")
-	if userIDStr != "" {
-		userID, err := uuid.Parse(userIDStr)
-		if err != nil {
-			h.logger.Warn("invalid user id for websocket join", "userID", userIDStr, "remoteAddr", r.RemoteAddr, "error", err)
-			http.Error(w, "invalid user id", http.StatusBadRequest)
+	if resumeToken == "" {
+		if !h.allowJoin(w, r) {
 			return
 		}
-
-		registeredUser, ok := h.userRegistry.GetUser(userID)
-		if !ok {
-			h.logger.Warn("user not found in registry", "userID", userID, "remoteAddr", r.RemoteAddr)
-			http.Error(w, "user not found", http.StatusNotFound)
+		var ok bool
+		if user, ok = h.resolveJoinUser(w, r); !ok {
 			return
 		}
-		user = *registeredUser
-		h.logger.Info("user from registry joining room", "userID", user.ID, "roomID", roomID)
-	} else {
-		userName := r.URL.Query().Get("userName")
-		if userName == "" {
-			userName = r.URL.Query().Get("user")
-		}
-		if userName == "" {
-			userName = h.defaultNames[rand.Intn(len(h.defaultNames))]
-		}
-
-		user = model.User{
-			ID:   uuid.New(),
-			Name: userName,
-		}
-		h.logger.Info("ephemeral user joining room", "userID", user.ID, "userName", user.Name, "roomID", roomID)
 	}
 
 	room, ok := h.hub.GetRoom(uint(roomID))
@@ -90,12 +88,65 @@ func (h *Handler) wsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if resumeToken != "" {
+		if user, ok = room.ReconnectUser(resumeToken); !ok {
+			h.logger.Warn("invalid reconnect token for websocket join", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+			http.Error(w, "invalid or expired reconnect token", http.StatusUnauthorized)
+			return
+		}
+	}
+	h.logger.Info("user joining room", "userID", user.ID, "userName", user.Name, "roomID", roomID, "resume", resumeToken != "")
+
+	if room.RequiresRegisteredUsers() {
+		if _, registered := h.userRegistry.GetUser(user.ID); !registered {
+			h.logger.Warn("ephemeral user attempted to join room requiring registered users", "roomID", roomID, "remoteAddr", r.RemoteAddr)
+			http.Error(w, "room requires a registered user", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if room.IsBanned(user.ID) {
+		h.logger.Warn("banned user attempted to join room", "roomID", roomID, "userID", user.ID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "user is banned from this room", http.StatusForbidden)
+		return
+	}
+
+	historySize := 0
+	if raw := r.URL.Query().Get("history"); raw != "" {
+		historySize, err = strconv.Atoi(raw)
+		if err != nil || historySize < 0 {
+			h.logger.Warn("invalid history size for websocket join", "history", raw, "remoteAddr", r.RemoteAddr, "error", err)
+			http.Error(w, "invalid history size", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !h.hub.AcquireConnection() {
+		h.logger.Warn("connection limit reached, rejecting websocket join", "roomID", roomID, "userID", user.ID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "too many connections", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := h.upgrade(w, r)
 	if err != nil {
+		h.hub.ReleaseConnection()
 		h.logger.Error("websocket upgrade failed", "roomID", roomID, "userID", user.ID, "userName", user.Name, "error", err)
 		return
 	}
 
+	// The client joins only once authenticated, so a connection that fails
+	// the handshake is never announced, listed or sent anything.
+	if h.wsAuthToken != "" {
+		if err := chat.Authenticate(conn, h.wsAuthToken, h.wsAuthTimeout); err != nil {
+			if chat.IsAuthError(err) {
+				h.logger.Warn("websocket authentication failed", "roomID", roomID, "userID", user.ID, "remoteAddr", r.RemoteAddr, "error", err)
+			}
+			h.hub.ReleaseConnection()
+			conn.Close()
+			return
+		}
+	}
+
 	var us chat.UploadStore
 	var uploadBaseURL string
 	if h.uploadStore != nil {
@@ -103,6 +154,22 @@ func (h *Handler) wsHandler(w http.ResponseWriter, r *http.Request) {
 		uploadBaseURL = resolveUploadBaseURL(r)
 	}
 	client := chat.NewClient(room, conn, user, h.systemUser, h.logger, us, uploadBaseURL)
+	client.SetHistoryReplay(historySize)
+	client.SetConnInfo(connInfo(r))
+	client.SetOnDisconnect(h.hub.ReleaseConnection)
+	client.SetOnActivity(func() { h.userRegistry.UpdateLastSeen(user.ID) })
+	h.userRegistry.UpdateLastSeen(user.ID)
+
+	if resumeToken != "" {
+		// The token was checked before the upgrade but may have expired since.
+		if _, ok := room.Resume(resumeToken); !ok {
+			h.logger.Warn("reconnect token expired during websocket upgrade", "roomID", roomID, "userID", user.ID)
+			_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "reconnect token expired"))
+			h.hub.ReleaseConnection()
+			conn.Close()
+			return
+		}
+	}
 
 	displayName := model.GetDisplayName(user)
 	timestamp := time.Now()
@@ -124,47 +191,170 @@ func (h *Handler) wsHandler(w http.ResponseWriter, r *http.Request) {
 				"joinedUserName": displayName,
 			},
 		}
+		// Tokens are only issued to clients that receive this message,
+		// otherwise their leave would be delayed for nothing.
+		if token := room.IssueReconnectToken(client); token != "" {
+			selfJoin.AdditionalInfo["reconnectToken"] = token
+		}
+		if resumeToken != "" {
+			selfJoin.AdditionalInfo["resumed"] = true
+		}
 		selfJoinBytes, _ := json.Marshal(selfJoin)
 
 		if err := conn.WriteMessage(websocket.TextMessage, selfJoinBytes); err != nil {
 			h.logger.Warn("failed to send join message to new client", "roomID", roomID, "userID", user.ID, "error", err)
+			h.hub.ReleaseConnection()
 			conn.Close()
 			return
 		}
 	}
 
-	hello := model.OutgoingMessage{
-		ID:          uuid.New(),
-		MessageType: model.SystemMessage,
-		Message:     fmt.Sprintf("%s joined room %d", displayName, roomID),
-		Timestamp:   timestamp,
-		User:        h.systemUser,
-		AdditionalInfo: model.AdditionalInfo{
-			"joinedUser": user,
-			// Deprecated: kept for pre-2.0 clients, remove in v2
-			"joinedUserId":   user.ID.String(),
-			"joinedUserName": displayName,
-		},
+	// A resumed user never left, so the room isn't told again.
+	var joined bool
+	if resumeToken != "" {
+		joined = room.TryRegister(client)
+	} else {
+		joined = room.Join(client)
+	}
+	if !joined {
+		h.logger.Warn("failed to register client, room may be closing", "roomID", roomID, "userID", user.ID)
+		h.hub.ReleaseConnection()
+		conn.Close()
+		return
 	}
+	h.logger.Info("client joined room", "roomID", roomID, "userID", user.ID, "userName", user.Name)
 
-	room.StoreMessage(hello)
+	go client.WritePump()
+	client.ReadPump()
+}
 
-	b, _ := json.Marshal(hello)
-	if !room.TryBroadcast(b) {
-		h.logger.Warn("failed to broadcast join message, room may be closing", "roomID", roomID)
+// multiWsHandler godoc
+// @Summary      Join several rooms via one WebSocket
+// @Description  Upgrades the HTTP connection to a multiplexed WebSocket that isn't bound to a room. User identification works like `/join/{roomID}`.
+// @Description
+// @Description  **Subscriptions:** Send `{"action": "subscribe", "roomId": 1}` to join a room (optionally with `"history": N` to replay the last N stored messages) and `{"action": "unsubscribe", "roomId": 1}` to leave it. The server confirms with a system message whose `additionalInfo.action` is `"subscribed"` or `"unsubscribed"`. If a room drops the subscription (kick, slow consumer, room closed), an `"unsubscribed"` message with a `reason` is sent and the connection stays open.
+// @Description
+// @Description  **Authentication:** With `WS_AUTH_TOKEN` set, the first frame must be an auth frame like on `/join/{roomID}`.
+// @Description
+// @Description  **Messages:** Every frame sent by the server carries the `roomId` it belongs to. To send a message, add `roomId` to a regular client message, e.g. `{"roomId": 1, "message": "hi"}`. Binary uploads are not supported on multiplexed connections.
+// @Tags         websocket
+// @Param        userId    query  string  false  "Registered user UUID"
+// @Param        userName  query  string  false  "Ephemeral display name"
+// @Success      101       "Switching Protocols - WebSocket connection established"
+// @Failure      400       {string}  string  "invalid user ID"
+// @Failure      404       {string}  string  "user not found"
+// @Failure      429       {string}  string  "too many requests"
+// @Failure      503       {string}  string  "too many connections"
+// @Router       /join [get]
+func (h *Handler) multiWsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.allowJoin(w, r) {
+		return
+	}
+	user, ok := h.resolveJoinUser(w, r)
+	if !ok {
+		return
 	}
 
-	if !room.TryRegister(client) {
-		h.logger.Warn("failed to register client, room may be closing", "roomID", roomID, "userID", user.ID)
-		conn.Close()
+	if !h.hub.AcquireConnection() {
+		h.logger.Warn("connection limit reached, rejecting multiplexed websocket", "userID", user.ID, "remoteAddr", r.RemoteAddr)
+		http.Error(w, "too many connections", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := h.upgrade(w, r)
+	if err != nil {
+		h.hub.ReleaseConnection()
+		h.logger.Error("websocket upgrade failed", "userID", user.ID, "userName", user.Name, "error", err)
 		return
 	}
-	h.logger.Info("client joined room", "roomID", roomID, "userID", user.ID, "userName", user.Name)
+
+	client := chat.NewMultiClient(h.hub, conn, user, h.systemUser, h.logger)
+	_, registered := h.userRegistry.GetUser(user.ID)
+	client.SetRegistered(registered)
+	client.SetConnInfo(connInfo(r))
+	if h.wsAuthToken != "" {
+		client.RequireAuth(h.wsAuthToken, h.wsAuthTimeout)
+	}
+	client.SetOnDisconnect(h.hub.ReleaseConnection)
+	client.SetOnActivity(func() { h.userRegistry.UpdateLastSeen(user.ID) })
+	h.userRegistry.UpdateLastSeen(user.ID)
+	h.logger.Info("multiplexed client connected", "userID", user.ID, "userName", user.Name)
 
 	go client.WritePump()
 	client.ReadPump()
 }
 
+// SetWebSocketAuth makes WebSocket clients send {"type": "auth", "token":
+// token} as their first frame within timeout. Clients that send anything else
+// or nothing are closed with 4005. An empty token disables the handshake.
+func (h *Handler) SetWebSocketAuth(token string, timeout time.Duration) {
+	h.wsAuthToken = token
+	h.wsAuthTimeout = timeout
+}
+
+// allowJoin applies the join rate limit. User IDs are public, so joins with
+// a userId are limited too, only from a separate budget.
+func (h *Handler) allowJoin(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Query().Get("userId") != "" {
+		return h.allowRate(w, r, h.userJoinLimit, "join rate limit exceeded")
+	}
+	return h.allowRate(w, r, h.joinLimit, "join rate limit exceeded")
+}
+
+// upgrade switches the request to a WebSocket connection. The server's read
+// and write timeouts would stay on the connection after the upgrade and cut
+// off long-lived sockets, so they are lifted first; the client pumps set
+// their own deadlines.
+func (h *Handler) upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+	return h.upgrader.Upgrade(w, r, nil)
+}
+
+// resolveJoinUser returns the registered user named by the userId query
+// parameter, or an ephemeral user named by userName with a color derived from
+// its ID in additionalInfo. It writes an error response and returns false if
+// userId is invalid or unknown.
+func (h *Handler) resolveJoinUser(w http.ResponseWriter, r *http.Request) (model.User, bool) {
+	userIDStr := r.URL.Query().Get("userId")
+	if userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			h.logger.Warn("invalid user id for websocket join", "userID", userIDStr, "remoteAddr", r.RemoteAddr, "error", err)
+			http.Error(w, "invalid user id", http.StatusBadRequest)
+			return model.User{}, false
+		}
+
+		registeredUser, ok := h.userRegistry.GetUser(userID)
+		if !ok {
+			h.logger.Warn("user not found in registry", "userID", userID, "remoteAddr", r.RemoteAddr)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return model.User{}, false
+		}
+		user := *registeredUser
+		// Presence is tracked by the registry; the copy carried in messages
+		// shouldn't freeze the value seen at join time.
+		user.LastSeen = nil
+		return user, true
+	}
+
+	userName := r.URL.Query().Get("userName")
+	if userName == "" {
+		userName = r.URL.Query().Get("user")
+	}
+	if userName == "" {
+		userName = h.randomUserName()
+	}
+
+	id := uuid.New()
+	return model.User{
+		ID:             id,
+		Name:           userName,
+		AdditionalInfo: model.AdditionalInfo{"color": anonymousColor(id)},
+	}, true
+}
+
 func resolveUploadBaseURL(r *http.Request) string {
 	if base := config.BaseURL(); base != "" {
 		return "http://" + base + "/uploads"
@@ -180,3 +370,13 @@ func resolveUploadBaseURL(r *http.Request) string {
 
 	return scheme + "://" + r.Host + "/uploads"
 }
+
+// connInfo captures where a WebSocket connection came from for the admin
+// connection listing.
+func connInfo(r *http.Request) chat.ConnInfo {
+	return chat.ConnInfo{
+		RemoteAddr:  r.RemoteAddr,
+		UserAgent:   r.UserAgent(),
+		ConnectedAt: time.Now(),
+	}
+}
@@ -14,8 +14,38 @@ const (
 	SystemMessage MessageType = "system"
 	UserMessage   MessageType = "message"
 	ImageMessage  MessageType = "image"
+	// MessageDeleted notifies clients that a stored message was removed,
+	// e.g. because it expired or was deleted via the REST API.
+	MessageDeleted MessageType = "message_deleted"
+	// MessageUpdated notifies clients that a stored message was edited.
+	MessageUpdated MessageType = "message_updated"
+	// ReceiptMessage acknowledges delivery of the message in MessageID.
+	ReceiptMessage MessageType = "receipt"
+	// PinsUpdated notifies clients that a message was pinned or unpinned.
+	PinsUpdated MessageType = "pins_updated"
+	// LeaveMessage is sent by a client to leave the room gracefully. It is
+	// never broadcast.
+	LeaveMessage MessageType = "leave"
+	// OccupancyMessage carries a room's current client count.
+	OccupancyMessage MessageType = "occupancy"
+	// RoomUpdated carries a room's additionalInfo after it was changed.
+	RoomUpdated MessageType = "room_updated"
+	// AuthMessage is the first frame a client sends when the server
+	// requires WebSocket authentication. It is never broadcast.
+	AuthMessage MessageType = "auth"
 )
 
+// ProtocolVersion is the version of the WebSocket message envelope, sent as
+// "v" with every message. Clients may send it on their messages; messages
+// without one are read as version 1.
+const ProtocolVersion = 1
+
+// SupportedVersion reports whether the server can read messages sent with
+// envelope version v. 0 means the client didn't send a version.
+func SupportedVersion(v int) bool {
+	return v == 0 || v == ProtocolVersion
+}
+
 type AdditionalInfo = map[string]any
 
 type User struct {
@@ -23,21 +53,34 @@ type User struct {
 	FirstName      string         `json:"firstName,omitempty" example:"John"`
 	LastName       string         `json:"lastName,omitempty" example:"Doe"`
 	Name           string         `json:"name,omitempty" example:"johndoe"`
+	Color          string         `json:"color,omitempty" example:"#1e90ff"`
+	AvatarURL      string         `json:"avatarUrl,omitempty" example:"https://example.com/avatars/johndoe.png"`
+	CreatedAt      time.Time      `json:"createdAt,omitzero" example:"2024-04-09T12:00:00Z"`
+	LastSeen       *time.Time     `json:"lastSeen,omitempty" example:"2024-04-09T12:35:10Z"`
 	AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty" swaggertype:"object"`
 }
 
 type OutgoingMessage struct {
+	Version        int            `json:"v" example:"1"`
 	ID             uuid.UUID      `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Seq            uint64         `json:"seq,omitempty" example:"42"`
 	MessageType    MessageType    `json:"type" example:"message"`
 	Message        string         `json:"message" example:"Hello everyone!"`
 	Timestamp      time.Time      `json:"timestamp" example:"2024-04-09T12:35:10.123456789Z"`
 	User           User           `json:"user"`
-	AdditionalInfo AdditionalInfo `json:"additionalInfo" swaggertype:"object"`
+	ParentID       *uuid.UUID     `json:"parentId,omitempty" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty" swaggertype:"object"`
 }
 
 type IncomingMessage struct {
+	Version        int            `json:"v,omitempty"`
 	MessageType    MessageType    `json:"type"`
 	Message        string         `json:"message"`
+	ParentID       *uuid.UUID     `json:"parentId,omitempty"`
+	ExpiresIn      int            `json:"expiresIn,omitempty"`
+	MessageID      *uuid.UUID     `json:"messageId,omitempty"`
+	Audience       string         `json:"audience,omitempty"`
+	Token          string         `json:"token,omitempty"`
 	AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty"`
 }
 
@@ -47,10 +90,21 @@ type RoomResponse struct {
 	AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty" swaggertype:"object"`
 }
 
+type RoomDetail struct {
+	ID             uint           `json:"id" example:"1"`
+	UserCount      int            `json:"onlineUser" example:"3"`
+	MessageCount   int            `json:"messageCount" example:"42"`
+	CreatedAt      time.Time      `json:"createdAt" example:"2024-04-09T12:00:00Z"`
+	LastActivity   time.Time      `json:"lastActivity" example:"2024-04-09T12:35:10Z"`
+	AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty" swaggertype:"object"`
+}
+
 type CreateUserRequest struct {
 	FirstName      string         `json:"firstName,omitempty" example:"John"`
 	LastName       string         `json:"lastName,omitempty" example:"Doe"`
 	Name           string         `json:"name,omitempty" example:"johndoe"`
+	Color          string         `json:"color,omitempty" example:"#1e90ff"`
+	AvatarURL      string         `json:"avatarUrl,omitempty" example:"https://example.com/avatars/johndoe.png"`
 	AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty" swaggertype:"object"`
 }
 
@@ -58,6 +112,8 @@ type UpdateUserRequest struct {
 	FirstName      string         `json:"firstName,omitempty" example:"Jane"`
 	LastName       string         `json:"lastName,omitempty" example:"Smith"`
 	Name           string         `json:"name,omitempty" example:"janesmith"`
+	Color          string         `json:"color,omitempty" example:"#ff8c00"`
+	AvatarURL      string         `json:"avatarUrl,omitempty" example:"https://example.com/avatars/janesmith.png"`
 	AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty" swaggertype:"object"`
 }
 
@@ -66,6 +122,11 @@ type UserWithRoom struct {
 	RoomID uint `json:"roomId" example:"1"`
 }
 
+type OnlineUser struct {
+	User    User   `json:"user"`
+	RoomIDs []uint `json:"roomIds"`
+}
+
 func GetDisplayName(user User) string {
 	displayName := user.Name
 	if displayName == "" && user.FirstName != "" && user.LastName != "" {
@@ -86,9 +147,34 @@ func ParseRoomID(roomIDStr string) (uint, error) {
 	return uint(roomID), nil
 }
 
+var knownMessageTypes = map[MessageType]struct{}{
+	SystemMessage:    {},
+	UserMessage:      {},
+	ImageMessage:     {},
+	MessageDeleted:   {},
+	MessageUpdated:   {},
+	ReceiptMessage:   {},
+	PinsUpdated:      {},
+	OccupancyMessage: {},
+	RoomUpdated:      {},
+}
+
+// IsKnownMessageType reports whether msgType is one of the built-in types.
+// Clients may still send custom types; this only covers the server's own set.
+func IsKnownMessageType(msgType MessageType) bool {
+	_, ok := knownMessageTypes[msgType]
+	return ok
+}
+
 // Non-storable types are transient or too large to keep in memory.
 var nonStorableTypes = map[MessageType]struct{}{
-	ImageMessage: {},
+	ImageMessage:     {},
+	MessageDeleted:   {},
+	MessageUpdated:   {},
+	ReceiptMessage:   {},
+	PinsUpdated:      {},
+	OccupancyMessage: {},
+	RoomUpdated:      {},
 }
 
 func ShouldStoreMessage(msgType MessageType) bool {
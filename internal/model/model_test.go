@@ -1,7 +1,12 @@
 package model
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 func TestParseRoomID(t *testing.T) {
@@ -121,6 +126,16 @@ func TestShouldStoreMessage(t *testing.T) {
 			msgType:  ImageMessage,
 			expected: false,
 		},
+		{
+			name:     "Do not store deletion events",
+			msgType:  MessageDeleted,
+			expected: false,
+		},
+		{
+			name:     "Do not store receipts",
+			msgType:  ReceiptMessage,
+			expected: false,
+		},
 		{
 			name:     "Do not store empty type",
 			msgType:  "",
@@ -147,3 +162,105 @@ func TestShouldStoreMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestOutgoingMessageOmitsEmptyAdditionalInfo(t *testing.T) {
+	msg := OutgoingMessage{
+		ID:          uuid.MustParse("550e8400-e29b-41d4-a716-446655440000"),
+		MessageType: UserMessage,
+		Message:     "hi",
+		Timestamp:   time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC),
+		User:        User{ID: uuid.MustParse("9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c"), Name: "alice"},
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"v":1,"id":"550e8400-e29b-41d4-a716-446655440000","type":"message","message":"hi","timestamp":"2024-04-09T12:00:00Z","user":{"id":"9a6e58a5-4d47-4c86-8b3f-9ea373cbdb0c","name":"alice"}}`
+	if string(b) != want {
+		t.Errorf("unexpected JSON\n got: %s\nwant: %s", b, want)
+	}
+
+	msg.AdditionalInfo = AdditionalInfo{"format": "markdown"}
+	b, _ = json.Marshal(msg)
+	if !strings.HasSuffix(string(b), `,"additionalInfo":{"format":"markdown"}}`) {
+		t.Errorf("expected additionalInfo to be kept when set, got %s", b)
+	}
+}
+
+func TestOutgoingMessageTimestampLayout(t *testing.T) {
+	defer SetTimestampLayout(TimestampNano)
+
+	tests := []struct {
+		layout string
+		ts     time.Time
+		want   string
+	}{
+		{TimestampNano, time.Date(2024, 4, 9, 12, 0, 0, 120000000, time.UTC), "2024-04-09T12:00:00.12Z"},
+		{TimestampMillis, time.Date(2024, 4, 9, 12, 0, 0, 120000000, time.UTC), "2024-04-09T12:00:00.120Z"},
+		{TimestampMillis, time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC), "2024-04-09T12:00:00.000Z"},
+		{TimestampSeconds, time.Date(2024, 4, 9, 12, 0, 0, 999999999, time.UTC), "2024-04-09T12:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			SetTimestampLayout(tt.layout)
+			b, err := json.Marshal(OutgoingMessage{Timestamp: tt.ts})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var decoded struct {
+				Timestamp string `json:"timestamp"`
+			}
+			if err := json.Unmarshal(b, &decoded); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if decoded.Timestamp != tt.want {
+				t.Errorf("expected timestamp %q, got %q", tt.want, decoded.Timestamp)
+			}
+
+			// Every layout must stay readable as a time.Time.
+			var msg OutgoingMessage
+			if err := json.Unmarshal(b, &msg); err != nil {
+				t.Errorf("failed to read timestamp back: %v", err)
+			}
+		})
+	}
+}
+
+func TestUserAndRoomTimestampLayout(t *testing.T) {
+	SetTimestampLayout(TimestampMillis)
+	defer SetTimestampLayout(TimestampNano)
+
+	ts := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	want := "2024-04-09T12:00:00.000Z"
+
+	b, _ := json.Marshal(User{ID: uuid.New(), CreatedAt: ts, LastSeen: &ts})
+	var user struct {
+		CreatedAt string `json:"createdAt"`
+		LastSeen  string `json:"lastSeen"`
+	}
+	if err := json.Unmarshal(b, &user); err != nil {
+		t.Fatalf("unmarshal user: %v", err)
+	}
+	if user.CreatedAt != want || user.LastSeen != want {
+		t.Errorf("expected user timestamps %q, got %s", want, b)
+	}
+
+	b, _ = json.Marshal(User{ID: uuid.New()})
+	if strings.Contains(string(b), "createdAt") || strings.Contains(string(b), "lastSeen") {
+		t.Errorf("expected unset user timestamps to be omitted, got %s", b)
+	}
+
+	b, _ = json.Marshal(RoomDetail{ID: 1, CreatedAt: ts, LastActivity: ts})
+	var room struct {
+		CreatedAt    string `json:"createdAt"`
+		LastActivity string `json:"lastActivity"`
+	}
+	if err := json.Unmarshal(b, &room); err != nil {
+		t.Fatalf("unmarshal room: %v", err)
+	}
+	if room.CreatedAt != want || room.LastActivity != want {
+		t.Errorf("expected room timestamps %q, got %s", want, b)
+	}
+}
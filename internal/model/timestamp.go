@@ -0,0 +1,114 @@
+package model
+
+import (
+	"cmp"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Layouts for SetTimestampLayout. All of them are valid RFC 3339, they only
+// differ in the number of fractional digits.
+const (
+	// TimestampNano drops trailing zeros, so the number of fractional
+	// digits varies between zero and nine.
+	TimestampNano    = time.RFC3339Nano
+	TimestampMillis  = "2006-01-02T15:04:05.000Z07:00"
+	TimestampSeconds = time.RFC3339
+)
+
+var timestampLayout = TimestampNano
+
+// SetTimestampLayout sets the layout message timestamps are written in. It
+// is not safe for concurrent use and must be called before serving.
+func SetTimestampLayout(layout string) {
+	timestampLayout = layout
+}
+
+// FormatTimestamp formats t with the configured timestamp layout.
+func FormatTimestamp(t time.Time) string {
+	return t.Format(timestampLayout)
+}
+
+// MarshalJSON writes the message with its timestamp in the configured
+// layout. The fields mirror OutgoingMessage to keep their order on the wire.
+// Messages without a version are written as ProtocolVersion.
+func (m OutgoingMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version        int            `json:"v"`
+		ID             uuid.UUID      `json:"id"`
+		Seq            uint64         `json:"seq,omitempty"`
+		MessageType    MessageType    `json:"type"`
+		Message        string         `json:"message"`
+		Timestamp      string         `json:"timestamp"`
+		User           User           `json:"user"`
+		ParentID       *uuid.UUID     `json:"parentId,omitempty"`
+		AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty"`
+	}{
+		Version:        cmp.Or(m.Version, ProtocolVersion),
+		ID:             m.ID,
+		Seq:            m.Seq,
+		MessageType:    m.MessageType,
+		Message:        m.Message,
+		Timestamp:      FormatTimestamp(m.Timestamp),
+		User:           m.User,
+		ParentID:       m.ParentID,
+		AdditionalInfo: m.AdditionalInfo,
+	})
+}
+
+// MarshalJSON writes the user with createdAt and lastSeen in the configured
+// layout.
+func (u User) MarshalJSON() ([]byte, error) {
+	var createdAt string
+	if !u.CreatedAt.IsZero() {
+		createdAt = FormatTimestamp(u.CreatedAt)
+	}
+	var lastSeen *string
+	if u.LastSeen != nil {
+		s := FormatTimestamp(*u.LastSeen)
+		lastSeen = &s
+	}
+	return json.Marshal(struct {
+		ID             uuid.UUID      `json:"id"`
+		FirstName      string         `json:"firstName,omitempty"`
+		LastName       string         `json:"lastName,omitempty"`
+		Name           string         `json:"name,omitempty"`
+		Color          string         `json:"color,omitempty"`
+		AvatarURL      string         `json:"avatarUrl,omitempty"`
+		CreatedAt      string         `json:"createdAt,omitempty"`
+		LastSeen       *string        `json:"lastSeen,omitempty"`
+		AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty"`
+	}{
+		ID:             u.ID,
+		FirstName:      u.FirstName,
+		LastName:       u.LastName,
+		Name:           u.Name,
+		Color:          u.Color,
+		AvatarURL:      u.AvatarURL,
+		CreatedAt:      createdAt,
+		LastSeen:       lastSeen,
+		AdditionalInfo: u.AdditionalInfo,
+	})
+}
+
+// MarshalJSON writes the room detail with createdAt and lastActivity in the
+// configured layout.
+func (d RoomDetail) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID             uint           `json:"id"`
+		UserCount      int            `json:"onlineUser"`
+		MessageCount   int            `json:"messageCount"`
+		CreatedAt      string         `json:"createdAt"`
+		LastActivity   string         `json:"lastActivity"`
+		AdditionalInfo AdditionalInfo `json:"additionalInfo,omitempty"`
+	}{
+		ID:             d.ID,
+		UserCount:      d.UserCount,
+		MessageCount:   d.MessageCount,
+		CreatedAt:      FormatTimestamp(d.CreatedAt),
+		LastActivity:   FormatTimestamp(d.LastActivity),
+		AdditionalInfo: d.AdditionalInfo,
+	})
+}
@@ -0,0 +1,356 @@
+// Package schema validates additionalInfo payloads against a JSON Schema.
+//
+// Only the commonly used subset of JSON Schema is supported: type,
+// properties, required, additionalProperties, items, enum, const,
+// minLength, maxLength, pattern, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, minItems and maxItems. Annotations such as title or
+// description are ignored. Any other keyword is rejected when the schema is
+// compiled so that a schema never silently validates less than it says.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var annotations = map[string]struct{}{
+	"$schema": {}, "$id": {}, "$comment": {},
+	"title": {}, "description": {}, "default": {}, "examples": {},
+}
+
+var validTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+type Schema struct {
+	types                []string
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	noAdditional         bool
+	items                *Schema
+	enum                 []any
+	constValue           any
+	hasConst             bool
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	minimum, maximum     *float64
+	exclusiveMin         *float64
+	exclusiveMax         *float64
+	minItems, maxItems   *int
+}
+
+// Load reads and compiles the schema file at path.
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Compile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Compile parses a JSON Schema document.
+func Compile(data []byte) (*Schema, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %w", err)
+	}
+	return compile(raw, "")
+}
+
+func compile(raw any, path string) (*Schema, error) {
+	if b, ok := raw.(bool); ok {
+		if b {
+			return &Schema{}, nil
+		}
+		// false matches nothing
+		return &Schema{types: []string{}}, nil
+	}
+
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", pathOrRoot(path))
+	}
+
+	s := &Schema{}
+	for key, value := range obj {
+		if _, ok := annotations[key]; ok {
+			continue
+		}
+		if err := s.setKeyword(key, value, path); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) setKeyword(key string, value any, path string) error {
+	invalid := func() error {
+		return fmt.Errorf("%s: invalid value for %q", pathOrRoot(path), key)
+	}
+
+	switch key {
+	case "type":
+		switch v := value.(type) {
+		case string:
+			s.types = []string{v}
+		case []any:
+			s.types = make([]string, 0, len(v))
+			for _, t := range v {
+				name, ok := t.(string)
+				if !ok {
+					return invalid()
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return invalid()
+		}
+		for _, t := range s.types {
+			if !slices.Contains(validTypes, t) {
+				return fmt.Errorf("%s: unknown type %q", pathOrRoot(path), t)
+			}
+		}
+	case "properties":
+		props, ok := value.(map[string]any)
+		if !ok {
+			return invalid()
+		}
+		s.properties = make(map[string]*Schema, len(props))
+		for name, raw := range props {
+			child, err := compile(raw, path+"/"+name)
+			if err != nil {
+				return err
+			}
+			s.properties[name] = child
+		}
+	case "required":
+		list, ok := value.([]any)
+		if !ok {
+			return invalid()
+		}
+		for _, v := range list {
+			name, ok := v.(string)
+			if !ok {
+				return invalid()
+			}
+			s.required = append(s.required, name)
+		}
+	case "additionalProperties":
+		if b, ok := value.(bool); ok {
+			s.noAdditional = !b
+			return nil
+		}
+		child, err := compile(value, path+"/*")
+		if err != nil {
+			return err
+		}
+		s.additionalProperties = child
+	case "items":
+		child, err := compile(value, path+"/[]")
+		if err != nil {
+			return err
+		}
+		s.items = child
+	case "enum":
+		list, ok := value.([]any)
+		if !ok {
+			return invalid()
+		}
+		s.enum = list
+	case "const":
+		s.constValue = value
+		s.hasConst = true
+	case "pattern":
+		expr, ok := value.(string)
+		if !ok {
+			return invalid()
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", pathOrRoot(path), err)
+		}
+		s.pattern = re
+	case "minLength", "maxLength", "minItems", "maxItems":
+		n, ok := value.(float64)
+		if !ok || n < 0 || n != math.Trunc(n) {
+			return invalid()
+		}
+		v := int(n)
+		switch key {
+		case "minLength":
+			s.minLength = &v
+		case "maxLength":
+			s.maxLength = &v
+		case "minItems":
+			s.minItems = &v
+		case "maxItems":
+			s.maxItems = &v
+		}
+	case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+		n, ok := value.(float64)
+		if !ok {
+			return invalid()
+		}
+		switch key {
+		case "minimum":
+			s.minimum = &n
+		case "maximum":
+			s.maximum = &n
+		case "exclusiveMinimum":
+			s.exclusiveMin = &n
+		case "exclusiveMaximum":
+			s.exclusiveMax = &n
+		}
+	default:
+		return fmt.Errorf("%s: unsupported keyword %q", pathOrRoot(path), key)
+	}
+	return nil
+}
+
+// Validate checks value against the schema and returns one message per
+// violation, sorted by path. A nil schema accepts everything.
+func (s *Schema) Validate(value any) []string {
+	if s == nil {
+		return nil
+	}
+
+	// Round-trip through JSON so Go values (typed maps, time.Time, ints)
+	// are checked the same way as decoded request bodies.
+	b, err := json.Marshal(value)
+	if err != nil {
+		return []string{fmt.Sprintf("/: value is not valid JSON: %v", err)}
+	}
+	var normalized any
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		return []string{fmt.Sprintf("/: value is not valid JSON: %v", err)}
+	}
+
+	var violations []string
+	s.validate(normalized, "", &violations)
+	sort.Strings(violations)
+	return violations
+}
+
+func (s *Schema) validate(value any, path string, violations *[]string) {
+	fail := func(format string, args ...any) {
+		*violations = append(*violations, pathOrRoot(path)+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.types != nil && !slices.ContainsFunc(s.types, func(t string) bool { return hasType(value, t) }) {
+		if len(s.types) == 0 {
+			fail("no value is allowed")
+		} else {
+			fail("expected %s, got %s", strings.Join(s.types, " or "), typeOf(value))
+		}
+		return
+	}
+
+	if s.hasConst && !reflect.DeepEqual(value, s.constValue) {
+		fail("must be %v", s.constValue)
+	}
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e any) bool { return reflect.DeepEqual(value, e) }) {
+		fail("must be one of %v", s.enum)
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			fail("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			fail("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %q", s.pattern.String())
+		}
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			fail("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			fail("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMin != nil && v <= *s.exclusiveMin {
+			fail("must be > %v", *s.exclusiveMin)
+		}
+		if s.exclusiveMax != nil && v >= *s.exclusiveMax {
+			fail("must be < %v", *s.exclusiveMax)
+		}
+	case []any:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, fmt.Sprintf("%s/%d", path, i), violations)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		for name, child := range v {
+			childPath := path + "/" + name
+			if prop, ok := s.properties[name]; ok {
+				prop.validate(child, childPath, violations)
+			} else if s.noAdditional {
+				*violations = append(*violations, childPath+": property is not allowed")
+			} else if s.additionalProperties != nil {
+				s.additionalProperties.validate(child, childPath, violations)
+			}
+		}
+	}
+}
+
+func hasType(value any, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	default:
+		return typeOf(value) == t
+	}
+}
+
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
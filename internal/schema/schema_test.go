@@ -0,0 +1,104 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustCompile(t *testing.T, src string) *Schema {
+	t.Helper()
+	s, err := Compile([]byte(src))
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return s
+}
+
+func TestValidate(t *testing.T) {
+	s := mustCompile(t, `{
+		"type": "object",
+		"required": ["theme"],
+		"additionalProperties": false,
+		"properties": {
+			"theme": {"enum": ["light", "dark"]},
+			"name": {"type": "string", "minLength": 1, "maxLength": 5, "pattern": "^[a-z]+$"},
+			"size": {"type": "integer", "minimum": 1, "exclusiveMaximum": 10},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+		}
+	}`)
+
+	tests := []struct {
+		name  string
+		value any
+		want  []string
+	}{
+		{"valid", map[string]any{"theme": "dark", "name": "abc", "size": 3, "tags": []string{"a"}}, nil},
+		{"missing required", map[string]any{}, []string{`/: missing required property "theme"`}},
+		{"enum", map[string]any{"theme": "blue"}, []string{"/theme: must be one of [light dark]"}},
+		{"extra property", map[string]any{"theme": "dark", "other": 1}, []string{"/other: property is not allowed"}},
+		{"string rules", map[string]any{"theme": "dark", "name": "ABCDEF"}, []string{
+			"/name: must be at most 5 characters",
+			`/name: must match pattern "^[a-z]+$"`,
+		}},
+		{"integer", map[string]any{"theme": "dark", "size": 1.5}, []string{"/size: expected integer, got number"}},
+		{"exclusive maximum", map[string]any{"theme": "dark", "size": 10}, []string{"/size: must be < 10"}},
+		{"items", map[string]any{"theme": "dark", "tags": []any{"a", 2, "c"}}, []string{
+			"/tags/1: expected string, got number",
+			"/tags: must have at most 2 items",
+		}},
+		{"wrong root type", "text", []string{"/: expected object, got string"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.Validate(tt.value)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNilSchema(t *testing.T) {
+	var s *Schema
+	if got := s.Validate(map[string]any{"anything": true}); got != nil {
+		t.Errorf("expected nil schema to accept everything, got %q", got)
+	}
+}
+
+func TestCompileRejectsUnsupportedKeyword(t *testing.T) {
+	for _, src := range []string{
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"properties": {"a": {"$ref": "#/defs/a"}}}`,
+		`{"type": "color"}`,
+		`{"minLength": -1}`,
+		`{"pattern": "("}`,
+		`not json`,
+	} {
+		if _, err := Compile([]byte(src)); err == nil {
+			t.Errorf("expected Compile(%s) to fail", src)
+		}
+	}
+}
+
+func TestCompileIgnoresAnnotations(t *testing.T) {
+	s := mustCompile(t, `{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "Room", "description": "x", "type": "object"}`)
+	if got := s.Validate(map[string]any{}); len(got) != 0 {
+		t.Errorf("expected no violations, got %q", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(`{"type": "object"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,73 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+// ExpiryInterval is how often RunExpiry looks for stale users.
+const ExpiryInterval = time.Minute
+
+// RunExpiry deletes the users last seen more than ttl ago until ctx is done.
+// Users online reports as connected are kept, since lastSeen only advances
+// when they send something.
+func (r *Registry) RunExpiry(ctx context.Context, ttl time.Duration, online func(uuid.UUID) bool) {
+	ticker := time.NewTicker(ExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n := r.deleteStale(time.Now().Add(-ttl), online)
+			r.logger.Info("stale users pruned", "count", n, "ttl", ttl)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deleteStale removes the users last seen before cutoff that aren't online
+// and returns how many were removed. online is called without holding the
+// registry lock.
+func (r *Registry) deleteStale(cutoff time.Time, online func(uuid.UUID) bool) int {
+	r.mu.RLock()
+	var stale []uuid.UUID
+	for id, user := range r.users {
+		if seenBefore(user, cutoff) {
+			stale = append(stale, id)
+		}
+	}
+	r.mu.RUnlock()
+
+	var offline []uuid.UUID
+	for _, id := range stale {
+		if online == nil || !online(id) {
+			offline = append(offline, id)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, id := range offline {
+		// The user may have been active since the first pass.
+		if user, ok := r.users[id]; ok && seenBefore(user, cutoff) {
+			delete(r.users, id)
+			n++
+		}
+	}
+	return n
+}
+
+// seenBefore reports whether user was last seen before cutoff. Users that
+// never connected count as seen when they were created.
+func seenBefore(user *model.User, cutoff time.Time) bool {
+	seen := user.CreatedAt
+	if user.LastSeen != nil {
+		seen = *user.LastSeen
+	}
+	return seen.Before(cutoff)
+}
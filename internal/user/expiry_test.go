@@ -0,0 +1,35 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDeleteStale(t *testing.T) {
+	r := NewRegistry(testLogger())
+	stale := r.CreateUser("", "", "stale", "", "", nil)
+	connected := r.CreateUser("", "", "connected", "", "", nil)
+	fresh := r.CreateUser("", "", "fresh", "", "", nil)
+
+	old := time.Now().Add(-48 * time.Hour)
+	r.mu.Lock()
+	stale.CreatedAt = old
+	connected.CreatedAt = old
+	r.mu.Unlock()
+
+	online := func(id uuid.UUID) bool { return id == connected.ID }
+	if n := r.deleteStale(time.Now().Add(-24*time.Hour), online); n != 1 {
+		t.Errorf("expected 1 user pruned, got %d", n)
+	}
+	if _, ok := r.GetUser(stale.ID); ok {
+		t.Error("expected stale user to be pruned")
+	}
+	if _, ok := r.GetUser(connected.ID); !ok {
+		t.Error("expected connected user to be kept")
+	}
+	if _, ok := r.GetUser(fresh.ID); !ok {
+		t.Error("expected fresh user to be kept")
+	}
+}
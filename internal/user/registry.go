@@ -1,10 +1,12 @@
 package user
 
 import (
+	"bytes"
 	"log/slog"
 	"maps"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/choffmann/chat-room/internal/model"
 	"github.com/google/uuid"
@@ -23,12 +25,15 @@ func NewRegistry(logger *slog.Logger) *Registry {
 	}
 }
 
-func (r *Registry) CreateUser(firstName, lastName, name string, additionalInfo model.AdditionalInfo) *model.User {
+func (r *Registry) CreateUser(firstName, lastName, name, color, avatarURL string, additionalInfo model.AdditionalInfo) *model.User {
 	user := &model.User{
 		ID:             uuid.New(),
 		FirstName:      firstName,
 		LastName:       lastName,
 		Name:           name,
+		Color:          color,
+		AvatarURL:      avatarURL,
+		CreatedAt:      time.Now(),
 		AdditionalInfo: additionalInfo,
 	}
 
@@ -40,21 +45,56 @@ func (r *Registry) CreateUser(firstName, lastName, name string, additionalInfo m
 	return user
 }
 
+// GetUser returns a copy of the registered user, like Lookup.
 func (r *Registry) GetUser(id uuid.UUID) (*model.User, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	user, ok := r.users[id]
-	return user, ok
+	if !ok {
+		return nil, false
+	}
+	return copyUser(user), true
 }
 
+// Lookup returns a copy of the registered user, safe to use while the user
+// is being updated.
+func (r *Registry) Lookup(id uuid.UUID) (model.User, bool) {
+	user, ok := r.GetUser(id)
+	if !ok {
+		return model.User{}, false
+	}
+	return *user, true
+}
+
+// GetAllUsers returns copies of all registered users ordered by creation
+// time, using the ID as a tie-breaker so the order is stable across calls.
 func (r *Registry) GetAllUsers() []*model.User {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	return slices.Collect(maps.Values(r.users))
+	users := make([]*model.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, copyUser(user))
+	}
+	slices.SortFunc(users, func(a, b *model.User) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+	return users
+}
+
+// copyUser copies user so it can be read after the registry's lock is
+// released. UpdateLastSeen replaces LastSeen instead of changing the time it
+// points to, so the pointer can be shared.
+func copyUser(user *model.User) *model.User {
+	u := *user
+	u.AdditionalInfo = maps.Clone(user.AdditionalInfo)
+	return &u
 }
 
-func (r *Registry) UpdateUser(id uuid.UUID, firstName, lastName, name string, additionalInfo model.AdditionalInfo) (*model.User, bool) {
+func (r *Registry) UpdateUser(id uuid.UUID, firstName, lastName, name, color, avatarURL string, additionalInfo model.AdditionalInfo) (*model.User, bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -66,10 +106,12 @@ func (r *Registry) UpdateUser(id uuid.UUID, firstName, lastName, name string, ad
 	user.FirstName = firstName
 	user.LastName = lastName
 	user.Name = name
+	user.Color = color
+	user.AvatarURL = avatarURL
 	user.AdditionalInfo = additionalInfo
 
 	r.logger.Info("user updated", "userID", id)
-	return user, true
+	return copyUser(user), true
 }
 
 func (r *Registry) PatchUser(id uuid.UUID, updates map[string]any) (*model.User, bool) {
@@ -90,6 +132,12 @@ func (r *Registry) PatchUser(id uuid.UUID, updates map[string]any) (*model.User,
 	if name, ok := updates["name"].(string); ok {
 		user.Name = name
 	}
+	if color, ok := updates["color"].(string); ok {
+		user.Color = color
+	}
+	if avatarURL, ok := updates["avatarUrl"].(string); ok {
+		user.AvatarURL = avatarURL
+	}
 	if additionalInfo, ok := updates["additionalInfo"].(map[string]any); ok {
 		if user.AdditionalInfo == nil {
 			user.AdditionalInfo = make(model.AdditionalInfo)
@@ -98,7 +146,23 @@ func (r *Registry) PatchUser(id uuid.UUID, updates map[string]any) (*model.User,
 	}
 
 	r.logger.Info("user patched", "userID", id)
-	return user, true
+	return copyUser(user), true
+}
+
+// UpdateLastSeen records that the registered user was just active. It
+// returns false for unknown users, including ephemeral ones.
+func (r *Registry) UpdateLastSeen(id uuid.UUID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	user.LastSeen = &now
+	return true
 }
 
 func (r *Registry) DeleteUser(id uuid.UUID) bool {
@@ -113,3 +177,32 @@ func (r *Registry) DeleteUser(id uuid.UUID) bool {
 	r.logger.Info("user deleted", "userID", id)
 	return true
 }
+
+// DeleteAll removes every user and returns how many were removed.
+func (r *Registry) DeleteAll() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.users)
+	clear(r.users)
+	r.logger.Info("all users deleted", "count", n)
+	return n
+}
+
+// DeleteOlderThan removes the users last seen before cutoff and returns how
+// many were removed. Users that never connected count as seen when they were
+// created.
+func (r *Registry) DeleteOlderThan(cutoff time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for id, user := range r.users {
+		if seenBefore(user, cutoff) {
+			delete(r.users, id)
+			n++
+		}
+	}
+	r.logger.Info("inactive users deleted", "cutoff", cutoff, "count", n)
+	return n
+}
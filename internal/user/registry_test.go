@@ -0,0 +1,123 @@
+package user
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/choffmann/chat-room/internal/model"
+	"github.com/google/uuid"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestGetAllUsersSortedByCreation(t *testing.T) {
+	r := NewRegistry(testLogger())
+
+	names := []string{"first", "second", "third", "fourth", "fifth"}
+	for _, name := range names {
+		r.CreateUser("", "", name, "", "", nil)
+		time.Sleep(time.Millisecond)
+	}
+
+	for range 5 {
+		users := r.GetAllUsers()
+		if len(users) != len(names) {
+			t.Fatalf("expected %d users, got %d", len(names), len(users))
+		}
+		for i, u := range users {
+			if u.Name != names[i] {
+				t.Fatalf("expected user %d to be %q, got %q", i, names[i], u.Name)
+			}
+			if u.CreatedAt.IsZero() {
+				t.Errorf("expected createdAt to be set for %q", u.Name)
+			}
+		}
+	}
+}
+
+func TestUpdateLastSeen(t *testing.T) {
+	r := NewRegistry(testLogger())
+	u := r.CreateUser("", "", "alice", "", "", nil)
+
+	if u.LastSeen != nil {
+		t.Fatal("expected new user to have no lastSeen")
+	}
+
+	before := time.Now()
+	if !r.UpdateLastSeen(u.ID) {
+		t.Fatal("expected UpdateLastSeen to succeed for registered user")
+	}
+	got, _ := r.GetUser(u.ID)
+	if got.LastSeen == nil || got.LastSeen.Before(before) {
+		t.Errorf("expected lastSeen after %v, got %v", before, got.LastSeen)
+	}
+
+	if r.UpdateLastSeen(uuid.New()) {
+		t.Error("expected UpdateLastSeen to fail for unknown user")
+	}
+}
+
+func TestGetUserReturnsCopy(t *testing.T) {
+	r := NewRegistry(testLogger())
+	u := r.CreateUser("", "", "alice", "", "", model.AdditionalInfo{"role": "agent"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			r.UpdateLastSeen(u.ID)
+		}
+	}()
+	for range 100 {
+		got, _ := r.GetUser(u.ID)
+		_ = got.LastSeen
+		for _, user := range r.GetAllUsers() {
+			_ = user.LastSeen
+		}
+	}
+	<-done
+
+	got, _ := r.GetUser(u.ID)
+	got.Name = "mallory"
+	got.AdditionalInfo["role"] = "admin"
+	if again, _ := r.GetUser(u.ID); again.Name != "alice" || again.AdditionalInfo["role"] != "agent" {
+		t.Errorf("expected changes to the returned user not to reach the registry, got %+v", again)
+	}
+}
+
+func TestDeleteOlderThan(t *testing.T) {
+	r := NewRegistry(testLogger())
+	stale := r.CreateUser("", "", "stale", "", "", nil)
+	active := r.CreateUser("", "", "active", "", "", nil)
+	fresh := r.CreateUser("", "", "fresh", "", "", nil)
+
+	old := time.Now().Add(-48 * time.Hour)
+	r.mu.Lock()
+	stale.CreatedAt = old
+	active.CreatedAt = old
+	r.mu.Unlock()
+	r.UpdateLastSeen(active.ID)
+
+	if n := r.DeleteOlderThan(time.Now().Add(-24 * time.Hour)); n != 1 {
+		t.Errorf("expected 1 user deleted, got %d", n)
+	}
+	if _, ok := r.GetUser(stale.ID); ok {
+		t.Error("expected stale user to be deleted")
+	}
+	for _, u := range []*model.User{active, fresh} {
+		if _, ok := r.GetUser(u.ID); !ok {
+			t.Errorf("expected %s to be kept", u.Name)
+		}
+	}
+
+	if n := r.DeleteAll(); n != 2 {
+		t.Errorf("expected 2 users deleted, got %d", n)
+	}
+	if users := r.GetAllUsers(); len(users) != 0 {
+		t.Errorf("expected empty registry, got %d users", len(users))
+	}
+}
@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultRetries = 2
+	defaultBackoff = time.Second
+)
+
+// Notifier POSTs JSON events to a single URL. Deliveries run in their own
+// goroutine so callers never wait on the remote end.
+type Notifier struct {
+	url     string
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	logger  *slog.Logger
+}
+
+func NewNotifier(url string, logger *slog.Logger) *Notifier {
+	return &Notifier{
+		url:     url,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+		logger:  logger,
+	}
+}
+
+// SetRetry configures how often a failed delivery is retried and the delay
+// before the first retry. The delay doubles with every further attempt.
+func (n *Notifier) SetRetry(retries int, backoff time.Duration) {
+	n.retries = retries
+	n.backoff = backoff
+}
+
+// Notify sends event as JSON in the background. Failures are logged and
+// retried; the event is dropped once all attempts failed.
+func (n *Notifier) Notify(event any) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Warn("failed to encode webhook event", "error", err)
+		return
+	}
+	go n.deliver(body)
+}
+
+func (n *Notifier) deliver(body []byte) {
+	delay := n.backoff
+	for attempt := 0; ; attempt++ {
+		err := n.post(body)
+		if err == nil {
+			return
+		}
+		if attempt >= n.retries {
+			n.logger.Warn("giving up on webhook delivery", "url", n.url, "attempts", attempt+1, "error", err)
+			return
+		}
+		n.logger.Warn("webhook delivery failed, retrying", "url", n.url, "attempt", attempt+1, "retryIn", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (n *Notifier) post(body []byte) error {
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestNotifyRetriesUntilSuccess(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var event map[string]any
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer srv.Close()
+
+	n := NewNotifier(srv.URL, testLogger())
+	n.SetRetry(2, time.Millisecond)
+	n.Notify(map[string]any{"type": "user_joined"})
+
+	select {
+	case event := <-received:
+		if event["type"] != "user_joined" {
+			t.Errorf("unexpected event %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("webhook not delivered after %d calls", calls.Load())
+	}
+}
+
+func TestNotifyGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	n := NewNotifier(srv.URL, testLogger())
+	n.SetRetry(1, time.Millisecond)
+	n.Notify("event")
+
+	time.Sleep(100 * time.Millisecond)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+}